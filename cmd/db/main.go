@@ -0,0 +1,138 @@
+// Command db serves a datastore over HTTP, see package httpapi.
+//
+// With -tls-cert and -tls-key it serves HTTPS, and -tls-client-ca turns on
+// mutual TLS. With -tokens or -client-certs every request must
+// authenticate; both files hold "<name> <access>" lines, where access is
+// read or write. With -acl instead, the ACL rules in the given JSON file
+// are stored in the DB and enforced per key prefix, see
+// httpapi.RequireACL; rules written to the DB later take effect at once.
+//
+// -rate-ops and -rate-bytes limit the requests and body bytes per second
+// of every client, told apart by token, certificate or IP address, and
+// -max-conns and -max-conns-per-client the connections open at a time.
+//
+// With -admin it also serves pprof profiles, stats and segments, and lets
+// operators pause, resume or run compaction, on a separate listener, see
+// package debugapi, which should not be reachable from outside. The
+// listener serves the status page of package status at /status.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/debugapi"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/httpapi"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/status"
+)
+
+func main() {
+	addr := flag.String("addr", ":8000", "address to listen on")
+	dir := flag.String("dir", "/data", "directory holding the segments")
+	var tlsOpts httpapi.TLSOptions
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "PEM server certificate; enables TLS")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "PEM server key")
+	flag.StringVar(&tlsOpts.ClientCAFile, "tls-client-ca", "", "PEM CAs to verify client certificates against")
+	flag.BoolVar(&tlsOpts.RequireClientCert, "tls-require-client-cert", false, "reject clients without a certificate")
+	tokensFile := flag.String("tokens", "", "file of bearer tokens and their access")
+	certsFile := flag.String("client-certs", "", "file of client certificate common names and their access")
+	aclFile := flag.String("acl", "", "JSON file of ACL rules to store and enforce; replaces -tokens and -client-certs")
+	adminAddr := flag.String("admin", "", "address of the debug listener; empty disables it")
+	var limits httpapi.LimitOptions
+	flag.Float64Var(&limits.OpsPerSec, "rate-ops", 0, "requests per second per client; 0 is unlimited")
+	flag.Float64Var(&limits.BytesPerSec, "rate-bytes", 0, "body bytes per second per client; 0 is unlimited")
+	maxConns := flag.Int("max-conns", 0, "connections open at a time; 0 is unlimited")
+	maxClientConns := flag.Int("max-conns-per-client", 0, "connections open at a time per client IP; 0 is unlimited")
+	flag.Parse()
+
+	var auths []httpapi.Authenticator
+	if *tokensFile != "" {
+		tokens, err := httpapi.LoadTokens(*tokensFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		auths = append(auths, tokens)
+	}
+	if *certsFile != "" {
+		certs, err := httpapi.LoadClientCerts(*certsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		auths = append(auths, certs)
+	}
+	var rules httpapi.ACLRules
+	if *aclFile != "" {
+		if len(auths) > 0 {
+			log.Fatal("-acl cannot be combined with -tokens or -client-certs")
+		}
+		var err error
+		if rules, err = httpapi.LoadACLRules(*aclFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	db, err := datastore.Open(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if *adminAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/status", status.Handler(db, status.Config{}))
+		mux.Handle("/", debugapi.Handler(db))
+		admin := &http.Server{Addr: *adminAddr, Handler: mux}
+		go func() {
+			log.Printf("serving debug endpoints on %s", *adminAddr)
+			if err := admin.ListenAndServe(); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+
+	handler := httpapi.Handler(db)
+	// Inside RequireAuth the limits are per checked credentials.
+	if limits.OpsPerSec > 0 || limits.BytesPerSec > 0 {
+		handler = httpapi.RateLimit(handler, limits)
+	}
+	switch {
+	case *aclFile != "":
+		if err := httpapi.SetACLRules(db, rules); err != nil {
+			log.Print(err)
+			return
+		}
+		acl, err := httpapi.NewACL(db)
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		defer acl.Close()
+		handler = httpapi.RequireACL(handler, acl)
+	case len(auths) > 0:
+		handler = httpapi.RequireAuth(handler, httpapi.AnyOf(auths...))
+	}
+	srv := &http.Server{Addr: *addr, Handler: handler}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	ln = httpapi.LimitListener(ln, *maxConns, *maxClientConns)
+
+	log.Printf("serving %s on %s", *dir, *addr)
+	if tlsOpts.CertFile != "" {
+		if srv.TLSConfig, err = tlsOpts.Config(); err != nil {
+			log.Print(err)
+			return
+		}
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,140 @@
+package datastore
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Consistency selects when reads see queued writes.
+type Consistency int
+
+const (
+	// ConsistencyCommitted shows a write once the writer has applied it,
+	// which is no later than its result is sent. A caller that waits for
+	// the result of PutAsync before reading always sees its write.
+	ConsistencyCommitted Consistency = iota
+	// ConsistencyEnqueued shows a Put, PutAsync or Delete to Get,
+	// GetAppend, GetMulti, RangeScan, ForEach and the iterators as soon as
+	// it is queued, by consulting the writes still waiting for the writer.
+	// A write that then fails is visible until it does. Conditional
+	// writes, merge operands, metadata and Export, which is a snapshot at
+	// a sequence number, only see applied writes.
+	ConsistencyEnqueued
+)
+
+// PutAsync queues a Put and returns at once with a channel that receives
+// its result. Writes to one key are applied in the order they are queued;
+// writes to different keys may be applied in any order, so a caller that
+// needs them ordered waits for each result before queuing the next.
+// Whether a Get sees the write before the result arrives depends on
+// Options.Consistency. A full write queue is handled as configured by
+// Options.Backpressure, so PutAsync may still block.
+func (db *DB) PutAsync(key, value string) <-chan error {
+	req := writeRequest{key: key, value: value, kind: kindValue, respCh: make(chan error, 1), queued: time.Now()}
+	db.track(&req)
+	if err := db.enqueue(context.Background(), req); err != nil {
+		db.pending.done(key, req.pending)
+		req.respCh <- err
+	}
+	return req.respCh
+}
+
+// track records req in db.pending under ConsistencyEnqueued, unless it is
+// a write whose outcome is only known once applied.
+func (db *DB) track(req *writeRequest) {
+	if db.opts.Consistency != ConsistencyEnqueued || req.update != nil || req.batch != nil || Reserved(req.key) {
+		return
+	}
+	if req.kind != kindValue && req.kind != kindTombstone {
+		return
+	}
+	if p := req.put; p != nil && (p.ifAbsent || p.hasVersion) {
+		return
+	}
+	req.pending = db.pending.add(req.key, req.value, req.kind == kindTombstone)
+}
+
+// pendingWrites holds the latest queued, not yet applied write of every
+// key, for ConsistencyEnqueued.
+type pendingWrites struct {
+	mu   sync.Mutex
+	next uint64
+	m    map[string]pendingWrite
+	n    atomic.Int64 // len(m), read without mu on the Get path
+}
+
+type pendingWrite struct {
+	id      uint64
+	value   string
+	deleted bool
+}
+
+// add records a queued write of value to key, or its deletion, and
+// returns its ID.
+func (p *pendingWrites) add(key, value string, deleted bool) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.m == nil {
+		p.m = make(map[string]pendingWrite)
+	}
+	p.next++
+	p.m[key] = pendingWrite{id: p.next, value: value, deleted: deleted}
+	p.n.Store(int64(len(p.m)))
+	return p.next
+}
+
+// done forgets the write with ID id to key once it has been applied,
+// unless a later write to the key was queued since. ID zero is ignored.
+func (p *pendingWrites) done(key string, id uint64) {
+	if id == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w, ok := p.m[key]; ok && w.id == id {
+		delete(p.m, key)
+		p.n.Store(int64(len(p.m)))
+	}
+}
+
+// get returns the pending write to key, if there is one. Reads must
+// consult it before the index: the write leaves it only once applied.
+func (p *pendingWrites) get(key string) (pendingWrite, bool) {
+	if p.n.Load() == 0 {
+		return pendingWrite{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, ok := p.m[key]
+	return w, ok
+}
+
+// keysInRange returns the keys in [start, end) with a pending write that
+// is not a delete, in ascending order. An empty end means no upper bound.
+func (p *pendingWrites) keysInRange(start, end string) []string {
+	if p.n.Load() == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var keys []string
+	for key, w := range p.m {
+		if !w.deleted && key >= start && (end == "" || key < end) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// result returns the result of reading key if it has a pending write:
+// its value, or ErrNotFound for a pending delete.
+func (w pendingWrite) result() (string, error) {
+	if w.deleted {
+		return "", ErrNotFound
+	}
+	return w.value, nil
+}
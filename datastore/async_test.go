@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// blockedWriter opens a DB whose writer stalls on the write of key
+// "block" until release is closed.
+func blockedWriter(t *testing.T, dir string, c Consistency) (*DB, chan struct{}) {
+	t.Helper()
+	release := make(chan struct{})
+	hooks := &Hooks{OnPut: func(key, _ string) {
+		if key == "block" {
+			<-release
+		}
+	}}
+	db, err := OpenWithOptions(dir, Options{Consistency: c, Hooks: hooks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, release
+}
+
+func TestPutAsync_Enqueued(t *testing.T) {
+	dir := "test_put_async_enqueued"
+	defer os.RemoveAll(dir)
+
+	db, release := blockedWriter(t, dir, ConsistencyEnqueued)
+	defer db.Close()
+
+	blocked := db.PutAsync("block", "x")
+	res := db.PutAsync("k", "v1")
+	res2 := db.PutAsync("k", "v2")
+
+	// Запис ще в черзі, але вже видимий
+	if v, err := db.Get("k"); err != nil || v != "v2" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	close(release)
+	for _, ch := range []<-chan error{blocked, res, res2} {
+		if err := <-ch; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := db.Get("k"); err != nil || v != "v2" {
+		t.Fatalf("Get after commit = %q, %v", v, err)
+	}
+	if n := db.pending.n.Load(); n != 0 {
+		t.Fatalf("%d pending writes left", n)
+	}
+}
+
+func TestPutAsync_Committed(t *testing.T) {
+	dir := "test_put_async_committed"
+	defer os.RemoveAll(dir)
+
+	db, release := blockedWriter(t, dir, ConsistencyCommitted)
+	defer db.Close()
+
+	blocked := db.PutAsync("block", "x")
+	res := db.PutAsync("k", "v")
+	if _, err := db.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before commit err = %v", err)
+	}
+	close(release)
+	<-blocked
+	// Після підтвердження запис гарантовано видно
+	if err := <-res; err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("k"); err != nil || v != "v" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+}
+
+func TestPendingReadThrough(t *testing.T) {
+	dir := "test_pending_read_through"
+	defer os.RemoveAll(dir)
+
+	db, release := blockedWriter(t, dir, ConsistencyEnqueued)
+	defer db.Close()
+	if err := db.Put("gone", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked := db.PutAsync("block", "x")
+	done := make(chan error, 2)
+	go func() { done <- db.Put("k", "v") }()
+	go func() { done <- db.Delete("gone") }()
+	// Чекаємо, доки обидва записи стануть у чергу
+	for db.pending.n.Load() < 2 {
+		runtime.Gosched()
+	}
+
+	// Синхронні записи в черзі теж видно, як і видалення
+	if v, err := db.GetAppend("k", []byte("=")); err != nil || string(v) != "=v" {
+		t.Fatalf("GetAppend = %q, %v", v, err)
+	}
+	if _, err := db.Get("gone"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(gone) err = %v", err)
+	}
+	res, err := db.GetMulti([]string{"k", "gone"})
+	if err != nil || len(res) != 1 || res["k"] != "v" {
+		t.Fatalf("GetMulti = %v, %v", res, err)
+	}
+	// Сканування бачить новий ключ і не бачить видаленого
+	scanned := map[string]string{}
+	if err := db.ForEach(func(key, value string) bool {
+		scanned[key] = value
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 2 || scanned["k"] != "v" || scanned["block"] != "x" {
+		t.Fatalf("ForEach saw %v", scanned)
+	}
+
+	close(release)
+	<-blocked
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Get("gone"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(gone) after commit err = %v", err)
+	}
+}
+
+func TestPutAsync_PerKeyOrder(t *testing.T) {
+	dir := "test_put_async_order"
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	applied := make(map[string][]int)
+	hooks := &Hooks{OnPut: func(key, value string) {
+		n, _ := strconv.Atoi(value)
+		mu.Lock()
+		applied[key] = append(applied[key], n)
+		mu.Unlock()
+	}}
+	db, err := OpenWithOptions(dir, Options{WriteStripes: 4, Hooks: hooks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var results []<-chan error
+	for i := 0; i < 2000; i++ {
+		results = append(results, db.PutAsync(fmt.Sprintf("k%d", i%8), strconv.Itoa(i)))
+	}
+	for _, ch := range results {
+		if err := <-ch; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Записи одного ключа застосовуються в порядку черги
+	for i := 0; i < 8; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if v, err := db.Get(key); err != nil || v != strconv.Itoa(1992+i) {
+			t.Errorf("Get(%s) = %q, %v", key, v, err)
+		}
+		mu.Lock()
+		got := applied[key]
+		mu.Unlock()
+		for j := 1; j < len(got); j++ {
+			if got[j] < got[j-1] {
+				t.Fatalf("%s: %d applied after %d", key, got[j], got[j-1])
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package datastore
+
+import "errors"
+
+// errSkipWrite is returned by an update function to leave the key as it
+// is. The update then succeeds without writing.
+var errSkipWrite = errors.New("skip write")
+
+// SetNX stores value under key only if the key is absent and reports
+// whether it did. The check runs in the writer, so of concurrent SetNX
+// calls for one key exactly one stores its value.
+func (db *DB) SetNX(key, value string) (bool, error) {
+	stored := false
+	err := db.update(key, func(_ string, exists bool) (string, error) {
+		if exists {
+			return "", errSkipWrite
+		}
+		stored = true
+		return value, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return stored, nil
+}
+
+// GetOrSet returns the value of key, storing value first if the key is
+// absent. loaded reports whether the returned value was already there.
+func (db *DB) GetOrSet(key, value string) (actual string, loaded bool, err error) {
+	err = db.update(key, func(old string, exists bool) (string, error) {
+		if exists {
+			actual, loaded = old, true
+			return "", errSkipWrite
+		}
+		actual, loaded = value, false
+		return value, nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return actual, loaded, nil
+}
+
+// GetSet stores value under key and returns the value it replaced.
+// existed reports whether there was one. The swap runs in the writer, so
+// of concurrent GetSet calls each sees the value stored by the one before.
+func (db *DB) GetSet(key, value string) (old string, existed bool, err error) {
+	err = db.update(key, func(cur string, exists bool) (string, error) {
+		old, existed = cur, exists
+		return value, nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return old, existed, nil
+}
+
+// ErrKeyExists is returned by Rename when the new key is taken and
+// overwriting was not asked for, and by Put with IfAbsent.
+var ErrKeyExists = errors.New("key already exists")
+
+// Rename moves the value of oldKey to newKey, replacing the value of
+// newKey only if overwrite is set. The new key and the deletion of the old
+// one are written as one atomic batch, so a crash never leaves both keys
+// or neither. A merged value is folded first. Rename needs FormatV7 or
+// newer.
+func (db *DB) Rename(oldKey, newKey string, overwrite bool) error {
+	return db.send(writeRequest{key: oldKey, batch: func() ([]entry, error) {
+		v, exists, err := db.getLocked(oldKey)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrNotFound
+		}
+		if oldKey == newKey {
+			return nil, errSkipWrite
+		}
+		if !overwrite {
+			_, taken, err := db.getLocked(newKey)
+			if err != nil {
+				return nil, err
+			}
+			if taken {
+				return nil, ErrKeyExists
+			}
+		}
+		return []entry{{key: newKey, value: v}, {key: oldKey, kind: kindTombstone}}, nil
+	}})
+}
+
+// CompareAndSwap stores value under key only if its current value is old
+// and reports whether it did. A missing key never matches.
+func (db *DB) CompareAndSwap(key, old, value string) (bool, error) {
+	swapped := false
+	err := db.update(key, func(cur string, exists bool) (string, error) {
+		if !exists || cur != old {
+			return "", errSkipWrite
+		}
+		swapped = true
+		return value, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return swapped, nil
+}
+
+// CompareAndDelete deletes key only if its current value is old and
+// reports whether it did.
+func (db *DB) CompareAndDelete(key, old string) (bool, error) {
+	deleted := false
+	err := db.send(writeRequest{key: key, batch: func() ([]entry, error) {
+		cur, exists, err := db.getLocked(key)
+		if err != nil || !exists || cur != old {
+			return nil, err
+		}
+		deleted = true
+		return []entry{{key: key, kind: kindTombstone}}, nil
+	}})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// GetDelete deletes key and returns the value it had. existed reports
+// whether there was one.
+func (db *DB) GetDelete(key string) (value string, existed bool, err error) {
+	err = db.send(writeRequest{key: key, batch: func() ([]entry, error) {
+		cur, exists, err := db.getLocked(key)
+		if err != nil || !exists {
+			return nil, err
+		}
+		value, existed = cur, true
+		return []entry{{key: key, kind: kindTombstone}}, nil
+	}})
+	if err != nil {
+		return "", false, err
+	}
+	return value, existed, nil
+}
@@ -0,0 +1,268 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetNX(t *testing.T) {
+	dir := "test_setnx"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if ok, err := db.SetNX("k", "first"); err != nil || !ok {
+		t.Fatalf("SetNX = %v, %v", ok, err)
+	}
+	if ok, err := db.SetNX("k", "second"); err != nil || ok {
+		t.Fatalf("second SetNX = %v, %v", ok, err)
+	}
+	if v, _ := db.Get("k"); v != "first" {
+		t.Fatalf("Get = %q", v)
+	}
+	// Відмова нічого не дописує в сегмент
+	if m, _ := db.GetMeta("k"); m.Seq != 1 {
+		t.Fatalf("seq = %d", m.Seq)
+	}
+
+	// Після видалення ключ знову вільний
+	db.Delete("k")
+	if ok, _ := db.SetNX("k", "third"); !ok {
+		t.Fatal("SetNX after Delete failed")
+	}
+
+	// З паралельних викликів виграє рівно один
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := db.SetNX("lock", strconv.Itoa(i)); err == nil && ok {
+				wins.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if wins.Load() != 1 {
+		t.Fatalf("%d SetNX calls won", wins.Load())
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	dir := "test_get_or_set"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if v, loaded, err := db.GetOrSet("k", "a"); err != nil || loaded || v != "a" {
+		t.Fatalf("GetOrSet = %q, %v, %v", v, loaded, err)
+	}
+	if v, loaded, err := db.GetOrSet("k", "b"); err != nil || !loaded || v != "a" {
+		t.Fatalf("second GetOrSet = %q, %v, %v", v, loaded, err)
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	dir := "test_get_set"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if old, existed, err := db.GetSet("token", "t0"); err != nil || existed || old != "" {
+		t.Fatalf("GetSet = %q, %v, %v", old, existed, err)
+	}
+
+	// Кожне старе значення повертається рівно одному викликові
+	var mu sync.Mutex
+	seen := map[string]int{}
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			old, existed, err := db.GetSet("token", "t"+strconv.Itoa(i))
+			if err != nil || !existed {
+				t.Errorf("GetSet = %q, %v, %v", old, existed, err)
+				return
+			}
+			mu.Lock()
+			seen[old]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	last, _ := db.Get("token")
+	if len(seen) != 50 || seen[last] != 0 {
+		t.Fatalf("saw %d distinct old values, last %q seen %d times", len(seen), last, seen[last])
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Fatalf("%q returned %d times", v, n)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	dir := "test_rename"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.RegisterMerge(sumMerge)
+
+	db.Put("old", "v")
+	db.Put("taken", "t")
+	if err := db.Rename("old", "taken", false); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("Rename onto taken key err = %v", err)
+	}
+	if err := db.Rename("missing", "x", false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Rename(missing) err = %v", err)
+	}
+	if err := db.Rename("old", "new", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("old key still there: %v", err)
+	}
+	if v, _ := db.Get("new"); v != "v" {
+		t.Fatalf("Get(new) = %q", v)
+	}
+	if err := db.Rename("new", "taken", true); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := db.Get("taken"); v != "v" {
+		t.Fatalf("Get(taken) = %q", v)
+	}
+
+	// Злите значення переноситься згорнутим
+	db.Put("c", "1")
+	db.MergeValue("c", "2")
+	if err := db.Rename("c", "d", false); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := db.Get("d"); v != "3" {
+		t.Fatalf("Get(d) = %q", v)
+	}
+
+	// Старіші формати не вміють атомарних пакетів
+	old, err := OpenWithOptions(dir+"_v6", Options{FormatVersion: FormatV6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir + "_v6")
+	defer old.Close()
+	old.Put("a", "1")
+	if err := old.Rename("a", "b", false); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("Rename in V6 err = %v", err)
+	}
+	if v, _ := old.Get("a"); v != "1" {
+		t.Fatalf("Get(a) = %q", v)
+	}
+}
+
+func TestRename_TornBatch(t *testing.T) {
+	dir := "test_rename_torn"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put("old", "v")
+	before := db.stripes[0].active.size
+	if err := db.Rename("old", "new", false); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Збій після першого запису пакета: лишається тільки перейменований ключ
+	path := db.stripes[0].active.path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := before + int64(8+len("new")+len("v")+formatSpecs[CurrentFormat].trailerSize())
+	if err := os.WriteFile(path, data[:first], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(dir); !errors.Is(err, errTornBatch) {
+		t.Fatalf("strict Open err = %v", err)
+	}
+	db, err = OpenWithOptions(dir, Options{RecoveryMode: RecoveryRepairTail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get("old"); err != nil || v != "v" {
+		t.Fatalf("Get(old) = %q, %v", v, err)
+	}
+	if _, err := db.Get("new"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(new) err = %v", err)
+	}
+	if db.stripes[0].active.size != before {
+		t.Fatalf("active size %d after repair, want %d", db.stripes[0].active.size, before)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	dir := "test_compare_and_swap"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if ok, err := db.CompareAndSwap("k", "", "v"); err != nil || ok {
+		t.Fatalf("CompareAndSwap on missing key = %v, %v", ok, err)
+	}
+	db.Put("k", "v1")
+	if ok, _ := db.CompareAndSwap("k", "other", "v2"); ok {
+		t.Fatal("swapped on mismatch")
+	}
+	if ok, _ := db.CompareAndSwap("k", "v1", "v2"); !ok {
+		t.Fatal("CompareAndSwap failed")
+	}
+
+	if ok, _ := db.CompareAndDelete("k", "v1"); ok {
+		t.Fatal("deleted on mismatch")
+	}
+	if ok, _ := db.CompareAndDelete("k", "v2"); !ok {
+		t.Fatal("CompareAndDelete failed")
+	}
+	if _, err := db.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after CompareAndDelete err = %v", err)
+	}
+
+	db.Put("g", "x")
+	if v, ok, err := db.GetDelete("g"); err != nil || !ok || v != "x" {
+		t.Fatalf("GetDelete = %q, %v, %v", v, ok, err)
+	}
+	if _, ok, err := db.GetDelete("g"); err != nil || ok {
+		t.Fatalf("second GetDelete = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,245 @@
+package datastore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	auditDirName         = "audit"
+	defaultAuditMaxBytes = 64 << 20
+)
+
+var auditRE = regexp.MustCompile(`^audit-(\d+)\.jsonl$`)
+
+// AuditOptions enables the audit log: an append-only record of every
+// committed write, kept apart from the data so it survives merges.
+type AuditOptions struct {
+	// Dir holds the log files. Empty means the audit directory inside the
+	// DB directory.
+	Dir string
+	// MaxBytes is the size at which the log moves on to a new file. Zero
+	// means 64 MiB.
+	MaxBytes int64
+	// MaxFiles and MaxAge bound the files kept: the oldest ones beyond
+	// MaxFiles, and ones last written more than MaxAge ago, are removed
+	// whenever the log moves on. The file being written is always kept.
+	// Zero keeps them all.
+	MaxFiles int
+	MaxAge   time.Duration
+}
+
+// AuditRecord is one line of the audit log, in JSON.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	Seq  uint64    `json:"seq"`
+	Op   string    `json:"op"` // put, delete or merge
+	Key  string    `json:"key"`
+	// ValueSHA256 is the hex SHA-256 of the value or merge operand; empty
+	// for deletes.
+	ValueSHA256 string `json:"value_sha256,omitempty"`
+	// Actor is the caller given to WithActor, if any.
+	Actor string `json:"actor,omitempty"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context that makes the writes of PutContext and
+// DeleteContext record actor as their author in the audit log.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// DeleteContext is Delete that stops waiting for room in a full write
+// queue once ctx is done, like PutContext.
+func (db *DB) DeleteContext(ctx context.Context, key string) error {
+	return db.sendContext(ctx, writeRequest{key: key, kind: kindTombstone})
+}
+
+// auditLog appends records to the newest of the numbered audit files.
+// The writers of the stripes take mu around their records.
+type auditLog struct {
+	mu   sync.Mutex
+	fs   FS
+	dir  string
+	opts AuditOptions
+	n    int // Number of the current file
+	file File
+	size int64
+}
+
+func openAuditLog(fsys FS, dbDir string, opts AuditOptions) (*auditLog, error) {
+	a := &auditLog{fs: fsys, dir: opts.Dir, opts: opts}
+	if a.dir == "" {
+		a.dir = filepath.Join(dbDir, auditDirName)
+	}
+	if a.opts.MaxBytes <= 0 {
+		a.opts.MaxBytes = defaultAuditMaxBytes
+	}
+	if err := fsys.MkdirAll(a.dir, 0o755); err != nil {
+		return nil, err
+	}
+	nums, err := a.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) > 0 {
+		a.n = nums[len(nums)-1]
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// files returns the numbers of the audit files, oldest first.
+func (a *auditLog) files() ([]int, error) {
+	ents, err := a.fs.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	var nums []int
+	for _, e := range ents {
+		if m := auditRE.FindStringSubmatch(e.Name()); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	return nums, nil
+}
+
+func (a *auditLog) path(n int) string {
+	return filepath.Join(a.dir, fmt.Sprintf("audit-%d.jsonl", n))
+}
+
+// open opens file a.n for appending.
+func (a *auditLog) open() error {
+	f, err := a.fs.OpenFile(a.path(a.n), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file, a.size = f, st.Size()
+	return nil
+}
+
+func (a *auditLog) write(rec AuditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if a.size > 0 && a.size+int64(len(line)) > a.opts.MaxBytes {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	return err
+}
+
+// rotate moves on to a new file and applies the retention limits.
+func (a *auditLog) rotate() error {
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.n++
+	if err := a.open(); err != nil {
+		return err
+	}
+	return a.prune()
+}
+
+// prune removes the files beyond MaxFiles and older than MaxAge.
+func (a *auditLog) prune() error {
+	nums, err := a.files()
+	if err != nil {
+		return err
+	}
+	nums = nums[:len(nums)-1] // The current file
+	for i, n := range nums {
+		drop := a.opts.MaxFiles > 0 && len(nums)-i >= a.opts.MaxFiles
+		if !drop && a.opts.MaxAge > 0 {
+			f, err := a.fs.Open(a.path(n))
+			if err != nil {
+				return err
+			}
+			st, err := f.Stat()
+			f.Close()
+			if err != nil {
+				return err
+			}
+			drop = time.Since(st.ModTime()) > a.opts.MaxAge
+		}
+		if drop {
+			if err := a.fs.Remove(a.path(n)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *auditLog) close() error {
+	if err := a.file.Sync(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+// audit appends the entries written for a request by actor to the audit
+// log. The writes are committed already, so failures are only logged.
+func (db *DB) audit(written []entry, actor string) {
+	if db.auditLog == nil {
+		return
+	}
+	db.auditLog.mu.Lock()
+	defer db.auditLog.mu.Unlock()
+	for _, e := range written {
+		rec := AuditRecord{Time: modTime(e.ts), Seq: e.seq, Key: e.key, Actor: actor}
+		if rec.Time.IsZero() {
+			rec.Time = db.now()
+		}
+		switch e.kind {
+		case kindTombstone:
+			rec.Op = "delete"
+		case kindMergeOperand:
+			rec.Op = "merge"
+		default:
+			rec.Op = "put"
+		}
+		if e.kind != kindTombstone {
+			sum := sha256.Sum256([]byte(e.value))
+			rec.ValueSHA256 = hex.EncodeToString(sum[:])
+		}
+		if err := db.auditLog.write(rec); err != nil {
+			db.log(slog.LevelError, "writing audit record failed", "key", e.key, "err", err)
+		}
+	}
+}
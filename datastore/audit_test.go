@@ -0,0 +1,127 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func readAudit(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []AuditRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := "test_audit"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{Audit: &AuditOptions{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithActor(context.Background(), "alice")
+	if err := db.PutContext(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("other", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteContext(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	// Видалення відсутнього ключа нічого не пише
+	if err := db.Delete("missing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	recs := readAudit(t, filepath.Join(dir, "audit", "audit-0.jsonl"))
+	if len(recs) != 3 {
+		t.Fatalf("got %d records: %+v", len(recs), recs)
+	}
+	sum := sha256.Sum256([]byte("v"))
+	if r := recs[0]; r.Op != "put" || r.Key != "k" || r.Actor != "alice" || r.Seq != 1 ||
+		r.ValueSHA256 != hex.EncodeToString(sum[:]) || r.Time.IsZero() {
+		t.Errorf("record 0 = %+v", r)
+	}
+	if r := recs[1]; r.Op != "put" || r.Key != "other" || r.Actor != "" {
+		t.Errorf("record 1 = %+v", r)
+	}
+	if r := recs[2]; r.Op != "delete" || r.Key != "k" || r.Actor != "alice" || r.ValueSHA256 != "" {
+		t.Errorf("record 2 = %+v", r)
+	}
+}
+
+func TestAuditLog_Rotation(t *testing.T) {
+	dir := "test_audit_rotation"
+	defer os.RemoveAll(dir)
+	auditDir := filepath.Join(dir, "trail")
+
+	opts := Options{Audit: &AuditOptions{Dir: auditDir, MaxBytes: 400, MaxFiles: 2}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put("k"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	// Лишаються тільки два найновіші файли
+	ents, err := os.ReadDir(auditDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 2 {
+		t.Fatalf("got %d audit files", len(ents))
+	}
+	a := &auditLog{fs: OSFS{}, dir: auditDir}
+	nums, err := a.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := nums[len(nums)-1]
+	recs := readAudit(t, a.path(last))
+	if len(recs) == 0 || recs[len(recs)-1].Key != "k19" {
+		t.Fatalf("last file = %+v", recs)
+	}
+
+	// Після перевідкриття запис продовжується в останній файл
+	db, err = OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("after", "reopen"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	nums, _ = a.files()
+	recs = readAudit(t, a.path(nums[len(nums)-1]))
+	if recs[len(recs)-1].Key != "after" || recs[len(recs)-1].Seq != 21 {
+		t.Fatalf("after reopen = %+v", recs[len(recs)-1])
+	}
+}
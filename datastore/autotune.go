@@ -0,0 +1,114 @@
+package datastore
+
+import (
+	"time"
+)
+
+const (
+	defaultTuneInterval = 10 * time.Second
+	// Segments are sized to hold about this much write traffic, and at
+	// least segmentEntries average entries.
+	targetRotationPeriod = time.Minute
+	segmentEntries       = 1024
+	compactorInterval    = 30 * time.Second
+	defaultCompactAfter  = 2
+)
+
+// AutoTuneOptions enables the adaptive controller and bounds the values it
+// may pick. Zero bounds leave the corresponding setting untouched.
+type AutoTuneOptions struct {
+	// Interval between adjustments. Defaults to 10s.
+	Interval time.Duration
+
+	// Segment size is chosen from the observed write rate and entry size.
+	MinSegmentSize int64
+	MaxSegmentSize int64
+
+	// Number of frozen segments that must pile up before the background
+	// compactor merges them; raised under heavy writes to cut write
+	// amplification.
+	MinCompactSegments int
+	MaxCompactSegments int
+
+	// Cache budget grows while reads mostly miss, and shrinks while the
+	// cache is mostly empty. A non-zero MaxCacheBytes enables the cache
+	// even if Options.CacheBytes is zero.
+	MinCacheBytes int64
+	MaxCacheBytes int64
+}
+
+// tuner adjusts DB settings from the counters observed since its last step.
+type tuner struct {
+	db   *DB
+	opts AutoTuneOptions
+
+	lastPuts, lastBytes  uint64
+	lastHits, lastMisses uint64
+}
+
+func (db *DB) autoTune() {
+	defer db.wg.Done()
+	t := &tuner{db: db, opts: *db.opts.AutoTune}
+	interval := t.opts.Interval
+	if interval <= 0 {
+		interval = defaultTuneInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.step(interval)
+		case <-db.quit:
+			return
+		}
+	}
+}
+
+func (t *tuner) step(elapsed time.Duration) {
+	puts, written := t.db.puts.Load(), t.db.bytesWritten.Load()
+	dPuts, dBytes := puts-t.lastPuts, written-t.lastBytes
+	t.lastPuts, t.lastBytes = puts, written
+
+	size := t.db.segmentLimit.Load()
+	if dPuts > 0 && t.opts.MaxSegmentSize > 0 {
+		rate := float64(dBytes) / elapsed.Seconds()
+		size = int64(rate * targetRotationPeriod.Seconds())
+		size = max(size, int64(dBytes/dPuts)*segmentEntries)
+		size = clamp(size, t.opts.MinSegmentSize, t.opts.MaxSegmentSize)
+		t.db.segmentLimit.Store(size)
+	}
+
+	if dPuts > 0 && t.opts.MaxCompactSegments > 0 {
+		// Merge roughly once per two compactor ticks' worth of rotations.
+		rotations := float64(dBytes) / float64(size) * (compactorInterval.Seconds() / elapsed.Seconds())
+		n := clamp(int64(2*rotations), int64(max(t.opts.MinCompactSegments, defaultCompactAfter)), int64(t.opts.MaxCompactSegments))
+		t.db.compactAfter.Store(n)
+	}
+
+	if c := t.db.cache; c != nil && t.opts.MaxCacheBytes > 0 {
+		hits, misses := c.counters()
+		dHits, dMisses := hits-t.lastHits, misses-t.lastMisses
+		t.lastHits, t.lastMisses = hits, misses
+
+		_, used := c.usage()
+		budget := c.limit()
+		switch {
+		case dMisses > dHits:
+			budget *= 2
+		case used < budget/2:
+			budget /= 2
+		}
+		c.setBudget(clamp(budget, t.opts.MinCacheBytes, t.opts.MaxCacheBytes))
+	}
+}
+
+func clamp(v, lo, hi int64) int64 {
+	if hi > 0 && v > hi {
+		v = hi
+	}
+	if v < lo {
+		v = lo
+	}
+	return v
+}
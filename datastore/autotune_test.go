@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAutoTune_Step(t *testing.T) {
+	dir := "test_autotune"
+	defer os.RemoveAll(dir)
+
+	opts := AutoTuneOptions{
+		Interval:           time.Hour, // крок викликаємо вручну
+		MinSegmentSize:     4 * 1024,
+		MaxSegmentSize:     64 * 1024,
+		MinCompactSegments: 2,
+		MaxCompactSegments: 8,
+		MinCacheBytes:      100,
+		MaxCacheBytes:      1000,
+	}
+	db, err := OpenWithOptions(dir, Options{AutoTune: &opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Читання, що не вміщуються в маленький кеш
+	for i := 0; i < 100; i++ {
+		if _, err := db.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tn := &tuner{db: db, opts: opts}
+	tn.step(time.Second)
+
+	st := db.Stats()
+	// 100 записів по ~113 байт за секунду дають сегмент більший за максимум
+	if st.MaxSegmentSize != opts.MaxSegmentSize {
+		t.Errorf("expected segment size to be capped at %d, got %d", opts.MaxSegmentSize, st.MaxSegmentSize)
+	}
+	if st.CompactAfter < opts.MinCompactSegments || st.CompactAfter > opts.MaxCompactSegments {
+		t.Errorf("compaction trigger %d outside of bounds", st.CompactAfter)
+	}
+	if st.CacheBudget != 200 {
+		t.Errorf("expected cache budget to double to 200, got %d", st.CacheBudget)
+	}
+
+	// Без записів та читань налаштування сегментів не змінюються, а кеш стискається
+	tn.step(time.Second)
+	if got := db.Stats().MaxSegmentSize; got != opts.MaxSegmentSize {
+		t.Errorf("expected segment size to stay %d, got %d", opts.MaxSegmentSize, got)
+	}
+}
+
+func TestAutoTune_CompactionOnly(t *testing.T) {
+	dir := "test_autotune_compaction"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "1024")
+
+	opts := AutoTuneOptions{Interval: time.Hour, MinCompactSegments: 3, MaxCompactSegments: 8}
+	db, err := OpenWithOptions(dir, Options{AutoTune: &opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Поріг злиття налаштовується і без меж розміру сегмента
+	tn := &tuner{db: db, opts: opts}
+	tn.step(time.Second)
+	st := db.Stats()
+	if st.CompactAfter != opts.MaxCompactSegments {
+		t.Errorf("expected compaction trigger raised to %d, got %d", opts.MaxCompactSegments, st.CompactAfter)
+	}
+	if st.MaxSegmentSize != 1024 {
+		t.Errorf("expected segment size left at 1024, got %d", st.MaxSegmentSize)
+	}
+}
+
+func TestClamp(t *testing.T) {
+	if clamp(5, 10, 20) != 10 || clamp(25, 10, 20) != 20 || clamp(15, 10, 20) != 15 {
+		t.Error("clamp does not respect bounds")
+	}
+	if clamp(25, 10, 0) != 25 {
+		t.Error("expected zero upper bound to mean unbounded")
+	}
+}
@@ -0,0 +1,132 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const defaultWriteQueueSize = 100
+
+// ErrBusy is returned by writes rejected under BackpressureFailFast.
+var ErrBusy = errors.New("write queue is full")
+
+// ErrTimeout is returned by PutWithTimeout when the write was not durable
+// in time.
+var ErrTimeout = errors.New("write timed out")
+
+// Backpressure selects what a write does when the writer's queue is full.
+type Backpressure int
+
+const (
+	// BackpressureBlock waits for room in the queue, or until the context
+	// of PutContext is done.
+	BackpressureBlock Backpressure = iota
+	// BackpressureFailFast rejects the write with ErrBusy.
+	BackpressureFailFast
+	// BackpressureGrow queues the write beyond the queue size, trading
+	// memory for never waiting on the queue.
+	BackpressureGrow
+)
+
+// PutContext is Put that stops waiting for room in a full write queue
+// once ctx is done. A write that was queued is carried out even if ctx
+// ends while it waits for the writer.
+func (db *DB) PutContext(ctx context.Context, key, value string) error {
+	return db.sendContext(ctx, writeRequest{key: key, value: value, kind: kindValue})
+}
+
+// PutWithTimeout is Put with WithSync(true) that gives up with ErrTimeout
+// once d has passed and the write is not fsynced yet, be it waiting for
+// room in the queue, for the writer or for the disk, so that callers with
+// a latency budget are not stuck behind a saturated disk. A write that
+// timed out after it was queued may still be carried out.
+func (db *DB) PutWithTimeout(key, value string, d time.Duration, opts ...PutOption) error {
+	po := &putOptions{}
+	for _, opt := range opts {
+		opt(po)
+	}
+	po.sync = true
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	req := writeRequest{key: key, value: value, kind: kindValue, put: po}
+	span := db.startWriteSpan(ctx, &req)
+	respCh, err := db.submit(ctx, &req)
+	if err == nil {
+		select {
+		case err = <-respCh:
+			db.putLatency.since(req.queued)
+			endWriteSpan(span, &req, true, err)
+			return err
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		db.writesTimedOut.Add(1)
+		err = ErrTimeout
+	}
+	endWriteSpan(span, &req, false, err)
+	return err
+}
+
+func (db *DB) sendContext(ctx context.Context, req writeRequest) error {
+	span := db.startWriteSpan(ctx, &req)
+	respCh, err := db.submit(ctx, &req)
+	if err != nil {
+		endWriteSpan(span, &req, false, err)
+		return err
+	}
+	err = <-respCh
+	db.putLatency.since(req.queued)
+	endWriteSpan(span, &req, true, err)
+	return err
+}
+
+// submit queues req and returns the channel its outcome is sent on.
+func (db *DB) submit(ctx context.Context, req *writeRequest) (<-chan error, error) {
+	req.respCh = make(chan error, 1)
+	req.queued = time.Now()
+	req.actor = actorFrom(ctx)
+	db.track(req)
+	if err := db.enqueue(ctx, *req); err != nil {
+		db.pending.done(req.key, req.pending)
+		return nil, err
+	}
+	return req.respCh, nil
+}
+
+// enqueue hands req to the writer of its stripe according to
+// Options.Backpressure.
+func (db *DB) enqueue(ctx context.Context, req writeRequest) error {
+	st, h := db.queueFor(req.key)
+	q := st.queue
+	for {
+		if q.reserve(db.opts.Backpressure == BackpressureGrow) {
+			return q.push(h, req)
+		}
+		if db.opts.Backpressure == BackpressureFailFast {
+			db.writesRejected.Add(1)
+			return ErrBusy
+		}
+		// The writer may have made room before waitRoom, so look again.
+		room := q.waitRoom()
+		if q.reserve(false) {
+			return q.push(h, req)
+		}
+		select {
+		case <-room:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// queueDepth returns the number of writes waiting for the writers.
+func (db *DB) queueDepth() int {
+	n := 0
+	for _, st := range db.stripes {
+		n += int(st.queue.depth.Load())
+	}
+	return n
+}
@@ -0,0 +1,164 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stallWriter зупиняє writer всередині update і заповнює чергу з одного місця
+func stallWriter(t *testing.T, db *DB) (release func()) {
+	t.Helper()
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		err := db.update("stall", func(string, bool) (string, error) {
+			close(entered)
+			<-unblock
+			return "v", nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	<-entered
+	go func() {
+		defer wg.Done()
+		if err := db.Put("queued", "v"); err != nil {
+			t.Error(err)
+		}
+	}()
+	waitFor(t, func() bool { return db.queueDepth() == 1 })
+	return func() {
+		close(unblock)
+		wg.Wait()
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBackpressure_FailFast(t *testing.T) {
+	dir := "test_backpressure_failfast"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{WriteQueueSize: 1, Backpressure: BackpressureFailFast})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	release := stallWriter(t, db)
+	if err := db.Put("key", "value"); !errors.Is(err, ErrBusy) {
+		t.Errorf("expected ErrBusy, got %v", err)
+	}
+	st := db.Stats()
+	release()
+	if st.WriteQueueDepth != 1 || st.WritesRejected != 1 {
+		t.Errorf("expected depth 1 and 1 rejected, got %d and %d", st.WriteQueueDepth, st.WritesRejected)
+	}
+
+	// Після звільнення черги запис проходить
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackpressure_BlockDeadline(t *testing.T) {
+	dir := "test_backpressure_block"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{WriteQueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	release := stallWriter(t, db)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = db.PutContext(ctx, "key", "value")
+	release()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if _, err := db.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected timed out write to be dropped, got %v", err)
+	}
+}
+
+func TestBackpressure_Grow(t *testing.T) {
+	dir := "test_backpressure_grow"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{WriteQueueSize: 1, Backpressure: BackpressureGrow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	release := stallWriter(t, db)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	// Черга росте понад WriteQueueSize
+	waitFor(t, func() bool { return db.Stats().WriteQueueDepth == 11 })
+	release()
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		if _, err := db.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Errorf("key%d: %v", i, err)
+		}
+	}
+}
+
+func TestPutWithTimeout(t *testing.T) {
+	dir := "test_put_timeout"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.PutWithTimeout("fast", "v", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Запис у черзі не дочекався writer
+	release := stallWriter(t, db)
+	err = db.PutWithTimeout("key", "value", 20*time.Millisecond)
+	timedOut := db.Stats().WritesTimedOut
+	release()
+	if !errors.Is(err, ErrTimeout) || timedOut != 1 {
+		t.Fatalf("expected ErrTimeout and 1 timed out, got %v and %d", err, timedOut)
+	}
+	// Але вже поставлений у чергу запис усе одно виконується
+	waitFor(t, func() bool {
+		v, err := db.Get("key")
+		return err == nil && v == "value"
+	})
+}
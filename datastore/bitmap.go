@@ -0,0 +1,120 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// ErrNotBitmap is returned by bitmap operations on a key holding another
+// value.
+var ErrNotBitmap = errors.New("value is not a bitmap")
+
+// MaxBitOffset is the largest offset SetBit accepts, bounding a bitmap to
+// 512 MiB.
+const MaxBitOffset = 1<<32 - 1
+
+// Bitmaps are stored like lists: SetBit writes a merge operand with the one
+// bit it changes, and reads and merges fold them into the bitmap. A folded
+// bitmap is bitmapMagic followed by its bytes, bit 0 being the most
+// significant bit of the first byte; an operand is bitmapOpMagic, an op
+// byte and the offset as a uvarint.
+const (
+	bitmapMagic   = "\x00bits\x01"
+	bitmapOpMagic = "\x00bits\x02"
+
+	bitmapOpSet   = '1'
+	bitmapOpClear = '0'
+)
+
+// SetBit sets the bit at offset in the bitmap at key, creating and growing
+// the bitmap as needed. It writes a few bytes whatever the bitmap's size.
+func (db *DB) SetBit(key string, offset uint64, value bool) error {
+	if offset > MaxBitOffset {
+		return fmt.Errorf("bit offset %d out of range", offset)
+	}
+	op := bitmapOpClear
+	if value {
+		op = bitmapOpSet
+	}
+	b := binary.AppendUvarint(append([]byte(bitmapOpMagic), byte(op)), offset)
+	return db.write(key, string(b), kindMergeOperand)
+}
+
+// GetBit returns the bit at offset in the bitmap at key. Bits past the end
+// and bits of a missing key read as false.
+func (db *DB) GetBit(key string, offset uint64) (bool, error) {
+	bm, err := db.bitmap(key)
+	if err != nil {
+		return false, err
+	}
+	if offset/8 >= uint64(len(bm)) {
+		return false, nil
+	}
+	return bm[offset/8]&(0x80>>(offset%8)) != 0, nil
+}
+
+// BitCount returns the number of set bits in the bitmap at key.
+func (db *DB) BitCount(key string) (uint64, error) {
+	bm, err := db.bitmap(key)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for i := 0; i < len(bm); i++ {
+		n += uint64(bits.OnesCount8(bm[i]))
+	}
+	return n, nil
+}
+
+func (db *DB) bitmap(key string) (string, error) {
+	v, err := db.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	bm, ok := strings.CutPrefix(v, bitmapMagic)
+	if !ok {
+		return "", ErrNotBitmap
+	}
+	return bm, nil
+}
+
+func foldBitmap(existing string, exists bool, operands []string) (string, error) {
+	var bm []byte
+	if exists {
+		body, ok := strings.CutPrefix(existing, bitmapMagic)
+		if !ok {
+			return "", ErrNotBitmap
+		}
+		bm = []byte(body)
+	}
+	for _, op := range operands {
+		body, ok := strings.CutPrefix(op, bitmapOpMagic)
+		if !ok || body == "" {
+			return "", ErrNotBitmap
+		}
+		offset, n := binary.Uvarint([]byte(body[1:]))
+		if n <= 0 || n != len(body)-1 || offset > MaxBitOffset {
+			return "", ErrNotBitmap
+		}
+		// Like in Redis, clearing a bit past the end still grows the bitmap.
+		i, mask := int(offset/8), byte(0x80>>(offset%8))
+		if i >= len(bm) {
+			bm = append(bm, make([]byte, i+1-len(bm))...)
+		}
+		switch body[0] {
+		case bitmapOpSet:
+			bm[i] |= mask
+		case bitmapOpClear:
+			bm[i] &^= mask
+		default:
+			return "", ErrNotBitmap
+		}
+	}
+	return bitmapMagic + string(bm), nil
+}
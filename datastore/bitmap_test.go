@@ -0,0 +1,61 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestBitmap(t *testing.T) {
+	dir := "test_bitmap"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Активність користувачів за день: біт на користувача
+	for _, uid := range []uint64{0, 7, 8, 1000, 7, 42} {
+		if err := db.SetBit("active:2026-10-15", uid, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetBit("active:2026-10-15", 42, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetBit("active:2026-10-15", MaxBitOffset+1, true); err == nil {
+		t.Error("expected out of range offset to be rejected")
+	}
+
+	// Біти переживають злиття й повторне відкриття
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for uid, want := range map[uint64]bool{0: true, 7: true, 8: true, 1000: true, 42: false, 1: false, 1 << 20: false} {
+		if got, err := db.GetBit("active:2026-10-15", uid); err != nil || got != want {
+			t.Errorf("GetBit(%d) = %v, %v; want %v", uid, got, err, want)
+		}
+	}
+	if n, err := db.BitCount("active:2026-10-15"); err != nil || n != 4 {
+		t.Errorf("BitCount = %d, %v", n, err)
+	}
+	if n, err := db.BitCount("missing"); err != nil || n != 0 {
+		t.Errorf("BitCount(missing) = %d, %v", n, err)
+	}
+
+	if err := db.Put("plain", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetBit("plain", 0); !errors.Is(err, ErrNotBitmap) {
+		t.Errorf("expected ErrNotBitmap, got %v", err)
+	}
+}
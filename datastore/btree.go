@@ -0,0 +1,262 @@
+package datastore
+
+import (
+	"slices"
+	"sort"
+)
+
+const (
+	btreeDegree   = 32
+	btreeMaxItems = 2*btreeDegree - 1
+)
+
+type btreeItem struct {
+	key string
+	pos position
+}
+
+type btreeNode struct {
+	items    []btreeItem
+	children []*btreeNode
+}
+
+// btreeIndex is an ordered keydir. Every node except the root holds between
+// btreeDegree-1 and btreeMaxItems items.
+type btreeIndex struct {
+	root *btreeNode
+	size int
+}
+
+func (t *btreeIndex) get(key string) (position, bool) {
+	n := t.root
+	for n != nil {
+		i, found := n.find(key)
+		if found {
+			return n.items[i].pos, true
+		}
+		if n.leaf() {
+			break
+		}
+		n = n.children[i]
+	}
+	return position{}, false
+}
+
+func (t *btreeIndex) put(key string, pos position) {
+	if t.root == nil {
+		t.root = &btreeNode{items: []btreeItem{{key: key, pos: pos}}}
+		t.size = 1
+		return
+	}
+	if len(t.root.items) >= btreeMaxItems {
+		old := t.root
+		t.root = &btreeNode{children: []*btreeNode{old}}
+		t.root.splitChild(0)
+	}
+	if t.root.insert(key, pos) {
+		t.size++
+	}
+}
+
+func (t *btreeIndex) remove(key string) {
+	if t.root == nil {
+		return
+	}
+	if t.root.remove(key) {
+		t.size--
+	}
+	if len(t.root.items) == 0 {
+		if t.root.leaf() {
+			t.root = nil
+		} else {
+			t.root = t.root.children[0]
+		}
+	}
+}
+
+func (t *btreeIndex) len() int {
+	return t.size
+}
+
+func (t *btreeIndex) ascend(start, end string, fn func(key string, pos position) bool) {
+	if t.root != nil {
+		t.root.ascend(start, end, fn)
+	}
+}
+
+func (t *btreeIndex) rebase(from, to int) {
+	if t.root != nil {
+		t.root.rebase(from, to)
+	}
+}
+
+func (n *btreeNode) leaf() bool {
+	return len(n.children) == 0
+}
+
+// find returns the index of the first item not less than key and whether
+// that item is key itself.
+func (n *btreeNode) find(key string) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool { return n.items[i].key >= key })
+	return i, i < len(n.items) && n.items[i].key == key
+}
+
+// splitChild splits the full child i around its median item, which moves up
+// into n.
+func (n *btreeNode) splitChild(i int) {
+	child := n.children[i]
+	mid := btreeDegree - 1
+	item := child.items[mid]
+	right := &btreeNode{items: slices.Clone(child.items[mid+1:])}
+	if !child.leaf() {
+		right.children = slices.Clone(child.children[mid+1:])
+		child.children = child.children[:mid+1]
+	}
+	child.items = child.items[:mid]
+	n.items = slices.Insert(n.items, i, item)
+	n.children = slices.Insert(n.children, i+1, right)
+}
+
+// insert adds or replaces key in the subtree rooted at the non-full node n.
+// It reports whether a new key was added.
+func (n *btreeNode) insert(key string, pos position) bool {
+	i, found := n.find(key)
+	if found {
+		n.items[i].pos = pos
+		return false
+	}
+	if n.leaf() {
+		n.items = slices.Insert(n.items, i, btreeItem{key: key, pos: pos})
+		return true
+	}
+	if len(n.children[i].items) >= btreeMaxItems {
+		n.splitChild(i)
+		switch {
+		case key == n.items[i].key:
+			n.items[i].pos = pos
+			return false
+		case key > n.items[i].key:
+			i++
+		}
+	}
+	return n.children[i].insert(key, pos)
+}
+
+// remove deletes key from the subtree rooted at n, keeping every node it
+// descends into above the minimum size. It reports whether key was found.
+func (n *btreeNode) remove(key string) bool {
+	i, found := n.find(key)
+	if n.leaf() {
+		if found {
+			n.items = slices.Delete(n.items, i, i+1)
+		}
+		return found
+	}
+	if found {
+		switch {
+		case len(n.children[i].items) >= btreeDegree:
+			pred := n.children[i].max()
+			n.items[i] = pred
+			return n.children[i].remove(pred.key)
+		case len(n.children[i+1].items) >= btreeDegree:
+			succ := n.children[i+1].min()
+			n.items[i] = succ
+			return n.children[i+1].remove(succ.key)
+		default:
+			n.mergeChildren(i)
+			return n.children[i].remove(key)
+		}
+	}
+	if len(n.children[i].items) < btreeDegree {
+		i = n.grow(i)
+	}
+	return n.children[i].remove(key)
+}
+
+// grow makes child i hold at least btreeDegree items by borrowing from a
+// sibling or merging with one. It returns the index of the grown child.
+func (n *btreeNode) grow(i int) int {
+	switch {
+	case i > 0 && len(n.children[i-1].items) >= btreeDegree:
+		child, left := n.children[i], n.children[i-1]
+		child.items = slices.Insert(child.items, 0, n.items[i-1])
+		n.items[i-1] = left.items[len(left.items)-1]
+		left.items = left.items[:len(left.items)-1]
+		if !left.leaf() {
+			child.children = slices.Insert(child.children, 0, left.children[len(left.children)-1])
+			left.children = left.children[:len(left.children)-1]
+		}
+		return i
+	case i < len(n.items) && len(n.children[i+1].items) >= btreeDegree:
+		child, right := n.children[i], n.children[i+1]
+		child.items = append(child.items, n.items[i])
+		n.items[i] = right.items[0]
+		right.items = slices.Delete(right.items, 0, 1)
+		if !right.leaf() {
+			child.children = append(child.children, right.children[0])
+			right.children = slices.Delete(right.children, 0, 1)
+		}
+		return i
+	case i < len(n.items):
+		n.mergeChildren(i)
+		return i
+	default:
+		n.mergeChildren(i - 1)
+		return i - 1
+	}
+}
+
+// mergeChildren folds item i and child i+1 into child i.
+func (n *btreeNode) mergeChildren(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	n.items = slices.Delete(n.items, i, i+1)
+	n.children = slices.Delete(n.children, i+1, i+2)
+}
+
+func (n *btreeNode) min() btreeItem {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.items[0]
+}
+
+func (n *btreeNode) max() btreeItem {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.items[len(n.items)-1]
+}
+
+func (n *btreeNode) ascend(start, end string, fn func(key string, pos position) bool) bool {
+	i, _ := n.find(start)
+	for ; i < len(n.items); i++ {
+		if !n.leaf() && !n.children[i].ascend(start, end, fn) {
+			return false
+		}
+		it := n.items[i]
+		if end != "" && it.key >= end {
+			return false
+		}
+		if !fn(it.key, it.pos) {
+			return false
+		}
+	}
+	if !n.leaf() {
+		return n.children[i].ascend(start, end, fn)
+	}
+	return true
+}
+
+func (n *btreeNode) rebase(from, to int) {
+	for i := range n.items {
+		if n.items[i].pos.segID == from {
+			n.items[i].pos.segID = to
+		}
+	}
+	for _, c := range n.children {
+		c.rebase(from, to)
+	}
+}
@@ -0,0 +1,84 @@
+package datastore
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestBTree_AgainstMap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tree := &btreeIndex{}
+	want := make(map[string]position)
+
+	// Випадкові вставки та видалення, що змушують вузли ділитися та зливатися
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprintf("key%05d", rnd.Intn(3000))
+		if rnd.Intn(3) == 0 {
+			tree.remove(key)
+			delete(want, key)
+		} else {
+			pos := position{segID: i, offset: int64(i)}
+			tree.put(key, pos)
+			want[key] = pos
+		}
+	}
+
+	if tree.len() != len(want) {
+		t.Fatalf("expected %d keys, got %d", len(want), tree.len())
+	}
+	for key, pos := range want {
+		got, ok := tree.get(key)
+		if !ok || got != pos {
+			t.Errorf("key %s: expected %v, got %v (found=%v)", key, pos, got, ok)
+		}
+	}
+
+	keys := make([]string, 0, len(want))
+	for key := range want {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var got []string
+	tree.ascend("", "", func(key string, _ position) bool {
+		got = append(got, key)
+		return true
+	})
+	if len(got) != len(keys) {
+		t.Fatalf("ascend visited %d keys, expected %d", len(got), len(keys))
+	}
+	for i := range keys {
+		if got[i] != keys[i] {
+			t.Fatalf("ascend order mismatch at %d: %s != %s", i, got[i], keys[i])
+		}
+	}
+
+	// Видаляємо все - дерево має стати порожнім
+	for _, key := range keys {
+		tree.remove(key)
+	}
+	if tree.len() != 0 || tree.root != nil {
+		t.Errorf("expected empty tree, got %d keys", tree.len())
+	}
+}
+
+func TestBTree_AscendRange(t *testing.T) {
+	tree := &btreeIndex{}
+	for i := 0; i < 1000; i++ {
+		tree.put(fmt.Sprintf("key%04d", i), position{offset: int64(i)})
+	}
+
+	var got []string
+	tree.ascend("key0100", "key0200", func(key string, _ position) bool {
+		got = append(got, key)
+		return true
+	})
+	if len(got) != 100 {
+		t.Fatalf("expected 100 keys, got %d", len(got))
+	}
+	if got[0] != "key0100" || got[99] != "key0199" {
+		t.Errorf("unexpected range bounds %s..%s", got[0], got[99])
+	}
+}
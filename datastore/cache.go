@@ -0,0 +1,119 @@
+package datastore
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+type cacheItem struct {
+	key   string
+	value string
+}
+
+// lruCache keeps recently read values in memory within a byte budget.
+type lruCache struct {
+	mu     sync.Mutex
+	budget int64
+	used   int64
+	ll     *list.List
+	items  map[string]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newLRUCache(budget int64) *lruCache {
+	return &lruCache{
+		budget: budget,
+		ll:     list.New(),
+		items:  make(map[string]*list.Element),
+	}
+}
+
+func itemCost(key, value string) int64 {
+	return int64(len(key) + len(value))
+}
+
+func (c *lruCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return "", false
+	}
+	c.hits.Add(1)
+	c.ll.MoveToFront(el)
+	return el.Value.(*cacheItem).value, true
+}
+
+func (c *lruCache) add(key, value string) {
+	cost := itemCost(key, value)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cost > c.budget {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		it := el.Value.(*cacheItem)
+		c.used += cost - itemCost(it.key, it.value)
+		it.value = value
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[key] = c.ll.PushFront(&cacheItem{key: key, value: value})
+		c.used += cost
+	}
+	for c.used > c.budget {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lruCache) limit() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.budget
+}
+
+// setBudget changes the byte budget, evicting entries if it shrank.
+func (c *lruCache) setBudget(budget int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = budget
+	for c.used > c.budget {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lruCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.used = 0
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	it := el.Value.(*cacheItem)
+	c.ll.Remove(el)
+	delete(c.items, it.key)
+	c.used -= itemCost(it.key, it.value)
+}
+
+func (c *lruCache) counters() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+func (c *lruCache) usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items), c.used
+}
@@ -0,0 +1,91 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCache_HitsAndMisses(t *testing.T) {
+	dir := "test_cache_hits"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{CacheBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Перше читання йде на диск, друге - з кешу
+	for i := 0; i < 2; i++ {
+		v, err := db.Get("key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "value" {
+			t.Errorf("expected value, got %s", v)
+		}
+	}
+
+	st := db.Stats()
+	if st.CacheHits != 1 || st.CacheMisses != 1 {
+		t.Errorf("expected 1 hit and 1 miss, got %d hits and %d misses", st.CacheHits, st.CacheMisses)
+	}
+}
+
+func TestCache_InvalidatedOnPut(t *testing.T) {
+	dir := "test_cache_invalidate"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{CacheBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("key", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := db.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "new" {
+		t.Errorf("expected new, got %s", v)
+	}
+}
+
+func TestCache_Budget(t *testing.T) {
+	c := newLRUCache(100)
+	for i := 0; i < 10; i++ {
+		c.add(fmt.Sprintf("key%d", i), strings.Repeat("v", 20))
+	}
+
+	entries, used := c.usage()
+	if used > 100 {
+		t.Errorf("expected at most 100 bytes cached, got %d", used)
+	}
+	if entries != 4 {
+		t.Errorf("expected 4 entries, got %d", entries)
+	}
+
+	// Найстаріші ключі мають бути витіснені
+	if _, ok := c.get("key0"); ok {
+		t.Error("expected key0 to be evicted")
+	}
+	if _, ok := c.get("key9"); !ok {
+		t.Error("expected key9 to be cached")
+	}
+}
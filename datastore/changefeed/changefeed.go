@@ -0,0 +1,187 @@
+// Package changefeed streams the committed writes of a datastore.DB to a
+// Sink such as Kafka or NATS. A Feed tails the DB by sequence number and
+// stores how far it got in the DB itself, so a restarted feed resumes where
+// it stopped. Delivery is at least once: a batch published just before a
+// crash is sent again.
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+const (
+	defaultName         = "default"
+	defaultPollInterval = 100 * time.Millisecond
+	defaultBatchSize    = 256
+	maxBackoff          = 5 * time.Second
+)
+
+// OffsetPrefix starts the keys feeds store their offsets under. Writes to
+// such keys are not published.
+const OffsetPrefix = "__changefeed/"
+
+// Message is one published write.
+type Message struct {
+	Seq   uint64 `json:"seq"`
+	Op    string `json:"op"` // "put", "delete" or "merge"
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// Sink publishes messages to an external system.
+type Sink interface {
+	// Publish delivers msgs in order. It returns only once they are
+	// durably accepted; on error the whole batch is retried.
+	Publish(ctx context.Context, msgs []Message) error
+	Close() error
+}
+
+// Options configures a Feed. Every field is optional.
+type Options struct {
+	// Name identifies the feed's offset, so several feeds can tail one DB.
+	// Empty means "default".
+	Name string
+	// PollInterval is how often an idle feed checks for new writes. Zero
+	// means 100ms.
+	PollInterval time.Duration
+	// BatchSize caps the messages per Publish. Zero means 256.
+	BatchSize int
+	// Logger receives publish failures.
+	Logger *slog.Logger
+}
+
+// Feed publishes the writes of a DB until closed.
+type Feed struct {
+	db     *datastore.DB
+	sink   Sink
+	opts   Options
+	key    string
+	offset atomic.Uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Start loads the feed's offset from db and starts publishing the writes
+// after it to sink. A new feed starts from the first write still on disk.
+func Start(db *datastore.DB, sink Sink, opts Options) (*Feed, error) {
+	if opts.Name == "" {
+		opts.Name = defaultName
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	f := &Feed{db: db, sink: sink, opts: opts, key: OffsetPrefix + opts.Name}
+	offset, err := db.GetInt64(f.key)
+	if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+		return nil, fmt.Errorf("changefeed: load offset: %w", err)
+	}
+	f.offset.Store(uint64(offset))
+
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	f.wg.Add(1)
+	go f.run()
+	return f, nil
+}
+
+// Offset returns the sequence number of the last write published.
+func (f *Feed) Offset() uint64 {
+	return f.offset.Load()
+}
+
+// Close stops the feed, interrupting a pending Publish, and closes the
+// sink.
+func (f *Feed) Close() error {
+	f.cancel()
+	f.wg.Wait()
+	return f.sink.Close()
+}
+
+func (f *Feed) run() {
+	defer f.wg.Done()
+	backoff := f.opts.PollInterval
+	for {
+		published, err := f.step()
+		if f.ctx.Err() != nil {
+			return
+		}
+		wait := f.opts.PollInterval
+		switch {
+		case err != nil:
+			wait = backoff
+			backoff = min(2*backoff, maxBackoff)
+			f.log(slog.LevelWarn, "publish failed", "err", err, "retry_in", wait)
+		case published:
+			backoff = f.opts.PollInterval
+			continue
+		default:
+			backoff = f.opts.PollInterval
+		}
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// step publishes the next batch and reports whether there was one.
+func (f *Feed) step() (bool, error) {
+	offset := f.offset.Load()
+	cur := f.db.CurrentSeq()
+	if cur <= offset {
+		return false, nil
+	}
+	changes, err := f.db.Changes(offset, f.opts.BatchSize)
+	if err != nil {
+		return false, err
+	}
+	if len(changes) == 0 {
+		// Everything after offset was compacted away.
+		f.offset.Store(cur)
+		return false, nil
+	}
+
+	last := changes[len(changes)-1].Seq
+	msgs := make([]Message, 0, len(changes))
+	for _, c := range changes {
+		if strings.HasPrefix(c.Key, OffsetPrefix) {
+			continue
+		}
+		msgs = append(msgs, Message{Seq: c.Seq, Op: c.Op.String(), Key: c.Key, Value: c.Value})
+	}
+	if len(msgs) == 0 {
+		// Only offset writes, ours included; persisting would make another.
+		f.offset.Store(last)
+		return false, nil
+	}
+	if err := f.sink.Publish(f.ctx, msgs); err != nil {
+		return false, err
+	}
+	f.offset.Store(last)
+	if err := f.db.PutInt64(f.key, int64(last)); err != nil {
+		return true, fmt.Errorf("changefeed: save offset: %w", err)
+	}
+	return true, nil
+}
+
+func (f *Feed) log(level slog.Level, msg string, args ...any) {
+	l := f.opts.Logger
+	if l == nil || !l.Enabled(context.Background(), level) {
+		return
+	}
+	l.Log(context.Background(), level, msg, append([]any{"feed", f.opts.Name}, args...)...)
+}
@@ -0,0 +1,118 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+type memSink struct {
+	mu    sync.Mutex
+	msgs  []Message
+	fails int // Number of Publish calls to fail
+}
+
+func (s *memSink) Publish(_ context.Context, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("sink down")
+	}
+	s.msgs = append(s.msgs, msgs...)
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func (s *memSink) received() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.msgs...)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFeed_PublishesAndResumes(t *testing.T) {
+	dir := "test_changefeed"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{PollInterval: 5 * time.Millisecond, BatchSize: 3}
+	sink := &memSink{fails: 2}
+	feed, err := Start(db, sink, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("key0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Помилки приймача повторюються, порядок зберігається
+	waitFor(t, func() bool { return len(sink.received()) == 6 })
+	msgs := sink.received()
+	for i, m := range msgs {
+		if m.Seq != uint64(i+1) {
+			t.Fatalf("messages out of order: %+v", msgs)
+		}
+	}
+	if msgs[5].Op != "delete" || msgs[5].Key != "key0" || msgs[0].Op != "put" || msgs[0].Value != "value" {
+		t.Errorf("unexpected messages %+v", msgs)
+	}
+	if err := feed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Після перевідкриття стрічка продовжує зі збереженої позиції
+	db, err = datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key5", "value"); err != nil {
+		t.Fatal(err)
+	}
+	sink = &memSink{}
+	feed, err = Start(db, sink, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer feed.Close()
+	waitFor(t, func() bool { return len(sink.received()) == 1 })
+	if m := sink.received()[0]; m.Key != "key5" {
+		t.Errorf("expected only key5 after resume, got %+v", m)
+	}
+
+	// Власні записи позиції не публікуються
+	time.Sleep(30 * time.Millisecond)
+	if n := len(sink.received()); n != 1 {
+		t.Errorf("expected no further messages, got %d", n)
+	}
+	if feed.Offset() < 7 {
+		t.Errorf("offset %d not past the last write", feed.Offset())
+	}
+}
@@ -0,0 +1,79 @@
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// KafkaSink produces messages to a Kafka topic through a Confluent REST
+// Proxy (API v2). Records are keyed by the DB key, so every write of a key
+// lands in the same partition and keeps its order; the record value is the
+// Message as JSON.
+type KafkaSink struct {
+	// URL is the base URL of the REST Proxy, e.g. "http://kafka-rest:8082".
+	URL   string
+	Topic string
+	// Client sends the requests. Nil means http.DefaultClient.
+	Client *http.Client
+}
+
+type kafkaRecord struct {
+	Key   string  `json:"key"`
+	Value Message `json:"value"`
+}
+
+type kafkaResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (k *KafkaSink) Publish(ctx context.Context, msgs []Message) error {
+	records := make([]kafkaRecord, len(msgs))
+	for i, m := range msgs {
+		records[i] = kafkaRecord{Key: m.Key, Value: m}
+	}
+	body, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return err
+	}
+	target := strings.TrimSuffix(k.URL, "/") + "/topics/" + url.PathEscape(k.Topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("changefeed: kafka: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var kr kafkaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&kr); err != nil {
+		return fmt.Errorf("changefeed: kafka: %w", err)
+	}
+	for _, o := range kr.Offsets {
+		if o.ErrorCode != nil {
+			return fmt.Errorf("changefeed: kafka: error %d: %s", *o.ErrorCode, o.Error)
+		}
+	}
+	return nil
+}
+
+func (k *KafkaSink) Close() error { return nil }
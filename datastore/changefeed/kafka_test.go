@@ -0,0 +1,44 @@
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKafkaSink(t *testing.T) {
+	var got struct {
+		Records []kafkaRecord `json:"records"`
+	}
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/writes" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		if fail {
+			w.Write([]byte(`{"offsets":[{"partition":null,"offset":null,"error_code":50002,"error":"leader not available"}]}`))
+			return
+		}
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":10,"error_code":null,"error":null}]}`))
+	}))
+	defer srv.Close()
+
+	sink := &KafkaSink{URL: srv.URL, Topic: "writes"}
+	msgs := []Message{{Seq: 1, Op: "put", Key: "key", Value: "value"}}
+	if err := sink.Publish(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Records) != 1 || got.Records[0].Key != "key" || got.Records[0].Value != msgs[0] {
+		t.Errorf("unexpected records %+v", got.Records)
+	}
+
+	// Помилка окремого запису провалює всю партію
+	fail = true
+	if err := sink.Publish(context.Background(), msgs); err == nil {
+		t.Error("expected record error")
+	}
+}
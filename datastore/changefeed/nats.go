@@ -0,0 +1,129 @@
+package changefeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSSink publishes every message as JSON to a NATS subject over the core
+// NATS protocol. Each batch ends with a PING, and Publish returns once the
+// server answers it, so the server has processed the batch. Core NATS does
+// not persist messages: point Subject at a JetStream stream for durability.
+type NATSSink struct {
+	// Addr is the host:port of the server.
+	Addr    string
+	Subject string
+	// Dialer opens the connection. Nil means a net.Dialer with a 5s
+	// timeout.
+	Dialer *net.Dialer
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (n *NATSSink) Publish(ctx context.Context, msgs []Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := n.publish(ctx, msgs); err != nil {
+		// The connection state is unknown; reconnect on the retry.
+		n.conn.Close()
+		n.conn = nil
+		return fmt.Errorf("changefeed: nats: %w", err)
+	}
+	return nil
+}
+
+func (n *NATSSink) connect(ctx context.Context) error {
+	d := n.Dialer
+	if d == nil {
+		d = &net.Dialer{Timeout: 5 * time.Second}
+	}
+	conn, err := d.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return fmt.Errorf("changefeed: nats: %w", err)
+	}
+	n.conn, n.r = conn, bufio.NewReader(conn)
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	line, err := n.r.ReadString('\n')
+	if err == nil && !strings.HasPrefix(line, "INFO ") {
+		err = fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	if err == nil {
+		_, err = conn.Write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"changefeed\"}\r\n"))
+	}
+	if err != nil {
+		conn.Close()
+		n.conn = nil
+		return fmt.Errorf("changefeed: nats: %w", err)
+	}
+	return nil
+}
+
+func (n *NATSSink) publish(ctx context.Context, msgs []Message) error {
+	// Unblock reads and writes once ctx is done.
+	stop := context.AfterFunc(ctx, func() { n.conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+	n.conn.SetDeadline(time.Time{})
+
+	w := bufio.NewWriter(n.conn)
+	for _, m := range msgs {
+		payload, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "PUB %s %d\r\n", n.Subject, len(payload))
+		w.Write(payload)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := n.r.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates need no answer.
+	}
+}
+
+func (n *NATSSink) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
@@ -0,0 +1,71 @@
+package changefeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeNATS accepts one connection and records the published payloads.
+func fakeNATS(t *testing.T, payloads chan<- string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			var subject string
+			var size int
+			switch {
+			case strings.HasPrefix(line, "PUB "):
+				fmt.Sscanf(line, "PUB %s %d", &subject, &size)
+				buf := make([]byte, size+2)
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return
+				}
+				payloads <- subject + " " + string(buf[:size])
+			case strings.HasPrefix(line, "PING"):
+				fmt.Fprint(conn, "PONG\r\n")
+			}
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestNATSSink(t *testing.T) {
+	payloads := make(chan string, 10)
+	sink := &NATSSink{Addr: fakeNATS(t, payloads), Subject: "db.writes"}
+	defer sink.Close()
+
+	msgs := []Message{{Seq: 1, Op: "put", Key: "a", Value: "1"}, {Seq: 2, Op: "delete", Key: "b"}}
+	if err := sink.Publish(context.Background(), msgs); err != nil {
+		t.Fatal(err)
+	}
+	// Publish повертається після PONG, тож обидва повідомлення вже дійшли
+	for _, want := range msgs {
+		var got Message
+		p := <-payloads
+		subject, payload, _ := strings.Cut(p, " ")
+		if err := json.Unmarshal([]byte(payload), &got); err != nil || subject != "db.writes" || got != want {
+			t.Errorf("got %q, want %+v", p, want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"path/filepath"
+)
+
+const checkpointName = "index.snapshot"
+
+var checkpointMagic = []byte("DBIDXCP1")
+
+// checkpoint is the decoded content of an index snapshot. Besides the
+// index it records the segment set it was taken against: the frozen
+// segments with their sizes, and how far the active segment was written.
+type checkpoint struct {
+	seq        uint64
+	nextID     int // ID the active segment takes when it is frozen
+	activeSize int64
+	segments   map[int]int64
+	index      map[string]position
+	operands   map[string]*operandChain
+}
+
+// Checkpoint writes the index to index.snapshot in the DB directory, so the
+// next Open loads it and only scans the entries written after it. Writes
+// wait while the index is copied; the file is written to a temporary file
+// and renamed into place. Merges and anything else that rewrites segments
+// remove the snapshot, and Open falls back to a full scan when the
+// segments on disk no longer match it. It fails with more than one write
+// stripe.
+func (db *DB) Checkpoint() error {
+	if len(db.stripes) > 1 {
+		return errors.New("checkpoint needs a single write stripe")
+	}
+	db.mergeMu.Lock()
+	defer db.mergeMu.Unlock()
+
+	// The checkpoint only holds if the active segment reached the disk.
+	if err := db.Flush(); err != nil {
+		return err
+	}
+	db.mu.RLock()
+	data := db.encodeCheckpoint()
+	keys := db.index.len()
+	db.mu.RUnlock()
+
+	path := filepath.Join(db.dir, checkpointName)
+	tmp := path + ".tmp"
+	f, err := db.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer db.fs.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := db.fs.Rename(tmp, path); err != nil {
+		return err
+	}
+	db.log(slog.LevelInfo, "index checkpoint written", "keys", keys, "bytes", len(data))
+	return nil
+}
+
+// encodeCheckpoint serializes the index and the segment set. The caller
+// must hold db.mu.
+func (db *DB) encodeCheckpoint() []byte {
+	le := binary.LittleEndian
+	buf := append([]byte(nil), checkpointMagic...)
+	buf = le.AppendUint64(buf, db.seq.Load())
+	active := db.stripes[0]
+	buf = le.AppendUint64(buf, uint64(active.id))
+	buf = le.AppendUint64(buf, uint64(active.active.size))
+	buf = le.AppendUint32(buf, uint32(len(db.segments)))
+	for _, s := range db.segments {
+		buf = le.AppendUint64(buf, uint64(s.id))
+		buf = le.AppendUint64(buf, uint64(s.size))
+	}
+
+	appendPos := func(buf []byte, p position) []byte {
+		buf = le.AppendUint64(buf, uint64(p.segID))
+		buf = le.AppendUint64(buf, uint64(p.offset))
+		return le.AppendUint64(buf, uint64(p.size))
+	}
+	buf = le.AppendUint64(buf, uint64(db.index.len()))
+	db.index.ascend("", "", func(key string, pos position) bool {
+		buf = le.AppendUint32(buf, uint32(len(key)))
+		buf = append(buf, key...)
+		buf = appendPos(buf, pos)
+		chain, ok := db.operands[key]
+		if !ok {
+			buf = append(buf, 0)
+			return true
+		}
+		buf = append(buf, 1)
+		if chain.hasBase {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		buf = appendPos(buf, chain.base)
+		buf = le.AppendUint32(buf, uint32(len(chain.ops)))
+		for _, p := range chain.ops {
+			buf = appendPos(buf, p)
+		}
+		return true
+	})
+	return le.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+}
+
+func decodeCheckpoint(data []byte) (*checkpoint, error) {
+	if len(data) < len(checkpointMagic)+4 || !bytes.Equal(data[:len(checkpointMagic)], checkpointMagic) {
+		return nil, errors.New("not an index snapshot")
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return nil, ErrChecksum
+	}
+	r := bytes.NewReader(body[len(checkpointMagic):])
+	le := binary.LittleEndian
+	var err error
+	u64 := func() uint64 {
+		var b [8]byte
+		if err == nil {
+			_, err = io.ReadFull(r, b[:])
+		}
+		return le.Uint64(b[:])
+	}
+	u32 := func() uint32 {
+		var b [4]byte
+		if err == nil {
+			_, err = io.ReadFull(r, b[:])
+		}
+		return le.Uint32(b[:])
+	}
+	u8 := func() byte {
+		var b [1]byte
+		if err == nil {
+			_, err = io.ReadFull(r, b[:])
+		}
+		return b[0]
+	}
+	pos := func() position {
+		return position{segID: int(int64(u64())), offset: int64(u64()), size: int64(u64())}
+	}
+
+	cp := &checkpoint{
+		seq:        u64(),
+		nextID:     int(u64()),
+		activeSize: int64(u64()),
+		segments:   make(map[int]int64),
+		index:      make(map[string]position),
+		operands:   make(map[string]*operandChain),
+	}
+	for n := u32(); n > 0 && err == nil; n-- {
+		id := int(u64())
+		cp.segments[id] = int64(u64())
+	}
+	for n := u64(); n > 0 && err == nil; n-- {
+		kl := u32()
+		if err != nil || int64(kl) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		key := make([]byte, kl)
+		io.ReadFull(r, key)
+		cp.index[string(key)] = pos()
+		if u8() == 0 {
+			continue
+		}
+		chain := &operandChain{hasBase: u8() == 1, base: pos()}
+		for ops := u32(); ops > 0 && err == nil; ops-- {
+			chain.ops = append(chain.ops, pos())
+		}
+		cp.operands[string(key)] = chain
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// loadCheckpoint fills the index from the snapshot, if there is one that
+// matches the segments on disk, and returns the offset recovery must scan
+// each segment from. Segments missing from the result are covered by the
+// snapshot. A nil result means every segment must be scanned. It runs
+// before recovery, so it needs no locks.
+func (db *DB) loadCheckpoint() map[*segment]int64 {
+	path := filepath.Join(db.dir, checkpointName)
+	f, err := db.fs.Open(path)
+	if err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		db.log(slog.LevelWarn, "ignoring index checkpoint", "err", err)
+		return nil
+	}
+	cp, err := decodeCheckpoint(data)
+	if err == nil {
+		err = db.matchCheckpoint(cp)
+	}
+	if err != nil {
+		db.log(slog.LevelWarn, "ignoring index checkpoint", "err", err)
+		return nil
+	}
+
+	// The active segment of the checkpoint may have been frozen since.
+	former := db.stripes[0].active
+	if i := db.segIdx(cp.nextID); i >= 0 {
+		former = db.segments[i]
+	}
+	from := map[*segment]int64{former: max(cp.activeSize, former.dataStart)}
+	for _, s := range db.segments {
+		if s.id > cp.nextID {
+			from[s] = s.dataStart
+		}
+	}
+	for _, s := range db.actives() {
+		if s != former {
+			from[s] = s.dataStart
+		}
+	}
+
+	for key, pos := range cp.index {
+		if pos.segID == -1 {
+			pos.segID = former.id
+		}
+		db.index.put(key, pos)
+	}
+	for key, chain := range cp.operands {
+		chain.rebase(-1, former.id)
+		db.operands[key] = chain
+	}
+	for key := range cp.index {
+		n := db.keyBytes(key)
+		db.liveBytes += n
+		if db.evictor != nil {
+			db.evictor.record(key, kindValue, n)
+		}
+	}
+	db.seq.Store(max(db.seq.Load(), cp.seq))
+	db.log(slog.LevelInfo, "index checkpoint loaded", "keys", len(cp.index), "seq", cp.seq)
+	return from
+}
+
+// matchCheckpoint checks that the segments on disk are the ones cp was
+// taken against, plus whatever was appended or frozen after it.
+func (db *DB) matchCheckpoint(cp *checkpoint) error {
+	for id, size := range cp.segments {
+		i := db.segIdx(id)
+		if i < 0 || db.segments[i].size != size {
+			return fmt.Errorf("segment %d changed since the checkpoint", id)
+		}
+	}
+	for _, s := range db.segments {
+		if _, ok := cp.segments[s.id]; !ok && s.id < cp.nextID {
+			return fmt.Errorf("segment %d is missing from the checkpoint", s.id)
+		}
+	}
+	former := db.stripes[0].active
+	if i := db.segIdx(cp.nextID); i >= 0 {
+		former = db.segments[i]
+	}
+	// Entries of the former active segment are replayed from where the
+	// checkpoint stopped, which a remote hint cannot do.
+	if former.remote != nil {
+		return fmt.Errorf("segment %d was offloaded since the checkpoint", former.id)
+	}
+	if former.size < cp.activeSize {
+		return fmt.Errorf("active segment is shorter than at the checkpoint")
+	}
+	return nil
+}
+
+// removeCheckpoint drops the index snapshot before segments are rewritten
+// under it. The caller must hold db.mergeMu or run before the DB is open.
+func (db *DB) removeCheckpoint() {
+	removeCheckpointFile(db.fs, db.dir)
+}
+
+func removeCheckpointFile(fsys FS, dir string) {
+	fsys.Remove(filepath.Join(dir, checkpointName))
+}
@@ -0,0 +1,125 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := "test_checkpoint"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.RegisterMerge(sumMerge)
+	for i := 0; i < 20; i++ {
+		if err := db.Put("k"+strconv.Itoa(i), "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Put("n", "1")
+	db.MergeValue("n", "2")
+	db.Delete("k3")
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	// Записи після знімка, включно з ротацією активного сегмента
+	for i := 0; i < 10; i++ {
+		if err := db.Put("k"+strconv.Itoa(i), "new"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.MergeValue("n", "3")
+	db.Delete("k15")
+	want := make(map[string]string)
+	db.RangeScan("", "", func(k, v string) bool {
+		want[k] = v
+		return true
+	})
+	seq, live := db.CurrentSeq(), db.LiveSize()
+	db.Close()
+
+	var last RecoveryProgress
+	reopened, err := OpenWithOptions(dir, Options{RecoveryProgress: func(p RecoveryProgress) { last = p }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	reopened.RegisterMerge(sumMerge)
+	if last.Entries != 12 {
+		t.Errorf("scanned %d entries, want only the 12 written after the checkpoint", last.Entries)
+	}
+	got := make(map[string]string)
+	reopened.RangeScan("", "", func(k, v string) bool {
+		got[k] = v
+		return true
+	})
+	if len(got) != len(want) {
+		t.Fatalf("got %d keys, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	if v, err := reopened.Get("n"); err != nil || v != "6" {
+		t.Errorf("Get(n) = %q, %v", v, err)
+	}
+	if reopened.CurrentSeq() != seq || reopened.LiveSize() != live {
+		t.Errorf("seq %d, live %d; want %d, %d", reopened.CurrentSeq(), reopened.LiveSize(), seq, live)
+	}
+}
+
+func TestCheckpoint_Invalidated(t *testing.T) {
+	dir := "test_checkpoint_invalid"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "100")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		db.Put("k"+strconv.Itoa(i%5), "v"+strconv.Itoa(i))
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	// Злиття переписує сегменти і видаляє знімок
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(dir, checkpointName)
+	if _, err := os.Stat(snapshot); !os.IsNotExist(err) {
+		t.Fatalf("snapshot survived a merge: %v", err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Пошкоджений знімок ігнорується, і індекс відновлюється повністю
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(snapshot, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for i := 15; i < 20; i++ {
+		if v, err := reopened.Get("k" + strconv.Itoa(i%5)); err != nil || v != "v"+strconv.Itoa(i) {
+			t.Errorf("Get = %q, %v", v, err)
+		}
+	}
+}
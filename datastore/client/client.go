@@ -0,0 +1,286 @@
+// Package client talks to a sharded deployment of independent datastore
+// servers, each serving package httpapi. Keys are spread over the shards by
+// consistent hashing with virtual nodes; requests to a shard are retried on
+// network errors and server failures. Client offers the same Put, Get,
+// Delete, RangeScan and lock methods as an embedded datastore.DB.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/httpapi"
+)
+
+const (
+	defaultVirtualNodes = 128
+	defaultRetries      = 2
+	defaultRetryBackoff = 50 * time.Millisecond
+	defaultTimeout      = 5 * time.Second
+	scanPageSize        = 1000
+)
+
+// KV is the key-value surface shared by Client and datastore.DB.
+type KV interface {
+	Put(key, value string, opts ...datastore.PutOption) error
+	Get(key string) (string, error)
+	Delete(key string) error
+	RangeScan(start, end string, fn func(key, value string) bool) error
+}
+
+// Options configures a Client.
+type Options struct {
+	// VirtualNodes is the number of ring points per shard. Zero means 128.
+	VirtualNodes int
+	// Retries is the number of times a failed request to a shard is
+	// repeated. Zero means 2; negative disables retries.
+	Retries int
+	// RetryBackoff is the wait before the first retry, doubled for every
+	// further one. Zero means 50ms.
+	RetryBackoff time.Duration
+	// Timeout bounds each request, retries included. Zero means 5s.
+	Timeout time.Duration
+	// HTTPClient sends the requests. Nil means http.DefaultClient. Set
+	// its transport's TLS config for HTTPS shards and client certificates.
+	HTTPClient *http.Client
+	// Token, if set, is sent as a bearer token to shards that require
+	// authentication.
+	Token string
+}
+
+// StatusError is returned for responses a shard failed with.
+type StatusError struct {
+	Shard   string
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("client: shard %s: %d %s: %s", e.Shard, e.Code, http.StatusText(e.Code), e.Message)
+}
+
+// Client routes keys to shards.
+type Client struct {
+	shards []string
+	ring   *ring
+	opts   Options
+	http   *http.Client
+}
+
+// New returns a client for the servers at the given base URLs, e.g.
+// "http://db-0:8000". Every client of a deployment must list the same
+// shards, in any order, to agree on where keys live.
+func New(shards []string, opts Options) (*Client, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("client: no shards")
+	}
+	seen := make(map[string]bool)
+	for _, s := range shards {
+		if seen[s] {
+			return nil, fmt.Errorf("client: duplicate shard %s", s)
+		}
+		seen[s] = true
+	}
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = defaultVirtualNodes
+	}
+	if opts.Retries == 0 {
+		opts.Retries = defaultRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultRetryBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	c := &Client{shards: append([]string(nil), shards...), ring: newRing(shards, opts.VirtualNodes), opts: opts, http: opts.HTTPClient}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	return c, nil
+}
+
+// Shard returns the base URL of the shard that owns key.
+func (c *Client) Shard(key string) string {
+	return c.shards[c.ring.owner(key)]
+}
+
+// Put stores value under key. Put options cannot be sent to a shard, so
+// passing any fails.
+func (c *Client) Put(key, value string, opts ...datastore.PutOption) error {
+	if len(opts) > 0 {
+		return errors.New("client: put options are not supported")
+	}
+	return c.PutContext(context.Background(), key, value)
+}
+
+func (c *Client) PutContext(ctx context.Context, key, value string) error {
+	body, err := json.Marshal(httpapi.PutRequest{Value: value})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, c.Shard(key), http.MethodPut, keyPath(key), body, nil)
+}
+
+// Get returns the value of key, or datastore.ErrNotFound.
+func (c *Client) Get(key string) (string, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+func (c *Client) GetContext(ctx context.Context, key string) (string, error) {
+	var e httpapi.Entry
+	if err := c.do(ctx, c.Shard(key), http.MethodGet, keyPath(key), nil, &e); err != nil {
+		return "", err
+	}
+	return e.Value, nil
+}
+
+func (c *Client) Delete(key string) error {
+	return c.DeleteContext(context.Background(), key)
+}
+
+func (c *Client) DeleteContext(ctx context.Context, key string) error {
+	return c.do(ctx, c.Shard(key), http.MethodDelete, keyPath(key), nil, nil)
+}
+
+// RangeScan calls fn for every key in [start, end) across all shards in
+// ascending key order until fn returns false. An empty end means no upper
+// bound. Shards are read a page at a time and merged.
+func (c *Client) RangeScan(start, end string, fn func(key, value string) bool) error {
+	return c.RangeScanContext(context.Background(), start, end, fn)
+}
+
+func (c *Client) RangeScanContext(ctx context.Context, start, end string, fn func(key, value string) bool) error {
+	cursors := make([]*cursor, len(c.shards))
+	for i, shard := range c.shards {
+		cursors[i] = &cursor{shard: shard, next: start, more: true}
+	}
+	for {
+		var first *cursor
+		for _, cur := range cursors {
+			if err := c.fill(ctx, cur, end); err != nil {
+				return err
+			}
+			if len(cur.page) > 0 && (first == nil || cur.page[0].Key < first.page[0].Key) {
+				first = cur
+			}
+		}
+		if first == nil {
+			return nil
+		}
+		e := first.page[0]
+		first.page = first.page[1:]
+		if !fn(e.Key, e.Value) {
+			return nil
+		}
+	}
+}
+
+// cursor is the position of a scan in one shard.
+type cursor struct {
+	shard string
+	page  []httpapi.Entry
+	next  string // Start of the next page
+	more  bool   // The shard may hold more keys after page
+}
+
+// fill fetches the next page of cur once its current one is used up.
+func (c *Client) fill(ctx context.Context, cur *cursor, end string) error {
+	if len(cur.page) > 0 || !cur.more {
+		return nil
+	}
+	q := url.Values{"start": {cur.next}, "limit": {strconv.Itoa(scanPageSize)}}
+	if end != "" {
+		q.Set("end", end)
+	}
+	var resp httpapi.ScanResponse
+	if err := c.do(ctx, cur.shard, http.MethodGet, httpapi.Prefix+"?"+q.Encode(), nil, &resp); err != nil {
+		return err
+	}
+	cur.page, cur.next, cur.more = resp.Entries, resp.Next, resp.Next != ""
+	return nil
+}
+
+func keyPath(key string) string {
+	return httpapi.Prefix + "/" + url.PathEscape(key)
+}
+
+// do sends a request to shard, retrying it on network errors, 5xx and 429
+// responses, and decodes a JSON response into out unless it is nil.
+func (c *Client) do(ctx context.Context, shard, method, path string, body []byte, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	backoff := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, shard, method, path, body, out)
+		if err == nil || !retryable(err) || attempt >= c.opts.Retries {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, shard, method, path string, body []byte, out any) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, shard+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet && strings.HasPrefix(path, httpapi.Prefix+"/") {
+		return datastore.ErrNotFound
+	}
+	if resp.StatusCode == http.StatusConflict && strings.HasPrefix(path, httpapi.LockPath+"/") {
+		if method == http.MethodDelete {
+			return datastore.ErrNotLocked
+		}
+		return datastore.ErrLocked
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &StatusError{Shard: shard, Code: resp.StatusCode, Message: string(bytes.TrimSpace(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 500 || se.Code == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, datastore.ErrNotFound) && !errors.Is(err, datastore.ErrLocked) && !errors.Is(err, datastore.ErrNotLocked) &&
+		!errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
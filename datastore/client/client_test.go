@@ -0,0 +1,153 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/httpapi"
+)
+
+var (
+	_ KV = (*Client)(nil)
+	_ KV = (*datastore.DB)(nil)
+)
+
+func startShards(t *testing.T, dir string, n int) ([]string, []*datastore.DB) {
+	t.Helper()
+	var urls []string
+	var dbs []*datastore.DB
+	for i := 0; i < n; i++ {
+		db, err := datastore.Open(filepath.Join(dir, fmt.Sprintf("shard%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		srv := httptest.NewServer(httpapi.Handler(db))
+		t.Cleanup(srv.Close)
+		urls = append(urls, srv.URL)
+		dbs = append(dbs, db)
+	}
+	return urls, dbs
+}
+
+func TestClient(t *testing.T) {
+	dir := "test_client"
+	defer os.RemoveAll(dir)
+
+	urls, dbs := startShards(t, dir, 3)
+	c, err := New(urls, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := c.Put(fmt.Sprintf("key%02d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := c.Get("key07"); err != nil || v != "value7" {
+		t.Fatalf("get: %q, %v", v, err)
+	}
+	if err := c.Delete("key07"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("key07"); !errors.Is(err, datastore.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// Ключ лежить лише на своєму шарді
+	for i, db := range dbs {
+		_, err := db.Get("key01")
+		if own := c.Shard("key01") == urls[i]; own != (err == nil) {
+			t.Errorf("shard %d: owns key01 = %v, has it: %v", i, own, err)
+		}
+	}
+
+	// Скан зливає шарди в порядку ключів
+	var keys []string
+	err = c.RangeScan("key10", "key20", func(key, value string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 10 || keys[0] != "key10" || keys[9] != "key19" {
+		t.Fatalf("unexpected scan %v", keys)
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Fatalf("scan out of order: %v", keys)
+		}
+	}
+	count := 0
+	if err := c.RangeScan("", "", func(string, string) bool { count++; return count < 5 }); err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expected scan to stop after 5 keys, got %d", count)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"key":"key","value":"value"}`))
+	}))
+	defer srv.Close()
+
+	c, err := New([]string{srv.URL}, Options{RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get("key"); err != nil || v != "value" {
+		t.Fatalf("expected success after retries, got %q, %v", v, err)
+	}
+
+	// Без повторів помилка шарда повертається одразу
+	calls.Store(0)
+	c, _ = New([]string{srv.URL}, Options{Retries: -1})
+	var se *StatusError
+	if _, err := c.Get("key"); !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 StatusError, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 call, got %d", calls.Load())
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	dir := "test_client_token"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	srv := httptest.NewServer(httpapi.RequireAuth(httpapi.Handler(db), httpapi.StaticTokens{"secret": httpapi.AccessWrite}))
+	defer srv.Close()
+
+	c, _ := New([]string{srv.URL}, Options{Token: "secret"})
+	if err := c.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	// Без токена сервер відмовляє, і запит не повторюється
+	c, _ = New([]string{srv.URL}, Options{})
+	var se *StatusError
+	if _, err := c.Get("key"); !errors.As(err, &se) || se.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/httpapi"
+)
+
+// lockPollInterval is how often Lock retries a held lock.
+const lockPollInterval = 50 * time.Millisecond
+
+// TryLock takes the lock named key on the shard that owns key, as
+// datastore.DB.TryLock does, and fails with datastore.ErrLocked while
+// someone else holds it. A retried request may find the lock taken by its
+// own first attempt; it then fails and the lock expires after ttl.
+func (c *Client) TryLock(key string, ttl time.Duration) (uint64, error) {
+	return c.TryLockContext(context.Background(), key, ttl)
+}
+
+func (c *Client) TryLockContext(ctx context.Context, key string, ttl time.Duration) (uint64, error) {
+	q := url.Values{"ttl": {ttl.String()}}
+	var resp httpapi.LockResponse
+	if err := c.do(ctx, c.Shard(key), http.MethodPost, lockPath(key)+"?"+q.Encode(), nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Token, nil
+}
+
+// Lock is TryLock waiting for the lock to be released or to expire, until
+// ctx is done.
+func (c *Client) Lock(ctx context.Context, key string, ttl time.Duration) (uint64, error) {
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		token, err := c.TryLockContext(ctx, key, ttl)
+		if !errors.Is(err, datastore.ErrLocked) {
+			return token, err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// Unlock releases the lock named key if token still holds it, and fails
+// with datastore.ErrNotLocked otherwise.
+func (c *Client) Unlock(key string, token uint64) error {
+	return c.UnlockContext(context.Background(), key, token)
+}
+
+func (c *Client) UnlockContext(ctx context.Context, key string, token uint64) error {
+	q := url.Values{"token": {strconv.FormatUint(token, 10)}}
+	return c.do(ctx, c.Shard(key), http.MethodDelete, lockPath(key)+"?"+q.Encode(), nil, nil)
+}
+
+func lockPath(key string) string {
+	return httpapi.LockPath + "/" + url.PathEscape(key)
+}
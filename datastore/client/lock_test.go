@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestClient_Lock(t *testing.T) {
+	dir := "test_client_lock"
+	defer os.RemoveAll(dir)
+
+	urls, _ := startShards(t, dir, 3)
+	c, err := New(urls, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := c.TryLock("job/1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.TryLock("job/1", time.Minute); !errors.Is(err, datastore.ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+	if err := c.Unlock("job/1", token+1); !errors.Is(err, datastore.ErrNotLocked) {
+		t.Errorf("expected ErrNotLocked, got %v", err)
+	}
+
+	// Lock чекає, доки власник не відпустить замок
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		c.Unlock("job/1", token)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	next, err := c.Lock(ctx, "job/1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= token {
+		t.Errorf("expected token above %d, got %d", token, next)
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// ring maps keys to shards by consistent hashing. Each shard owns many
+// points on the ring, so adding or removing one moves only about 1/N of
+// the keys and the load stays even.
+type ring struct {
+	points []uint64 // Sorted
+	owners []int    // Shard index of each point
+}
+
+func newRing(shards []string, vnodes int) *ring {
+	r := &ring{}
+	type point struct {
+		hash  uint64
+		owner int
+	}
+	points := make([]point, 0, len(shards)*vnodes)
+	for i, shard := range shards {
+		for v := 0; v < vnodes; v++ {
+			points = append(points, point{xxhash.Sum64String(shard + "#" + strconv.Itoa(v)), i})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	for _, p := range points {
+		r.points = append(r.points, p.hash)
+		r.owners = append(r.owners, p.owner)
+	}
+	return r
+}
+
+// owner returns the index of the shard owning key: the first point at or
+// after the key's hash, wrapping around.
+func (r *ring) owner(key string) int {
+	h := xxhash.Sum64String(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[i]
+}
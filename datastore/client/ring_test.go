@@ -0,0 +1,31 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing_BalanceAndStability(t *testing.T) {
+	shards := []string{"a", "b", "c", "d"}
+	r := newRing(shards, defaultVirtualNodes)
+
+	counts := make([]int, len(shards))
+	for i := 0; i < 10000; i++ {
+		counts[r.owner(fmt.Sprintf("key%d", i))]++
+	}
+	// Кожен шард отримує приблизно чверть ключів
+	for i, n := range counts {
+		if n < 1500 || n > 3500 {
+			t.Errorf("shard %s owns %d of 10000 keys", shards[i], n)
+		}
+	}
+
+	// Додавання шарда переносить лише ключі, що дістаються йому
+	grown := newRing(append(shards, "e"), defaultVirtualNodes)
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if o := grown.owner(key); o != 4 && o != r.owner(key) {
+			t.Fatalf("%s moved from %s to %s", key, shards[r.owner(key)], shards[o])
+		}
+	}
+}
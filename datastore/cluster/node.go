@@ -0,0 +1,247 @@
+// Package cluster replicates a datastore.DB over Raft. Nodes elect a
+// leader that serves linearizable Put, Delete and Get; the other nodes
+// follow its log and take over if it fails. A majority of nodes must be up
+// for the cluster to make progress, so three nodes tolerate one failure.
+//
+// The DB itself is the Raft snapshot: entries are dropped from the log once
+// they are applied and a merge of the DB completes, and followers too far
+// behind are sent an Export of the leader's DB. Only Put and Delete are
+// replicated; writing to Node.DB directly makes the nodes diverge.
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+const (
+	defaultElectionTimeout   = 300 * time.Millisecond
+	defaultHeartbeatInterval = 50 * time.Millisecond
+	defaultTrailingLogs      = 1024
+	raftDir                  = "raft"
+)
+
+var (
+	// ErrNotLeader is returned by operations sent to a node that is not
+	// the leader; Leader tells where to send them instead.
+	ErrNotLeader = errors.New("cluster: not the leader")
+	// ErrLeadershipLost is returned by writes whose leader stepped down
+	// before they committed. They may still be applied by the next leader.
+	ErrLeadershipLost = errors.New("cluster: leadership lost")
+	// ErrClosed is returned by operations on a closed node.
+	ErrClosed = errors.New("cluster: node is closed")
+)
+
+// Config configures a node.
+type Config struct {
+	// ID names the node; it must be unique and listed in Peers.
+	ID string
+	// Peers lists the IDs of every node of the cluster, this one included.
+	Peers []string
+	// Transport carries RPCs to the other nodes.
+	Transport Transport
+
+	// Dir holds the DB and, in its raft subdirectory, the Raft state.
+	Dir string
+	// Options opens the DB. Hooks.OnMergeComplete is wrapped to truncate
+	// the log.
+	Options datastore.Options
+
+	// ElectionTimeout is the minimum time without a leader before a
+	// follower stands for election; the actual timeout is randomised up to
+	// twice as long. Zero means 300ms.
+	ElectionTimeout time.Duration
+	// HeartbeatInterval is how often the leader contacts idle followers.
+	// Zero means 50ms.
+	HeartbeatInterval time.Duration
+	// TrailingLogs is the number of applied entries kept in the log after
+	// a truncation, so briefly lagging followers catch up without a
+	// snapshot. Zero means 1024.
+	TrailingLogs uint64
+}
+
+// Node is one member of a cluster.
+type Node struct {
+	id     string
+	peers  []string // Other nodes
+	cfg    Config
+	db     *datastore.DB
+	trans  Transport
+	store  *storage
+	logger *slog.Logger
+
+	// applyMu serialises changes of the DB: applying entries and
+	// installing snapshots. It is taken before mu.
+	applyMu sync.Mutex
+
+	mu sync.Mutex
+	raftState
+	closed bool
+
+	ctx    context.Context // Canceled by Close
+	cancel context.CancelFunc
+	wake   chan struct{} // Signals the applier
+	wg     sync.WaitGroup
+}
+
+// Open opens the DB and Raft state in cfg.Dir and starts the node as a
+// follower.
+func Open(cfg Config) (*Node, error) {
+	if !slices.Contains(cfg.Peers, cfg.ID) {
+		return nil, fmt.Errorf("cluster: node %q is not in peers %v", cfg.ID, cfg.Peers)
+	}
+	if cfg.ElectionTimeout <= 0 {
+		cfg.ElectionTimeout = defaultElectionTimeout
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if cfg.TrailingLogs == 0 {
+		cfg.TrailingLogs = defaultTrailingLogs
+	}
+	n := &Node{
+		id:     cfg.ID,
+		cfg:    cfg,
+		trans:  cfg.Transport,
+		logger: cfg.Options.Logger,
+		wake:   make(chan struct{}, 1),
+	}
+	for _, p := range cfg.Peers {
+		if p != cfg.ID {
+			n.peers = append(n.peers, p)
+		}
+	}
+
+	store, hs, entries, err := openStorage(filepath.Join(cfg.Dir, raftDir))
+	if err != nil {
+		return nil, err
+	}
+	n.store = store
+	n.initState(hs, entries)
+
+	opts := cfg.Options
+	hooks := datastore.Hooks{}
+	if opts.Hooks != nil {
+		hooks = *opts.Hooks
+	}
+	onMerge := hooks.OnMergeComplete
+	hooks.OnMergeComplete = func(rec datastore.CompactionRecord) {
+		if rec.Err == "" {
+			n.truncateLog()
+		}
+		if onMerge != nil {
+			onMerge(rec)
+		}
+	}
+	opts.Hooks = &hooks
+	if n.db, err = datastore.OpenWithOptions(cfg.Dir, opts); err != nil {
+		store.close()
+		return nil, err
+	}
+
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	n.wg.Add(2)
+	go n.ticker()
+	go n.applier()
+	return n, nil
+}
+
+// ID returns the node's ID.
+func (n *Node) ID() string { return n.id }
+
+// DB returns the node's local DB. Reads from it may be stale; use Get for
+// linearizable reads.
+func (n *Node) DB() *datastore.DB { return n.db }
+
+// Leader returns the ID of the current leader as far as this node knows,
+// or "" if it does not know one.
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader
+}
+
+// IsLeader reports whether this node is the leader.
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role == leader
+}
+
+// ReplicationLag returns how long ago the leader appended the oldest entry
+// each other node is missing, zero for one that has them all, as
+// status.Config wants it. Only the leader knows; other nodes return nil.
+func (n *Node) ReplicationLag() map[string]time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.role != leader {
+		return nil
+	}
+	now := time.Now()
+	lag := make(map[string]time.Duration, len(n.peers))
+	for _, p := range n.peers {
+		if n.matchIndex[p] >= n.lastIndex() {
+			lag[p] = 0
+		} else {
+			lag[p] = now.Sub(n.appendTime(n.matchIndex[p] + 1))
+		}
+	}
+	return lag
+}
+
+// Put sets key to value on every node. It returns once the write is
+// committed and applied on this node, which must be the leader.
+func (n *Node) Put(ctx context.Context, key, value string) error {
+	return n.propose(ctx, Command{Op: OpPut, Key: key, Value: value})
+}
+
+// Delete removes key on every node, like Put.
+func (n *Node) Delete(ctx context.Context, key string) error {
+	return n.propose(ctx, Command{Op: OpDelete, Key: key})
+}
+
+// Get returns the value of key as of the moment it is called: every write
+// that completed before is visible. It must be sent to the leader, which
+// checks with a majority that it still leads before reading.
+func (n *Node) Get(ctx context.Context, key string) (string, error) {
+	if err := n.readBarrier(ctx); err != nil {
+		return "", err
+	}
+	return n.db.Get(key)
+}
+
+// Close stops the node and closes its DB. Pending operations fail with
+// ErrClosed.
+func (n *Node) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	n.cancel()
+	n.failWaiters(ErrClosed)
+	n.mu.Unlock()
+	n.wg.Wait()
+
+	err := n.db.Close()
+	if serr := n.store.close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+func (n *Node) log(level slog.Level, msg string, args ...any) {
+	if n.logger == nil || !n.logger.Enabled(context.Background(), level) {
+		return
+	}
+	n.logger.Log(context.Background(), level, msg, append([]any{"node", n.id}, args...)...)
+}
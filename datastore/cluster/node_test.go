@@ -0,0 +1,477 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/testutil"
+)
+
+var testIDs = []string{"n1", "n2", "n3"}
+
+type testCluster struct {
+	t     *testing.T
+	dir   string
+	net   *MemNetwork
+	nodes map[string]*Node
+	cfg   func(id string) Config
+}
+
+func newTestCluster(t *testing.T, dir string, trailing uint64) *testCluster {
+	t.Helper()
+	c := &testCluster{t: t, dir: dir, net: NewMemNetwork(), nodes: make(map[string]*Node)}
+	c.cfg = func(id string) Config {
+		return Config{
+			ID:                id,
+			Peers:             testIDs,
+			Transport:         c.net.Transport(id),
+			Dir:               filepath.Join(dir, id),
+			ElectionTimeout:   50 * time.Millisecond,
+			HeartbeatInterval: 10 * time.Millisecond,
+			TrailingLogs:      trailing,
+		}
+	}
+	for _, id := range testIDs {
+		c.start(id)
+	}
+	return c
+}
+
+func (c *testCluster) start(id string) {
+	c.t.Helper()
+	n, err := Open(c.cfg(id))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.net.Register(n)
+	c.nodes[id] = n
+}
+
+func (c *testCluster) close() {
+	for _, n := range c.nodes {
+		n.Close()
+	}
+}
+
+// leader waits for a single leader among the connected nodes.
+func (c *testCluster) leader(except string) *Node {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for id, n := range c.nodes {
+			if id != except && n.IsLeader() {
+				return n
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.t.Fatal("no leader elected")
+	return nil
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func hasValue(n *Node, key, value string) bool {
+	v, err := n.DB().Get(key)
+	return err == nil && v == value
+}
+
+func TestCluster_ReplicatesAndFailsOver(t *testing.T) {
+	dir := "test_cluster_failover"
+	defer os.RemoveAll(dir)
+
+	c := newTestCluster(t, dir, 0)
+	defer c.close()
+	ctx := context.Background()
+
+	l := c.leader("")
+	if err := l.Put(ctx, "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := l.Get(ctx, "key"); err != nil || v != "value" {
+		t.Fatalf("leader read %q, %v", v, err)
+	}
+	for _, n := range c.nodes {
+		waitFor(t, func() bool { return hasValue(n, "key", "value") })
+	}
+
+	// Послідовники не приймають записів
+	for _, n := range c.nodes {
+		if n != l {
+			if err := n.Put(ctx, "key", "other"); !errors.Is(err, ErrNotLeader) {
+				t.Errorf("%s: expected ErrNotLeader, got %v", n.ID(), err)
+			}
+			if _, err := n.Get(ctx, "key"); !errors.Is(err, ErrNotLeader) {
+				t.Errorf("%s: expected ErrNotLeader on read, got %v", n.ID(), err)
+			}
+		}
+	}
+
+	// Відрізаний послідовник відстає, поки лідер пише
+	var follower *Node
+	for _, n := range c.nodes {
+		if n != l {
+			follower = n
+			break
+		}
+	}
+	waitFor(t, func() bool { return l.ReplicationLag()[follower.ID()] == 0 })
+	if lag := follower.ReplicationLag(); lag != nil {
+		t.Errorf("expected no lag known to a follower, got %v", lag)
+	}
+	c.net.Disconnect(follower.ID())
+	if err := l.Put(ctx, "lagging", "x"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if lag := l.ReplicationLag()[follower.ID()]; lag < 50*time.Millisecond {
+		t.Errorf("expected the disconnected follower to lag, got %v", lag)
+	}
+	c.net.Reconnect(follower.ID())
+	waitFor(t, func() bool { return l.ReplicationLag()[follower.ID()] == 0 })
+
+	// Ізольований лідер не може підтвердити читання, решта обирає нового
+	c.net.Disconnect(l.ID())
+	readCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	_, err := l.Get(readCtx, "key")
+	cancel()
+	if err == nil {
+		t.Error("expected isolated leader to refuse a linearizable read")
+	}
+	l2 := c.leader(l.ID())
+	if err := l2.Put(ctx, "key", "value2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Delete(ctx, "gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Старий лідер повертається послідовником і наздоганяє
+	c.net.Reconnect(l.ID())
+	waitFor(t, func() bool { return !l.IsLeader() && hasValue(l, "key", "value2") })
+	if got := l.Leader(); got != l2.ID() {
+		t.Errorf("expected old leader to follow %s, got %q", l2.ID(), got)
+	}
+}
+
+func TestCluster_LagBoundedUnderWrites(t *testing.T) {
+	dir := "test_cluster_lag"
+	defer os.RemoveAll(dir)
+
+	// Повільна мережа: поки відповідь іде, лідер уже дописує нові записи
+	c := newTestCluster(t, dir, 0)
+	defer c.close()
+	c.close()
+	base := c.cfg
+	c.cfg = func(id string) Config {
+		cfg := base(id)
+		cfg.Transport = slowTransport{cfg.Transport, 5 * time.Millisecond}
+		return cfg
+	}
+	for _, id := range testIDs {
+		c.start(id)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l := c.leader("")
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ctx.Err() == nil; i++ {
+				l.Put(ctx, fmt.Sprintf("w%d", w), strconv.Itoa(i))
+			}
+		}()
+	}
+
+	// Послідовники весь час трохи позаду, але відставання не накопичується
+	var worst time.Duration
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, lag := range l.ReplicationLag() {
+			worst = max(worst, lag)
+		}
+	}
+	cancel()
+	wg.Wait()
+	if worst > 250*time.Millisecond {
+		t.Errorf("lag reached %v under steady writes", worst)
+	}
+}
+
+// slowTransport delays every AppendEntries by delay.
+type slowTransport struct {
+	Transport
+	delay time.Duration
+}
+
+func (t slowTransport) Append(ctx context.Context, peer string, req *AppendRequest) (*AppendResponse, error) {
+	time.Sleep(t.delay)
+	return t.Transport.Append(ctx, peer, req)
+}
+
+func TestCluster_SnapshotAfterMerge(t *testing.T) {
+	dir := "test_cluster_snapshot"
+	defer os.RemoveAll(dir)
+
+	// Дрібні сегменти, щоб злиття мало що зливати
+	t.Setenv("SEG_MAX", "300")
+
+	c := newTestCluster(t, dir, 2)
+	defer c.close()
+	ctx := context.Background()
+
+	l := c.leader("")
+	var lagging *Node
+	for _, n := range c.nodes {
+		if n != l {
+			lagging = n
+			break
+		}
+	}
+	if err := l.Put(ctx, "stale", "value"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return hasValue(lagging, "stale", "value") })
+
+	c.net.Disconnect(lagging.ID())
+	for i := 0; i < 30; i++ {
+		if err := l.Put(ctx, fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Delete(ctx, "stale"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Злиття обрізає журнал лідера до останніх записів
+	if err := l.DB().Merge(); err != nil {
+		t.Fatal(err)
+	}
+	l.mu.Lock()
+	snapshotIndex, entries := l.snapshotIndex, len(l.entries)
+	l.mu.Unlock()
+	if snapshotIndex == 0 || entries > 2 {
+		t.Fatalf("expected log to be truncated, snapshot at %d with %d entries", snapshotIndex, entries)
+	}
+
+	// Відсталий вузол отримує знімок
+	c.net.Reconnect(lagging.ID())
+	waitFor(t, func() bool { return hasValue(lagging, "key29", "value29") })
+	if _, err := lagging.DB().Get("stale"); !errors.Is(err, datastore.ErrNotFound) {
+		t.Errorf("expected key deleted before the snapshot to be gone, got %v", err)
+	}
+}
+
+func TestCluster_Restart(t *testing.T) {
+	dir := "test_cluster_restart"
+	defer os.RemoveAll(dir)
+
+	c := newTestCluster(t, dir, 0)
+	defer c.close()
+	ctx := context.Background()
+
+	l := c.leader("")
+	if err := l.Put(ctx, "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	l.mu.Lock()
+	term := l.term
+	l.mu.Unlock()
+
+	// Перезапуск усіх вузлів зберігає журнал, термін і дані
+	c.close()
+	for _, id := range testIDs {
+		c.start(id)
+	}
+	l = c.leader("")
+	l.mu.Lock()
+	newTerm := l.term
+	l.mu.Unlock()
+	if newTerm <= term {
+		t.Errorf("expected term to grow past %d, got %d", term, newTerm)
+	}
+	if v, err := l.Get(ctx, "key"); err != nil || v != "value" {
+		t.Fatalf("read after restart: %q, %v", v, err)
+	}
+	if err := l.Put(ctx, "key", "value2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCluster_PartitionedLeaderLosesWrites(t *testing.T) {
+	dir := "test_cluster_partition"
+	defer os.RemoveAll(dir)
+
+	c := newTestCluster(t, dir, 0)
+	defer c.close()
+	ctx := context.Background()
+
+	l := c.leader("")
+	if err := l.Put(ctx, "key", "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Лідер у меншості не може зафіксувати запис
+	c.net.Disconnect(l.ID())
+	lostCtx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	err := l.Put(lostCtx, "lost", "x")
+	cancel()
+	if err == nil {
+		t.Fatal("expected the minority leader to fail the write")
+	}
+
+	// Більшість обирає нового лідера й приймає записи
+	l2 := c.leader(l.ID())
+	if err := l2.Put(ctx, "key", "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Після відновлення мережі незафіксований запис зникає скрізь
+	c.net.Reconnect(l.ID())
+	waitFor(t, func() bool { return !l.IsLeader() && hasValue(l, "key", "v2") })
+	for _, n := range c.nodes {
+		waitFor(t, func() bool { return hasValue(n, "key", "v2") })
+		if _, err := n.DB().Get("lost"); !errors.Is(err, datastore.ErrNotFound) {
+			t.Errorf("%s: expected the uncommitted write dropped, got %v", n.ID(), err)
+		}
+	}
+	if err := c.leader("").Put(ctx, "after", "heal"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCluster_LeaderCrash(t *testing.T) {
+	dir := "test_cluster_leader_crash"
+	defer os.RemoveAll(dir)
+
+	c := newTestCluster(t, dir, 0)
+	defer c.close()
+	ctx := context.Background()
+
+	l := c.leader("")
+	for i := 0; i < 10; i++ {
+		if err := l.Put(ctx, fmt.Sprintf("key%d", i), "v1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Лідер падає, решта обирає нового без втрати зафіксованих записів
+	crashed := l.ID()
+	l.Close()
+	l2 := c.leader(crashed)
+	for i := 0; i < 10; i++ {
+		if v, err := l2.Get(ctx, fmt.Sprintf("key%d", i)); err != nil || v != "v1" {
+			t.Fatalf("key%d on new leader = %q, %v", i, v, err)
+		}
+	}
+	for i := 5; i < 15; i++ {
+		if err := l2.Put(ctx, fmt.Sprintf("key%d", i), "v2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Перезапущений вузол стає послідовником і наздоганяє
+	c.start(crashed)
+	n := c.nodes[crashed]
+	waitFor(t, func() bool { return hasValue(n, "key14", "v2") && n.Leader() == l2.ID() })
+	for i := 0; i < 15; i++ {
+		want := "v1"
+		if i >= 5 {
+			want = "v2"
+		}
+		if !hasValue(n, fmt.Sprintf("key%d", i), want) {
+			t.Errorf("key%d on the restarted node is not %q", i, want)
+		}
+	}
+	waitFor(t, func() bool { return l2.ReplicationLag()[crashed] == 0 })
+}
+
+func TestOpen_NotInPeers(t *testing.T) {
+	_, err := Open(Config{ID: "n4", Peers: testIDs, Dir: "test_cluster_peers"})
+	if err == nil {
+		t.Error("expected error for a node missing from peers")
+	}
+}
+
+func TestCluster_TruncateAfterCrash(t *testing.T) {
+	dir := "test_cluster_truncate_crash"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "300")
+
+	// База на FaultFS втрачає все несинхронізоване, стан Raft — на диску
+	fsys := testutil.NewFaultFS(nil)
+	net := NewMemNetwork()
+	cfg := Config{
+		ID:                "n1",
+		Peers:             []string{"n1"},
+		Transport:         net.Transport("n1"),
+		Dir:               dir,
+		Options:           datastore.Options{FS: fsys},
+		ElectionTimeout:   50 * time.Millisecond,
+		HeartbeatInterval: 10 * time.Millisecond,
+		TrailingLogs:      1,
+	}
+	n, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	net.Register(n)
+	waitFor(t, n.IsLeader)
+	ctx := context.Background()
+	for i := 0; i < 30; i++ {
+		if err := n.Put(ctx, fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := n.DB().Merge(); err != nil {
+		t.Fatal(err)
+	}
+	n.mu.Lock()
+	snapshotIndex := n.snapshotIndex
+	n.mu.Unlock()
+	if snapshotIndex == 0 {
+		t.Fatal("expected the log to be truncated")
+	}
+
+	crashed, err := fsys.Crash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Close()
+	cfg.Options.FS = crashed
+	net = NewMemNetwork()
+	cfg.Transport = net.Transport("n1")
+	if n, err = Open(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	net.Register(n)
+	waitFor(t, n.IsLeader)
+	// Записи, викинуті з журналу, мають бути в базі
+	for i := 0; i < 30; i++ {
+		key, want := fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)
+		if v, err := n.Get(ctx, key); err != nil || v != want {
+			t.Errorf("Get(%s) = %q, %v", key, v, err)
+		}
+	}
+}
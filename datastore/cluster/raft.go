@@ -0,0 +1,827 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// maxAppendEntries caps the entries sent in one AppendEntries RPC.
+const maxAppendEntries = 256
+
+// Op is the operation of a Command.
+type Op string
+
+const (
+	OpPut    Op = "put"
+	OpDelete Op = "delete"
+	// OpNoop is appended by every new leader to commit the entries of
+	// earlier terms.
+	OpNoop Op = "noop"
+)
+
+// Command is a replicated write.
+type Command struct {
+	Op    Op     `json:"op"`
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// LogEntry is one entry of the replicated log.
+type LogEntry struct {
+	Index   uint64  `json:"index"`
+	Term    uint64  `json:"term"`
+	Command Command `json:"command"`
+}
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+// waiter is a write waiting to be applied.
+type waiter struct {
+	term uint64
+	done chan error
+}
+
+// raftState is the Raft state of a node, guarded by Node.mu.
+type raftState struct {
+	role     role
+	term     uint64
+	votedFor string
+	leader   string
+
+	entries       []LogEntry // Entries after snapshotIndex
+	snapshotIndex uint64
+	snapshotTerm  uint64
+	commitIndex   uint64
+	lastApplied   uint64
+	applied       chan struct{} // Closed and replaced whenever lastApplied grows
+
+	electionDeadline time.Time
+	lastBroadcast    time.Time
+
+	// Leader state.
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	appendedAt map[uint64]time.Time // When each entry of the log was appended
+	inflight   map[string]bool      // A replicate goroutine runs for the peer
+	pending    map[string]bool      // More to send once the running one is done
+	noopIndex  uint64               // First entry of the current term
+	waiters    map[uint64]waiter
+	// appendedBefore stands in for the append time of entries missing
+	// from appendedAt: those of earlier leaders and those truncated.
+	appendedBefore time.Time
+}
+
+func (n *Node) initState(hs hardState, entries []LogEntry) {
+	n.term, n.votedFor = hs.Term, hs.VotedFor
+	n.snapshotIndex, n.snapshotTerm = hs.SnapshotIndex, hs.SnapshotTerm
+	n.entries = entries
+	// The DB holds every entry up to the snapshot and possibly later ones;
+	// reapplying those is harmless as Put and Delete overwrite.
+	n.commitIndex, n.lastApplied = hs.SnapshotIndex, hs.SnapshotIndex
+	n.applied = make(chan struct{})
+	n.waiters = make(map[uint64]waiter)
+	n.resetElectionDeadline()
+}
+
+func (n *Node) hardState() hardState {
+	return hardState{Term: n.term, VotedFor: n.votedFor, SnapshotIndex: n.snapshotIndex, SnapshotTerm: n.snapshotTerm}
+}
+
+func (n *Node) lastIndex() uint64 {
+	return n.snapshotIndex + uint64(len(n.entries))
+}
+
+func (n *Node) lastTerm() uint64 {
+	if len(n.entries) == 0 {
+		return n.snapshotTerm
+	}
+	return n.entries[len(n.entries)-1].Term
+}
+
+// termAt returns the term of the entry at index, which must not be before
+// the snapshot or after the last entry.
+func (n *Node) termAt(index uint64) uint64 {
+	if index == n.snapshotIndex {
+		return n.snapshotTerm
+	}
+	return n.entries[index-n.snapshotIndex-1].Term
+}
+
+func (n *Node) entryAt(index uint64) LogEntry {
+	return n.entries[index-n.snapshotIndex-1]
+}
+
+func (n *Node) quorum() int {
+	return (len(n.peers)+1)/2 + 1
+}
+
+func (n *Node) resetElectionDeadline() {
+	timeout := n.cfg.ElectionTimeout + time.Duration(rand.Int63n(int64(n.cfg.ElectionTimeout)))
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+// ticker starts elections and sends heartbeats.
+func (n *Node) ticker() {
+	defer n.wg.Done()
+	t := time.NewTicker(n.cfg.HeartbeatInterval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-n.ctx.Done():
+			return
+		}
+		n.mu.Lock()
+		switch {
+		case n.role == leader:
+			if time.Since(n.lastBroadcast) >= n.cfg.HeartbeatInterval {
+				n.broadcast()
+			}
+		case time.Now().After(n.electionDeadline):
+			n.startElection()
+		}
+		n.mu.Unlock()
+	}
+}
+
+// persist saves the hard state. The caller must hold n.mu.
+func (n *Node) persist() error {
+	return n.store.saveState(n.hardState())
+}
+
+// stepDown makes the node a follower, adopting term if it is newer. The
+// caller must hold n.mu.
+func (n *Node) stepDown(term uint64) error {
+	if n.role == leader {
+		n.log(slog.LevelInfo, "stepped down", "term", n.term)
+		n.failWaiters(ErrLeadershipLost)
+	}
+	n.role = follower
+	if term > n.term {
+		n.term, n.votedFor, n.leader = term, "", ""
+		n.resetElectionDeadline()
+		return n.persist()
+	}
+	return nil
+}
+
+// startElection stands for election in a new term. The caller must hold
+// n.mu.
+func (n *Node) startElection() {
+	n.role = candidate
+	n.term++
+	n.votedFor, n.leader = n.id, ""
+	n.resetElectionDeadline()
+	if err := n.persist(); err != nil {
+		n.log(slog.LevelError, "persisting vote failed", "err", err)
+		return
+	}
+	n.log(slog.LevelInfo, "election started", "term", n.term)
+
+	req := &VoteRequest{Term: n.term, Candidate: n.id, LastLogIndex: n.lastIndex(), LastLogTerm: n.lastTerm()}
+	votes := 1
+	if votes >= n.quorum() {
+		n.becomeLeader()
+		return
+	}
+	for _, peer := range n.peers {
+		peer := peer
+		n.goRPC(func() {
+			resp, err := n.callVote(peer, req)
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if err != nil || n.closed {
+				return
+			}
+			if resp.Term > n.term {
+				n.stepDown(resp.Term)
+				return
+			}
+			if n.role != candidate || n.term != req.Term || !resp.Granted {
+				return
+			}
+			if votes++; votes == n.quorum() {
+				n.becomeLeader()
+			}
+		})
+	}
+}
+
+func (n *Node) callVote(peer string, req *VoteRequest) (*VoteResponse, error) {
+	ctx, cancel := context.WithTimeout(n.ctx, n.cfg.ElectionTimeout)
+	defer cancel()
+	return n.trans.Vote(ctx, peer, req)
+}
+
+// goRPC runs fn on a goroutine that Close waits for. The caller must hold
+// n.mu.
+func (n *Node) goRPC(fn func()) {
+	if n.closed {
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		fn()
+	}()
+}
+
+// becomeLeader takes over leadership and appends a no-op, which commits
+// the entries left by earlier leaders once it commits. The caller must hold
+// n.mu.
+func (n *Node) becomeLeader() {
+	n.role, n.leader = leader, n.id
+	n.nextIndex = make(map[string]uint64)
+	n.matchIndex = make(map[string]uint64)
+	n.appendedAt = make(map[uint64]time.Time)
+	n.appendedBefore = time.Now()
+	n.inflight = make(map[string]bool)
+	n.pending = make(map[string]bool)
+	for _, p := range n.peers {
+		n.nextIndex[p] = n.lastIndex() + 1
+	}
+	n.log(slog.LevelInfo, "became leader", "term", n.term)
+	n.noopIndex = n.lastIndex() + 1
+	if _, err := n.appendLocal(Command{Op: OpNoop}); err != nil {
+		n.log(slog.LevelError, "appending no-op failed", "err", err)
+		n.stepDown(n.term)
+		return
+	}
+	n.broadcast()
+}
+
+// appendLocal appends cmd to the leader's log. The caller must hold n.mu.
+func (n *Node) appendLocal(cmd Command) (LogEntry, error) {
+	e := LogEntry{Index: n.lastIndex() + 1, Term: n.term, Command: cmd}
+	if err := n.store.append([]LogEntry{e}); err != nil {
+		return e, err
+	}
+	n.entries = append(n.entries, e)
+	n.appendedAt[e.Index] = time.Now()
+	n.advanceCommit()
+	return e, nil
+}
+
+// broadcast replicates the log to every follower. The caller must hold
+// n.mu.
+func (n *Node) broadcast() {
+	n.lastBroadcast = time.Now()
+	for _, peer := range n.peers {
+		if n.inflight[peer] {
+			n.pending[peer] = true
+			continue
+		}
+		n.inflight[peer] = true
+		peer := peer
+		n.goRPC(func() { n.replicate(peer) })
+	}
+}
+
+// replicate sends entries or a snapshot to peer until it has caught up.
+func (n *Node) replicate(peer string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer func() { n.inflight[peer] = false }()
+	for n.role == leader && !n.closed {
+		term := n.term
+		next := n.nextIndex[peer]
+		var err error
+		if next <= n.snapshotIndex {
+			err = n.sendSnapshot(peer, term)
+		} else {
+			err = n.sendEntries(peer, term, next)
+		}
+		if err != nil || n.role != leader || n.term != term {
+			return
+		}
+		if n.nextIndex[peer] > n.lastIndex() && !n.pending[peer] {
+			return
+		}
+		n.pending[peer] = false
+	}
+}
+
+// sendEntries sends the entries from next on. It is called with n.mu held
+// and releases it during the RPC.
+func (n *Node) sendEntries(peer string, term, next uint64) error {
+	prev := next - 1
+	end := min(n.lastIndex(), prev+maxAppendEntries)
+	req := &AppendRequest{
+		Term:         term,
+		Leader:       n.id,
+		PrevLogIndex: prev,
+		PrevLogTerm:  n.termAt(prev),
+		Entries:      append([]LogEntry(nil), n.entries[prev-n.snapshotIndex:end-n.snapshotIndex]...),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+	ctx, cancel := context.WithTimeout(n.ctx, n.cfg.ElectionTimeout)
+	resp, err := n.trans.Append(ctx, peer, req)
+	cancel()
+	n.mu.Lock()
+	if err != nil {
+		return err
+	}
+	if resp.Term > n.term {
+		return n.stepDown(resp.Term)
+	}
+	if n.role != leader || n.term != term {
+		return nil
+	}
+	if resp.Success {
+		match := prev + uint64(len(req.Entries))
+		n.matchIndex[peer] = max(n.matchIndex[peer], match)
+		n.nextIndex[peer] = max(n.nextIndex[peer], match+1)
+		n.advanceCommit()
+		return nil
+	}
+	// Back up to the follower's last entry at most, and retry.
+	n.nextIndex[peer] = max(1, min(next-1, resp.LastIndex+1))
+	return nil
+}
+
+// appendTime returns when the leader appended the entry at index. The
+// caller must hold n.mu.
+func (n *Node) appendTime(index uint64) time.Time {
+	if t, ok := n.appendedAt[index]; ok {
+		return t
+	}
+	return n.appendedBefore
+}
+
+// sendSnapshot sends an export of the DB to a follower that needs entries
+// already dropped from the log. It is called with n.mu held and releases it
+// while the snapshot is taken and sent.
+func (n *Node) sendSnapshot(peer string, term uint64) error {
+	n.mu.Unlock()
+	snap, err := n.snapshot()
+	if err != nil {
+		n.mu.Lock()
+		return err
+	}
+	snap.Term, snap.Leader = term, n.id
+	ctx, cancel := context.WithTimeout(n.ctx, 10*n.cfg.ElectionTimeout)
+	resp, err := n.trans.InstallSnapshot(ctx, peer, snap)
+	cancel()
+	n.mu.Lock()
+	if err != nil {
+		return err
+	}
+	if resp.Term > n.term {
+		return n.stepDown(resp.Term)
+	}
+	if n.role == leader && n.term == term {
+		n.matchIndex[peer] = max(n.matchIndex[peer], snap.LastIndex)
+		n.nextIndex[peer] = max(n.nextIndex[peer], snap.LastIndex+1)
+		n.log(slog.LevelInfo, "snapshot sent", "peer", peer, "index", snap.LastIndex, "bytes", len(snap.Data))
+	}
+	return nil
+}
+
+// snapshot exports the DB as of the last applied entry.
+func (n *Node) snapshot() (*SnapshotRequest, error) {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	req := &SnapshotRequest{LastIndex: n.lastApplied, LastTerm: n.termAt(n.lastApplied)}
+	n.mu.Unlock()
+	var buf bytes.Buffer
+	if err := n.db.Export(&buf); err != nil {
+		return nil, err
+	}
+	req.Data = buf.Bytes()
+	return req, nil
+}
+
+// advanceCommit commits the entries of the current term a majority has
+// stored. The caller must hold n.mu.
+func (n *Node) advanceCommit() {
+	if n.role != leader {
+		return
+	}
+	for index := n.lastIndex(); index > n.commitIndex && n.termAt(index) == n.term; index-- {
+		count := 1
+		for _, p := range n.peers {
+			if n.matchIndex[p] >= index {
+				count++
+			}
+		}
+		if count >= n.quorum() {
+			n.commitIndex = index
+			n.signalApplier()
+			return
+		}
+	}
+}
+
+func (n *Node) signalApplier() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// applier applies committed entries to the DB in order.
+func (n *Node) applier() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.wake:
+		case <-n.ctx.Done():
+			return
+		}
+		for n.applyNext() {
+		}
+	}
+}
+
+// applyNext applies the entry after lastApplied if it is committed and
+// reports whether it did.
+func (n *Node) applyNext() bool {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	if n.closed || n.lastApplied >= n.commitIndex {
+		n.mu.Unlock()
+		return false
+	}
+	e := n.entryAt(n.lastApplied + 1)
+	n.mu.Unlock()
+
+	var err error
+	switch e.Command.Op {
+	case OpPut:
+		err = n.db.Put(e.Command.Key, e.Command.Value)
+	case OpDelete:
+		err = n.db.Delete(e.Command.Key)
+	}
+	if err != nil {
+		n.log(slog.LevelError, "applying entry failed", "index", e.Index, "err", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lastApplied = e.Index
+	close(n.applied)
+	n.applied = make(chan struct{})
+	if w, ok := n.waiters[e.Index]; ok {
+		delete(n.waiters, e.Index)
+		if w.term != e.Term {
+			err = ErrLeadershipLost
+		}
+		w.done <- err
+	}
+	return true
+}
+
+// failWaiters fails every pending write. The caller must hold n.mu.
+func (n *Node) failWaiters(err error) {
+	for index, w := range n.waiters {
+		w.done <- err
+		delete(n.waiters, index)
+	}
+}
+
+func (n *Node) propose(ctx context.Context, cmd Command) error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return ErrClosed
+	}
+	if n.role != leader {
+		leader := n.leader
+		n.mu.Unlock()
+		return fmt.Errorf("%w: leader is %q", ErrNotLeader, leader)
+	}
+	e, err := n.appendLocal(cmd)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	done := make(chan error, 1)
+	n.waiters[e.Index] = waiter{term: e.Term, done: done}
+	n.broadcast()
+	n.mu.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		n.mu.Lock()
+		delete(n.waiters, e.Index)
+		n.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// readBarrier returns once this node has applied every write committed
+// before it was called, having confirmed that it still leads.
+func (n *Node) readBarrier(ctx context.Context) error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return ErrClosed
+	}
+	if n.role != leader {
+		leader := n.leader
+		n.mu.Unlock()
+		return fmt.Errorf("%w: leader is %q", ErrNotLeader, leader)
+	}
+	// Until the no-op commits, commitIndex may lag behind what earlier
+	// leaders committed.
+	readIndex := max(n.commitIndex, n.noopIndex)
+	term := n.term
+	n.mu.Unlock()
+
+	if err := n.confirmLeadership(ctx, term); err != nil {
+		return err
+	}
+	for {
+		n.mu.Lock()
+		applied, ch := n.lastApplied, n.applied
+		closed := n.closed
+		n.mu.Unlock()
+		if closed {
+			return ErrClosed
+		}
+		if applied >= readIndex {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// confirmLeadership checks that a majority still accepts this node as the
+// leader of term, so no newer leader can have committed writes it misses.
+func (n *Node) confirmLeadership(ctx context.Context, term uint64) error {
+	acks := make(chan bool, len(n.peers))
+	n.mu.Lock()
+	if n.role != leader || n.term != term {
+		n.mu.Unlock()
+		return fmt.Errorf("%w: lost term %d", ErrNotLeader, term)
+	}
+	for _, peer := range n.peers {
+		peer := peer
+		prev := n.nextIndex[peer] - 1
+		if prev < n.snapshotIndex {
+			prev = n.snapshotIndex
+		}
+		req := &AppendRequest{Term: term, Leader: n.id, PrevLogIndex: prev, PrevLogTerm: n.termAt(prev), LeaderCommit: n.commitIndex}
+		n.goRPC(func() {
+			ctx, cancel := context.WithTimeout(ctx, n.cfg.ElectionTimeout)
+			defer cancel()
+			resp, err := n.trans.Append(ctx, peer, req)
+			if err == nil && resp.Term > term {
+				n.mu.Lock()
+				n.stepDown(resp.Term)
+				n.mu.Unlock()
+			}
+			acks <- err == nil && resp.Term == term
+		})
+	}
+	n.mu.Unlock()
+
+	votes := 1
+	for i := 0; i < len(n.peers) && votes < n.quorum(); i++ {
+		select {
+		case ok := <-acks:
+			if ok {
+				votes++
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if votes < n.quorum() {
+		return fmt.Errorf("%w: no majority confirmed term %d", ErrNotLeader, term)
+	}
+	return nil
+}
+
+// truncateLog drops applied entries from the log, keeping TrailingLogs of
+// them. The DB stands in for the dropped entries, so it is flushed to disk
+// first: without Options.SyncWrites they may not be there yet.
+func (n *Node) truncateLog() {
+	n.mu.Lock()
+	applied := n.lastApplied
+	n.mu.Unlock()
+	if err := n.db.Flush(); err != nil {
+		n.log(slog.LevelError, "truncating log failed", "err", err)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed || applied <= n.snapshotIndex+n.cfg.TrailingLogs {
+		return
+	}
+	upTo := applied - n.cfg.TrailingLogs
+	hs := n.hardState()
+	hs.SnapshotIndex, hs.SnapshotTerm = upTo, n.termAt(upTo)
+	// The state goes first: entries it marks as snapshotted are skipped
+	// on load should the log rewrite not happen.
+	if err := n.store.saveState(hs); err != nil {
+		n.log(slog.LevelError, "truncating log failed", "err", err)
+		return
+	}
+	kept := append([]LogEntry(nil), n.entries[upTo-n.snapshotIndex:]...)
+	if n.role == leader {
+		n.appendedBefore = n.appendTime(upTo)
+		for i := n.snapshotIndex + 1; i <= upTo; i++ {
+			delete(n.appendedAt, i)
+		}
+	}
+	n.snapshotIndex, n.snapshotTerm, n.entries = hs.SnapshotIndex, hs.SnapshotTerm, kept
+	if err := n.store.rewrite(kept); err != nil {
+		n.log(slog.LevelError, "truncating log failed", "err", err)
+		return
+	}
+	n.log(slog.LevelInfo, "log truncated", "index", upTo, "entries", len(kept))
+}
+
+// HandleVote answers a RequestVote RPC.
+func (n *Node) HandleVote(req *VoteRequest) (*VoteResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrClosed
+	}
+	if req.Term > n.term {
+		if err := n.stepDown(req.Term); err != nil {
+			return nil, err
+		}
+	}
+	resp := &VoteResponse{Term: n.term}
+	if req.Term < n.term || (n.votedFor != "" && n.votedFor != req.Candidate) {
+		return resp, nil
+	}
+	upToDate := req.LastLogTerm > n.lastTerm() ||
+		(req.LastLogTerm == n.lastTerm() && req.LastLogIndex >= n.lastIndex())
+	if !upToDate {
+		return resp, nil
+	}
+	n.votedFor = req.Candidate
+	if err := n.persist(); err != nil {
+		return nil, err
+	}
+	n.resetElectionDeadline()
+	resp.Granted = true
+	return resp, nil
+}
+
+// HandleAppend answers an AppendEntries RPC.
+func (n *Node) HandleAppend(req *AppendRequest) (*AppendResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrClosed
+	}
+	if req.Term < n.term {
+		return &AppendResponse{Term: n.term, LastIndex: n.lastIndex()}, nil
+	}
+	if req.Term > n.term || n.role != follower {
+		if err := n.stepDown(req.Term); err != nil {
+			return nil, err
+		}
+	}
+	n.leader = req.Leader
+	n.resetElectionDeadline()
+
+	resp := &AppendResponse{Term: n.term}
+	if req.PrevLogIndex > n.lastIndex() {
+		resp.LastIndex = n.lastIndex()
+		return resp, nil
+	}
+	if req.PrevLogIndex >= n.snapshotIndex && n.termAt(req.PrevLogIndex) != req.PrevLogTerm {
+		resp.LastIndex = req.PrevLogIndex - 1
+		return resp, nil
+	}
+
+	for i, e := range req.Entries {
+		if e.Index <= n.snapshotIndex {
+			continue
+		}
+		if e.Index <= n.lastIndex() {
+			if n.termAt(e.Index) == e.Term {
+				continue
+			}
+			// A conflicting entry was never committed; drop it and
+			// everything after it.
+			n.entries = n.entries[:e.Index-n.snapshotIndex-1]
+			if err := n.store.rewrite(n.entries); err != nil {
+				return nil, err
+			}
+		}
+		if err := n.store.append(req.Entries[i:]); err != nil {
+			return nil, err
+		}
+		n.entries = append(n.entries, req.Entries[i:]...)
+		break
+	}
+
+	if last := req.PrevLogIndex + uint64(len(req.Entries)); req.LeaderCommit > n.commitIndex {
+		n.commitIndex = max(n.commitIndex, min(req.LeaderCommit, last))
+		n.signalApplier()
+	}
+	resp.Success = true
+	resp.LastIndex = n.lastIndex()
+	return resp, nil
+}
+
+// HandleSnapshot answers an InstallSnapshot RPC by replacing the contents
+// of the DB with the leader's export.
+func (n *Node) HandleSnapshot(req *SnapshotRequest) (*SnapshotResponse, error) {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if req.Term < n.term {
+		defer n.mu.Unlock()
+		return &SnapshotResponse{Term: n.term}, nil
+	}
+	if req.Term > n.term || n.role != follower {
+		if err := n.stepDown(req.Term); err != nil {
+			n.mu.Unlock()
+			return nil, err
+		}
+	}
+	n.leader = req.Leader
+	n.resetElectionDeadline()
+	resp := &SnapshotResponse{Term: n.term}
+	if req.LastIndex <= n.lastApplied {
+		n.mu.Unlock()
+		return resp, nil
+	}
+	n.mu.Unlock()
+
+	if err := n.restore(req.Data); err != nil {
+		return nil, err
+	}
+	// The snapshot replaces the log only once it is on disk.
+	if err := n.db.Flush(); err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var kept []LogEntry
+	if req.LastIndex < n.lastIndex() && req.LastIndex >= n.snapshotIndex && n.termAt(req.LastIndex) == req.LastTerm {
+		kept = append(kept, n.entries[req.LastIndex-n.snapshotIndex:]...)
+	}
+	hs := n.hardState()
+	hs.SnapshotIndex, hs.SnapshotTerm = req.LastIndex, req.LastTerm
+	if err := n.store.saveState(hs); err != nil {
+		return nil, err
+	}
+	n.snapshotIndex, n.snapshotTerm, n.entries = req.LastIndex, req.LastTerm, kept
+	if err := n.store.rewrite(kept); err != nil {
+		return nil, err
+	}
+	n.commitIndex = max(n.commitIndex, req.LastIndex)
+	n.lastApplied = req.LastIndex
+	close(n.applied)
+	n.applied = make(chan struct{})
+	n.signalApplier()
+	n.log(slog.LevelInfo, "snapshot installed", "index", req.LastIndex, "bytes", len(req.Data))
+	return resp, nil
+}
+
+// restore replaces the contents of the DB with an export. The caller must
+// hold n.applyMu.
+func (n *Node) restore(data []byte) error {
+	var keys []string
+	err := n.db.ForEach(func(key, _ string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := n.db.Delete(key); err != nil && !errors.Is(err, datastore.ErrNotFound) {
+			return err
+		}
+	}
+	_, err = datastore.Import(n.db, bytes.NewReader(data))
+	return err
+}
@@ -0,0 +1,178 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	stateFileName = "state.json"
+	logFileName   = "log.jsonl"
+)
+
+// hardState is the Raft state that must survive restarts besides the log.
+type hardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for"`
+	// Entries up to SnapshotIndex were applied to the DB and dropped from
+	// the log.
+	SnapshotIndex uint64 `json:"snapshot_index"`
+	SnapshotTerm  uint64 `json:"snapshot_term"`
+}
+
+// storage keeps the hard state and the log in dir. The log is a JSON Lines
+// file that is appended to and rewritten whole when its head or tail is
+// cut off.
+type storage struct {
+	dir string
+	log *os.File
+}
+
+// openStorage loads the state and the log entries after the snapshot. A
+// torn last line, left by a crash during an append, is dropped.
+func openStorage(dir string) (*storage, hardState, []LogEntry, error) {
+	var st hardState
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, st, nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, stateFileName))
+	if err == nil {
+		err = json.Unmarshal(data, &st)
+	} else if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return nil, st, nil, err
+	}
+
+	path := filepath.Join(dir, logFileName)
+	data, err = os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, st, nil, err
+	}
+	var entries []LogEntry
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		var e LogEntry
+		if err := json.Unmarshal(data[:i], &e); err != nil {
+			return nil, st, nil, err
+		}
+		data = data[i+1:]
+		if e.Index > st.SnapshotIndex {
+			entries = append(entries, e)
+		}
+	}
+
+	s := &storage{dir: dir}
+	if err := s.rewrite(entries); err != nil {
+		return nil, st, nil, err
+	}
+	return s, st, entries, nil
+}
+
+func (s *storage) saveState(st hardState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(filepath.Join(s.dir, stateFileName), data)
+}
+
+// append adds entries to the end of the log.
+func (s *storage) append(entries []LogEntry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if _, err := s.log.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+// rewrite replaces the log with entries.
+func (s *storage) rewrite(entries []LogEntry) error {
+	path := filepath.Join(s.dir, logFileName)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		return err
+	}
+	if s.log != nil {
+		s.log.Close()
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	s.log = f
+	return syncDir(s.dir)
+}
+
+func (s *storage) close() error {
+	return s.log.Close()
+}
+
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir fsyncs dir, making the renames in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
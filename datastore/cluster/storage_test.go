@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage_TornAppend(t *testing.T) {
+	dir := "test_cluster_storage"
+	defer os.RemoveAll(dir)
+
+	s, _, _, err := openStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []LogEntry{
+		{Index: 1, Term: 1, Command: Command{Op: OpNoop}},
+		{Index: 2, Term: 1, Command: Command{Op: OpPut, Key: "key", Value: "value"}},
+		{Index: 3, Term: 2, Command: Command{Op: OpDelete, Key: "key"}},
+	}
+	if err := s.append(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.saveState(hardState{Term: 2, VotedFor: "n1", SnapshotIndex: 1, SnapshotTerm: 1}); err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+
+	// Обірваний останній рядок після збою відкидається
+	f, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"index":4,"te`)
+	f.Close()
+
+	s, hs, got, err := openStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if hs.Term != 2 || hs.VotedFor != "n1" {
+		t.Errorf("unexpected state %+v", hs)
+	}
+	// Записи до знімка пропускаються
+	if len(got) != 2 || got[0] != entries[1] || got[1] != entries[2] {
+		t.Errorf("unexpected entries %+v", got)
+	}
+}
@@ -0,0 +1,231 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// VoteRequest is the RequestVote RPC of a candidate.
+type VoteRequest struct {
+	Term         uint64 `json:"term"`
+	Candidate    string `json:"candidate"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// AppendRequest is the AppendEntries RPC of a leader, which doubles as its
+// heartbeat when Entries is empty.
+type AppendRequest struct {
+	Term         uint64     `json:"term"`
+	Leader       string     `json:"leader"`
+	PrevLogIndex uint64     `json:"prev_log_index"`
+	PrevLogTerm  uint64     `json:"prev_log_term"`
+	Entries      []LogEntry `json:"entries,omitempty"`
+	LeaderCommit uint64     `json:"leader_commit"`
+}
+
+// AppendResponse reports whether the follower's log matched at
+// PrevLogIndex. LastIndex hints where the leader should retry from.
+type AppendResponse struct {
+	Term      uint64 `json:"term"`
+	Success   bool   `json:"success"`
+	LastIndex uint64 `json:"last_index"`
+}
+
+// SnapshotRequest is the InstallSnapshot RPC of a leader. Data is a
+// datastore Export of every entry up to LastIndex.
+type SnapshotRequest struct {
+	Term      uint64 `json:"term"`
+	Leader    string `json:"leader"`
+	LastIndex uint64 `json:"last_index"`
+	LastTerm  uint64 `json:"last_term"`
+	Data      []byte `json:"data"`
+}
+
+type SnapshotResponse struct {
+	Term uint64 `json:"term"`
+}
+
+// Transport carries RPCs from a node to its peers, which answer them with
+// their Handle methods.
+type Transport interface {
+	Vote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error)
+	Append(ctx context.Context, peer string, req *AppendRequest) (*AppendResponse, error)
+	InstallSnapshot(ctx context.Context, peer string, req *SnapshotRequest) (*SnapshotResponse, error)
+}
+
+// ErrUnreachable is returned by transports for peers they cannot reach.
+var ErrUnreachable = errors.New("cluster: peer unreachable")
+
+// MemNetwork connects nodes of one process, for tests and embedding. Nodes
+// can be disconnected to simulate failures and partitions.
+type MemNetwork struct {
+	mu    sync.RWMutex
+	nodes map[string]*Node
+	down  map[string]bool
+}
+
+func NewMemNetwork() *MemNetwork {
+	return &MemNetwork{nodes: make(map[string]*Node), down: make(map[string]bool)}
+}
+
+// Transport returns the transport of node id.
+func (m *MemNetwork) Transport(id string) Transport {
+	return memTransport{net: m, from: id}
+}
+
+// Register makes n reachable under its ID.
+func (m *MemNetwork) Register(n *Node) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[n.ID()] = n
+}
+
+// Disconnect drops every RPC to and from id until Reconnect.
+func (m *MemNetwork) Disconnect(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.down[id] = true
+}
+
+func (m *MemNetwork) Reconnect(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.down, id)
+}
+
+func (m *MemNetwork) peer(from, to string) (*Node, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.nodes[to]
+	if !ok || m.down[from] || m.down[to] {
+		return nil, fmt.Errorf("%w: %s", ErrUnreachable, to)
+	}
+	return n, nil
+}
+
+type memTransport struct {
+	net  *MemNetwork
+	from string
+}
+
+func (t memTransport) Vote(_ context.Context, peer string, req *VoteRequest) (*VoteResponse, error) {
+	n, err := t.net.peer(t.from, peer)
+	if err != nil {
+		return nil, err
+	}
+	return n.HandleVote(req)
+}
+
+func (t memTransport) Append(_ context.Context, peer string, req *AppendRequest) (*AppendResponse, error) {
+	n, err := t.net.peer(t.from, peer)
+	if err != nil {
+		return nil, err
+	}
+	return n.HandleAppend(req)
+}
+
+func (t memTransport) InstallSnapshot(_ context.Context, peer string, req *SnapshotRequest) (*SnapshotResponse, error) {
+	n, err := t.net.peer(t.from, peer)
+	if err != nil {
+		return nil, err
+	}
+	return n.HandleSnapshot(req)
+}
+
+// HTTPTransport sends RPCs as JSON over HTTP to the Handler of each peer.
+type HTTPTransport struct {
+	// Addrs maps peer IDs to the base URL their Handler is mounted at,
+	// e.g. "http://10.0.0.2:8000/raft".
+	Addrs map[string]string
+	// Client sends the requests. Nil means http.DefaultClient.
+	Client *http.Client
+}
+
+func (t *HTTPTransport) Vote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error) {
+	resp := &VoteResponse{}
+	return resp, t.call(ctx, peer, "vote", req, resp)
+}
+
+func (t *HTTPTransport) Append(ctx context.Context, peer string, req *AppendRequest) (*AppendResponse, error) {
+	resp := &AppendResponse{}
+	return resp, t.call(ctx, peer, "append", req, resp)
+}
+
+func (t *HTTPTransport) InstallSnapshot(ctx context.Context, peer string, req *SnapshotRequest) (*SnapshotResponse, error) {
+	resp := &SnapshotResponse{}
+	return resp, t.call(ctx, peer, "snapshot", req, resp)
+}
+
+func (t *HTTPTransport) call(ctx context.Context, peer, rpc string, req, resp any) error {
+	addr, ok := t.Addrs[peer]
+	if !ok {
+		return fmt.Errorf("%w: no address for %s", ErrUnreachable, peer)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+"/"+rpc, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	hresp, err := client.Do(hreq)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(hresp.Body, 512))
+		return fmt.Errorf("cluster: %s to %s: %s: %s", rpc, peer, hresp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(hresp.Body).Decode(resp)
+}
+
+// Handler serves the RPCs of HTTPTransport for n. Mount it with its prefix
+// stripped, e.g. http.StripPrefix("/raft", n.Handler()).
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/vote", rpcHandler(n.HandleVote))
+	mux.Handle("/append", rpcHandler(n.HandleAppend))
+	mux.Handle("/snapshot", rpcHandler(n.HandleSnapshot))
+	return mux
+}
+
+func rpcHandler[Req, Resp any](handle func(*Req) (*Resp, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req := new(Req)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := handle(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	dir := "test_cluster_http"
+	defer os.RemoveAll(dir)
+
+	// Сервери стартують раніше за вузли, тож обробник підставляється пізніше
+	var mu sync.Mutex
+	handlers := map[string]http.Handler{}
+	addrs := map[string]string{}
+	for _, id := range testIDs {
+		id := id
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			h := handlers[id]
+			mu.Unlock()
+			if h == nil {
+				http.Error(w, "starting", http.StatusServiceUnavailable)
+				return
+			}
+			http.StripPrefix("/raft", h).ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		addrs[id] = srv.URL + "/raft"
+	}
+
+	nodes := map[string]*Node{}
+	for _, id := range testIDs {
+		n, err := Open(Config{
+			ID:                id,
+			Peers:             testIDs,
+			Transport:         &HTTPTransport{Addrs: addrs},
+			Dir:               filepath.Join(dir, id),
+			ElectionTimeout:   100 * time.Millisecond,
+			HeartbeatInterval: 20 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+		nodes[id] = n
+		mu.Lock()
+		handlers[id] = n.Handler()
+		mu.Unlock()
+	}
+
+	var l *Node
+	waitFor(t, func() bool {
+		for _, n := range nodes {
+			if n.IsLeader() {
+				l = n
+				return true
+			}
+		}
+		return false
+	})
+	ctx := context.Background()
+	if err := l.Put(ctx, "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := l.Get(ctx, "key"); err != nil || v != "value" {
+		t.Fatalf("read %q, %v", v, err)
+	}
+	for _, n := range nodes {
+		waitFor(t, func() bool { return hasValue(n, "key", "value") })
+	}
+}
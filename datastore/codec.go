@@ -0,0 +1,307 @@
+package datastore
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrUnknownCodec is returned for values encoded by a codec the DB was not
+// given.
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// Codec encodes values on their way to disk and decodes them back, for
+// compression or encryption. Codecs must be safe for concurrent use.
+type Codec interface {
+	// ID identifies the codec in the values it encoded, so it must never
+	// change. IDs below 128 are reserved for the codecs of this package.
+	ID() byte
+	Encode(value []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// CodecOptions selects how values are encoded on disk by key prefix.
+type CodecOptions struct {
+	// Policies apply their codecs to the values of keys starting with
+	// their prefix; the longest matching prefix wins, and a policy
+	// without codecs stores values as they are.
+	Policies []CodecPolicy
+	// Decoders are codecs only used to read values, such as ones no policy
+	// applies any more. The codecs of this package that need no key are
+	// always available.
+	Decoders []Codec
+}
+
+// CodecPolicy applies Codecs, in order, to the values of keys starting
+// with Prefix.
+type CodecPolicy struct {
+	Prefix string
+	Codecs []Codec
+}
+
+// An encoded value starts with the number of codecs applied to it and
+// their IDs, in the order they were applied, and is marked with
+// kindEncodedFlag. Only full values are encoded; operands, tombstones and
+// dedup references are stored as they are.
+
+// codecs holds the policies and the codecs known by ID. It never changes
+// after Open, and without Options.Codecs it knows the built-in codecs
+// only.
+type codecs struct {
+	policies []CodecPolicy
+	byID     map[byte]Codec
+}
+
+func newCodecs(opts CodecOptions) (*codecs, error) {
+	c := &codecs{policies: opts.Policies, byID: map[byte]Codec{
+		codecFlate: flateCodec{},
+		codecZstd:  zstdCodec{},
+	}}
+	// Codecs of one type may share their ID, like Flate at different
+	// levels; the last one given decodes.
+	add := func(codec Codec) error {
+		if old, ok := c.byID[codec.ID()]; ok && reflect.TypeOf(old) != reflect.TypeOf(codec) {
+			return fmt.Errorf("codec ID %d is used by %T and %T", codec.ID(), old, codec)
+		}
+		c.byID[codec.ID()] = codec
+		return nil
+	}
+	for _, p := range opts.Policies {
+		if len(p.Codecs) > 255 {
+			return nil, fmt.Errorf("policy for %q has too many codecs", p.Prefix)
+		}
+		for _, codec := range p.Codecs {
+			if err := add(codec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, codec := range opts.Decoders {
+		if err := add(codec); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// policy returns the codecs for the values of key.
+func (c *codecs) policy(key string) []Codec {
+	var best *CodecPolicy
+	for i := range c.policies {
+		p := &c.policies[i]
+		if strings.HasPrefix(key, p.Prefix) && (best == nil || len(p.Prefix) > len(best.Prefix)) {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.Codecs
+}
+
+// encode returns the entries to store for entries, with the values their
+// policies select encoded. Blobs written by Options.Dedup take the policy
+// of the key written right after them, which references them. It returns
+// entries itself if no value is encoded.
+func (c *codecs) encode(entries []entry) ([]entry, error) {
+	var stored []entry
+	for i, e := range entries {
+		key := e.key
+		for j := i; strings.HasPrefix(key, dedupBlobPrefix) && j+1 < len(entries); j++ {
+			key = entries[j+1].key
+		}
+		var chain []Codec
+		if e.kind == kindValue && !e.encoded && !strings.HasPrefix(e.value, dedupRefMagic) {
+			chain = c.policy(key)
+		}
+		if len(chain) == 0 {
+			if stored != nil {
+				stored = append(stored, e)
+			}
+			continue
+		}
+		if stored == nil {
+			stored = append(make([]entry, 0, len(entries)), entries[:i]...)
+		}
+		v := []byte(e.value)
+		hdr := []byte{byte(len(chain))}
+		for _, codec := range chain {
+			var err error
+			if v, err = codec.Encode(v); err != nil {
+				return nil, fmt.Errorf("encoding %q: %w", e.key, err)
+			}
+			hdr = append(hdr, codec.ID())
+		}
+		e.value, e.encoded = string(append(hdr, v...)), true
+		stored = append(stored, e)
+	}
+	if stored == nil {
+		return entries, nil
+	}
+	return stored, nil
+}
+
+// decodeValue returns v as it was written if encoded is set, v otherwise.
+// Values encoded by codecs the DB was not given fail with ErrUnknownCodec.
+func (db *DB) decodeValue(v []byte, encoded bool) ([]byte, error) {
+	if !encoded {
+		return v, nil
+	}
+	if len(v) == 0 || len(v) < 1+int(v[0]) {
+		return nil, errors.New("encoded value is truncated")
+	}
+	ids, data := v[1:1+int(v[0])], v[1+int(v[0]):]
+	for i := len(ids) - 1; i >= 0; i-- {
+		codec := db.codecs.byID[ids[i]]
+		if codec == nil {
+			return nil, fmt.Errorf("%w %d", ErrUnknownCodec, ids[i])
+		}
+		var err error
+		if data, err = codec.Decode(data); err != nil {
+			return nil, fmt.Errorf("codec %d: %w", ids[i], err)
+		}
+	}
+	return data, nil
+}
+
+// decodeEntryValue decodes the value of e in place.
+func (db *DB) decodeEntryValue(e *entry) error {
+	if !e.encoded {
+		return nil
+	}
+	v, err := db.decodeValue([]byte(e.value), true)
+	if err != nil {
+		return fmt.Errorf("value of %q: %w", e.key, err)
+	}
+	e.value, e.encoded = string(v), false
+	return nil
+}
+
+// IDs of the codecs of this package.
+const (
+	codecFlate = 1
+	codecZstd  = 2
+	codecAES   = 3
+)
+
+// Flate returns a codec compressing values with DEFLATE at level, from
+// flate.BestSpeed to flate.BestCompression; flate.DefaultCompression
+// picks a balance.
+func Flate(level int) Codec {
+	return flateCodec{level: level}
+}
+
+type flateCodec struct{ level int }
+
+func (flateCodec) ID() byte { return codecFlate }
+
+func (c flateCodec) Encode(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCodec) Decode(data []byte) ([]byte, error) {
+	return io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+}
+
+// Zstd returns a codec compressing values with Zstandard at level, from 1
+// (fastest) to 22, mapped to the nearest level the encoder implements.
+func Zstd(level int) Codec {
+	return zstdCodec{level: zstd.EncoderLevelFromZstd(level)}
+}
+
+type zstdCodec struct{ level zstd.EncoderLevel }
+
+// zstdEncoders holds an encoder per level and zstdDecoder the shared
+// decoder; both are safe for concurrent EncodeAll and DecodeAll.
+var (
+	zstdMu       sync.Mutex
+	zstdEncoders = map[zstd.EncoderLevel]*zstd.Encoder{}
+	zstdDecoder  = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+)
+
+func (zstdCodec) ID() byte { return codecZstd }
+
+func (c zstdCodec) Encode(value []byte) ([]byte, error) {
+	level := c.level
+	if level == 0 {
+		level = zstd.SpeedDefault
+	}
+	zstdMu.Lock()
+	enc, ok := zstdEncoders[level]
+	if !ok {
+		var err error
+		if enc, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(level)); err != nil {
+			zstdMu.Unlock()
+			return nil, err
+		}
+		zstdEncoders[level] = enc
+	}
+	zstdMu.Unlock()
+	return enc.EncodeAll(value, nil), nil
+}
+
+func (zstdCodec) Decode(data []byte) ([]byte, error) {
+	dec, err := zstdDecoder()
+	if err != nil {
+		return nil, err
+	}
+	return dec.DecodeAll(data, nil)
+}
+
+// AESGCM returns a codec encrypting values with AES-GCM under key, which
+// must be 16, 24 or 32 bytes long. Every value gets a random nonce, so
+// equal values encrypt differently and Options.Dedup stores them apart.
+func AESGCM(key []byte) (Codec, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aesCodec{aead}, nil
+}
+
+type aesCodec struct{ aead cipher.AEAD }
+
+func (aesCodec) ID() byte { return codecAES }
+
+func (c aesCodec) Encode(value []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(value)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, value, nil), nil
+}
+
+func (c aesCodec) Decode(data []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("ciphertext is truncated")
+	}
+	return c.aead.Open(nil, data[:n], data[n:], nil)
+}
@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	dir := "test_codecs"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "10485760")
+
+	aes, err := AESGCM(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Codecs: &CodecOptions{Policies: []CodecPolicy{
+		{Prefix: "doc:", Codecs: []Codec{Zstd(9)}},
+		{Prefix: "doc:raw:"},
+		{Prefix: "log:", Codecs: []Codec{Flate(6)}},
+		{Prefix: "secret:", Codecs: []Codec{Flate(1), aes}},
+	}}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := strings.Repeat("lorem ipsum dolor sit amet ", 400)
+	values := map[string]string{
+		"doc:1":     doc,
+		"doc:raw:1": "plain " + doc[:100],
+		"log:1":     doc,
+		"secret:1":  "attack at dawn",
+		"other":     "v",
+	}
+	for k, v := range values {
+		if err := db.Put(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size, _ := db.Size(); size > int64(len(doc)) {
+		t.Errorf("Size = %d, want the documents compressed", size)
+	}
+	check := func(db *DB) {
+		t.Helper()
+		for k, want := range values {
+			if v, err := db.Get(k); err != nil || v != want {
+				t.Errorf("Get(%q) = %d bytes, %v", k, len(v), err)
+			}
+		}
+		got, err := db.GetMulti([]string{"doc:1", "secret:1"})
+		if err != nil || got["doc:1"] != doc || got["secret:1"] != "attack at dawn" {
+			t.Errorf("GetMulti = %v", err)
+		}
+		if v, _, err := db.GetWithMeta("log:1"); err != nil || v != doc {
+			t.Errorf("GetWithMeta = %d bytes, %v", len(v), err)
+		}
+	}
+	check(db)
+
+	// Відкритий текст не потрапляє на диск
+	data, err := os.ReadFile(filepath.Join(dir, "segment-0.data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("attack")) || !bytes.Contains(data, []byte("plain lorem")) {
+		t.Error("values were not encoded as their policies say")
+	}
+
+	// Значення описують свої кодеки, тож злиття й нові політики їх не ламають
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = OpenWithOptions(dir, Options{Codecs: &CodecOptions{Decoders: []Codec{aes}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get("doc:1"); err != nil || v != doc {
+		t.Errorf("Get without codecs = %d bytes, %v", len(v), err)
+	}
+	if _, err := db.Get("secret:1"); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("expected ErrUnknownCodec, got %v", err)
+	}
+
+	if _, err := OpenWithOptions(dir+"_old", Options{Codecs: &CodecOptions{}, FormatVersion: FormatV8}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+const (
+	arenaSlabSize       = 64 << 10
+	compactInitialSlots = 1024
+	// compactPosSize is the size of a position in a slab: segment ID,
+	// offset and entry size.
+	compactPosSize = 4 + 8 + 4
+)
+
+// Slot values with a special meaning.
+const (
+	slotRefEmpty   = 0
+	slotRefDeleted = ^uint64(0)
+)
+
+// compactIndex stores every key in large byte slabs as a record of its
+// uvarint length, the key and its position, and the index itself as an
+// open-addressing table of 8-byte slots. A slot holds 16 bits of the key
+// hash, with the lowest bit set so no slot is zero, the slab number and the
+// offset in the slab:
+//
+//	tag(16) slab(32) offset(16)
+//
+// so probes skip most other keys without touching their slabs. A key costs
+// its length, 17 or 18 bytes and its share of the table, where a Go map
+// pays a string header, a separate allocation per key and bucket overhead.
+//
+// Removed keys stay in their slab until the index is rebuilt, which
+// happens when the table fills up or when removed keys take more than half
+// of the slab bytes.
+type compactIndex struct {
+	hash  HashFunc
+	slabs [][]byte
+	slots []uint64
+	used  int // Slots holding a key
+	dead  int // Deleted slots
+	// size and garbage count the slab bytes of all and of removed keys.
+	size    int
+	garbage int
+}
+
+func newCompactIndex(hash HashFunc) *compactIndex {
+	if hash == nil {
+		hash = HashXXH64
+	}
+	return &compactIndex{hash: hash, slots: make([]uint64, compactInitialSlots)}
+}
+
+// record returns the key and the position bytes of the record at slot.
+func (c *compactIndex) record(slot uint64) ([]byte, []byte) {
+	slab := c.slabs[uint32(slot>>16)]
+	off := int(uint16(slot))
+	n, w := binary.Uvarint(slab[off:])
+	end := off + w + int(n)
+	return slab[off+w : end], slab[end : end+compactPosSize]
+}
+
+// store appends a record for key to the slabs and returns its slot value.
+// Records longer than a slab get one of their own.
+func (c *compactIndex) store(key string, tag uint64) uint64 {
+	need := binary.MaxVarintLen32 + len(key) + compactPosSize
+	last := len(c.slabs) - 1
+	if last < 0 || cap(c.slabs[last])-len(c.slabs[last]) < need {
+		c.slabs = append(c.slabs, make([]byte, 0, max(arenaSlabSize, need)))
+		last++
+	}
+	slab := c.slabs[last]
+	off := len(slab)
+	slab = binary.AppendUvarint(slab, uint64(len(key)))
+	slab = append(slab, key...)
+	slab = append(slab, make([]byte, compactPosSize)...)
+	c.slabs[last] = slab
+	c.size += len(slab) - off
+	return tag<<48 | uint64(last)<<16 | uint64(off)
+}
+
+func decodeCompactPos(b []byte) position {
+	return position{
+		segID:  int(int32(binary.LittleEndian.Uint32(b[0:4]))),
+		offset: int64(binary.LittleEndian.Uint64(b[4:12])),
+		size:   int64(binary.LittleEndian.Uint32(b[12:16])),
+	}
+}
+
+func encodeCompactPos(b []byte, pos position) {
+	binary.LittleEndian.PutUint32(b[0:4], uint32(int32(pos.segID)))
+	binary.LittleEndian.PutUint64(b[4:12], uint64(pos.offset))
+	binary.LittleEndian.PutUint32(b[12:16], uint32(pos.size))
+}
+
+// find returns the slot holding key, or -1 and the first slot key can be
+// inserted at, and the tag of key.
+func (c *compactIndex) find(key string) (int, int, uint64) {
+	h := c.hash(key)
+	tag := h>>48 | 1
+	mask := len(c.slots) - 1
+	free := -1
+	for i, n := int(h)&mask, 0; n < len(c.slots); i, n = (i+1)&mask, n+1 {
+		switch s := c.slots[i]; {
+		case s == slotRefEmpty:
+			if free < 0 {
+				free = i
+			}
+			return -1, free, tag
+		case s == slotRefDeleted:
+			if free < 0 {
+				free = i
+			}
+		case s>>48 == tag:
+			if k, _ := c.record(s); string(k) == key {
+				return i, -1, tag
+			}
+		}
+	}
+	return -1, free, tag
+}
+
+func (c *compactIndex) get(key string) (position, bool) {
+	i, _, _ := c.find(key)
+	if i < 0 {
+		return position{}, false
+	}
+	_, pos := c.record(c.slots[i])
+	return decodeCompactPos(pos), true
+}
+
+func (c *compactIndex) put(key string, pos position) {
+	i, free, tag := c.find(key)
+	if i < 0 {
+		if c.slots[free] == slotRefDeleted {
+			c.dead--
+		}
+		i = free
+		c.slots[i] = c.store(key, tag)
+		c.used++
+	}
+	_, b := c.record(c.slots[i])
+	encodeCompactPos(b, pos)
+	if (c.used+c.dead)*4 > len(c.slots)*3 {
+		c.rebuild()
+	}
+}
+
+func (c *compactIndex) remove(key string) {
+	i, _, _ := c.find(key)
+	if i < 0 {
+		return
+	}
+	c.garbage += len(binary.AppendUvarint(nil, uint64(len(key)))) + len(key) + compactPosSize
+	c.slots[i] = slotRefDeleted
+	c.used--
+	c.dead++
+	if c.garbage > arenaSlabSize && c.garbage*2 > c.size {
+		c.rebuild()
+	}
+}
+
+func (c *compactIndex) len() int {
+	return c.used
+}
+
+// live calls fn with the key and position bytes of every key.
+func (c *compactIndex) live(fn func(key, pos []byte)) {
+	for _, s := range c.slots {
+		if s != slotRefEmpty && s != slotRefDeleted {
+			fn(c.record(s))
+		}
+	}
+}
+
+func (c *compactIndex) ascend(start, end string, fn func(key string, pos position) bool) {
+	var items []btreeItem
+	c.live(func(k, pos []byte) {
+		if key := string(k); key >= start && (end == "" || key < end) {
+			items = append(items, btreeItem{key: key, pos: decodeCompactPos(pos)})
+		}
+	})
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	for _, it := range items {
+		if !fn(it.key, it.pos) {
+			return
+		}
+	}
+}
+
+func (c *compactIndex) rebase(from, to int) {
+	c.live(func(_, pos []byte) {
+		if int32(binary.LittleEndian.Uint32(pos[0:4])) == int32(from) {
+			binary.LittleEndian.PutUint32(pos[0:4], uint32(int32(to)))
+		}
+	})
+}
+
+// rebuild copies the live keys into fresh slabs and a table at most half
+// full, dropping deleted slots and the records they held.
+func (c *compactIndex) rebuild() {
+	n := compactInitialSlots
+	for c.used*2 > n {
+		n *= 2
+	}
+	old := *c
+	*c = compactIndex{hash: old.hash, slots: make([]uint64, n)}
+	old.live(func(key, pos []byte) {
+		c.put(string(key), decodeCompactPos(pos))
+	})
+}
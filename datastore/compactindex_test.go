@@ -0,0 +1,123 @@
+package datastore
+
+import (
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestCompactIndex_MatchesMap(t *testing.T) {
+	c := newCompactIndex(nil)
+	want := make(hashIndex)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200000; i++ {
+		key := "k" + strconv.Itoa(rng.Intn(20000))
+		if rng.Intn(3) == 0 {
+			c.remove(key)
+			want.remove(key)
+			continue
+		}
+		pos := position{segID: rng.Intn(5) - 1, offset: int64(i), size: int64(len(key))}
+		c.put(key, pos)
+		want.put(key, pos)
+	}
+	c.rebase(-1, 7)
+	want.rebase(-1, 7)
+
+	if c.len() != want.len() {
+		t.Fatalf("len = %d, want %d", c.len(), want.len())
+	}
+	for key, pos := range want {
+		if got, ok := c.get(key); !ok || got != pos {
+			t.Fatalf("get(%q) = %+v, %v; want %+v", key, got, ok, pos)
+		}
+	}
+	var keys []string
+	c.ascend("k1", "k2", func(key string, pos position) bool {
+		keys = append(keys, key)
+		return true
+	})
+	var wantKeys []string
+	want.ascend("k1", "k2", func(key string, pos position) bool {
+		wantKeys = append(wantKeys, key)
+		return true
+	})
+	if len(keys) != len(wantKeys) {
+		t.Fatalf("ascend returned %d keys, want %d", len(keys), len(wantKeys))
+	}
+	for i := range keys {
+		if keys[i] != wantKeys[i] {
+			t.Fatalf("ascend[%d] = %q, want %q", i, keys[i], wantKeys[i])
+		}
+	}
+}
+
+// Компактний індекс займає помітно менше пам'яті, ніж мапа, навіть одразу
+// після подвоєння таблиці
+func TestCompactIndex_Memory(t *testing.T) {
+	const n = 200000
+	heap := func(build func()) int64 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		build()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		return int64(after.HeapAlloc) - int64(before.HeapAlloc)
+	}
+	var m keydir
+	mapBytes := heap(func() {
+		m = make(hashIndex)
+		for i := 0; i < n; i++ {
+			m.put("user:"+strconv.Itoa(i), position{offset: int64(i)})
+		}
+	})
+	var c keydir
+	compactBytes := heap(func() {
+		c = newCompactIndex(nil)
+		for i := 0; i < n; i++ {
+			c.put("user:"+strconv.Itoa(i), position{offset: int64(i)})
+		}
+	})
+	runtime.KeepAlive(m)
+	runtime.KeepAlive(c)
+	if compactBytes*3 > mapBytes*2 {
+		t.Errorf("compact index uses %d bytes, map %d", compactBytes, mapBytes)
+	}
+}
+
+func TestCompactIndex_DB(t *testing.T) {
+	dir := "test_compact_index"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "2000")
+
+	opts := Options{IndexType: IndexCompact}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if err := db.Put("key"+strconv.Itoa(i%100), "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Delete("key7")
+	db.Close()
+
+	reopened, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Count() != 99 {
+		t.Fatalf("Count = %d", reopened.Count())
+	}
+	if v, err := reopened.Get("key42"); err != nil || v != "v442" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if _, err := reopened.Get("key7"); err == nil {
+		t.Fatal("deleted key found")
+	}
+}
@@ -0,0 +1,182 @@
+package datastore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ConsistencyKind names a way the index disagrees with the log.
+type ConsistencyKind string
+
+const (
+	// ConsistencyLostUpdate is a key whose latest entry in the log the
+	// index does not point to: it misses the key or points to an older
+	// entry.
+	ConsistencyLostUpdate ConsistencyKind = "lost_update"
+	// ConsistencyResurrection is a key the index holds although its latest
+	// entry in the log deletes it.
+	ConsistencyResurrection ConsistencyKind = "resurrection"
+	// ConsistencyOffsetMismatch is a key the index points to where no
+	// entry of it starts.
+	ConsistencyOffsetMismatch ConsistencyKind = "offset_mismatch"
+	// ConsistencyUnreadable is an entry the replay could not decode; the
+	// rest of its segment is not checked.
+	ConsistencyUnreadable ConsistencyKind = "unreadable"
+)
+
+// ConsistencyReport is the result of CheckConsistency.
+type ConsistencyReport struct {
+	// Segments is the number of segments replayed. Offloaded segments
+	// are skipped, and so are the keys the index finds in them.
+	Segments        int `json:"segments"`
+	SkippedSegments int `json:"skipped_segments"`
+	Entries         int `json:"entries"`
+	// Keys is the number of live keys after the replay, IndexKeys the
+	// number the index holds.
+	Keys      int                `json:"keys"`
+	IndexKeys int                `json:"index_keys"`
+	Issues    []ConsistencyIssue `json:"issues"`
+}
+
+// OK reports whether the check found no issue.
+func (r *ConsistencyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// ConsistencyIssue is a key, or an entry, the index and the log disagree
+// on. Index is where the index points, Log where the latest entry of the
+// key is.
+type ConsistencyIssue struct {
+	Kind  ConsistencyKind `json:"kind"`
+	Key   string          `json:"key,omitempty"`
+	Index *EntryLocation  `json:"index,omitempty"`
+	Log   *EntryLocation  `json:"log,omitempty"`
+	Err   string          `json:"err,omitempty"`
+}
+
+// EntryLocation is where an entry is on disk.
+type EntryLocation struct {
+	Segment int   `json:"segment"`
+	Offset  int64 `json:"offset"`
+	Size    int64 `json:"size"`
+}
+
+func locationOf(pos position) *EntryLocation {
+	return &EntryLocation{Segment: pos.segID, Offset: pos.offset, Size: pos.size}
+}
+
+// replayed is an entry seen by the replay, numbered in log order.
+type replayed struct {
+	key   string
+	order int
+}
+
+// CheckConsistency replays the log of db, as Open does, and compares the
+// result with the in-memory index. It holds db.mu for reading throughout,
+// so writes and merges wait for it; meant for offline or staging checks.
+func CheckConsistency(db *DB) *ConsistencyReport {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	rep := &ConsistencyReport{IndexKeys: db.index.len()}
+	entries := make(map[position]replayed)
+	latest := make(map[string]position) // Live keys
+	seen := make(map[string]bool)
+	skipped := make(map[int]bool)
+	for _, s := range append(append([]*segment(nil), db.segments...), db.actives()...) {
+		if s.remote != nil {
+			skipped[s.id] = true
+			rep.SkippedSegments++
+			continue
+		}
+		rep.Segments++
+		replaySegment(s, rep, func(e *entry, pos position) {
+			entries[pos] = replayed{key: e.key, order: len(entries)}
+			seen[e.key] = true
+			if e.kind == kindTombstone {
+				delete(latest, e.key)
+			} else {
+				latest[e.key] = pos
+			}
+		})
+	}
+	rep.Keys = len(latest)
+
+	for key := range seen {
+		want, live := latest[key]
+		pos, indexed := db.index.get(key)
+		if indexed && skipped[pos.segID] {
+			continue
+		}
+		issue := ConsistencyIssue{Key: key}
+		if indexed {
+			issue.Index = locationOf(pos)
+		}
+		if live {
+			issue.Log = locationOf(want)
+		}
+		at, found := entries[pos]
+		switch {
+		case !indexed && !live:
+			continue
+		case indexed && (!found || at.key != key):
+			issue.Kind = ConsistencyOffsetMismatch
+		case !live:
+			issue.Kind = ConsistencyResurrection
+		case !indexed || at.order < entries[want].order:
+			issue.Kind = ConsistencyLostUpdate
+		default:
+			continue
+		}
+		rep.Issues = append(rep.Issues, issue)
+	}
+	slices.SortFunc(rep.Issues, func(a, b ConsistencyIssue) int { return strings.Compare(a.Key, b.Key) })
+	return rep
+}
+
+// replaySegment calls fn for every indexed entry of s, as scanSegment
+// does: entries of a batch only once its last one is read, none of a
+// batch the segment ends inside. An entry it cannot decode is reported in
+// rep and ends the replay of s. The caller must hold db.mu.
+func replaySegment(s *segment, rep *ConsistencyReport, fn func(e *entry, pos position)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := bufio.NewReader(io.NewSectionReader(s.reader(), s.dataStart, s.size-s.dataStart))
+	offset := s.dataStart
+	var batch []entry
+	var batchPos []position
+	for {
+		var e entry
+		n, err := decodeEntry(&e, r, s.version)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			rep.Issues = append(rep.Issues, ConsistencyIssue{
+				Kind: ConsistencyUnreadable,
+				Log:  &EntryLocation{Segment: s.id, Offset: offset},
+				Err:  err.Error(),
+			})
+			return
+		}
+		rep.Entries++
+		pos := position{segID: s.id, offset: offset, size: int64(n)}
+		offset += int64(n)
+		if e.kind == kindHistory {
+			continue
+		}
+		if e.batch {
+			batch = append(batch, e)
+			batchPos = append(batchPos, pos)
+			continue
+		}
+		for i := range batch {
+			fn(&batch[i], batchPos[i])
+		}
+		batch, batchPos = batch[:0], batchPos[:0]
+		fn(&e, pos)
+	}
+}
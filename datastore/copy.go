@@ -0,0 +1,167 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CopyTo writes every live key of db into dst and returns the number of
+// keys copied. Like Export it copies a snapshot of the moment it starts;
+// merged values are copied folded, and dst stamps the copies with its own
+// sequence numbers and write times. Copies do not expire.
+func (db *DB) CopyTo(dst *DB) (int, error) {
+	return db.CopyPrefixTo(dst, "")
+}
+
+// CopyPrefixTo is CopyTo limited to the keys starting with prefix.
+func (db *DB) CopyPrefixTo(dst *DB, prefix string) (int, error) {
+	if dst == db {
+		return 0, errors.New("cannot copy a DB into itself")
+	}
+	keys, seq := db.keysInRange(prefix, prefixEnd(prefix))
+	return db.snapshotEach(keys, seq, func(key, value string) error {
+		return dst.Put(key, value)
+	})
+}
+
+// Clone copies the live keys of the store in dir into a new store in
+// newDir, which leaves out superseded entries and tombstones. newDir must
+// not hold a store yet; dir must not be open.
+func Clone(dir, newDir string) error {
+	src, err := Open(dir)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := Open(newDir)
+	if err != nil {
+		return err
+	}
+	if dst.Count() > 0 {
+		dst.Close()
+		return fmt.Errorf("clone target %s is not empty", newDir)
+	}
+	if _, err := src.CopyTo(dst); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Record is the value of a key in a store together with the metadata of
+// its latest write.
+type Record struct {
+	Value string
+	Meta  Meta
+}
+
+// ConflictFn returns the value MergeDirs keeps for a key found in both
+// stores, given its record in the first and in the second.
+type ConflictFn func(key string, a, b Record) (string, error)
+
+// NewestWins is the ConflictFn MergeDirs uses by default: the value with
+// the later write time wins, and a on a tie. Entries written before
+// FormatV6 have no write time and lose to ones that have.
+func NewestWins(_ string, a, b Record) (string, error) {
+	if b.Meta.Modified.After(a.Meta.Modified) {
+		return b.Value, nil
+	}
+	return a.Value, nil
+}
+
+// MergeDirs combines the live keys of the stores in dirA and dirB into a
+// new store in out. Keys found in both get the value resolve returns, or
+// NewestWins if it is nil. Neither store may be open, and out must not
+// hold a store yet.
+func MergeDirs(dirA, dirB, out string, resolve ConflictFn) error {
+	if resolve == nil {
+		resolve = NewestWins
+	}
+	a, err := Open(dirA)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := Open(dirB)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	dst, err := Open(out)
+	if err != nil {
+		return err
+	}
+	if dst.Count() > 0 {
+		dst.Close()
+		return fmt.Errorf("merge target %s is not empty", out)
+	}
+	if err := mergeInto(dst, a, b, resolve); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// mergeInto writes the keys of a and b to dst, walking both key lists in
+// order.
+func mergeInto(dst, a, b *DB, resolve ConflictFn) error {
+	keysA, _ := a.keysInRange("", "")
+	keysB, _ := b.keysInRange("", "")
+	read := func(src *DB, key string) (Record, bool, error) {
+		v, m, err := src.GetWithMeta(key)
+		if errors.Is(err, ErrNotFound) {
+			return Record{}, false, nil
+		}
+		return Record{Value: v, Meta: m}, err == nil, err
+	}
+	for len(keysA) > 0 || len(keysB) > 0 {
+		var key string
+		var ra, rb Record
+		var okA, okB bool
+		var err error
+		switch {
+		case len(keysB) == 0 || len(keysA) > 0 && keysA[0] < keysB[0]:
+			key, keysA = keysA[0], keysA[1:]
+			ra, okA, err = read(a, key)
+		case len(keysA) == 0 || keysB[0] < keysA[0]:
+			key, keysB = keysB[0], keysB[1:]
+			rb, okB, err = read(b, key)
+		default:
+			key, keysA, keysB = keysA[0], keysA[1:], keysB[1:]
+			if ra, okA, err = read(a, key); err == nil {
+				rb, okB, err = read(b, key)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		v := ra.Value
+		switch {
+		case okA && okB:
+			if v, err = resolve(key, ra, rb); err != nil {
+				return fmt.Errorf("resolving %q: %w", key, err)
+			}
+		case okB:
+			v = rb.Value
+		case !okA:
+			continue
+		}
+		if err := dst.Put(key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or "" if there is none.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+package datastore
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCopyTo(t *testing.T) {
+	dir := "test_copy_src"
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(dir + "_dst")
+	defer os.RemoveAll(dir + "_users")
+
+	src, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	for i := 0; i < 20; i++ {
+		src.Put("user:"+strconv.Itoa(i), "u"+strconv.Itoa(i))
+		src.Put("item:"+strconv.Itoa(i), "i"+strconv.Itoa(i))
+	}
+	src.Delete("user:3")
+
+	dst, err := Open(dir + "_dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if n, err := src.CopyTo(dst); err != nil || n != 39 {
+		t.Fatalf("CopyTo = %d, %v", n, err)
+	}
+	if v, _ := dst.Get("item:7"); v != "i7" || dst.Count() != 39 {
+		t.Fatalf("Get(item:7) = %q, Count = %d", v, dst.Count())
+	}
+
+	// Лише ключі з префіксом
+	users, err := Open(dir + "_users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer users.Close()
+	if n, err := src.CopyPrefixTo(users, "user:"); err != nil || n != 19 {
+		t.Fatalf("CopyPrefixTo = %d, %v", n, err)
+	}
+	if _, err := users.Get("item:1"); err == nil {
+		t.Fatal("item:1 copied with user: prefix")
+	}
+	if _, err := src.CopyTo(src); err == nil {
+		t.Fatal("expected error copying into itself")
+	}
+}
+
+func TestClone(t *testing.T) {
+	dir := "test_clone_src"
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(dir + "_copy")
+	t.Setenv("SEG_MAX", "500")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Багато перезаписів одного ключа роздувають каталог
+	for i := 0; i < 200; i++ {
+		db.Put("k", strconv.Itoa(i))
+	}
+	db.Put("other", "x")
+	before, _ := db.Size()
+	db.Close()
+
+	if err := Clone(dir, dir+"_copy"); err != nil {
+		t.Fatal(err)
+	}
+	clone, err := Open(dir + "_copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := clone.Get("k"); v != "199" || clone.Count() != 2 {
+		t.Fatalf("Get(k) = %q, Count = %d", v, clone.Count())
+	}
+	if after, _ := clone.Size(); after >= before/10 {
+		t.Fatalf("clone has %d bytes, source %d", after, before)
+	}
+	clone.Close()
+
+	// Непорожній каталог призначення
+	if err := Clone(dir, dir+"_copy"); err == nil {
+		t.Fatal("expected error cloning into a non-empty store")
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	for prefix, want := range map[string]string{"": "", "a": "b", "ab\xff": "ac", "\xff\xff": ""} {
+		if got := prefixEnd(prefix); got != want {
+			t.Errorf("prefixEnd(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
+
+func TestMergeDirs(t *testing.T) {
+	dir := "test_merge_dirs"
+	defer os.RemoveAll(dir + "_a")
+	defer os.RemoveAll(dir + "_b")
+	defer os.RemoveAll(dir + "_out")
+	defer os.RemoveAll(dir + "_custom")
+
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	write := func(path string, kv ...string) {
+		t.Helper()
+		db, err := OpenWithOptions(path, Options{Clock: clock})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(kv); i += 2 {
+			db.Put(kv[i], kv[i+1])
+			now = now.Add(time.Second)
+		}
+		db.Close()
+	}
+	// Спільні ключі записані в різний час на різних хостах
+	write(dir+"_a", "only-a", "1", "shared", "a-old", "late", "a")
+	write(dir+"_b", "shared", "b-new", "only-b", "2")
+	write(dir+"_a", "late", "a-newest")
+
+	if err := MergeDirs(dir+"_a", dir+"_b", dir+"_out", nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Open(dir + "_out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"only-a": "1", "only-b": "2", "shared": "b-new", "late": "a-newest"}
+	for k, v := range want {
+		if got, err := out.Get(k); err != nil || got != v {
+			t.Errorf("Get(%s) = %q, %v, want %q", k, got, err, v)
+		}
+	}
+	if out.Count() != len(want) {
+		t.Errorf("Count = %d", out.Count())
+	}
+	out.Close()
+
+	// Власна функція розв'язання конфліктів
+	concat := func(key string, a, b Record) (string, error) { return a.Value + "+" + b.Value, nil }
+	if err := MergeDirs(dir+"_a", dir+"_b", dir+"_custom", concat); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := Open(dir + "_custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer custom.Close()
+	if v, _ := custom.Get("shared"); v != "a-old+b-new" {
+		t.Errorf("Get(shared) = %q", v)
+	}
+	if v, _ := custom.Get("only-b"); v != "2" {
+		t.Errorf("Get(only-b) = %q", v)
+	}
+}
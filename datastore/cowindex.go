@@ -0,0 +1,333 @@
+package datastore
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+	"sort"
+)
+
+// cowIndex is a persistent hash array mapped trie: every change copies the
+// path to the key it changes and shares the rest, so a root, once
+// published in a readView, never changes and Get reads it without db.mu.
+// Each level consumes hamtBits bits of the key hash; keys whose hashes are
+// equal share a collision node below the last level.
+type cowIndex struct {
+	hash HashFunc
+	root *hamtNode
+	n    int
+}
+
+const (
+	hamtBits  = 5
+	hamtWidth = 1 << hamtBits
+	hamtDepth = 64 / hamtBits
+)
+
+type hamtNode struct {
+	bitmap uint32
+	slots  []hamtSlot
+	// collisions holds the keys of a node past the last level.
+	collisions []hamtLeaf
+}
+
+// hamtSlot is a subtrie if child is set, else a single key.
+type hamtSlot struct {
+	child *hamtNode
+	leaf  hamtLeaf
+}
+
+type hamtLeaf struct {
+	key  string
+	hash uint64
+	pos  position
+}
+
+func newCOWIndex(hash HashFunc) *cowIndex {
+	if hash == nil {
+		hash = HashXXH64
+	}
+	return &cowIndex{hash: hash, root: &hamtNode{}}
+}
+
+func (c *cowIndex) get(key string) (position, bool) {
+	return c.root.get(key, c.hash(key))
+}
+
+func (n *hamtNode) get(key string, h uint64) (position, bool) {
+	for level := 0; ; level++ {
+		if level == hamtDepth {
+			for _, l := range n.collisions {
+				if l.key == key {
+					return l.pos, true
+				}
+			}
+			return position{}, false
+		}
+		bit := uint32(1) << hamtIndex(h, level)
+		if n.bitmap&bit == 0 {
+			return position{}, false
+		}
+		s := &n.slots[bits.OnesCount32(n.bitmap&(bit-1))]
+		if s.child == nil {
+			if s.leaf.key == key {
+				return s.leaf.pos, true
+			}
+			return position{}, false
+		}
+		n = s.child
+	}
+}
+
+func (c *cowIndex) put(key string, pos position) {
+	var added bool
+	c.root, added = c.root.put(hamtLeaf{key: key, hash: c.hash(key), pos: pos}, 0)
+	if added {
+		c.n++
+	}
+}
+
+// put returns a copy of n with leaf stored and whether its key is new.
+func (n *hamtNode) put(leaf hamtLeaf, level int) (*hamtNode, bool) {
+	if level == hamtDepth {
+		cp := &hamtNode{collisions: slices.Clone(n.collisions)}
+		for i, l := range cp.collisions {
+			if l.key == leaf.key {
+				cp.collisions[i] = leaf
+				return cp, false
+			}
+		}
+		cp.collisions = append(cp.collisions, leaf)
+		return cp, true
+	}
+	bit := uint32(1) << hamtIndex(leaf.hash, level)
+	i := bits.OnesCount32(n.bitmap & (bit - 1))
+	cp := &hamtNode{bitmap: n.bitmap | bit}
+	if n.bitmap&bit == 0 {
+		cp.slots = slices.Insert(slices.Clone(n.slots), i, hamtSlot{leaf: leaf})
+		return cp, true
+	}
+	cp.slots = slices.Clone(n.slots)
+	s := &cp.slots[i]
+	switch {
+	case s.child != nil:
+		var added bool
+		s.child, added = s.child.put(leaf, level+1)
+		return cp, added
+	case s.leaf.key == leaf.key:
+		s.leaf = leaf
+		return cp, false
+	}
+	// Push the key down into a subtrie holding both.
+	child, _ := (&hamtNode{}).put(s.leaf, level+1)
+	child, _ = child.put(leaf, level+1)
+	*s = hamtSlot{child: child}
+	return cp, true
+}
+
+func (c *cowIndex) remove(key string) {
+	root, removed := c.root.remove(key, c.hash(key), 0)
+	if !removed {
+		return
+	}
+	if root == nil {
+		root = &hamtNode{}
+	}
+	c.root = root
+	c.n--
+}
+
+// remove returns a copy of n without key, nil if nothing is left, and
+// whether key was there.
+func (n *hamtNode) remove(key string, h uint64, level int) (*hamtNode, bool) {
+	if level == hamtDepth {
+		i := slices.IndexFunc(n.collisions, func(l hamtLeaf) bool { return l.key == key })
+		if i < 0 {
+			return n, false
+		}
+		if len(n.collisions) == 1 {
+			return nil, true
+		}
+		return &hamtNode{collisions: slices.Delete(slices.Clone(n.collisions), i, i+1)}, true
+	}
+	bit := uint32(1) << hamtIndex(h, level)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := bits.OnesCount32(n.bitmap & (bit - 1))
+	s := n.slots[i]
+	var child *hamtNode
+	if s.child == nil {
+		if s.leaf.key != key {
+			return n, false
+		}
+	} else {
+		var removed bool
+		if child, removed = s.child.remove(key, h, level+1); !removed {
+			return n, false
+		}
+	}
+	cp := &hamtNode{bitmap: n.bitmap, slots: slices.Clone(n.slots)}
+	if child != nil {
+		cp.slots[i] = hamtSlot{child: child}
+		// A subtrie left with one key folds back into a leaf.
+		if leaf, ok := child.single(); ok {
+			cp.slots[i] = hamtSlot{leaf: leaf}
+		}
+		return cp, true
+	}
+	cp.bitmap &^= bit
+	cp.slots = slices.Delete(cp.slots, i, i+1)
+	if len(cp.slots) == 0 {
+		return nil, true
+	}
+	return cp, true
+}
+
+// single returns the only key of n, if it holds just one.
+func (n *hamtNode) single() (hamtLeaf, bool) {
+	if len(n.collisions) == 1 {
+		return n.collisions[0], true
+	}
+	if len(n.slots) == 1 && n.slots[0].child == nil {
+		return n.slots[0].leaf, true
+	}
+	return hamtLeaf{}, false
+}
+
+func (c *cowIndex) len() int {
+	return c.n
+}
+
+func (c *cowIndex) ascend(start, end string, fn func(key string, pos position) bool) {
+	var leaves []hamtLeaf
+	c.root.each(func(l hamtLeaf) {
+		if l.key >= start && (end == "" || l.key < end) {
+			leaves = append(leaves, l)
+		}
+	})
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].key < leaves[j].key })
+	for _, l := range leaves {
+		if !fn(l.key, l.pos) {
+			return
+		}
+	}
+}
+
+func (n *hamtNode) each(fn func(l hamtLeaf)) {
+	for _, l := range n.collisions {
+		fn(l)
+	}
+	for _, s := range n.slots {
+		if s.child != nil {
+			s.child.each(fn)
+		} else {
+			fn(s.leaf)
+		}
+	}
+}
+
+// rebase copies the nodes holding positions in segment from; the rest of
+// the trie is shared.
+func (c *cowIndex) rebase(from, to int) {
+	c.root = c.root.rebase(from, to)
+}
+
+func (n *hamtNode) rebase(from, to int) *hamtNode {
+	var cp *hamtNode
+	clone := func() {
+		if cp == nil {
+			cp = &hamtNode{bitmap: n.bitmap, slots: slices.Clone(n.slots), collisions: slices.Clone(n.collisions)}
+		}
+	}
+	for i, l := range n.collisions {
+		if l.pos.segID == from {
+			clone()
+			cp.collisions[i].pos.segID = to
+		}
+	}
+	for i, s := range n.slots {
+		if s.child != nil {
+			if child := s.child.rebase(from, to); child != s.child {
+				clone()
+				cp.slots[i].child = child
+			}
+		} else if s.leaf.pos.segID == from {
+			clone()
+			cp.slots[i].leaf.pos.segID = to
+		}
+	}
+	if cp == nil {
+		return n
+	}
+	return cp
+}
+
+// hamtIndex returns the slot of hash h at level.
+func hamtIndex(h uint64, level int) uint {
+	return uint(h>>(level*hamtBits)) & (hamtWidth - 1)
+}
+
+// readView is what Get needs to read a key without db.mu: the index root
+// and the segments its positions point into, as of the end of the last
+// write, merge or drop. Writers publish a new one in DB.view.
+type readView struct {
+	index    *cowIndex // A copy, sharing the published root
+	segments []*segment
+	actives  []*segment
+}
+
+// publishView makes the current index and segments the ones Get reads.
+// Segments retired since the last view are released once it is out of
+// reach; readers that loaded an older view fail to take a reference to
+// them afterwards and read under db.mu instead. The caller must hold db.mu.
+func (db *DB) publishView() {
+	c, ok := db.index.(*cowIndex)
+	if !ok {
+		return
+	}
+	cp := *c
+	db.view.Store(&readView{index: &cp, segments: db.segments, actives: db.actives()})
+	db.releaseRetired()
+}
+
+func (v *readView) segmentFor(pos position) (*segment, error) {
+	if pos.segID < 0 {
+		return v.actives[-1-pos.segID], nil
+	}
+	i, ok := slices.BinarySearchFunc(v.segments, pos.segID, func(s *segment, id int) int { return s.id - id })
+	if !ok {
+		return nil, fmt.Errorf("invalid segment ID %d", pos.segID)
+	}
+	return v.segments[i], nil
+}
+
+// lookupView is lookup reading the published view instead of holding
+// db.mu. Keys whose latest entry is a merge operand are folded by lookup,
+// so ok is false for them, as it is if the segment was closed since v was
+// published.
+func (db *DB) lookupView(v *readView, key string, buf *[]byte) (value []byte, pos position, nocache, ok bool, err error) {
+	pos, found := v.index.get(key)
+	if !found {
+		return nil, pos, false, true, ErrNotFound
+	}
+	s, err := v.segmentFor(pos)
+	if err != nil {
+		return nil, pos, false, true, err
+	}
+	if !s.tryRef() {
+		return nil, pos, false, false, nil
+	}
+	defer db.unref(s)
+	s.mu.RLock()
+	e, err := s.readEntryInto(pos.offset, pos.size, buf)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, pos, false, true, err
+	}
+	if e.kind == kindMergeOperand {
+		return nil, pos, false, false, nil
+	}
+	value, nocache, err = db.entryValue(key, e)
+	return value, pos, nocache, true, err
+}
@@ -0,0 +1,148 @@
+package datastore
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCOWIndex_MatchesMap(t *testing.T) {
+	// Хеш із 8 бітів змушує ключі ділити гілки та вузли колізій
+	for name, hash := range map[string]HashFunc{
+		"xxh64": nil,
+		"narrow": func(key string) uint64 {
+			return HashXXH64(key) & 0xff
+		},
+	} {
+		c := newCOWIndex(hash)
+		want := make(hashIndex)
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 50000; i++ {
+			key := "k" + strconv.Itoa(rng.Intn(5000))
+			if rng.Intn(3) == 0 {
+				c.remove(key)
+				want.remove(key)
+				continue
+			}
+			pos := position{segID: rng.Intn(5) - 1, offset: int64(i), size: int64(len(key))}
+			c.put(key, pos)
+			want.put(key, pos)
+		}
+		// Старий корінь не змінюється після rebase
+		old := *c
+		c.rebase(-1, 7)
+		want.rebase(-1, 7)
+
+		if c.len() != want.len() {
+			t.Fatalf("%s: len = %d, want %d", name, c.len(), want.len())
+		}
+		for key, pos := range want {
+			if got, ok := c.get(key); !ok || got != pos {
+				t.Fatalf("%s: get(%q) = %+v, %v; want %+v", name, key, got, ok, pos)
+			}
+			if pos.segID == 7 {
+				if got, _ := old.get(key); got.segID != -1 {
+					t.Fatalf("%s: old root sees %+v for %q", name, got, key)
+				}
+			}
+		}
+		var keys, wantKeys []string
+		c.ascend("k1", "k2", func(key string, pos position) bool {
+			keys = append(keys, key)
+			return true
+		})
+		want.ascend("k1", "k2", func(key string, pos position) bool {
+			wantKeys = append(wantKeys, key)
+			return true
+		})
+		if strings.Join(keys, ",") != strings.Join(wantKeys, ",") {
+			t.Fatalf("%s: ascend returned %d keys, want %d", name, len(keys), len(wantKeys))
+		}
+
+		for key := range want {
+			c.remove(key)
+		}
+		if c.len() != 0 || len(c.root.slots) != 0 {
+			t.Errorf("%s: %d keys left after removing all", name, c.len())
+		}
+	}
+}
+
+// Читання без блокування бачать узгоджені значення під час записів,
+// ротацій і злиттів
+func TestIndexCOW_ConcurrentReads(t *testing.T) {
+	dir := "test_cowindex"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "2048")
+
+	db, err := OpenWithOptions(dir, Options{IndexType: IndexCOW})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	const keys = 50
+	for i := 0; i < keys; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("key%d-0", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				key := fmt.Sprintf("key%d", rand.Intn(keys))
+				v, err := db.Get(key)
+				if err != nil || !strings.HasPrefix(v, key+"-") {
+					t.Errorf("get %s: %q, %v", key, v, err)
+					return
+				}
+			}
+		}()
+	}
+	for round := 1; round <= 20; round++ {
+		for i := 0; i < keys; i++ {
+			if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("key%d-%d", i, round)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if round%5 == 0 {
+			if err := db.Merge(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	for i := 0; i < keys; i++ {
+		if v, err := db.Get(fmt.Sprintf("key%d", i)); err != nil || v != fmt.Sprintf("key%d-20", i) {
+			t.Errorf("key%d = %q, %v", i, v, err)
+		}
+	}
+	// Операнди злиття читаються під блокуванням
+	if err := db.RPush("list", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.LRange("list", 0, -1); err != nil || strings.Join(got, ",") != "a,b" {
+		t.Errorf("list = %v, %v", got, err)
+	}
+	if err := db.Delete("key0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("key0"); err != ErrNotFound {
+		t.Errorf("deleted key: err = %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package datastore
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CSVOptions configures ExportCSV and ImportCSV. Both sides of a transfer
+// have to use the same options.
+type CSVOptions struct {
+	// Comma is the field delimiter. Zero means ','.
+	Comma rune
+	// Base64 stores values in standard base64, for values that are not
+	// valid text.
+	Base64 bool
+	// NoHeader leaves out the "key,value" header row.
+	NoHeader bool
+}
+
+func (o CSVOptions) comma() rune {
+	if o.Comma == 0 {
+		return ','
+	}
+	return o.Comma
+}
+
+// ExportCSV writes every live key to w as CSV rows of key and value, in key
+// order and from the same snapshot semantics as Export.
+func (db *DB) ExportCSV(w io.Writer, opts CSVOptions) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = opts.comma()
+	if !opts.NoHeader {
+		if err := cw.Write([]string{"key", "value"}); err != nil {
+			return err
+		}
+	}
+
+	keys, seq := db.keysInRange("", "")
+	_, err := db.snapshotEach(keys, seq, func(key, value string) error {
+		if opts.Base64 {
+			value = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		return cw.Write([]string{key, value})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportCSV loads rows written by ExportCSV into db and returns the number
+// of rows written. Rows are applied in order, so a later row for the same
+// key wins.
+func ImportCSV(db *DB, r io.Reader, opts CSVOptions) (int, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = opts.comma()
+	cr.FieldsPerRecord = 2
+	cr.ReuseRecord = true
+
+	count := 0
+	if !opts.NoHeader {
+		if _, err := cr.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, nil
+			}
+			return 0, err
+		}
+	}
+	for {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		key, value := row[0], row[1]
+		if opts.Base64 {
+			raw, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				line, _ := cr.FieldPos(1)
+				return count, fmt.Errorf("line %d: invalid base64 value: %w", line, err)
+			}
+			value = string(raw)
+		}
+		if err := db.Put(key, value); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
@@ -0,0 +1,91 @@
+package datastore
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	data := map[string]string{
+		"plain":  "value",
+		"quoted": `a "b", c`,
+		"multi":  "line1\nline2",
+		"binary": "\x00\xff\x01",
+	}
+	for name, opts := range map[string]CSVOptions{
+		"default":   {},
+		"semicolon": {Comma: ';', Base64: true},
+		"noheader":  {Comma: '\t', NoHeader: true, Base64: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			src, dst := "test_csv_src_"+name, "test_csv_dst_"+name
+			defer os.RemoveAll(src)
+			defer os.RemoveAll(dst)
+
+			db, err := Open(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			for k, v := range data {
+				if err := db.Put(k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := db.ExportCSV(&buf, opts); err != nil {
+				t.Fatal(err)
+			}
+			if opts.Base64 && strings.Contains(buf.String(), "\x00") {
+				t.Fatal("base64 export contains raw binary")
+			}
+
+			target, err := Open(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer target.Close()
+			n, err := ImportCSV(target, &buf, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(data) {
+				t.Fatalf("imported %d rows", n)
+			}
+			for k, v := range data {
+				if got, err := target.Get(k); err != nil || got != v {
+					t.Errorf("%q = %q, %v", k, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExportCSV_Format(t *testing.T) {
+	dir := "test_csv_format"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put("b", "2")
+	db.Put("a", "x;y")
+
+	// Ключі впорядковані, поле з роздільником береться в лапки
+	var buf bytes.Buffer
+	if err := db.ExportCSV(&buf, CSVOptions{Comma: ';'}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "key;value\na;\"x;y\"\nb;2\n"; buf.String() != want {
+		t.Fatalf("export = %q, want %q", buf.String(), want)
+	}
+
+	if _, err := ImportCSV(db, strings.NewReader("key,value\na,!!!\n"), CSVOptions{Base64: true}); err == nil {
+		t.Fatal("expected error for invalid base64")
+	}
+}
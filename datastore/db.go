@@ -2,75 +2,356 @@ package datastore
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	activeName      = "current-data"
-	defaultMaxBytes = 10 * 1024 * 1024
+	activeName = "current-data"
+	// DefaultMaxSegmentSize is the size at which active segments rotate
+	// unless Options.MaxSegmentSize says otherwise.
+	DefaultMaxSegmentSize = 10 * 1024 * 1024
 )
 
 var (
-	ErrNotFound    = fmt.Errorf("record does not exist")
-	segRE          = regexp.MustCompile(`^segment-(\d+)\.data$`)
-	MaxSegmentSize = int64(defaultMaxBytes)
+	ErrNotFound = fmt.Errorf("record does not exist")
+	segRE       = regexp.MustCompile(`^segment-(\d+)\.data$`)
+	// mergeTmpRE matches the output of a merge until it replaces the
+	// segments it merged.
+	mergeTmpRE = regexp.MustCompile(`^merge-tmp-\d+\.data$`)
 )
 
 type position struct {
 	segID  int
 	offset int64
+	size   int64 // Encoded size of the entry
 }
 
 type segment struct {
-	file *os.File
+	file File
 	id   int
 	size int64
 	path string
 	mu   sync.RWMutex // Per-segment lock for safe concurrent access
+
+	version   uint16 // On-disk format version
+	dataStart int64  // Offset of the first entry, after the header
+
+	// frozen is when the segment stopped taking writes, the file's
+	// modification time for segments found at open.
+	frozen time.Time
+
+	// keys filters the keys of a frozen segment's entries, nil if they are
+	// not known; the active segment collects them in collected instead.
+	keys      *keyFilter
+	collected keyHashes
+
+	// remote is set once the segment is offloaded to the object store;
+	// file is nil and path names the hint file then.
+	remote *remoteSegment
+
+	// dead is the size of the entries the index no longer points to, see
+	// supersede. Guarded by db.mu.
+	dead int64
+
+	// pending holds the last bytes of the active segment while they wait
+	// in the write buffer. They count in size. Changed under both db.mu
+	// and mu.
+	pending []byte
+
+	// refs counts the reads using the segment, minus one once it is
+	// retired; it is closed when that drops below zero, see ref.
+	refs atomic.Int64
+	// unlink removes the file as well when the segment is closed. Set by
+	// retire. removed is set once it is gone.
+	unlink  bool
+	removed atomic.Bool
 }
 
+type entryKind byte
+
+const (
+	kindValue entryKind = iota
+	kindMergeOperand
+	// kindHistory is an older value kept by compaction for GetHistory and
+	// GetAt. It is never indexed. FormatV10.
+	kindHistory
+	// kindTombstone records that the key was deleted.
+	kindTombstone
+
+	// kindBatchFlag is set on the stored kind byte of every entry of an
+	// atomic batch but the last. It never appears in entry.kind.
+	kindBatchFlag entryKind = 0x80
+	// kindEncodedFlag is set on the stored kind byte of values encoded by
+	// codecs, see entry.encoded. It never appears in entry.kind either.
+	kindEncodedFlag entryKind = 0x40
+)
+
 type entry struct {
 	key   string
 	value string
+	kind  entryKind
+	seq   uint64 // Zero in formats older than FormatV3
+	ts    int64  // Write time in Unix nanoseconds; zero before FormatV6
+	batch bool   // More entries of the same atomic write follow; FormatV7
+	// expires is when the entry stops being visible, in Unix nanoseconds;
+	// zero for never. Writers set ttl instead, which doBatch turns into
+	// expires relative to the write time. FormatV8.
+	expires int64
+	ttl     time.Duration
+	// encoded tells that value is encoded by codecs, see Options.Codecs.
+	// FormatV9.
+	encoded bool
 }
 
 type writeRequest struct {
-	key    string
-	value  string
-	respCh chan error
+	key   string
+	value string
+	kind  entryKind
+	// update, if set, computes the value from the current one inside the
+	// writer, which makes read-modify-write atomic.
+	update func(old string, exists bool) (string, error)
+	// batch, if set, returns entries written together in place of key and
+	// value. It runs inside the writer with db.mu held, and either all of
+	// the entries survive a crash or none does.
+	batch func() ([]entry, error)
+	// put holds the options of a Put.
+	put *putOptions
+	// reserved, if set, lets the write reach reserved keys. Only the
+	// features owning them set it.
+	reserved bool
+	// actor is recorded as the author of the write in the audit log.
+	actor string
+	// pending is the ID of the write in db.pending, zero if it has none.
+	pending uint64
+	respCh  chan error
+	queued  time.Time
+	// wait, if set, receives the time the write waited for the writer.
+	wait *time.Duration
 }
 
 type DB struct {
 	dir      string
-	segments []*segment
-	active   *segment
-	index    map[string]position
+	segments []*segment // Frozen, by ID
+	// stripes hold the active segments, see Options.WriteStripes.
+	stripes  []*stripe
+	nextID   int // ID of the next new segment
+	index    keydir
+	operands map[string]*operandChain // Keys with unfolded merge operands
+	mergeFn  MergeFunc
+	// validators check values before they are written, see
+	// RegisterValidator.
+	validators []prefixValidator
+	dedup      *dedup // Nil unless Options.Dedup is set
+	codecs     *codecs
+	zsets      zsets
 
-	mu      sync.RWMutex
-	writeCh chan writeRequest
-	quit    chan struct{}
-	wg      sync.WaitGroup
+	opts   Options
+	format uint16 // Format version of newly written segments
+	cache  *lruCache
+
+	writerSync    latencyHistogram
+	compactorSync latencyHistogram
+	putLatency    latencyHistogram
+	queueLatency  latencyHistogram
+	getLatency    latencyHistogram
+	mergeLatency  latencyHistogram
+
+	// seq is the sequence number of the latest write.
+	seq atomic.Uint64
+
+	puts           atomic.Uint64
+	gets           atomic.Uint64
+	misses         atomic.Uint64 // Gets of missing keys
+	bytesWritten   atomic.Uint64
+	writesRejected atomic.Uint64
+	writesTimedOut atomic.Uint64
+	readAheadBytes atomic.Uint64
+	scrubPasses    atomic.Uint64
+	scrubbedBytes  atomic.Uint64
+	corruptEntries atomic.Uint64
+
+	quotaRejections atomic.Uint64
+	evictedSegments atomic.Uint64
+	evictedKeys     atomic.Uint64
+
+	// view is what Get reads with IndexCOW, see publishView; nil with
+	// other indexes.
+	view atomic.Pointer[readView]
+
+	// Overrides set by Options, the auto-tuner and SetOption; zero means
+	// use the defaults.
+	segmentLimit atomic.Int64
+	compactAfter atomic.Int64
+	syncWrites   atomic.Bool // Options.SyncWrites, or as SetOption changed it
+
+	fs           FS
+	governor     *governor
+	compactionIO *tokenBucket
+	scrubIO      *tokenBucket
+	compaction   gate
+	mergeMu      sync.Mutex // Serialises merges and offloads
+	drops        int        // DropAll calls, naming the dropped files
+	// retired are the segments IndexCOW readers may still find in the
+	// published view, released by the next publishView. Guarded by mu.
+	retired []*segment
+	// merges are the merges the manifest records until their older
+	// inputs are removed. Guarded by mu.
+	merges    []mergeIntent
+	hookQueue *hookQueue // Nil unless Hooks.Async
+	auditLog  *auditLog  // Nil unless Options.Audit is set
+	pending   pendingWrites
+	evictor   *evictor // Nil unless Options.Eviction
+	// liveBytes is the size of the entries the index points to, see
+	// LiveSize. Guarded by mu.
+	liveBytes int64
+	watchers  watchers
+	// leases are the deadlines of the granted leases, see leaseReaper.
+	// Guarded by mu.
+	leases map[LeaseID]int64
+	tracer trace.Tracer // Nil unless Options.TracerProvider
+	// expvarPrefix is the prefix of the expvar variables of the DB, empty
+	// unless Options.Expvar is set.
+	expvarPrefix string
+	tier         *tier
+
+	events      *ring[Event]
+	compactions *ring[CompactionRecord]
+
+	mu   sync.RWMutex
+	quit chan struct{}
+	wg   sync.WaitGroup
 }
 
 func Open(dir string) (*DB, error) {
-	if err := os.MkdirAll(dir, 0o755); err != nil {
+	return OpenWithOptions(dir, Options{})
+}
+
+// OpenWithOptions opens the DB in dir configured by opts.
+func OpenWithOptions(dir string, opts Options) (*DB, error) {
+	format, err := writeFormat(opts.FormatVersion)
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeepVersions > 1 && !formatSpecs[format].history {
+		return nil, fmt.Errorf("%w: KeepVersions needs format %d or newer", ErrUnsupportedFormat, FormatV10)
+	}
+	if opts.Eviction != nil && !formatSpecs[format].tombstones {
+		return nil, fmt.Errorf("%w: Eviction needs format %d or newer", ErrUnsupportedFormat, FormatV4)
+	}
+	if opts.MaxAge > 0 && !formatSpecs[format].timestamp {
+		return nil, fmt.Errorf("%w: MaxAge needs format %d or newer", ErrUnsupportedFormat, FormatV6)
+	}
+	if opts.Codecs != nil && !formatSpecs[format].codecs {
+		return nil, fmt.Errorf("%w: Codecs needs format %d or newer", ErrUnsupportedFormat, FormatV9)
+	}
+	var codecOpts CodecOptions
+	if opts.Codecs != nil {
+		codecOpts = *opts.Codecs
+	}
+	valueCodecs, err := newCodecs(codecOpts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Dedup != nil {
+		if !formatSpecs[format].batches {
+			return nil, fmt.Errorf("%w: Dedup needs format %d or newer", ErrUnsupportedFormat, FormatV7)
+		}
+		if opts.KeepVersions > 1 || opts.Eviction != nil {
+			return nil, errors.New("Dedup cannot be combined with KeepVersions or Eviction")
+		}
+	}
+	queueSize := opts.WriteQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultWriteQueueSize
+	}
+	fsys := opts.FS
+	if fsys == nil {
+		fsys = OSFS{}
+	}
+	if err := fsys.MkdirAll(dir, 0o755); err != nil {
 		return nil, err
 	}
 	db := &DB{
-		dir:     dir,
-		index:   make(map[string]position),
-		quit:    make(chan struct{}),
-		writeCh: make(chan writeRequest, 100),
+		dir:         dir,
+		fs:          fsys,
+		operands:    make(map[string]*operandChain),
+		mergeFn:     withBuiltins(nil),
+		codecs:      valueCodecs,
+		opts:        opts,
+		format:      format,
+		governor:    newGovernor(opts.Governor),
+		events:      newRing[Event](eventLogSize),
+		compactions: newRing[CompactionRecord](compactionHistorySize),
+		quit:        make(chan struct{}),
+		leases:      make(map[LeaseID]int64),
+	}
+	for i := 0; i < max(opts.WriteStripes, 1); i++ {
+		db.stripes = append(db.stripes, newStripe(i, queueSize))
+	}
+	if db.index, err = db.newKeydir(opts); err != nil {
+		return nil, err
+	}
+	opened := false
+	defer func() {
+		if !opened {
+			db.closeFiles()
+		}
+	}()
+	db.syncWrites.Store(opts.SyncWrites)
+	db.segmentLimit.Store(opts.MaxSegmentSize)
+	if v := os.Getenv("SEG_MAX"); v != "" && opts.MaxSegmentSize <= 0 {
+		if n, _ := strconv.ParseInt(v, 10, 64); n > 0 {
+			db.segmentLimit.Store(n)
+		}
+	}
+	if opts.CompactionBytesPerSec > 0 {
+		db.compactionIO = newTokenBucket(float64(opts.CompactionBytesPerSec))
+	}
+	if opts.Scrub != nil {
+		rate := opts.Scrub.BytesPerSec
+		if rate <= 0 {
+			rate = defaultScrubBytesPerSec
+		}
+		db.scrubIO = newTokenBucket(float64(rate))
+	}
+	if opts.TracerProvider != nil {
+		db.tracer = opts.TracerProvider.Tracer(tracerName)
+	}
+	if opts.CacheBytes > 0 {
+		db.cache = newLRUCache(opts.CacheBytes)
+	} else if opts.AutoTune != nil && opts.AutoTune.MaxCacheBytes > 0 {
+		db.cache = newLRUCache(max(opts.AutoTune.MinCacheBytes, 1))
+	}
+
+	if opts.Eviction != nil {
+		db.evictor = newEvictor(*opts.Eviction)
+	}
+	if opts.Tier != nil {
+		if db.tier, err = newTier(fsys, dir, *opts.Tier); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := db.loadSegments(); err != nil {
@@ -79,272 +360,1055 @@ func Open(dir string) (*DB, error) {
 	if err := db.recover(); err != nil {
 		return nil, err
 	}
+	if opts.Dedup != nil {
+		db.dedup = newDedup(*opts.Dedup)
+		if err := db.loadDedup(); err != nil {
+			return nil, err
+		}
+	}
+	// New entries are always written in the negotiated format, so an active
+	// segment in any other version is frozen as is.
+	for _, st := range db.stripes {
+		if st.active.size > 0 && st.active.version != db.format {
+			if err := db.rotateActive(st); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := db.loadLeases(); err != nil {
+		return nil, err
+	}
+	db.publishView()
+	db.event(EventOpen, "opened %s with %d frozen segments and %d keys", dir, len(db.segments), db.index.len())
 
-	db.wg.Add(1)
-	go db.writer()
+	if opts.Audit != nil {
+		if db.auditLog, err = openAuditLog(fsys, dir, *opts.Audit); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Expvar != nil {
+		if err := db.publishExpvars(opts.Expvar.Prefix); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Hooks != nil && opts.Hooks.Async {
+		db.hookQueue = newHookQueue()
+	}
+	for _, st := range db.stripes {
+		db.wg.Add(1)
+		go db.writer(st)
+	}
 	go db.compactor()
+	db.wg.Add(1)
+	go db.leaseReaper()
+	if opts.AutoTune != nil {
+		db.wg.Add(1)
+		go db.autoTune()
+	}
+	if opts.Tier != nil && opts.Tier.Interval > 0 {
+		db.wg.Add(1)
+		go db.tierer(opts.Tier.Interval)
+	}
+	if opts.Scrub != nil {
+		interval := opts.Scrub.Interval
+		if interval <= 0 {
+			interval = defaultScrubInterval
+		}
+		db.wg.Add(1)
+		go db.scrubber(interval)
+	}
+	opened = true
 	return db, nil
 }
 
-func (db *DB) writer() {
+func (db *DB) writer(st *stripe) {
 	defer db.wg.Done()
+	flush, stop := db.flushTicker()
+	defer stop()
+	var batch []writeRequest
 	for {
 		select {
-		case req := <-db.writeCh:
-			err := db.doPut(req.key, req.value)
-			req.respCh <- err
+		case <-flush:
+			db.flushBuffered(st)
+		case <-st.queue.ready:
+			batch = db.commitAll(st.queue.take(batch, false))
 		case <-db.quit:
+			db.commitAll(st.queue.take(batch, true))
 			return
 		}
 	}
 }
 
-func (db *DB) doPut(key, value string) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// commitAll commits batch, at most maxWriteBatch writes at a time, and
+// returns it emptied for reuse.
+func (db *DB) commitAll(batch []writeRequest) []writeRequest {
+	for reqs := batch; len(reqs) > 0; {
+		n := min(len(reqs), maxWriteBatch)
+		db.commit(reqs[:n])
+		reqs = reqs[n:]
+	}
+	clear(batch)
+	return batch[:0]
+}
 
-	if v := os.Getenv("SEG_MAX"); v != "" {
-		if n, _ := strconv.ParseInt(v, 10, 64); n > 0 {
-			MaxSegmentSize = n
+// commit applies reqs, runs the write hooks once db.mu is released and
+// answers them.
+func (db *DB) commit(reqs []writeRequest) {
+	for _, req := range reqs {
+		db.queueLatency.since(req.queued)
+		if req.wait != nil {
+			*req.wait = time.Since(req.queued)
 		}
 	}
+	results := db.applySynced(reqs)
+	for i, req := range reqs {
+		r := results[i]
+		db.pending.done(req.key, req.pending)
+		db.audit(r.written, req.actor)
+		for _, e := range r.written {
+			db.committed(e)
+		}
+		if len(r.written) > 0 && db.evictor != nil {
+			db.evictOverBudget(r.written[0].key)
+		}
+		req.respCh <- r.err
+	}
+}
 
-	e := entry{key: key, value: value}
-	data := e.Encode()
+// applied is the outcome of a write request.
+type applied struct {
+	written []entry
+	err     error
+}
 
-	offset := db.active.size
-	n, err := db.active.file.Write(data)
+// applySynced applies reqs under a single hold of db.mu and fsyncs every
+// segment they ask for once: with one stripe before db.mu is released, so
+// reads never see a write before its fsync, else after.
+func (db *DB) applySynced(reqs []writeRequest) []applied {
+	results := make([]applied, len(reqs))
+	syncs := make([]*segment, len(reqs))
+	single := len(db.stripes) == 1
+	func() {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		defer db.publishView()
+		for i, req := range reqs {
+			results[i].written, syncs[i], results[i].err = db.apply(req)
+			// The segments to sync may be frozen and retired meanwhile.
+			if syncs[i] != nil {
+				syncs[i].ref()
+			}
+		}
+		if single {
+			db.syncAll(results, syncs)
+		}
+	}()
+	if !single {
+		db.syncAll(results, syncs)
+	}
+	for _, s := range syncs {
+		if s != nil {
+			db.unref(s)
+		}
+	}
+	return results
+}
+
+// syncAll fsyncs the segments in syncs, once each, and reports a failure to
+// every write that asked for it.
+func (db *DB) syncAll(results []applied, syncs []*segment) {
+	var errs map[*segment]error
+	for i, s := range syncs {
+		if s == nil {
+			continue
+		}
+		err, done := errs[s]
+		if !done {
+			err = db.syncFile(s.file, SyncSourceWriter)
+			if errs == nil {
+				errs = make(map[*segment]error)
+			}
+			errs[s] = err
+		}
+		if err != nil {
+			results[i].err = err
+		}
+	}
+}
+
+// apply writes req and returns the entries written, none if nothing was,
+// and the segment the caller must still fsync, if any. The caller must
+// hold db.mu.
+func (db *DB) apply(req writeRequest) ([]entry, *segment, error) {
+	if req.batch != nil {
+		entries, err := req.batch()
+		if err != nil || len(entries) == 0 {
+			if err == errSkipWrite {
+				err = nil
+			}
+			return nil, nil, err
+		}
+		if !req.reserved {
+			if err := checkReserved(entries); err != nil {
+				return nil, nil, err
+			}
+		}
+		st, err := db.writeBatch(entries)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db.syncWrite(req, st, entries)
+	}
+	if Reserved(req.key) && !req.reserved {
+		return nil, nil, ErrReservedKey
+	}
+	e := entry{key: req.key, value: req.value, kind: req.kind}
+	if req.put != nil {
+		if err := db.checkPut(req.key, req.put); err != nil {
+			return nil, nil, err
+		}
+		e.ttl = req.put.ttl
+	}
+	if e.kind == kindTombstone {
+		if _, exists, err := db.getLocked(e.key); err != nil || !exists {
+			return nil, nil, err
+		}
+	}
+	if req.update != nil {
+		old, exists, err := db.getLocked(req.key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if e.value, err = req.update(old, exists); err != nil {
+			if err == errSkipWrite {
+				err = nil
+			}
+			return nil, nil, err
+		}
+	}
+	written := []entry{e}
+	st := db.stripeFor(e.key)
+	if err := db.doBatch(st, written); err != nil {
+		return nil, nil, err
+	}
+	if req.put != nil && req.put.written != nil {
+		*req.put.written = written[0].seq
+	}
+	return db.syncWrite(req, st, written)
+}
+
+// doBatch appends entries to the active segment of st with a single write
+// and stamps them with their sequence numbers and write time. Recovery
+// indexes the entries of a batch only once it has read all of them. The
+// caller must hold db.mu.
+func (db *DB) doBatch(st *stripe, entries []entry) error {
+	if st.active.size == 0 {
+		if err := st.active.writeHeader(db.format); err != nil {
+			return err
+		}
+	}
+
+	if len(entries) > 1 && !formatSpecs[st.active.version].batches {
+		return fmt.Errorf("%w: atomic batches need format %d or newer", ErrUnsupportedFormat, FormatV7)
+	}
+
+	if err := db.validate(entries); err != nil {
+		return err
+	}
+	stored := entries
+	if db.dedup != nil {
+		stored = db.dedup.prepare(entries)
+	}
+	if len(db.codecs.policies) > 0 {
+		var err error
+		if stored, err = db.codecs.encode(stored); err != nil {
+			return err
+		}
+	}
+
+	ts := db.now().UnixNano()
+	var data []byte
+	var quota int64
+	for i := range stored {
+		e := &stored[i]
+		e.seq = db.seq.Load() + uint64(i) + 1
+		e.ts = ts
+		e.batch = i < len(stored)-1
+		st.active.collected.add(e.key)
+		if e.ttl > 0 {
+			e.expires = ts + int64(e.ttl)
+		}
+		enc, err := encodeEntry(e, st.active.version)
+		if err != nil {
+			return err
+		}
+		// Deletes are always accepted: merges need them to reclaim space.
+		if e.kind != kindTombstone {
+			quota += int64(len(enc))
+		}
+		if data == nil {
+			data = enc
+		} else {
+			data = append(data, enc...)
+		}
+	}
+	if quota > 0 {
+		if err := db.checkQuota(quota); err != nil {
+			return err
+		}
+	}
+
+	offset := st.active.size
+	n, err := db.appendActive(st, data)
 	if err != nil {
 		return err
 	}
 
-	// Update segment size
-	db.active.size += int64(n)
+	db.seq.Store(stored[len(stored)-1].seq)
+	db.puts.Add(uint64(len(entries)))
+	db.bytesWritten.Add(uint64(n))
 
 	// Update index
-	db.index[key] = position{
-		segID:  -1,
-		offset: offset,
+	for i := range stored {
+		e := &stored[i]
+		size := int64(entrySize(e, st.active.version))
+		if db.evictor != nil {
+			db.evictor.record(e.key, e.kind, size)
+		}
+		db.indexEntry(e.key, e.kind, position{
+			segID:  st.segID(),
+			offset: offset,
+			size:   size,
+		})
+		if db.cache != nil {
+			db.cache.remove(e.key)
+		}
+		offset += size
+	}
+	if db.dedup != nil {
+		db.dedup.commit(entries, stored)
 	}
 
 	// Check segment size
-	if db.active.size >= MaxSegmentSize {
-		if err := db.rotateActive(); err != nil {
+	if st.active.size >= db.maxSegmentSize() {
+		if err := db.rotateActive(st); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (db *DB) rotateActive() error {
+// maxSegmentSize is the size at which the active segment is rotated.
+func (db *DB) maxSegmentSize() int64 {
+	if n := db.segmentLimit.Load(); n > 0 {
+		return n
+	}
+	return DefaultMaxSegmentSize
+}
+
+// SetMaxSegmentSize changes the size at which the active segments of this
+// DB rotate, from the next write on; n <= 0 restores the default. The
+// auto-tuner, if enabled, goes on adjusting it.
+func (db *DB) SetMaxSegmentSize(n int64) {
+	db.segmentLimit.Store(max(n, 0))
+}
+
+// rotateActive freezes the active segment of st and moves st on to a new
+// one. The caller must hold db.mu.
+func (db *DB) rotateActive(st *stripe) error {
+	if err := db.flushActive(st); err != nil {
+		return err
+	}
 	// Sync active file
-	if err := db.active.file.Sync(); err != nil {
+	if err := db.syncFile(st.active.file, SyncSourceWriter); err != nil {
 		return err
 	}
 
-	// Determine next segment ID
-	nextID := 0
-	if len(db.segments) > 0 {
-		lastID := db.segments[len(db.segments)-1].id
-		nextID = lastID + 1
+	if db.opts.Preallocate {
+		if err := releasePreallocated(st.active.file, st.active.size); err != nil {
+			db.log(slog.LevelWarn, "releasing preallocated space failed", "path", st.active.path, "err", err)
+		}
 	}
 
-	// Rename active file
-	frozenPath := filepath.Join(db.dir, fmt.Sprintf("segment-%d.data", nextID))
-	if err := os.Rename(db.active.path, frozenPath); err != nil {
+	newActive, nextID, err := db.nextActive(st)
+	if err != nil {
+		return err
+	}
+	// The frozen segment is read through a read-only handle; the append
+	// handle is closed once no reader uses it.
+	frozenFile, err := db.fs.Open(st.active.path)
+	if err != nil {
+		newActive.file.Close()
 		return err
 	}
 
-	// Keep file descriptor open for frozen segment
-	frozenFile := db.active.file
-
-	// Add frozen segment
-	db.segments = append(db.segments, &segment{
-		file: frozenFile,
-		id:   nextID,
-		size: db.active.size,
-		path: frozenPath,
+	// Add frozen segment. Another stripe may have frozen newer ones.
+	old, frozenID := st.active, st.id
+	i, _ := slices.BinarySearchFunc(db.segments, frozenID, func(s *segment, id int) int { return cmp.Compare(s.id, id) })
+	db.segments = slices.Insert(slices.Clip(db.segments), i, &segment{
+		file:      frozenFile,
+		id:        frozenID,
+		size:      old.size,
+		path:      old.path,
+		version:   old.version,
+		dataStart: old.dataStart,
+		frozen:    db.now(),
+		keys:      old.collected.filter(),
+		dead:      old.dead,
 	})
+	db.retire([]*segment{old}, old.path)
 
 	// Update index
-	for key, pos := range db.index {
-		if pos.segID == -1 {
-			pos.segID = nextID
-			db.index[key] = pos
-		}
+	db.index.rebase(st.segID(), frozenID)
+	for _, chain := range db.operands {
+		chain.rebase(st.segID(), frozenID)
 	}
 
-	// Create new active segment
-	newActivePath := filepath.Join(db.dir, activeName)
-	newActiveFile, err := os.OpenFile(
-		newActivePath,
-		os.O_CREATE|os.O_RDWR|os.O_APPEND,
-		0o644,
-	)
+	st.active, st.id = newActive, nextID
+	db.event(EventRotate, "froze segment %d (%d bytes)", frozenID, old.size)
+	db.log(slog.LevelInfo, "segment rotated", "segment", frozenID, "bytes", old.size)
+	return db.preallocateActive(st)
+}
+
+// preallocateActive reserves space for a full active segment of st if
+// Options.Preallocate is set. A full disk is reported here, when the
+// segment is created, instead of by a later write.
+func (db *DB) preallocateActive(st *stripe) error {
+	if !db.opts.Preallocate {
+		return nil
+	}
+	if err := preallocate(st.active.file, db.maxSegmentSize()); err != nil {
+		db.log(slog.LevelError, "preallocating active segment failed", "path", st.active.path, "err", err)
+		return fmt.Errorf("preallocate %s: %w", st.active.path, err)
+	}
+	return nil
+}
+
+// writeHeader starts an empty segment with the header of version.
+func (s *segment) writeHeader(version uint16) error {
+	hdr := segmentPreamble(version)
+	n, err := s.file.Write(hdr)
+	s.size += int64(n)
 	if err != nil {
 		return err
 	}
+	s.version = version
+	s.dataStart = int64(len(hdr))
+	return nil
+}
 
-	db.active = &segment{
-		file: newActiveFile,
-		id:   -1,
-		size: 0,
-		path: newActivePath,
+// openSegment wraps an open segment file, detecting its format version.
+func openSegment(f File, id int, path string) (*segment, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	version, dataStart, err := readSegmentHeader(f, st.Size())
+	if err != nil {
+		return nil, fmt.Errorf("segment %s: %w", path, err)
+	}
+	return &segment{
+		file:      f,
+		id:        id,
+		size:      st.Size(),
+		path:      path,
+		version:   version,
+		dataStart: dataStart,
+		frozen:    st.ModTime(),
+	}, nil
 }
 
-func (db *DB) Put(key, value string) error {
-	respCh := make(chan error)
-	db.writeCh <- writeRequest{
-		key:    key,
-		value:  value,
-		respCh: respCh,
+// Put stores value under key. Options attach a TTL, fsync behaviour or a
+// precondition to this write only.
+func (db *DB) Put(key, value string, opts ...PutOption) error {
+	sync := db.syncWrites.Load()
+	if len(opts) == 0 && !sync {
+		return db.write(key, value, kindValue)
+	}
+	po := &putOptions{sync: sync}
+	for _, opt := range opts {
+		opt(po)
 	}
-	return <-respCh
+	if po.lease != 0 {
+		return db.putLeased(key, value, po)
+	}
+	return db.send(writeRequest{key: key, value: value, kind: kindValue, put: po, reserved: po.reserved})
+}
+
+// Delete removes key. Deleting a missing key is a no-op. It needs
+// FormatV4 or newer.
+func (db *DB) Delete(key string) error {
+	return db.write(key, "", kindTombstone)
+}
+
+func (db *DB) write(key, value string, kind entryKind) error {
+	return db.send(writeRequest{key: key, value: value, kind: kind})
+}
+
+// update replaces the value of key with fn applied to the current one,
+// atomically with respect to other writes.
+func (db *DB) update(key string, fn func(old string, exists bool) (string, error)) error {
+	return db.send(writeRequest{key: key, update: fn})
+}
+
+func (db *DB) send(req writeRequest) error {
+	return db.sendContext(context.Background(), req)
 }
 
 func (db *DB) Get(key string) (string, error) {
+	return db.GetContext(context.Background(), key)
+}
+
+// GetContext is Get whose span, with Options.TracerProvider, is a child
+// of the span of ctx.
+func (db *DB) GetContext(ctx context.Context, key string) (string, error) {
+	db.gets.Add(1)
+	defer db.getLatency.since(time.Now())
+	if db.evictor != nil {
+		db.evictor.touch(key)
+	}
+	var v string
+	var err error
+	if db.tracer != nil {
+		v, err = db.traceGet(ctx, key)
+	} else {
+		v, err = db.get(key, nil)
+	}
+	if errors.Is(err, ErrNotFound) {
+		db.misses.Add(1)
+	}
+	return v, err
+}
+
+// get reads the value of key, reporting where it found it in info unless
+// info is nil.
+func (db *DB) get(key string, info *readInfo) (string, error) {
+	if w, ok := db.pending.get(key); ok {
+		if info != nil {
+			info.source = "pending"
+		}
+		return w.result()
+	}
+	if db.cache != nil {
+		if v, ok := db.cache.get(key); ok {
+			if info != nil {
+				info.source = "cache"
+			}
+			return v, nil
+		}
+	}
+
+	bp := getEntryBuf()
+	defer putEntryBuf(bp)
+	raw, pos, nocache, err := db.lookup(key, bp)
+	if err != nil {
+		return "", err
+	}
+	if info != nil {
+		info.source, info.pos = "segment", pos
+	}
+	v := string(raw)
+	if db.cache != nil && !nocache {
+		// Only cache the value if no write replaced it while we were
+		// reading. Writers drop cached values before they publish a view,
+		// so this checks the index under db.mu even with IndexCOW.
+		db.mu.RLock()
+		if cur, ok := db.index.get(key); ok && cur == pos {
+			db.cache.add(key, v)
+		}
+		db.mu.RUnlock()
+	}
+	return v, nil
+}
+
+// GetAppend appends the value of key to dst and returns the extended
+// slice. Reads use pooled buffers, so with a large enough dst it does not
+// allocate. Values read from disk are not added to the cache.
+func (db *DB) GetAppend(key string, dst []byte) ([]byte, error) {
+	db.gets.Add(1)
+	defer db.getLatency.since(time.Now())
+	if db.evictor != nil {
+		db.evictor.touch(key)
+	}
+	if w, ok := db.pending.get(key); ok {
+		v, err := w.result()
+		return append(dst, v...), err
+	}
+	if db.cache != nil {
+		if v, ok := db.cache.get(key); ok {
+			return append(dst, v...), nil
+		}
+	}
+
+	bp := getEntryBuf()
+	defer putEntryBuf(bp)
+	raw, _, _, err := db.lookup(key, bp)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			db.misses.Add(1)
+		}
+		return dst, err
+	}
+	return append(dst, raw...), nil
+}
+
+// lookup reads the value of key past the cache. The value aliases *buf
+// unless it was folded from merge operands. nocache is set if the caller
+// must not cache the value: a folded one has been cached already, when
+// that is safe, and one that expires is never cached. pos is where a value
+// read from disk was found.
+func (db *DB) lookup(key string, buf *[]byte) (value []byte, pos position, nocache bool, err error) {
+	if v := db.view.Load(); v != nil {
+		value, pos, nocache, ok, err := db.lookupView(v, key, buf)
+		if ok {
+			return value, pos, nocache, err
+		}
+	}
 	db.mu.RLock()
-	pos, ok := db.index[key]
+	pos, ok := db.index.get(key)
 	if !ok {
 		db.mu.RUnlock()
-		return "", ErrNotFound
+		return nil, pos, false, ErrNotFound
 	}
-	var s *segment
-	if pos.segID == -1 {
-		s = db.active
-	} else {
-		idx := db.segIdx(pos.segID)
-		if idx < 0 || idx >= len(db.segments) {
-			db.mu.RUnlock()
-			return "", fmt.Errorf("invalid segment ID %d", pos.segID)
+	if chain, ok := db.operands[key]; ok {
+		defer db.mu.RUnlock()
+		v, expires, err := db.fold(key, chain)
+		if err != nil {
+			return nil, pos, true, err
 		}
-		s = db.segments[idx]
+		if db.cache != nil && expires == 0 {
+			db.cache.add(key, v)
+		}
+		return []byte(v), pos, true, nil
+	}
+	s, err := db.segmentFor(pos)
+	if err != nil {
+		db.mu.RUnlock()
+		return nil, pos, false, err
 	}
+	s.ref()
+	defer db.unref(s)
 	// Lock segment for reading
 	s.mu.RLock()
-	defer s.mu.RUnlock()
 	db.mu.RUnlock()
+	e, err := s.readEntryInto(pos.offset, pos.size, buf)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, pos, false, err
+	}
+	value, nocache, err = db.entryValue(key, e)
+	return value, pos, nocache, err
+}
 
-	// Read header: 8 bytes (key len + value len)
-	hdr := make([]byte, 8)
-	if _, err := s.file.ReadAt(hdr, pos.offset); err != nil {
-		return "", fmt.Errorf("failed to read entry header: %w", err)
+// entryValue returns the value of key read as e, decoded and dereferenced.
+func (db *DB) entryValue(key string, e entryView) (value []byte, nocache bool, err error) {
+	if string(e.key) != key || db.expired(db.expiresAt(e.ts, e.expires)) {
+		// Fingerprint collision with another key, or expired
+		return nil, false, ErrNotFound
 	}
-	kl := binary.LittleEndian.Uint32(hdr[0:4])
-	vl := binary.LittleEndian.Uint32(hdr[4:8])
-	totalSize := int64(8 + kl + vl)
+	nocache = db.expiresAt(e.ts, e.expires) != 0
+	if value, err = db.decodeValue(e.value, e.encoded); err != nil {
+		return nil, false, fmt.Errorf("value of %q: %w", key, err)
+	}
+	if db.dedup != nil && bytes.HasPrefix(value, []byte(dedupRefMagic)) {
+		v, err := db.deref(string(value))
+		return []byte(v), nocache, err
+	}
+	return value, nocache, nil
+}
+
+// getLocked returns the current value of key. The caller must hold db.mu.
+func (db *DB) getLocked(key string) (string, bool, error) {
+	pos, ok := db.index.get(key)
+	if !ok {
+		return "", false, nil
+	}
+	if chain, ok := db.operands[key]; ok {
+		v, _, err := db.fold(key, chain)
+		return v, err == nil, err
+	}
+	e, err := db.readAt(pos)
+	if err != nil || e.key != key || db.expired(db.expiresAt(e.ts, e.expires)) {
+		return "", false, err
+	}
+	if err := db.decodeEntryValue(&e); err != nil {
+		return "", false, err
+	}
+	v, err := db.derefLocked(e.value)
+	return v, err == nil, err
+}
 
-	// Read full entry
-	buf := make([]byte, totalSize)
-	copy(buf, hdr)
-	if _, err := s.file.ReadAt(buf[8:], pos.offset+8); err != nil {
-		return "", fmt.Errorf("failed to read entry body: %w", err)
+// segmentFor returns the segment holding pos. The caller must hold db.mu.
+func (db *DB) segmentFor(pos position) (*segment, error) {
+	if pos.segID < 0 {
+		return db.stripes[-1-pos.segID].active, nil
 	}
+	idx := db.segIdx(pos.segID)
+	if idx < 0 || idx >= len(db.segments) {
+		return nil, fmt.Errorf("invalid segment ID %d", pos.segID)
+	}
+	return db.segments[idx], nil
+}
 
-	var e entry
-	if err := e.Decode(buf); err != nil {
-		return "", fmt.Errorf("decode error: %w", err)
+// readEntry reads the entry stored at offset. The caller must hold s.mu.
+func (s *segment) readEntry(offset int64) (entry, error) {
+	bp := getEntryBuf()
+	defer putEntryBuf(bp)
+	v, err := s.readEntryInto(offset, 0, bp)
+	if err != nil {
+		return entry{}, err
 	}
-	return e.value, nil
+	return entry{key: string(v.key), value: string(v.value), kind: v.kind, seq: v.seq, ts: v.ts, expires: v.expires, encoded: v.encoded}, nil
 }
 
 func (db *DB) Size() (int64, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
-	var total int64
-	for _, s := range append(db.segments, db.active) {
-		total += s.size
-	}
-	return total, nil
+	return db.totalSize(), nil
+}
+
+// Count returns the number of keys, leaving out reserved ones.
+func (db *DB) Count() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	n, _ := db.reservedKeys()
+	return db.index.len() - n
+}
+
+// LiveSize estimates the bytes of live data: the on-disk size of the
+// latest entry of every key, or of the base value and operands a merged
+// value is folded from. Unlike Size it leaves out superseded entries and
+// tombstones awaiting a merge, as well as reserved keys. Keys of offloaded
+// segments count only the key after a reopen.
+func (db *DB) LiveSize() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	_, size := db.reservedKeys()
+	return db.liveBytes - size
 }
 
 func (db *DB) Close() error {
+	db.unpublishExpvars()
 	close(db.quit)
-	close(db.writeCh)
 	db.wg.Wait()
+	db.mu.Lock()
+	for _, st := range db.stripes {
+		if err := db.flushActive(st); err != nil {
+			db.log(slog.LevelError, "flushing write buffer failed", "err", err)
+		}
+	}
+	db.releaseRetired()
+	db.mu.Unlock()
+	db.closeWatchers()
+	if db.hookQueue != nil {
+		db.hookQueue.close()
+	}
+	return db.closeFiles()
+}
+
+// closeFiles closes the audit log, the index and the segments, those Open
+// got to if it failed.
+func (db *DB) closeFiles() error {
+	if db.auditLog != nil {
+		if err := db.auditLog.close(); err != nil {
+			db.log(slog.LevelError, "closing audit log failed", "err", err)
+		}
+	}
+	db.closeIndex()
 
 	var first error
-	for _, s := range append(db.segments, db.active) {
-		if err := s.file.Close(); err != nil && first == nil {
+	for _, s := range append(db.segments, db.actives()...) {
+		if s == nil {
+			continue
+		}
+		var err error
+		if s.remote != nil {
+			err = s.remote.close()
+		} else {
+			err = s.file.Close()
+		}
+		if err != nil && first == nil {
 			first = err
 		}
 	}
 	return first
 }
 
+// repoint moves key, indexed at old in a segment a merge replaced, to pos.
+// The caller must hold db.mu.
+func (db *DB) repoint(key string, old, pos position) {
+	if f, ok := db.index.(*fingerprintIndex); ok {
+		f.repoint(key, old, pos)
+		return
+	}
+	db.index.put(key, pos)
+}
+
+// closeIndex releases the files of index implementations that have them.
+func (db *DB) closeIndex() {
+	switch idx := db.index.(type) {
+	case *lazyIndex:
+		idx.close()
+	case *diskIndex:
+		idx.close()
+	}
+}
+
+// removeMergeTemp removes the output of an interrupted merge found at
+// Open.
+func (db *DB) removeMergeTemp(e fs.DirEntry) error {
+	var size int64
+	if info, err := e.Info(); err == nil {
+		size = info.Size()
+	}
+	p := filepath.Join(db.dir, e.Name())
+	if err := db.fs.Remove(p); err != nil {
+		return err
+	}
+	db.log(slog.LevelWarn, "removed output of an interrupted merge", "path", p, "bytes", size)
+	return nil
+}
+
 func (db *DB) loadSegments() error {
-	ents, err := os.ReadDir(db.dir)
+	if err := db.finishMerges(); err != nil {
+		return err
+	}
+	if err := db.finishDrop(); err != nil {
+		return err
+	}
+	ents, err := db.fs.ReadDir(db.dir)
 	if err != nil {
 		return err
 	}
 
+	remote := remoteIDs(ents)
 	var ids []int
+	legacy := false
 	for _, e := range ents {
+		if e.Name() == activeName {
+			legacy = true
+		}
 		if e.IsDir() || e.Name() == activeName {
 			continue
 		}
+		if mergeTmpRE.MatchString(e.Name()) {
+			// A merge was interrupted before its output replaced the
+			// segments it merged, which are still all there.
+			if err := db.removeMergeTemp(e); err != nil {
+				return err
+			}
+			continue
+		}
 		if m := segRE.FindStringSubmatch(e.Name()); len(m) == 2 {
 			id, _ := strconv.Atoi(m[1])
 			ids = append(ids, id)
+			if remote[id] {
+				// Offload stopped before the local file was removed; the
+				// local copy is complete, so keep using it.
+				db.log(slog.LevelWarn, "removing hint of an unfinished offload", "segment", id)
+				db.fs.Remove(filepath.Join(db.dir, fmt.Sprintf("segment-%d.remote", id)))
+				delete(remote, id)
+			}
 		}
 	}
+	for id := range remote {
+		ids = append(ids, id)
+	}
 	sort.Ints(ids)
+	actives, err := db.loadManifest(ids, legacy)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		db.nextID = ids[len(ids)-1] + 1
+	}
+	db.nextID = max(db.nextID, slices.Max(actives)+1)
+	// A single active segment is taken over as it is. Otherwise keys may
+	// hash to other stripes than before, so the active segments are
+	// frozen and every stripe starts a new one.
+	adopt := len(actives) == 1 && len(db.stripes) == 1
+	if adopt {
+		ids = slices.DeleteFunc(ids, func(id int) bool { return id == actives[0] })
+		if len(ids) > 0 && ids[len(ids)-1] > actives[0] {
+			return fmt.Errorf("segment %d is newer than the active segment %d", ids[len(ids)-1], actives[0])
+		}
+	}
 
 	for _, id := range ids {
-		p := filepath.Join(db.dir, fmt.Sprintf("segment-%d.data", id))
-		f, err := os.Open(p)
+		if remote[id] {
+			s, err := db.openRemoteSegment(id, filepath.Join(db.dir, fmt.Sprintf("segment-%d.remote", id)))
+			if err != nil {
+				return err
+			}
+			db.segments = append(db.segments, s)
+			continue
+		}
+		p := segmentPath(db.dir, id)
+		f, err := db.fs.Open(p)
+		if err != nil {
+			return err
+		}
+		s, err := openSegment(f, id, p)
 		if err != nil {
+			f.Close()
 			return err
 		}
-		st, _ := f.Stat()
-		db.segments = append(db.segments, &segment{file: f, id: id, size: st.Size(), path: p})
+		if s.size == 0 && slices.Contains(actives, id) {
+			// An active segment nothing was written to
+			f.Close()
+			if err := db.fs.Remove(p); err != nil {
+				return err
+			}
+			continue
+		}
+		db.segments = append(db.segments, s)
 	}
 
-	p := filepath.Join(db.dir, activeName)
-	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
-	if err != nil {
-		return err
+	if !adopt {
+		actives = make([]int, len(db.stripes))
+		for i := range actives {
+			actives[i] = db.nextID + i
+		}
+		if err := db.saveManifest(actives); err != nil {
+			return err
+		}
+		db.nextID += len(actives)
+	}
+	for i, st := range db.stripes {
+		if st.active, err = db.openActive(actives[i], st); err != nil {
+			return err
+		}
+		st.id = actives[i]
+		if err := db.preallocateActive(st); err != nil {
+			return err
+		}
 	}
-	st, _ := f.Stat()
-	db.active = &segment{file: f, id: -1, size: st.Size(), path: p}
 	return nil
 }
 
 func (db *DB) recover() error {
-	for _, s := range append(db.segments, db.active) {
-		if err := db.scanSegment(s); err != nil {
+	start := time.Now()
+	segs := append(db.segments, db.actives()...)
+	// Segments the checkpoint covers in full are not scanned at all.
+	from := db.loadCheckpoint()
+	if from != nil {
+		segs = slices.DeleteFunc(slices.Clone(segs), func(s *segment) bool {
+			_, ok := from[s]
+			return !ok
+		})
+	}
+	rp := newRecoveryProgress(db.opts.RecoveryProgress, segs)
+	total := 0
+	for _, s := range segs {
+		start := s.dataStart
+		if from != nil {
+			start = from[s]
+		}
+		n, err := db.scanSegment(s, start, rp)
+		if err != nil {
+			db.log(slog.LevelError, "recovery failed", "segment", s.id, "err", err)
 			return err
 		}
+		db.log(slog.LevelDebug, "segment scanned", "segment", s.id, "bytes", s.size, "entries", n, "remote", s.remote != nil)
+		total += n
+		rp.segmentDone(s.size)
+	}
+	// Only the entries scanned counted their dead bytes.
+	if from != nil {
+		db.countDead()
 	}
+	db.log(slog.LevelInfo, "recovery finished", "dir", db.dir, "segments", len(segs),
+		"entries", total, "keys", db.index.len(), "duration", time.Since(start))
 	return nil
 }
 
-func (db *DB) scanSegment(s *segment) error {
-	r := bufio.NewReader(s.file)
-	offset := int64(0)
-	for {
+// scanSegment indexes the entries of s from offset start and returns how
+// many it read. Remote segments are always indexed in full.
+func (db *DB) scanSegment(s *segment, start int64, rp *recoveryProgress) (int, error) {
+	if s.remote != nil {
+		return db.scanRemoteHint(s, rp)
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.file, start, s.size-start))
+	offset := start
+	count := 0
+	keys := keyHashes{complete: start == s.dataStart}
+	defer func() {
+		if s.id < 0 {
+			s.collected = keys
+		} else {
+			s.keys = keys.filter()
+		}
+	}()
+	// Entries of a batch whose last entry has not been read yet
+	var batch []entry
+	var batchPos []position
+	index := func(e entry, pos position) {
+		if e.kind != kindHistory {
+			db.indexEntry(e.key, e.kind, pos)
+			if db.evictor != nil {
+				db.evictor.record(e.key, e.kind, pos.size)
+			}
+		} else {
+			db.addDead(pos)
+		}
+		if e.seq > db.seq.Load() {
+			db.seq.Store(e.seq)
+		}
+	}
+	for ; ; count++ {
 		var e entry
-		n, err := e.DecodeFromReader(r)
+		n, err := decodeEntry(&e, r, s.version)
 		if errors.Is(err, io.EOF) {
 			break
 		}
 		if err != nil {
-			return err
+			if len(batch) > 0 {
+				// The batch is lost with this entry, and so is the rest
+				// of the segment.
+				_, err := db.recoveryError(s, batchPos[0].offset, 0, err)
+				return count, err
+			}
+			skip, err := db.recoveryError(s, offset, n, err)
+			if err != nil || skip == 0 {
+				return count, err
+			}
+			keys.complete = false
+			offset += skip
+			continue
+		}
+		keys.add(e.key)
+		pos := position{segID: s.id, offset: offset, size: int64(n)}
+		if e.batch {
+			batch = append(batch, e)
+			batchPos = append(batchPos, pos)
+		} else {
+			for i := range batch {
+				index(batch[i], batchPos[i])
+			}
+			batch, batchPos = batch[:0], batchPos[:0]
+			index(e, pos)
 		}
-		db.index[e.key] = position{segID: s.id, offset: offset}
 		offset += int64(n)
+		rp.entry(offset)
 	}
-	return nil
+	if len(batch) > 0 {
+		// A crash cut the batch short, so none of it was acknowledged.
+		_, err := db.recoveryError(s, batchPos[0].offset, 0, errTornBatch)
+		return count, err
+	}
+	return count, nil
 }
 
 func (db *DB) compactor() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(compactorInterval)
 	for {
 		select {
 		case <-ticker.C:
-			_ = db.merge()
+			if !db.compaction.isClosed() && db.segmentCount() >= db.compactThreshold() {
+				// Failures are logged and recorded by compact.
+				db.compact(context.Background(), db.opts.MergeWidth)
+			}
 		case <-db.quit:
 			ticker.Stop()
 			return
@@ -352,93 +1416,571 @@ func (db *DB) compactor() {
 	}
 }
 
+// compactThreshold is the number of frozen segments that triggers a
+// background merge.
+func (db *DB) compactThreshold() int {
+	if n := db.compactAfter.Load(); n > 0 {
+		return int(n)
+	}
+	return defaultCompactAfter
+}
+
+// segmentCount returns the number of local frozen segments, the ones
+// merge compacts.
+func (db *DB) segmentCount() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.segments) - db.localSuffix()
+}
+
 func (db *DB) Merge() error {
 	return db.merge()
 }
 
+// MergeContext is Merge that gives up once ctx is done, returning its
+// error and leaving the segments as they were. A merge suspended by
+// PauseCompaction is given up too.
+func (db *DB) MergeContext(ctx context.Context) error {
+	return db.compact(ctx, 0)
+}
+
+// MergeSmallest compacts the n adjacent local frozen segments with the
+// smallest total size, so its cost follows the size of recent, small
+// segments rather than of the whole store.
+func (db *DB) MergeSmallest(n int) error {
+	if n < 2 {
+		return fmt.Errorf("invalid merge width %d", n)
+	}
+	return db.compact(context.Background(), n)
+}
+
+// PauseCompaction stops background merges from starting and suspends a
+// running merge, including one started with Merge, until
+// ResumeCompaction is called. Close still interrupts a suspended merge.
+func (db *DB) PauseCompaction() {
+	db.compaction.close()
+	db.event(EventCompactionPaused, "compaction paused")
+}
+
+// ResumeCompaction lets merges suspended by PauseCompaction continue.
+func (db *DB) ResumeCompaction() {
+	db.compaction.open()
+	db.event(EventCompactionResumed, "compaction resumed")
+}
+
+// merge compacts all local frozen segments into one.
 func (db *DB) merge() error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	if len(db.segments) < 2 {
+	return db.compact(context.Background(), 0)
+}
+
+// smallestRun returns the start of the run of width adjacent segments
+// with the smallest total size.
+func smallestRun(segs []*segment, width int) int {
+	best, bestSize := 0, int64(-1)
+	var size int64
+	for i, s := range segs {
+		size += s.size
+		if i >= width {
+			size -= segs[i-width].size
+		}
+		if i >= width-1 && (bestSize < 0 || size < bestSize) {
+			best, bestSize = i-width+1, size
+		}
+	}
+	return best
+}
+
+// compact merges a run of adjacent local frozen segments into one, picked
+// by pickRun. Offloaded segments are left alone. Entries are copied outside
+// db.mu, since frozen segments never change, and the result is swapped in
+// under a short critical section. The merged segment takes over the ID of
+// the newest input, so segments frozen while the merge ran still sort after
+// it. It may lack tombstones the older inputs need, so the manifest records
+// the merge before the merged segment is renamed into place, and Open
+// finishes it should older inputs outlive a crash, see mergeIntent.
+func (db *DB) compact(ctx context.Context, width int) (err error) {
+	db.mergeMu.Lock()
+	defer db.mergeMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.mu.RLock()
+	first := db.localSuffix()
+	olds := slices.Clone(db.segments[first:])
+	olds = db.pickRun(olds[:db.mergeable(olds)], width)
+	if len(olds) > 0 {
+		first = db.segIdx(olds[0].id)
+	}
+	fn := db.mergeFn
+	var liveBlobs map[string]bool
+	if db.dedup != nil {
+		liveBlobs = db.dedup.live()
+	}
+	older := make([]*keyFilter, first)
+	for i, s := range db.segments[:first] {
+		older[i] = s.keys
+	}
+	db.mu.RUnlock()
+	if len(olds) < 2 {
 		return nil
 	}
+	mergedID := olds[len(olds)-1].id
+	db.removeCheckpoint()
 
-	// Find max segment ID for merged segment
-	maxID := -1
-	for _, s := range db.segments {
-		if s.id > maxID {
-			maxID = s.id
-		}
+	rec := CompactionRecord{Start: time.Now(), Segments: len(olds)}
+	for _, s := range olds {
+		rec.BytesBefore += s.size
 	}
-	mergedID := maxID + 1
+	db.log(slog.LevelInfo, "merge started", "segments", rec.Segments, "bytes", rec.BytesBefore)
+	ctx, span := db.startSpan(ctx, "datastore.Merge")
+	defer func() {
+		span.SetAttributes(attribute.Int("db.merge.segments", rec.Segments),
+			attribute.Int64("db.merge.bytes_before", rec.BytesBefore), attribute.Int64("db.merge.bytes_after", rec.BytesAfter))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		rec.Duration = time.Since(rec.Start)
+		db.mergeLatency.observe(rec.Duration)
+		if err != nil {
+			rec.Err = err.Error()
+			db.event(EventMergeFailed, "merge of %d segments failed: %v", rec.Segments, err)
+			db.log(slog.LevelError, "merge failed", "segments", rec.Segments, "duration", rec.Duration, "err", err)
+		} else {
+			db.event(EventMerge, "merged %d segments, %d -> %d bytes", rec.Segments, rec.BytesBefore, rec.BytesAfter)
+			db.log(slog.LevelInfo, "merge finished", "segments", rec.Segments, "bytes_before", rec.BytesBefore,
+				"bytes_after", rec.BytesAfter, "reclaimed", rec.BytesBefore-rec.BytesAfter, "duration", rec.Duration)
+		}
+		db.compactions.add(rec)
+		db.mergeComplete(rec)
+	}()
 
 	tmp := filepath.Join(db.dir, fmt.Sprintf("merge-tmp-%d.data", time.Now().UnixNano()))
-	tf, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR, 0o644)
+	tf, err := db.fs.OpenFile(tmp, os.O_CREATE|os.O_RDWR, 0o644)
 	if err != nil {
 		return err
 	}
 	defer tf.Close()
+	// Once the manifest may record the merge, Open needs the output.
+	keepTmp := false
+	defer func() {
+		if !keepTmp {
+			db.fs.Remove(tmp)
+		}
+	}()
 
-	seen := make(map[string]struct{})
-	for i := len(db.segments) - 1; i >= 0; i-- {
-		if err := db.copyUnique(db.segments[i], tf, seen); err != nil {
+	hdr := segmentPreamble(db.format)
+	if _, err := tf.Write(hdr); err != nil {
+		return err
+	}
+
+	// Newest segments first, so the first copy of a key is its latest value.
+	w := &mergeWriter{
+		w:         bufio.NewWriter(tf),
+		version:   db.format,
+		fn:        fn,
+		offset:    int64(len(hdr)),
+		segID:     mergedID,
+		offsets:   make(map[string]position),
+		pending:   make(map[string][]entry),
+		keep:      db.opts.KeepVersions,
+		maxAge:    db.opts.MaxAge,
+		versions:  make(map[string]int),
+		opOffsets: make(map[string][]position),
+		deleted:   make(map[string]bool),
+		now:       db.now().UnixNano(),
+		keys:      keyHashes{complete: true},
+		older:     older,
+		liveBlobs: liveBlobs,
+		deref:     db.deref,
+		decode:    db.decodeEntryValue,
+		// Tombstones hide the history kept with KeepVersions.
+		keepTombstones: db.opts.KeepVersions > 1,
+	}
+	quit, release := quitOrDone(db.quit, ctx)
+	defer release()
+	task := db.governor.start(quit)
+	task.limit, task.gate = db.compactionIO, &db.compaction
+	for i := len(olds) - 1; i >= 0; i-- {
+		if err := db.copyUnique(olds[i], w, task); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+	// Operands whose key has no base value in the merged segments. If
+	// older segments were left out, offloaded or not picked, the base may
+	// live there, so the operands are kept as they are.
+	for key, ops := range w.pending {
+		var err error
+		if first > 0 {
+			err = w.writeOperands(key, ops)
+		} else {
+			err = w.fold(key, "", false, ops)
+		}
+		if err != nil {
 			return err
 		}
 	}
-	tf.Sync()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := db.syncFile(tf, SyncSourceCompactor); err != nil {
+		return err
+	}
 
-	mergedPath := filepath.Join(db.dir, fmt.Sprintf("segment-%d.data", mergedID))
-	if err := os.Rename(tmp, mergedPath); err != nil {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	defer db.publishView()
+
+	// The fingerprint index may answer with the entry of a colliding key,
+	// told apart by reading the key back while the inputs are still there.
+	indexed := db.index.get
+	if f, ok := db.index.(*fingerprintIndex); ok {
+		var keys []string
+		for key := range w.offsets {
+			keys = append(keys, key)
+		}
+		for key := range w.deleted {
+			keys = append(keys, key)
+		}
+		for key := range w.opOffsets {
+			keys = append(keys, key)
+		}
+		indexed = f.verified(keys)
+	}
+
+	ids := make([]int, len(olds))
+	for i, s := range olds {
+		ids[i] = s.id
+	}
+	db.merges = append(db.merges, mergeIntent{tmp: filepath.Base(tmp), ids: ids, olds: olds[:len(olds)-1]})
+	if err := db.saveManifest(db.activeIDs()); err != nil {
+		db.merges = db.merges[:len(db.merges)-1]
+		keepTmp = true
 		return err
 	}
+	mergedPath := segmentPath(db.dir, mergedID)
+	if err := db.fs.Rename(tmp, mergedPath); err != nil {
+		db.merges = db.merges[:len(db.merges)-1]
+		keepTmp = db.saveManifest(db.activeIDs()) != nil
+		return err
+	}
+	sf, err := db.fs.Open(mergedPath)
+	if err != nil {
+		return err
+	}
+	merged, err := openSegment(sf, mergedID, mergedPath)
+	if err != nil {
+		sf.Close()
+		return err
+	}
+	merged.frozen = olds[len(olds)-1].frozen
+	merged.keys = w.keys.filter()
 
-	// Lock and close old segments
-	oldSegments := db.segments
-	for _, s := range oldSegments {
-		s.mu.Lock()
-		s.file.Close()
-		os.Remove(s.path)
-		s.mu.Unlock()
+	mergedIDs := make(map[int]bool, len(olds))
+	for _, s := range olds {
+		mergedIDs[s.id] = true
 	}
+	// Other stripes may have frozen segments in between meanwhile; they
+	// hold none of the merged keys, see stripe.
+	db.segments = slices.DeleteFunc(slices.Clone(db.segments), func(s *segment) bool { return mergedIDs[s.id] })
+	i, _ := slices.BinarySearchFunc(db.segments, mergedID, func(s *segment, id int) int { return cmp.Compare(s.id, id) })
+	db.segments = slices.Insert(db.segments, i, merged)
+	// Reads that took a reference to an old segment before the swap finish
+	// on it before it is closed.
+	db.retire(olds, mergedPath)
+	rec.BytesAfter = merged.size
 
-	// Create new merged segment
-	sf, err := os.Open(mergedPath)
+	// Repoint keys whose latest entry was merged. Keys written since the
+	// snapshot already point past it, but operands written since then now
+	// fold onto the merged value.
+	// Whatever the keys do not point to afterwards is dead.
+	live := int64(0)
+	for key, newPos := range w.offsets {
+		before := db.keyBytes(key)
+		if pos, ok := indexed(key); ok && mergedIDs[pos.segID] {
+			db.repoint(key, pos, newPos)
+			delete(db.operands, key)
+			live += newPos.size
+		} else if chain, ok := db.operands[key]; ok {
+			chain.base, chain.hasBase = newPos, true
+			chain.ops = slices.DeleteFunc(chain.ops, func(p position) bool { return mergedIDs[p.segID] })
+			live += newPos.size
+		}
+		db.liveBytes += db.keyBytes(key) - before
+	}
+	// Keys the merge found expired are still indexed unless written since.
+	for key := range w.deleted {
+		if pos, ok := indexed(key); ok && mergedIDs[pos.segID] {
+			if _, ok := db.operands[key]; !ok {
+				db.liveBytes -= pos.size
+				if f, ok := db.index.(*fingerprintIndex); ok {
+					f.removeAt(key, pos)
+				} else {
+					db.index.remove(key)
+				}
+			}
+		}
+	}
+	for key, mergedOps := range w.opOffsets {
+		chain, ok := db.operands[key]
+		if !ok || !slices.ContainsFunc(chain.ops, func(p position) bool { return mergedIDs[p.segID] }) {
+			// Overwritten since the snapshot
+			continue
+		}
+		before := db.keyBytes(key)
+		ops := make([]position, 0, len(mergedOps)+len(chain.ops))
+		ops = append(ops, mergedOps...)
+		for _, p := range chain.ops {
+			if !mergedIDs[p.segID] {
+				ops = append(ops, p)
+			}
+		}
+		chain.ops = ops
+		if pos, ok := indexed(key); ok && mergedIDs[pos.segID] {
+			db.repoint(key, pos, ops[len(ops)-1])
+		}
+		db.liveBytes += db.keyBytes(key) - before
+		for _, p := range mergedOps {
+			live += p.size
+		}
+	}
+	merged.dead = max(merged.size-merged.dataStart-live, 0)
+
+	if db.cache != nil {
+		db.cache.purge()
+	}
+	return nil
+}
+
+// mergeWriter appends merged entries and remembers where each key landed.
+type mergeWriter struct {
+	w       *bufio.Writer
+	version uint16
+	fn      MergeFunc
+	offset  int64
+	segID   int // ID the merged segment will take
+	offsets map[string]position
+	// Operands of keys whose base value has not been reached yet, newest
+	// first.
+	pending map[string][]entry
+	// keep is the number of versions per key to retain and versions the
+	// number written so far.
+	keep     int
+	versions map[string]int
+	maxAge   time.Duration // Options.MaxAge
+	// Positions of operands copied without folding, oldest first.
+	opOffsets map[string][]position
+	// Keys whose latest entry is a tombstone. Tombstones are only copied if
+	// older segments or history could still hold a value they hide: older
+	// holds the key filters of the segments older than the merged ones.
+	deleted        map[string]bool
+	older          []*keyFilter
+	keepTombstones bool
+	// now is the time values are checked for expiry against. Expired ones
+	// are written as tombstones.
+	now int64
+	// keys collects the keys written, for the merged segment's filter.
+	keys keyHashes
+	// liveBlobs holds the dedup blobs referenced when the merge started,
+	// the others are dropped; nil without Options.Dedup. deref resolves
+	// references in values operands fold onto.
+	liveBlobs map[string]bool
+	deref     func(string) (string, error)
+	// decode decodes values encoded by Options.Codecs. Entries are copied
+	// encoded, only values operands fold onto are decoded.
+	decode func(*entry) error
+}
+
+func (w *mergeWriter) write(e *entry) error {
+	data, err := encodeEntry(e, w.version)
 	if err != nil {
 		return err
 	}
-	st, _ := sf.Stat()
-	db.segments = []*segment{{file: sf, id: mergedID, size: st.Size(), path: mergedPath}}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	w.offsets[e.key] = position{segID: w.segID, offset: w.offset, size: int64(len(data))}
+	w.offset += int64(len(data))
+	w.versions[e.key] = 1
+	w.keys.add(e.key)
+	return nil
+}
 
-	// Rebuild index
-	db.index = make(map[string]position)
-	if err := db.scanSegment(db.segments[0]); err != nil {
+// writeTombstone records that the key of e is deleted, copying the
+// tombstone unless it can be dropped: no segment older than the merged
+// ones holds the key, and inputs that outlive a crash are removed by Open,
+// see mergeIntent.
+func (w *mergeWriter) writeTombstone(e *entry) error {
+	w.deleted[e.key] = true
+	if !w.keepTombstones && !mayHoldKey(w.older, e.key) {
+		return nil
+	}
+	data, err := encodeEntry(e, w.version)
+	if err != nil {
 		return err
 	}
-	if err := db.scanSegment(db.active); err != nil {
+	if _, err := w.w.Write(data); err != nil {
 		return err
 	}
+	w.offset += int64(len(data))
+	w.versions[e.key] = 1
+	w.keys.add(e.key)
 	return nil
 }
 
-func (db *DB) copyUnique(src *segment, dst *os.File, seen map[string]struct{}) error {
-	src.file.Seek(0, io.SeekStart)
-	r := bufio.NewReader(src.file)
+// writeOperands copies ops, given newest first, as operands.
+func (w *mergeWriter) writeOperands(key string, ops []entry) error {
+	for i := len(ops) - 1; i >= 0; i-- {
+		data, err := encodeEntry(&ops[i], w.version)
+		if err != nil {
+			return err
+		}
+		if _, err := w.w.Write(data); err != nil {
+			return err
+		}
+		w.opOffsets[key] = append(w.opOffsets[key], position{segID: w.segID, offset: w.offset, size: int64(len(data))})
+		w.offset += int64(len(data))
+	}
+	w.keys.add(key)
+	delete(w.pending, key)
+	return nil
+}
+
+// writeHistory keeps e, an older value of a key already written, if the
+// key has fewer than keep versions so far.
+func (w *mergeWriter) writeHistory(e *entry) error {
+	n, ok := w.versions[e.key]
+	if !ok || n >= w.keep {
+		return nil
+	}
+	if aged := agedExpiry(e.ts, 0, w.maxAge); aged != 0 && aged <= w.now {
+		return nil
+	}
+	h := *e
+	h.kind = kindHistory
+	data, err := encodeEntry(&h, w.version)
+	if err != nil {
+		return err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	w.offset += int64(len(data))
+	w.versions[e.key] = n + 1
+	w.keys.add(e.key)
+	return nil
+}
+
+// fold applies the merge operator to ops, given newest first, and writes
+// the result as a full value stamped with the newest operand's sequence
+// number.
+func (w *mergeWriter) fold(key, base string, exists bool, ops []entry) error {
+	if w.fn == nil {
+		return ErrNoMergeOperator
+	}
+	values := make([]string, len(ops))
+	for i, op := range ops {
+		values[len(ops)-1-i] = op.value
+	}
+	if exists {
+		var err error
+		if base, err = w.deref(base); err != nil {
+			return err
+		}
+	}
+	v, err := w.fn(key, base, exists, values)
+	if err != nil {
+		return err
+	}
+	delete(w.pending, key)
+	return w.write(&entry{key: key, value: v, seq: ops[0].seq, ts: ops[0].ts})
+}
+
+// copyUnique copies the entries of src that are not shadowed by newer ones
+// into dst. Entries are visited newest first, so the segment is decoded
+// into memory before anything is written.
+func (db *DB) copyUnique(src *segment, dst *mergeWriter, task *bgTask) error {
+	var ents []entry
+	r := bufio.NewReader(io.NewSectionReader(src.file, src.dataStart, src.size-src.dataStart))
 	for {
 		var e entry
-		_, err := e.DecodeFromReader(r)
+		n, err := decodeEntry(&e, r, src.version)
 		if errors.Is(err, io.EOF) {
 			break
 		}
 		if err != nil {
 			return err
 		}
-		if _, ok := seen[e.key]; ok {
+		if err := task.step(n); err != nil {
+			return err
+		}
+		// Frozen segments only hold whole batches, and merged ones keep
+		// just some of their entries.
+		e.batch = false
+		ents = append(ents, e)
+	}
+
+	for i := len(ents) - 1; i >= 0; i-- {
+		e := &ents[i]
+		if e.kind == kindHistory {
+			continue
+		}
+		if _, ok := dst.offsets[e.key]; ok || dst.deleted[e.key] {
+			if e.kind == kindValue {
+				if err := dst.writeHistory(e); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if e.kind == kindMergeOperand {
+			dst.pending[e.key] = append(dst.pending[e.key], *e)
+			continue
+		}
+		if dst.liveBlobs != nil && !dst.liveBlobs[e.key] && strings.HasPrefix(e.key, dedupBlobPrefix) {
+			// Copies written since have a new position and stay indexed.
+			dst.deleted[e.key] = true
 			continue
 		}
-		seen[e.key] = struct{}{}
-		if _, err := dst.Write(e.Encode()); err != nil {
+		if e.kind == kindValue {
+			if expires := agedExpiry(e.ts, e.expires, dst.maxAge); expires != 0 && expires <= dst.now {
+				e = &entry{key: e.key, kind: kindTombstone, seq: e.seq, ts: e.ts}
+			}
+		}
+		var err error
+		ops, pending := dst.pending[e.key]
+		switch {
+		case pending && e.kind == kindTombstone:
+			err = dst.fold(e.key, "", false, ops)
+		case pending:
+			if err = dst.decode(e); err == nil {
+				err = dst.fold(e.key, e.value, true, ops)
+			}
+		case e.kind == kindTombstone:
+			err = dst.writeTombstone(e)
+		default:
+			err = dst.write(e)
+		}
+		if err != nil {
 			return err
 		}
+		if err := task.step(len(e.key) + len(e.value)); err != nil {
+			return err
+		}
+	}
+	// Kept history is older than everything else in src and already
+	// stored newest first.
+	for i := range ents {
+		if ents[i].kind == kindHistory {
+			if err := dst.writeHistory(&ents[i]); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -508,3 +2050,26 @@ func (db *DB) GetInt64(key string) (int64, error) {
 	}
 	return strconv.ParseInt(strVal, 10, 64)
 }
+
+// IncrInt64 атомарно додає delta до int64-значення (відсутній ключ
+// вважається нулем) і повертає нове значення. Виконується в горутині
+// запису, тож паралельні інкременти не губляться.
+func (db *DB) IncrInt64(key string, delta int64) (int64, error) {
+	var n int64
+	err := db.update(key, func(old string, exists bool) (string, error) {
+		n = 0
+		if exists {
+			cur, err := strconv.ParseInt(old, 10, 64)
+			if err != nil {
+				return "", fmt.Errorf("value of %q is not an int64: %w", key, err)
+			}
+			n = cur
+		}
+		n += delta
+		return strconv.FormatInt(n, 10), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -3,6 +3,7 @@ package datastore
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -56,3 +57,161 @@ func TestSegmentRotationAndMerge(t *testing.T) {
 		}
 	}
 }
+
+func TestSmallestRun(t *testing.T) {
+	segs := []*segment{{size: 900}, {size: 100}, {size: 300}, {size: 50}, {size: 60}, {size: 500}}
+	if i := smallestRun(segs, 2); i != 3 {
+		t.Errorf("expected run at 3, got %d", i)
+	}
+	if i := smallestRun(segs, 3); i != 2 {
+		t.Errorf("expected run at 2, got %d", i)
+	}
+}
+
+func TestMergeSmallest(t *testing.T) {
+	dir := "test_merge_smallest"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.RegisterMerge(sumMerge)
+
+	// Великий сегмент після повного злиття
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("counter", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	big := db.segments[0]
+
+	// Дрібні сегменти з перезаписами та операндами
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%10), "new"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.MergeValue("counter", "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := len(db.segments)
+	if before < 4 {
+		t.Fatalf("expected several small segments, got %d", before)
+	}
+
+	if err := db.MergeSmallest(2); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.segments) != before-1 {
+		t.Errorf("expected %d segments, got %d", before-1, len(db.segments))
+	}
+	if db.segments[0] != big {
+		t.Error("expected the big segment to be left alone")
+	}
+
+	check := func(db *DB) {
+		t.Helper()
+		for i := 0; i < 30; i++ {
+			want := strings.Repeat("v", 20)
+			if i < 10 {
+				want = "new"
+			}
+			if v, err := db.Get(fmt.Sprintf("key%d", i)); err != nil || v != want {
+				t.Errorf("key%d: expected %s, got %q, %v", i, want, v, err)
+			}
+		}
+		// Операнди без основи у злитих сегментах не згортаються
+		if v, err := db.Get("counter"); err != nil || v != "30" {
+			t.Errorf("expected counter 30, got %q, %v", v, err)
+		}
+	}
+	check(db)
+
+	db.Close()
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	reopened.RegisterMerge(sumMerge)
+	check(reopened)
+}
+
+// Кожна БД у процесі має власний розмір сегмента
+func TestMaxSegmentSize_PerDB(t *testing.T) {
+	dir := "test_segment_size"
+	defer os.RemoveAll(dir)
+
+	small, err := OpenWithOptions(dir+"/small", Options{MaxSegmentSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer small.Close()
+	large, err := Open(dir + "/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer large.Close()
+
+	put := func(db *DB) {
+		for i := 0; i < 10; i++ {
+			if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	put(small)
+	put(large)
+	if len(small.segments) == 0 || len(large.segments) != 0 {
+		t.Fatalf("frozen segments: small %d, large %d", len(small.segments), len(large.segments))
+	}
+
+	large.SetMaxSegmentSize(100)
+	put(large)
+	if len(large.segments) == 0 {
+		t.Error("expected rotation after SetMaxSegmentSize")
+	}
+	if large.SetMaxSegmentSize(0); large.Stats().MaxSegmentSize != DefaultMaxSegmentSize {
+		t.Errorf("MaxSegmentSize = %d after reset", large.Stats().MaxSegmentSize)
+	}
+}
+
+func TestOpen_RemovesMergeTemp(t *testing.T) {
+	dir := "test_merge_temp"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Вихід перерваного злиття лишився в каталозі
+	tmp := filepath.Join(dir, "merge-tmp-12345.data")
+	if err := os.WriteFile(tmp, []byte("partial merge output"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", tmp, err)
+	}
+	if v, err := db.Get("key"); err != nil || v != "value" {
+		t.Errorf("Get(key) = %q, %v", v, err)
+	}
+}
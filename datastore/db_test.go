@@ -79,3 +79,74 @@ func TestSize(t *testing.T) {
 		t.Errorf("Expected size > 0, got %d", size)
 	}
 }
+
+func TestCountAndLiveSize(t *testing.T) {
+	dir := "test_live_size"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "150")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		want[key] = "value"
+		if err := db.Put(key, "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Перезапис і видалення коригують лічильники
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("key%d", i)
+		want[key] = "a much longer value"
+		if err := db.Put(key, want[key]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 15; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		delete(want, key)
+		if err := db.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := func() int64 {
+		var n int64
+		for k, v := range want {
+			data, err := encodeEntry(&entry{key: k, value: v}, CurrentFormat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += int64(len(data))
+		}
+		return n
+	}
+	check := func(db *DB, stage string) {
+		t.Helper()
+		if n := db.Count(); n != len(want) {
+			t.Errorf("%s: Count = %d, want %d", stage, n, len(want))
+		}
+		if n := db.LiveSize(); n != expected() {
+			t.Errorf("%s: LiveSize = %d, want %d", stage, n, expected())
+		}
+	}
+	check(db, "after writes")
+	if size, _ := db.Size(); db.LiveSize() >= size {
+		t.Errorf("LiveSize %d should leave out dead data of Size %d", db.LiveSize(), size)
+	}
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db, "after merge")
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db, "after reopen")
+}
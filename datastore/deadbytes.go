@@ -0,0 +1,82 @@
+package datastore
+
+// Every segment counts its dead bytes: the entries the index no longer
+// points to, superseded versions, tombstones and history, which a merge
+// can reclaim. Writes add the entries they supersede, recovery and merges
+// count the segments they read or write from the index. Offloaded
+// segments found at open index only their keys, so they count none.
+
+// supersede adds the entries key is read from to the dead bytes of their
+// segments, before the write of kind replaces them. The caller must hold
+// db.mu.
+func (db *DB) supersede(key string, kind entryKind, pos position) {
+	if kind == kindTombstone {
+		db.addDead(pos)
+	}
+	if kind == kindMergeOperand {
+		return
+	}
+	if chain, ok := db.operands[key]; ok {
+		if chain.hasBase {
+			db.addDead(chain.base)
+		}
+		for _, p := range chain.ops {
+			db.addDead(p)
+		}
+		return
+	}
+	if prev, ok := db.index.get(key); ok {
+		db.addDead(prev)
+	}
+}
+
+func (db *DB) addDead(pos position) {
+	if s, err := db.segmentFor(pos); err == nil {
+		s.dead += pos.size
+	}
+}
+
+// countDead sets the dead bytes of every local segment to what the index
+// does not point to. The caller must hold db.mu.
+func (db *DB) countDead() {
+	segs := append(append([]*segment(nil), db.segments...), db.actives()...)
+	live := make(map[*segment]int64, len(segs))
+	add := func(pos position) {
+		if s, err := db.segmentFor(pos); err == nil {
+			live[s] += pos.size
+		}
+	}
+	db.index.ascend("", "", func(key string, pos position) bool {
+		if _, chained := db.operands[key]; !chained {
+			add(pos)
+		}
+		return true
+	})
+	for _, chain := range db.operands {
+		if chain.hasBase {
+			add(chain.base)
+		}
+		for _, p := range chain.ops {
+			add(p)
+		}
+	}
+	for _, s := range segs {
+		s.dead = 0
+		if s.remote == nil && s.size > s.dataStart {
+			s.dead = max(s.size-s.dataStart-live[s], 0)
+		}
+	}
+}
+
+// DeadBytes returns the dead bytes of all segments, the part of Size a
+// merge of every segment would reclaim, give or take the tombstones and
+// history it keeps.
+func (db *DB) DeadBytes() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var n int64
+	for _, s := range append(append([]*segment(nil), db.segments...), db.actives()...) {
+		n += s.dead
+	}
+	return n
+}
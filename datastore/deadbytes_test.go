@@ -0,0 +1,100 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// checkDead перевіряє, що мертві байти разом із живими дають розмір даних
+func checkDead(t *testing.T, db *DB, when string) {
+	t.Helper()
+	db.mu.RLock()
+	var data int64
+	for _, s := range append(append([]*segment(nil), db.segments...), db.actives()...) {
+		data += max(s.size-s.dataStart, 0)
+	}
+	db.mu.RUnlock()
+	if dead, live := db.DeadBytes(), db.LiveSize(); dead+live != data {
+		t.Errorf("%s: dead %d + live %d != data %d", when, dead, live, data)
+	}
+}
+
+func TestDeadBytes(t *testing.T) {
+	dir := "test_deadbytes"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "300")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("a", "value"); err != nil {
+		t.Fatal(err)
+	}
+	size := db.LiveSize()
+	if db.DeadBytes() != 0 {
+		t.Fatalf("dead = %d before overwrites", db.DeadBytes())
+	}
+	// Перезапис робить мертвим попередній запис
+	if err := db.Put("a", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if db.DeadBytes() != size {
+		t.Errorf("dead = %d, want %d", db.DeadBytes(), size)
+	}
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10; i++ {
+			if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Delete("key0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RPush("list", "x"); err != nil {
+		t.Fatal(err)
+	}
+	checkDead(t, db, "after writes")
+	var frozen int64
+	for _, s := range db.Segments() {
+		if !s.Active {
+			frozen += s.DeadBytes
+		}
+	}
+	if frozen == 0 {
+		t.Error("expected dead bytes in frozen segments")
+	}
+
+	// Після перевідкриття, зокрема з контрольною точкою, облік той самий
+	dead := db.DeadBytes()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	if db.DeadBytes() != dead {
+		t.Errorf("dead = %d after reopen, want %d", db.DeadBytes(), dead)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if db, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	checkDead(t, db, "after checkpoint")
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	checkDead(t, db, "after merge")
+	if db.DeadBytes() >= dead {
+		t.Errorf("dead = %d after merge, was %d", db.DeadBytes(), dead)
+	}
+}
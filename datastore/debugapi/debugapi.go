@@ -0,0 +1,89 @@
+// Package debugapi serves profiling and introspection endpoints for a
+// datastore.DB, meant for an admin listener kept apart from the data API:
+//
+//	/debug/pprof/     the net/http/pprof profiles
+//	/debug/stats      datastore.Stats as JSON
+//	/debug/segments   datastore.SegmentInfo of every segment as JSON
+//	/debug/consistency datastore.CheckConsistency as JSON; writes wait for it
+//
+// and lets operators steer compaction with POST requests:
+//
+//	/debug/compaction/pause    DB.PauseCompaction
+//	/debug/compaction/resume   DB.ResumeCompaction
+//	/debug/compaction/merge    DB.MergeContext, given up if the client leaves
+//
+// and change settings at runtime with POST /debug/options, whose name and
+// value form fields are passed to DB.SetOption; /debug/stats shows the
+// values in force.
+//
+// Nothing is registered on http.DefaultServeMux.
+package debugapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// Handler serves the debug endpoints of db.
+func Handler(db *datastore.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, db.Stats())
+	})
+	mux.HandleFunc("/debug/segments", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, db.Segments())
+	})
+	mux.HandleFunc("/debug/consistency", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, datastore.CheckConsistency(db))
+	})
+	mux.HandleFunc("/debug/compaction/pause", post(func(w http.ResponseWriter, r *http.Request) {
+		db.PauseCompaction()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/debug/compaction/resume", post(func(w http.ResponseWriter, r *http.Request) {
+		db.ResumeCompaction()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/debug/compaction/merge", post(func(w http.ResponseWriter, r *http.Request) {
+		if err := db.MergeContext(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("/debug/options", post(func(w http.ResponseWriter, r *http.Request) {
+		err := db.SetOption(r.FormValue("name"), r.FormValue("value"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return mux
+}
+
+func post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
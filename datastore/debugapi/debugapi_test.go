@@ -0,0 +1,82 @@
+package debugapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestHandler(t *testing.T) {
+	dir := "test_debugapi"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	h := Handler(db)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	var stats datastore.Stats
+	rec := get("/debug/stats")
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Puts != 1 {
+		t.Errorf("stats: %d %s", rec.Code, rec.Body)
+	}
+	var segs []datastore.SegmentInfo
+	rec = get("/debug/segments")
+	if err := json.Unmarshal(rec.Body.Bytes(), &segs); err != nil || len(segs) == 0 || !segs[len(segs)-1].Active {
+		t.Errorf("segments: %d %s", rec.Code, rec.Body)
+	}
+	var report datastore.ConsistencyReport
+	rec = get("/debug/consistency")
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || !report.OK() || report.Keys != 1 {
+		t.Errorf("consistency: %d %s", rec.Code, rec.Body)
+	}
+	// Профілі pprof
+	if rec := get("/debug/pprof/goroutine?debug=1"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine") {
+		t.Errorf("pprof: %d", rec.Code)
+	}
+
+	// Керування компакцією
+	for _, action := range []string{"pause", "resume", "merge"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/compaction/"+action, nil))
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s: %d %s", action, rec.Code, rec.Body)
+		}
+	}
+	if rec := get("/debug/compaction/merge"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", rec.Code)
+	}
+
+	// Зміна налаштувань без перезапуску
+	post := func(form string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/debug/options", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post("name=MaxSegmentSize&value=4096"); code != http.StatusNoContent {
+		t.Errorf("set option: %d", code)
+	}
+	if db.Stats().MaxSegmentSize != 4096 {
+		t.Errorf("MaxSegmentSize = %d", db.Stats().MaxSegmentSize)
+	}
+	if code := post("name=Nope&value=1"); code != http.StatusBadRequest {
+		t.Errorf("unknown option: %d", code)
+	}
+}
@@ -0,0 +1,191 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// DedupOptions configures storing large values once per distinct content.
+type DedupOptions struct {
+	// MinSize is the size from which values are deduplicated; smaller ones
+	// are stored inline as usual. Zero means 1 KiB.
+	MinSize int
+}
+
+const defaultDedupMinSize = 1 << 10
+
+// A deduplicated value is stored once as a blob, under dedupBlobPrefix and
+// the SHA-256 of its content, and the keys holding it store a reference,
+// dedupRefMagic and the same hash. The blob is written in one batch with
+// the first reference to it; merges drop blobs no key references any more.
+// Blob keys are reserved, see Reserved; Changes sees references instead of
+// the values.
+const (
+	dedupBlobPrefix = "\x00blob\x00"
+	dedupRefMagic   = "\x00blob\x01"
+)
+
+// dedup counts the references to every blob. Counts may run high, for
+// example for references that expired or were folded by a merge, which
+// only keeps a blob until the next merge after its keys are rewritten;
+// they never run low. Guarded by db.mu.
+type dedup struct {
+	minSize int
+	refs    map[string]int    // References per hash
+	keyRefs map[string]string // Hash each key references
+}
+
+func newDedup(opts DedupOptions) *dedup {
+	minSize := opts.MinSize
+	if minSize <= 0 {
+		minSize = defaultDedupMinSize
+	}
+	return &dedup{minSize: minSize, refs: make(map[string]int), keyRefs: make(map[string]string)}
+}
+
+// prepare returns the entries to store for entries: values of at least
+// minSize replaced by references, each preceded by its blob unless a live
+// key references it already. It returns entries itself if none is
+// deduplicated. Values that look like references are always deduplicated,
+// so they are never mistaken for one.
+func (d *dedup) prepare(entries []entry) []entry {
+	var stored []entry
+	var written map[string]bool
+	for i, e := range entries {
+		if e.kind != kindValue || strings.HasPrefix(e.key, dedupBlobPrefix) ||
+			(len(e.value) < d.minSize && !strings.HasPrefix(e.value, dedupRefMagic)) {
+			if stored != nil {
+				stored = append(stored, e)
+			}
+			continue
+		}
+		if stored == nil {
+			stored = append(make([]entry, 0, len(entries)+1), entries[:i]...)
+			written = make(map[string]bool)
+		}
+		sum := sha256.Sum256([]byte(e.value))
+		hash := string(sum[:])
+		if d.refs[hash] == 0 && !written[hash] {
+			stored = append(stored, entry{key: dedupBlobPrefix + hash, value: e.value, kind: kindValue})
+			written[hash] = true
+		}
+		e.value = dedupRefMagic + hash
+		stored = append(stored, e)
+	}
+	if stored == nil {
+		return entries
+	}
+	return stored
+}
+
+// commit counts the references among stored, which prepare returned for
+// entries and which were written, and copies what writing them stamped
+// back to entries.
+func (d *dedup) commit(entries, stored []entry) {
+	j := 0
+	for _, e := range stored {
+		if strings.HasPrefix(e.key, dedupBlobPrefix) {
+			continue
+		}
+		entries[j].seq, entries[j].ts, entries[j].expires = e.seq, e.ts, e.expires
+		j++
+		// Operands fold onto the value the key references.
+		if e.kind == kindMergeOperand {
+			continue
+		}
+		d.release(e.key)
+		if hash, ok := strings.CutPrefix(e.value, dedupRefMagic); ok && e.kind == kindValue {
+			d.keyRefs[e.key] = hash
+			d.refs[hash]++
+		}
+	}
+}
+
+func (d *dedup) release(key string) {
+	hash, ok := d.keyRefs[key]
+	if !ok {
+		return
+	}
+	delete(d.keyRefs, key)
+	if d.refs[hash]--; d.refs[hash] <= 0 {
+		delete(d.refs, hash)
+	}
+}
+
+// live returns the blob keys referenced now, for a merge to keep.
+func (d *dedup) live() map[string]bool {
+	keys := make(map[string]bool, len(d.refs))
+	for hash := range d.refs {
+		keys[dedupBlobPrefix+hash] = true
+	}
+	return keys
+}
+
+// loadDedup counts the references held by the indexed keys. References
+// are short, so only small entries are read. The caller must hold db.mu.
+func (db *DB) loadDedup() error {
+	d := db.dedup
+	count := func(key string, pos position) error {
+		ref := entry{key: key, value: dedupRefMagic + string(make([]byte, sha256.Size))}
+		if pos.size > int64(entrySize(&ref, CurrentFormat)) {
+			return nil
+		}
+		e, err := db.readAt(pos)
+		if err != nil {
+			return err
+		}
+		if hash, ok := strings.CutPrefix(e.value, dedupRefMagic); ok && e.key == key && e.kind == kindValue {
+			d.keyRefs[key] = hash
+			d.refs[hash]++
+		}
+		return nil
+	}
+	var err error
+	db.index.ascend("", "", func(key string, pos position) bool {
+		if _, chained := db.operands[key]; chained || strings.HasPrefix(key, dedupBlobPrefix) {
+			return true
+		}
+		err = count(key, pos)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	for key, chain := range db.operands {
+		if chain.hasBase {
+			if err := count(key, chain.base); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deref returns the value v stands for: the content of the blob it
+// references, or v itself.
+func (db *DB) deref(v string) (string, error) {
+	if db.dedup == nil || !strings.HasPrefix(v, dedupRefMagic) {
+		return v, nil
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.derefLocked(v)
+}
+
+// derefLocked is deref for callers holding db.mu.
+func (db *DB) derefLocked(v string) (string, error) {
+	hash, ok := strings.CutPrefix(v, dedupRefMagic)
+	if db.dedup == nil || !ok {
+		return v, nil
+	}
+	pos, ok := db.index.get(dedupBlobPrefix + hash)
+	if !ok {
+		return "", fmt.Errorf("deduplicated value %x is missing", hash)
+	}
+	e, err := db.readAt(pos)
+	if err == nil {
+		err = db.decodeEntryValue(&e)
+	}
+	return e.value, err
+}
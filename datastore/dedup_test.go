@@ -0,0 +1,160 @@
+package datastore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	dir := "test_dedup"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "1024")
+
+	opts := Options{Dedup: &DedupOptions{MinSize: 64}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := strings.Repeat("shared payload ", 300)
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("k%02d", i), big); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Короткі значення та значення, схожі на посилання, читаються як є
+	if err := db.Put("small", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("tricky", dedupRefMagic+"x"); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := db.Size(); size > 2*int64(len(big)) {
+		t.Errorf("Size = %d, want the shared value stored once", size)
+	}
+
+	check := func(db *DB) {
+		t.Helper()
+		for i := 0; i < 20; i += 7 {
+			if v, err := db.Get(fmt.Sprintf("k%02d", i)); err != nil || v != big {
+				t.Fatalf("Get(k%02d) = %d bytes, %v", i, len(v), err)
+			}
+		}
+		got, err := db.GetMulti([]string{"k01", "small", "tricky"})
+		if err != nil || got["k01"] != big || got["small"] != "v" || got["tricky"] != dedupRefMagic+"x" {
+			t.Fatalf("GetMulti = %d keys, %v", len(got), err)
+		}
+		n := 0
+		err = db.RangeScan("k", "l", func(_, v string) bool {
+			if v != big {
+				t.Errorf("scanned value of %d bytes", len(v))
+			}
+			n++
+			return true
+		})
+		if err != nil || n != 20 {
+			t.Fatalf("RangeScan saw %d keys, %v", n, err)
+		}
+	}
+	check(db)
+
+	// Після перевідкриття лічильники посилань відновлюються
+	db.Close()
+	db, err = OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+
+	// Злиття прибирає значення, на які більше ніхто не посилається
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("k%02d", i), "gone"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := db.Size(); size > int64(len(big)) {
+		t.Errorf("Size after merge = %d, want the unreferenced value reclaimed", size)
+	}
+	if err := db.Put("k00", big); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("k00"); err != nil || v != big {
+		t.Fatalf("Get after rewrite = %d bytes, %v", len(v), err)
+	}
+
+	if _, err := OpenWithOptions(dir+"_old", Options{Dedup: &DedupOptions{}, FormatVersion: FormatV6}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestDedup_ReservedBlobKeys(t *testing.T) {
+	dir := "test_dedup_reserved"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{Dedup: &DedupOptions{MinSize: 8}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	shared := strings.Repeat("x", 64)
+	for _, key := range []string{"a", "b"} {
+		if err := db.Put(key, shared); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var blob string
+	db.mu.RLock()
+	db.index.ascend(dedupBlobPrefix, prefixEnd(dedupBlobPrefix), func(key string, _ position) bool {
+		blob = key
+		return false
+	})
+	db.mu.RUnlock()
+	if blob == "" {
+		t.Fatal("no blob key")
+	}
+
+	// Записати чи видалити спільне значення напряму не можна
+	if err := db.Put(blob, "evil"); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Put: err = %v", err)
+	}
+	if err := db.Delete(blob); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Delete: err = %v", err)
+	}
+	if err := db.Rename("a", blob, true); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Rename: err = %v", err)
+	}
+	if v, err := db.Get("b"); err != nil || v != shared {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+
+	// Службові ключі не видно ні в лічильнику, ні в обході, ні в експорті
+	if n := db.Count(); n != 2 {
+		t.Errorf("Count = %d, want 2", n)
+	}
+	var keys []string
+	db.ForEach(func(key, _ string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if strings.Join(keys, ",") != "a,b" {
+		t.Errorf("ForEach saw %q", keys)
+	}
+	var out bytes.Buffer
+	if err := db.Export(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "blob") {
+		t.Errorf("Export shows the blob key: %q", out.String())
+	}
+}
@@ -0,0 +1,345 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	dir := "test_delete"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i += 2 {
+		if err := db.Delete(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Видалення відсутнього ключа нічого не пише
+	size, _ := db.Size()
+	if err := db.Delete("missing"); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := db.Size(); after != size {
+		t.Errorf("expected deleting a missing key to write nothing, size %d -> %d", size, after)
+	}
+
+	check := func(db *DB) {
+		t.Helper()
+		for i := 0; i < 20; i++ {
+			_, err := db.Get(fmt.Sprintf("key%d", i))
+			if i%2 == 0 && !errors.Is(err, ErrNotFound) {
+				t.Errorf("key%d: expected ErrNotFound, got %v", i, err)
+			}
+			if i%2 == 1 && err != nil {
+				t.Errorf("key%d: %v", i, err)
+			}
+		}
+	}
+	check(db)
+	db.Close()
+
+	// Надгробки переживають перезапуск і злиття
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	if err := db.Put("key0", "back"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("key0"); err != nil || v != "back" {
+		t.Errorf("expected back, got %q, %v", v, err)
+	}
+}
+
+func TestDelete_PartialMergeKeepsTombstone(t *testing.T) {
+	dir := "test_delete_partial"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Великий найстаріший сегмент не потрапляє до часткового злиття
+	if err := db.Put("victim", strings.Repeat("o", 300)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("pad%d", i), strings.Repeat("p", 20)); err != nil {
+			t.Fatal(err)
+		}
+		if i == 10 {
+			if err := db.Delete("victim"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	oldest := db.segments[0]
+	if err := db.MergeSmallest(len(db.segments) - 1); err != nil {
+		t.Fatal(err)
+	}
+	if db.segments[0] != oldest || len(db.segments) != 2 {
+		t.Fatalf("expected the oldest segment to be left out, got %d segments", len(db.segments))
+	}
+	db.Close()
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get("victim"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDelete_OperandsAndHistory(t *testing.T) {
+	dir := "test_delete_history"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.RegisterMerge(sumMerge)
+
+	if err := db.Put("counter", "10"); err != nil {
+		t.Fatal(err)
+	}
+	seq := db.CurrentSeq()
+	if err := db.Delete("counter"); err != nil {
+		t.Fatal(err)
+	}
+	// Операнди після видалення згортаються без основи
+	if err := db.MergeValue("counter", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("counter"); err != nil || v != "2" {
+		t.Errorf("expected 2, got %q, %v", v, err)
+	}
+
+	if v, err := db.GetAt("counter", seq); err != nil || v != "10" {
+		t.Errorf("expected 10 before the delete, got %q, %v", v, err)
+	}
+	if _, err := db.GetAt("counter", seq+1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound right after the delete, got %v", err)
+	}
+	hist, err := db.GetHistory("counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 3 || hist[0].Value != "2" || !hist[1].Deleted || hist[2].Value != "10" {
+		t.Errorf("unexpected history %+v", hist)
+	}
+}
+
+func TestDelete_OldFormat(t *testing.T) {
+	dir := "test_delete_v3"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{FormatVersion: FormatV3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("key"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestDelete_PartialMergeDropsTombstone(t *testing.T) {
+	dir := "test_delete_partial_drop"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("old", strings.Repeat("o", 300)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("pad%d", i), strings.Repeat("p", 20)); err != nil {
+			t.Fatal(err)
+		}
+		switch i {
+		case 5:
+			err = db.Put("temp", "t")
+		case 15:
+			err = db.Delete("temp")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Найстаріший сегмент не містить ключа, тож надгробок більше не потрібен
+	if err := db.MergeSmallest(len(db.segments) - 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.segments) != 2 {
+		t.Fatalf("got %d segments", len(db.segments))
+	}
+	changes, err := db.Changes(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range changes {
+		if c.Key == "temp" {
+			t.Errorf("unexpected change %+v left after merge", c)
+		}
+	}
+	db.Close()
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get("temp"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// rotate freezes the active segment of a single-stripe db.
+func rotate(t *testing.T, db *DB) {
+	t.Helper()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.rotateActive(db.stripes[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// olderInputs returns the files of the frozen segments a merge of segs
+// removes, to put them back as if a crash had kept them.
+func olderInputs(t *testing.T, segs []*segment) map[string][]byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	for _, s := range segs[:len(segs)-1] {
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[s.path] = data
+	}
+	return files
+}
+
+func TestDelete_MergeCrashKeepsInputs(t *testing.T) {
+	dir := "test_delete_merge_crash"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	rotate(t, db)
+	if err := db.Delete("k"); err != nil {
+		t.Fatal(err)
+	}
+	rotate(t, db)
+	inputs := olderInputs(t, db.segments)
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Збій до видалення старших вхідних сегментів злиття
+	for path, data := range inputs {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %q, %v", v, err)
+	}
+	for path := range inputs {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s removed, got %v", path, err)
+		}
+	}
+}
+
+func TestDelete_PartialMergeCrashKeepsInputs(t *testing.T) {
+	dir := "test_delete_partial_crash"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []func() error{
+		func() error { return db.Put("old", strings.Repeat("o", 300)) },
+		func() error { return db.Put("temp", "t") },
+		func() error { return db.Delete("temp") },
+		func() error { return db.Put("new", strings.Repeat("n", 300)) },
+	} {
+		if err := op(); err != nil {
+			t.Fatal(err)
+		}
+		rotate(t, db)
+	}
+	// Зливаються лише два малі сегменти посередині, надгробок відкидається
+	inputs := olderInputs(t, db.segments[1:3])
+	if err := db.MergeSmallest(2); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.segments) != 3 {
+		t.Fatalf("got %d segments", len(db.segments))
+	}
+	db.Close()
+
+	for path, data := range inputs {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get("temp"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %q, %v", v, err)
+	}
+	for _, key := range []string{"old", "new"} {
+		if _, err := db.Get(key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// IndexStorage selects where the keydir lives.
+type IndexStorage int
+
+const (
+	// IndexMemory keeps the keydir in Go memory, structured as IndexType
+	// says.
+	IndexMemory IndexStorage = iota
+	// IndexDisk keeps the keydir in a memory-mapped hash file, so the
+	// kernel pages it in and out and the key space is not bounded by RAM.
+	// Gets cost an extra read of the key from a second file. IndexType is
+	// ignored. Needs the OS filesystem on Linux.
+	IndexDisk
+)
+
+const (
+	diskIndexName     = "index.hash"
+	diskIndexKeysName = "index.keys"
+
+	diskSlotSize     = 48
+	diskInitialSlots = 1024
+)
+
+// Slot states.
+const (
+	slotEmpty = iota
+	slotUsed
+	slotDeleted
+)
+
+// diskIndex is an open-addressing hash table with linear probing in a
+// memory-mapped file. A slot holds the state and key length, the key hash,
+// the offset of the key in the key file, and the position:
+//
+//	state(1) pad(3) keylen(4) hash(8) keyoff(8) segid(8) offset(8) size(8)
+//
+// Keys are appended to the key file and read back with ReadAt to confirm
+// a hash match. Deleted slots stay as markers until the table is rebuilt,
+// which also drops the keys they held. Both files are scratch space,
+// rebuilt by every Open and removed on Close.
+//
+// get only reads the mapping, so readers may run concurrently under db.mu
+// held for reading; put, remove and rebase need it held for writing.
+type diskIndex struct {
+	dir     string
+	hash    HashFunc
+	onError func(error)
+	table   *os.File
+	keys    *os.File
+	slots   []byte
+	nslots  int
+	used    int // Slots holding a key
+	dead    int // Deleted slots
+	heap    int64
+}
+
+func newDiskIndex(fsys FS, dir string, hash HashFunc, onError func(error)) (*diskIndex, error) {
+	if _, ok := fsys.(OSFS); !ok {
+		return nil, errors.New("IndexDisk needs the OS filesystem")
+	}
+	if hash == nil {
+		hash = HashXXH64
+	}
+	d := &diskIndex{dir: dir, hash: hash, onError: onError}
+	if err := d.create(diskInitialSlots); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// create replaces the files with an empty table of n slots.
+func (d *diskIndex) create(n int) error {
+	table, err := os.Create(filepath.Join(d.dir, diskIndexName))
+	if err != nil {
+		return err
+	}
+	if err := table.Truncate(int64(n) * diskSlotSize); err != nil {
+		table.Close()
+		return err
+	}
+	slots, err := mmapFile(table, n*diskSlotSize)
+	if err != nil {
+		table.Close()
+		return err
+	}
+	keys, err := os.Create(filepath.Join(d.dir, diskIndexKeysName))
+	if err != nil {
+		munmap(slots)
+		table.Close()
+		return err
+	}
+	d.table, d.keys, d.slots, d.nslots = table, keys, slots, n
+	d.used, d.dead, d.heap = 0, 0, 0
+	return nil
+}
+
+func (d *diskIndex) slot(i int) []byte {
+	return d.slots[i*diskSlotSize : (i+1)*diskSlotSize]
+}
+
+// find returns the slot holding key, or -1 and the first free slot key
+// can be inserted at.
+func (d *diskIndex) find(key string) (int, int, error) {
+	h := d.hash(key)
+	free := -1
+	mask := d.nslots - 1
+	for i, n := int(h)&mask, 0; n < d.nslots; i, n = (i+1)&mask, n+1 {
+		s := d.slot(i)
+		switch s[0] {
+		case slotEmpty:
+			if free < 0 {
+				free = i
+			}
+			return -1, free, nil
+		case slotDeleted:
+			if free < 0 {
+				free = i
+			}
+			continue
+		}
+		if binary.LittleEndian.Uint64(s[8:16]) != h || int(binary.LittleEndian.Uint32(s[4:8])) != len(key) {
+			continue
+		}
+		k, err := d.keyOf(s)
+		if err != nil {
+			return -1, -1, err
+		}
+		if k == key {
+			return i, -1, nil
+		}
+	}
+	return -1, free, nil
+}
+
+func (d *diskIndex) keyOf(s []byte) (string, error) {
+	buf := make([]byte, binary.LittleEndian.Uint32(s[4:8]))
+	if _, err := d.keys.ReadAt(buf, int64(binary.LittleEndian.Uint64(s[16:24]))); err != nil {
+		return "", fmt.Errorf("index key file: %w", err)
+	}
+	return string(buf), nil
+}
+
+func slotPosition(s []byte) position {
+	return position{
+		segID:  int(int64(binary.LittleEndian.Uint64(s[24:32]))),
+		offset: int64(binary.LittleEndian.Uint64(s[32:40])),
+		size:   int64(binary.LittleEndian.Uint64(s[40:48])),
+	}
+}
+
+func setSlotPosition(s []byte, pos position) {
+	binary.LittleEndian.PutUint64(s[24:32], uint64(pos.segID))
+	binary.LittleEndian.PutUint64(s[32:40], uint64(pos.offset))
+	binary.LittleEndian.PutUint64(s[40:48], uint64(pos.size))
+}
+
+func (d *diskIndex) get(key string) (position, bool) {
+	i, _, err := d.find(key)
+	if err != nil {
+		d.onError(err)
+		return position{}, false
+	}
+	if i < 0 {
+		return position{}, false
+	}
+	return slotPosition(d.slot(i)), true
+}
+
+func (d *diskIndex) put(key string, pos position) {
+	i, free, err := d.find(key)
+	if err != nil {
+		d.onError(err)
+		return
+	}
+	if i >= 0 {
+		setSlotPosition(d.slot(i), pos)
+		return
+	}
+	if _, err := d.keys.WriteAt([]byte(key), d.heap); err != nil {
+		d.onError(err)
+		return
+	}
+	s := d.slot(free)
+	if s[0] == slotDeleted {
+		d.dead--
+	}
+	s[0] = slotUsed
+	binary.LittleEndian.PutUint32(s[4:8], uint32(len(key)))
+	binary.LittleEndian.PutUint64(s[8:16], d.hash(key))
+	binary.LittleEndian.PutUint64(s[16:24], uint64(d.heap))
+	setSlotPosition(s, pos)
+	d.heap += int64(len(key))
+	d.used++
+	if (d.used+d.dead)*4 > d.nslots*3 {
+		d.grow()
+	}
+}
+
+func (d *diskIndex) remove(key string) {
+	i, _, err := d.find(key)
+	if err != nil {
+		d.onError(err)
+		return
+	}
+	if i < 0 {
+		return
+	}
+	d.slot(i)[0] = slotDeleted
+	d.used--
+	d.dead++
+}
+
+func (d *diskIndex) len() int {
+	return d.used
+}
+
+func (d *diskIndex) ascend(start, end string, fn func(key string, pos position) bool) {
+	var items []btreeItem
+	for i := 0; i < d.nslots; i++ {
+		s := d.slot(i)
+		if s[0] != slotUsed {
+			continue
+		}
+		key, err := d.keyOf(s)
+		if err != nil {
+			d.onError(err)
+			continue
+		}
+		if key >= start && (end == "" || key < end) {
+			items = append(items, btreeItem{key: key, pos: slotPosition(s)})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	for _, it := range items {
+		if !fn(it.key, it.pos) {
+			return
+		}
+	}
+}
+
+func (d *diskIndex) rebase(from, to int) {
+	for i := 0; i < d.nslots; i++ {
+		s := d.slot(i)
+		if s[0] == slotUsed && int(int64(binary.LittleEndian.Uint64(s[24:32]))) == from {
+			binary.LittleEndian.PutUint64(s[24:32], uint64(to))
+		}
+	}
+}
+
+// grow rebuilds the table, twice as large unless most of the occupied
+// slots were deleted markers. Rebuilding drops the markers and the keys
+// they held. If the new files cannot be created the old table is kept.
+func (d *diskIndex) grow() {
+	n := d.nslots
+	if d.used*2 > n {
+		n *= 2
+	}
+	old := *d
+	d.dir = filepath.Join(old.dir, "index-rebuild")
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		old.onError(err)
+		*d = old
+		return
+	}
+	defer os.RemoveAll(d.dir)
+	if err := d.create(n); err != nil {
+		old.onError(err)
+		*d = old
+		return
+	}
+	for i := 0; i < old.nslots; i++ {
+		s := old.slot(i)
+		if s[0] != slotUsed {
+			continue
+		}
+		key, err := old.keyOf(s)
+		if err != nil {
+			old.onError(err)
+			d.close()
+			*d = old
+			return
+		}
+		d.put(key, slotPosition(s))
+	}
+	rebuilt := *d
+	for _, name := range []string{diskIndexName, diskIndexKeysName} {
+		os.Rename(filepath.Join(rebuilt.dir, name), filepath.Join(old.dir, name))
+	}
+	rebuilt.dir = old.dir
+	*d = rebuilt
+	munmap(old.slots)
+	old.table.Close()
+	old.keys.Close()
+}
+
+// close unmaps the table and removes both files.
+func (d *diskIndex) close() error {
+	err := munmap(d.slots)
+	d.table.Close()
+	d.keys.Close()
+	os.Remove(filepath.Join(d.dir, diskIndexName))
+	os.Remove(filepath.Join(d.dir, diskIndexKeysName))
+	return err
+}
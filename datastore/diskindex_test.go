@@ -0,0 +1,79 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestDiskIndex(t *testing.T) {
+	dir := "test_disk_index"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "4000")
+
+	opts := Options{IndexStorage: IndexDisk}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Більше ключів, ніж початкових слотів, щоб таблиця перебудувалась
+	const n = 3000
+	for i := 0; i < n; i++ {
+		if err := db.Put("key"+strconv.Itoa(i), "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i += 2 {
+		if err := db.Delete("key" + strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put("key0", "again"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(db *DB) {
+		t.Helper()
+		for i := 1; i < n; i++ {
+			v, err := db.Get("key" + strconv.Itoa(i))
+			if i%2 == 0 {
+				if err == nil {
+					t.Fatalf("deleted key%d = %q", i, v)
+				}
+				continue
+			}
+			if err != nil || v != "v"+strconv.Itoa(i) {
+				t.Fatalf("Get(key%d) = %q, %v", i, v, err)
+			}
+		}
+		if v, err := db.Get("key0"); err != nil || v != "again" {
+			t.Fatalf("Get(key0) = %q, %v", v, err)
+		}
+		if c := db.Count(); c != n/2+1 {
+			t.Fatalf("Count = %d, want %d", c, n/2+1)
+		}
+	}
+	check(db)
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+	if _, err := os.Stat(filepath.Join(dir, diskIndexName)); !os.IsNotExist(err) {
+		t.Errorf("index file left after Close: %v", err)
+	}
+
+	reopened, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	check(reopened)
+}
+
+func TestDiskIndex_NeedsOSFS(t *testing.T) {
+	if _, err := OpenWithOptions("mem", Options{IndexStorage: IndexDisk, FS: NewMemFS()}); err == nil {
+		t.Fatal("expected an error on a non-OS filesystem")
+	}
+}
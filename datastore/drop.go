@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+)
+
+const (
+	// dropMarkerName exists while DropAll moves segment files away, so
+	// Open can finish an interrupted drop.
+	dropMarkerName = "drop-pending"
+	// droppedDirName holds dropped segment files until the reads still
+	// using them are done.
+	droppedDirName = "dropped"
+)
+
+// DropAll discards every key and the segments holding them. The drop is
+// decided by a marker file written before any segment is touched: should
+// DropAll fail or crash after that, the next Open finishes it rather than
+// bringing part of the data back, and the store must be reopened. Reads
+// that started before DropAll may still return old values; offloaded
+// segments are deleted from the object store too.
+func (db *DB) DropAll() error {
+	db.mergeMu.Lock()
+	defer db.mergeMu.Unlock()
+	db.mu.Lock()
+	objects, err := db.dropAll()
+	db.publishView()
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, name := range objects {
+		if err := db.tier.opts.Store.Delete(context.Background(), name); err != nil {
+			db.log(slog.LevelWarn, "deleting dropped object failed", "object", name, "err", err)
+		}
+	}
+	return nil
+}
+
+// dropAll moves every segment to the dropped directory and starts over
+// with empty active segments and index. It returns the names of the
+// objects of offloaded segments. The caller must hold db.mergeMu and db.mu.
+func (db *DB) dropAll() ([]string, error) {
+	for _, st := range db.stripes {
+		if err := db.flushActive(st); err != nil {
+			return nil, err
+		}
+	}
+	marker, err := db.fs.Create(filepath.Join(db.dir, dropMarkerName))
+	if err != nil {
+		return nil, err
+	}
+	err = marker.Sync()
+	if cerr := marker.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	db.removeCheckpoint()
+
+	trash := filepath.Join(db.dir, droppedDirName)
+	if err := db.fs.MkdirAll(trash, 0o755); err != nil {
+		return nil, err
+	}
+	db.drops++
+	olds := append(db.segments, db.actives()...)
+	var local []*segment
+	var objects []string
+	for _, s := range olds {
+		if s.remote != nil {
+			if err := db.fs.Remove(s.path); err != nil {
+				return nil, err
+			}
+			s.remote.close()
+			objects = append(objects, s.remote.name)
+			continue
+		}
+		// Reads still using the file keep it open; retire removes it.
+		dst := filepath.Join(trash, fmt.Sprintf("%d-%s", db.drops, filepath.Base(s.path)))
+		if err := db.fs.Rename(s.path, dst); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.path = dst
+		s.mu.Unlock()
+		local = append(local, s)
+	}
+
+	// The new active segments keep the IDs of the old ones, whose files
+	// are out of the way now, so the manifest still holds.
+	actives := make([]*segment, len(db.stripes))
+	for i, st := range db.stripes {
+		if actives[i], err = db.openActive(st.id, st); err != nil {
+			for _, s := range actives[:i] {
+				s.file.Close()
+			}
+			return nil, err
+		}
+		actives[i].collected.complete = true
+	}
+	db.closeIndex()
+	index, err := db.newKeydir(db.opts)
+	if err != nil {
+		for _, s := range actives {
+			s.file.Close()
+		}
+		return nil, err
+	}
+	keys := db.index.len()
+	db.segments, db.index = nil, index
+	for i, st := range db.stripes {
+		st.active = actives[i]
+	}
+	db.operands = make(map[string]*operandChain)
+	db.liveBytes = 0
+	if db.cache != nil {
+		db.cache.purge()
+	}
+	db.zsets.gen.Add(1)
+	if db.dedup != nil {
+		clear(db.dedup.refs)
+		clear(db.dedup.keyRefs)
+	}
+	if db.evictor != nil {
+		db.evictor = newEvictor(*db.opts.Eviction)
+	}
+	db.retire(local, "")
+	for _, st := range db.stripes {
+		if err := db.preallocateActive(st); err != nil {
+			return nil, err
+		}
+	}
+	if err := db.fs.Remove(filepath.Join(db.dir, dropMarkerName)); err != nil {
+		return nil, err
+	}
+
+	db.event(EventDropAll, "dropped %d segments and %d keys", len(olds), keys)
+	db.log(slog.LevelInfo, "all data dropped", "segments", len(olds), "keys", keys)
+	return objects, nil
+}
+
+// finishDrop removes what an earlier DropAll left behind: the dropped
+// directory and, if it was interrupted, the segments it was dropping.
+func (db *DB) finishDrop() error {
+	if err := db.fs.RemoveAll(filepath.Join(db.dir, droppedDirName)); err != nil {
+		return err
+	}
+	ents, err := db.fs.ReadDir(db.dir)
+	if err != nil {
+		return err
+	}
+	interrupted := false
+	for _, e := range ents {
+		if e.Name() == dropMarkerName {
+			interrupted = true
+		}
+	}
+	if !interrupted {
+		return nil
+	}
+	db.log(slog.LevelWarn, "finishing an interrupted DropAll")
+	removeCheckpointFile(db.fs, db.dir)
+	for _, e := range ents {
+		name := e.Name()
+		if name == activeName || segRE.MatchString(name) || remoteRE.MatchString(name) {
+			if err := db.fs.Remove(filepath.Join(db.dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return db.fs.Remove(filepath.Join(db.dir, dropMarkerName))
+}
@@ -0,0 +1,108 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestDropAll(t *testing.T) {
+	dir := "test_drop_all"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "300")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		db.Put("k"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+	}
+	if db.segmentCount() == 0 {
+		t.Fatal("expected several segments")
+	}
+
+	// Читання паралельно зі скиданням не падають
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := db.Get("k1"); err != nil && !errors.Is(err, ErrNotFound) {
+					t.Errorf("Get during DropAll: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	if err := db.DropAll(); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	wg.Wait()
+
+	if db.Count() != 0 || db.segmentCount() != 0 {
+		t.Fatalf("Count = %d, segments = %d", db.Count(), db.segmentCount())
+	}
+	if _, err := db.Get("k1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after DropAll err = %v", err)
+	}
+	if err := db.Put("fresh", "x"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Після перевідкриття лишаються тільки нові записи, а смітник прибрано
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get("fresh"); err != nil || v != "x" || db.Count() != 1 {
+		t.Fatalf("Get(fresh) = %q, %v, Count = %d", v, err, db.Count())
+	}
+	if _, err := os.Stat(filepath.Join(dir, droppedDirName)); !os.IsNotExist(err) {
+		t.Fatalf("dropped directory left behind: %v", err)
+	}
+}
+
+func TestDropAll_Interrupted(t *testing.T) {
+	dir := "test_drop_all_interrupted"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "300")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		db.Put("k"+strconv.Itoa(i), "value")
+	}
+	db.Close()
+
+	// Збій одразу після запису маркера: Open завершує скидання
+	if err := os.WriteFile(filepath.Join(dir, dropMarkerName), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.Count() != 0 || db.segmentCount() != 0 {
+		t.Fatalf("Count = %d, segments = %d", db.Count(), db.segmentCount())
+	}
+	if _, err := os.Stat(filepath.Join(dir, dropMarkerName)); !os.IsNotExist(err) {
+		t.Fatalf("marker left behind: %v", err)
+	}
+}
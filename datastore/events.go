@@ -0,0 +1,132 @@
+package datastore
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	eventLogSize          = 64
+	compactionHistorySize = 16
+)
+
+// Event kinds recorded in the recent events log.
+const (
+	EventOpen        = "open"
+	EventRotate      = "rotate"
+	EventMerge       = "merge"
+	EventMergeFailed = "merge-failed"
+	// Segments moved to the object store, see Offload.
+	EventOffload       = "offload"
+	EventOffloadFailed = "offload-failed"
+	// See PauseCompaction.
+	EventCompactionPaused  = "compaction-paused"
+	EventCompactionResumed = "compaction-resumed"
+	// Found by the scrubber, see Scrub.
+	EventCorruption = "corruption"
+	// A segment dropped to stay within Options.MaxTotalBytes.
+	EventEvict = "evict"
+	// Every key discarded, see DropAll.
+	EventDropAll = "drop-all"
+)
+
+// Event is a notable occurrence kept for diagnostics.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+}
+
+// CompactionRecord describes one merge run.
+type CompactionRecord struct {
+	Start       time.Time     `json:"start"`
+	Duration    time.Duration `json:"duration"`
+	Segments    int           `json:"segments"`
+	BytesBefore int64         `json:"bytes_before"`
+	BytesAfter  int64         `json:"bytes_after"`
+	Err         string        `json:"error,omitempty"`
+}
+
+// SegmentInfo describes one segment file.
+type SegmentInfo struct {
+	ID      int    `json:"id"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Version uint16 `json:"version"`
+	Active  bool   `json:"active"`
+	Remote  bool   `json:"remote"`
+	// DeadBytes is the part of Size a merge can reclaim, see DB.DeadBytes.
+	DeadBytes int64 `json:"dead_bytes"`
+}
+
+// ring keeps the last len(items) values added to it.
+type ring[T any] struct {
+	mu    sync.Mutex
+	items []T
+	next  int
+	full  bool
+}
+
+func newRing[T any](size int) *ring[T] {
+	return &ring[T]{items: make([]T, size)}
+}
+
+func (r *ring[T]) add(v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[r.next] = v
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the kept values, newest first.
+func (r *ring[T]) list() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.items)
+	}
+	out := make([]T, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.items[(r.next-i+len(r.items))%len(r.items)])
+	}
+	return out
+}
+
+func (db *DB) event(kind, format string, args ...any) {
+	db.events.add(Event{Time: time.Now(), Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// RecentEvents returns the latest notable events, newest first.
+func (db *DB) RecentEvents() []Event {
+	return db.events.list()
+}
+
+// CompactionHistory returns the latest merge runs, newest first.
+func (db *DB) CompactionHistory() []CompactionRecord {
+	return db.compactions.list()
+}
+
+// Segments describes the frozen segments in ID order followed by the
+// active ones.
+func (db *DB) Segments() []SegmentInfo {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	infos := make([]SegmentInfo, 0, len(db.segments)+len(db.stripes))
+	for _, s := range append(db.segments, db.actives()...) {
+		infos = append(infos, SegmentInfo{
+			ID:        s.id,
+			Path:      s.path,
+			Size:      s.size,
+			Version:   s.version,
+			Active:    s.id < 0,
+			Remote:    s.remote != nil,
+			DeadBytes: s.dead,
+		})
+	}
+	return infos
+}
@@ -0,0 +1,51 @@
+package datastore
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing[int](3)
+	for i := 1; i <= 5; i++ {
+		r.add(i)
+	}
+	got := r.list()
+	if len(got) != 3 || got[0] != 5 || got[2] != 3 {
+		t.Errorf("expected [5 4 3], got %v", got)
+	}
+}
+
+func TestCompactionHistory(t *testing.T) {
+	dir := "test_compaction_history"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "50")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := db.Put("key", strings.Repeat("v", 40)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	hist := db.CompactionHistory()
+	if len(hist) != 1 {
+		t.Fatalf("expected 1 compaction record, got %d", len(hist))
+	}
+	if hist[0].BytesAfter >= hist[0].BytesBefore {
+		t.Errorf("expected merge to reclaim space: %d -> %d", hist[0].BytesBefore, hist[0].BytesAfter)
+	}
+	if ev := db.RecentEvents(); ev[0].Kind != EventMerge {
+		t.Errorf("expected latest event to be a merge, got %s", ev[0].Kind)
+	}
+}
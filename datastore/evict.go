@@ -0,0 +1,151 @@
+package datastore
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// evictionSamples is the number of keys compared to pick each victim.
+const evictionSamples = 16
+
+// EvictionPolicy picks the keys a DB in cache mode deletes.
+type EvictionPolicy int
+
+const (
+	// EvictLRU deletes the keys read or written least recently.
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU deletes the keys read or written least often.
+	EvictLFU
+)
+
+// EvictionOptions turns the DB into a persistent cache that deletes keys
+// instead of growing past a budget.
+type EvictionOptions struct {
+	// MaxLiveBytes is the budget for the on-disk size of the current entry
+	// of every key; superseded entries awaiting a merge do not count.
+	// Offloaded segments only count their keys.
+	MaxLiveBytes int64
+	Policy       EvictionPolicy
+}
+
+// evictor tracks the live size and the use of every key. Like Redis it
+// approximates the policy: each victim is the coldest of a random sample
+// of keys, which keeps tracking a counter update per access.
+type evictor struct {
+	policy EvictionPolicy
+	budget int64
+
+	mu    sync.Mutex
+	clock uint64
+	live  int64
+	keys  map[string]*keyUse
+}
+
+type keyUse struct {
+	size int64
+	last uint64 // Clock of the latest access
+	hits uint64
+}
+
+func newEvictor(opts EvictionOptions) *evictor {
+	return &evictor{policy: opts.Policy, budget: opts.MaxLiveBytes, keys: make(map[string]*keyUse)}
+}
+
+// record accounts for an entry of size bytes written to key.
+func (ev *evictor) record(key string, kind entryKind, size int64) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	u := ev.keys[key]
+	if kind == kindTombstone {
+		if u != nil {
+			ev.live -= u.size
+			delete(ev.keys, key)
+		}
+		return
+	}
+	if u == nil {
+		u = &keyUse{}
+		ev.keys[key] = u
+	}
+	if kind == kindMergeOperand {
+		// The operand adds to the value until a merge folds them.
+		u.size += size
+		ev.live += size
+	} else {
+		ev.live += size - u.size
+		u.size = size
+	}
+	ev.clock++
+	u.last = ev.clock
+	u.hits++
+}
+
+// remove forgets key, which left the index without a tombstone.
+func (ev *evictor) remove(key string) {
+	ev.record(key, kindTombstone, 0)
+}
+
+// touch records a read of key.
+func (ev *evictor) touch(key string) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if u := ev.keys[key]; u != nil {
+		ev.clock++
+		u.last = ev.clock
+		u.hits++
+	}
+}
+
+// victim returns a key to evict if the live size is over budget, never
+// keep, which was just written.
+func (ev *evictor) victim(keep string) (string, bool) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.live <= ev.budget {
+		return "", false
+	}
+	var best string
+	var bestScore uint64
+	found, n := false, 0
+	for key, u := range ev.keys {
+		if key == keep {
+			continue
+		}
+		score := u.last
+		if ev.policy == EvictLFU {
+			score = u.hits
+		}
+		if !found || score < bestScore {
+			best, bestScore, found = key, score, true
+		}
+		if n++; n == evictionSamples {
+			break
+		}
+	}
+	return best, found
+}
+
+// evictOverBudget deletes keys until the live size fits the budget. It
+// runs on the writer after key was committed.
+func (db *DB) evictOverBudget(key string) {
+	for {
+		victim, ok := db.evictor.victim(key)
+		if !ok {
+			return
+		}
+		r := db.applySynced([]writeRequest{{key: victim, kind: kindTombstone}})[0]
+		if r.err != nil {
+			db.log(slog.LevelError, "eviction failed", "key", victim, "err", r.err)
+			return
+		}
+		written := r.written
+		if len(written) == 0 {
+			// Not in the index anymore
+			db.evictor.remove(victim)
+			continue
+		}
+		db.evictedKeys.Add(1)
+		db.audit(written, "")
+		db.committed(written[0])
+	}
+}
@@ -0,0 +1,76 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestEviction(t *testing.T) {
+	for name, policy := range map[string]EvictionPolicy{"lru": EvictLRU, "lfu": EvictLFU} {
+		policy := policy
+		t.Run(name, func(t *testing.T) {
+			dir := fmt.Sprintf("test_eviction_%d", policy)
+			defer os.RemoveAll(dir)
+
+			// Одне значення займає кілька десятків байтів, бюджет вміщує ~20
+			opts := Options{Eviction: &EvictionOptions{MaxLiveBytes: 20 * 40, Policy: policy}}
+			db, err := OpenWithOptions(dir, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hot := []string{"hot0", "hot1", "hot2", "hot3", "hot4"}
+			for _, key := range hot {
+				if err := db.Put(key, "value"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 200; i++ {
+				if err := db.Put(fmt.Sprintf("cold%03d", i), "value"); err != nil {
+					t.Fatal(err)
+				}
+				for _, key := range hot {
+					if _, err := db.Get(key); err != nil {
+						t.Fatalf("hot key %s evicted after %d writes: %v", key, i, err)
+					}
+				}
+			}
+
+			count := 0
+			db.ForEach(func(string, string) bool { count++; return true })
+			if count >= 30 {
+				t.Errorf("expected about 20 keys within budget, got %d", count)
+			}
+			if ev := db.Stats().EvictedKeys; ev != uint64(205-count) {
+				t.Errorf("EvictedKeys = %d, want %d", ev, 205-count)
+			}
+			if v, err := db.Get("cold199"); err != nil || v != "value" {
+				t.Errorf("latest write evicted: %q, %v", v, err)
+			}
+			db.Close()
+
+			// Витіснення збережені як видалення
+			db, err = OpenWithOptions(dir, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err := db.Get("cold000"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected cold000 to stay evicted, got %v", err)
+			}
+			if db.evictor.live > opts.Eviction.MaxLiveBytes {
+				t.Errorf("live size %d over budget after reopen", db.evictor.live)
+			}
+		})
+	}
+}
+
+func TestEviction_NeedsTombstones(t *testing.T) {
+	dir := "test_eviction_v3"
+	defer os.RemoveAll(dir)
+	_, err := OpenWithOptions(dir, Options{FormatVersion: FormatV3, Eviction: &EvictionOptions{MaxLiveBytes: 1000}})
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
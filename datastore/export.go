@@ -0,0 +1,197 @@
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const exportManifestName = "manifest.json"
+
+// exportRecord is a single line of a JSON Lines export.
+type exportRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ExportOption configures an Export.
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	partitioned bool
+	dir         string
+	partitions  int
+}
+
+// Partitioned splits an Export into up to n JSON Lines files in dir, each
+// holding a contiguous key range of roughly equal size, so they can be
+// loaded in parallel. The writer passed to Export receives the
+// ExportManifest describing them, which is also written to manifest.json
+// in dir last, once every partition file is complete.
+func Partitioned(dir string, n int) ExportOption {
+	return func(o *exportOptions) { o.partitioned, o.dir, o.partitions = true, dir, n }
+}
+
+// ExportManifest describes the files written by Export with Partitioned.
+type ExportManifest struct {
+	Partitions []ExportPartition `json:"partitions"`
+}
+
+// ExportPartition is one range-partitioned export file. StartKey and
+// EndKey are both inclusive.
+type ExportPartition struct {
+	File     string `json:"file"`
+	StartKey string `json:"start_key"`
+	EndKey   string `json:"end_key"`
+	Count    int    `json:"count"`
+}
+
+// exportPartitions writes keys with their values at seq into up to n
+// files in dir, and the manifest after them.
+func (db *DB) exportPartitions(dir string, n int, keys []string, seq uint64) (*ExportManifest, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	per := (len(keys) + n - 1) / n
+	if per == 0 {
+		per = 1
+	}
+
+	manifest := &ExportManifest{Partitions: []ExportPartition{}}
+	for i := 0; i*per < len(keys); i++ {
+		part := keys[i*per : min((i+1)*per, len(keys))]
+		name := fmt.Sprintf("part-%05d.jsonl", i)
+		count, err := db.exportFile(filepath.Join(dir, name), part, seq)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Partitions = append(manifest.Partitions, ExportPartition{
+			File:     name,
+			StartKey: part[0],
+			EndKey:   part[len(part)-1],
+			Count:    count,
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, exportManifestName), data, 0o644); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (db *DB) exportFile(path string, keys []string, seq uint64) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	count, err := db.exportKeys(w, keys, seq)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return count, f.Sync()
+}
+
+// Export writes every live key to w as JSON Lines, one {"key", "value"}
+// object per line in key order. The export is a snapshot of the moment it
+// starts: keys written later are exported with their earlier value, looked
+// up with GetAt, or left out if they did not exist yet. That earlier value
+// can only be found if the DB writes FormatV3 or newer and, should a merge
+// run meanwhile, retains it through Options.KeepVersions.
+func (db *DB) Export(w io.Writer, opts ...ExportOption) error {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.partitioned && o.partitions < 1 {
+		return fmt.Errorf("invalid partition count %d", o.partitions)
+	}
+	keys, seq := db.keysInRange("", "")
+	if o.partitioned {
+		manifest, err := db.exportPartitions(o.dir, o.partitions, keys, seq)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(manifest)
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := db.exportKeys(bw, keys, seq); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// exportKeys writes one JSON record per key to w with the value the key had
+// at sequence number seq.
+func (db *DB) exportKeys(w io.Writer, keys []string, seq uint64) (int, error) {
+	enc := json.NewEncoder(w)
+	return db.snapshotEach(keys, seq, func(key, value string) error {
+		return enc.Encode(exportRecord{Key: key, Value: value})
+	})
+}
+
+// snapshotEach calls fn with the value every key had at sequence number
+// seq, skipping keys that did not exist then, and returns the number of
+// calls.
+func (db *DB) snapshotEach(keys []string, seq uint64, fn func(key, value string) error) (int, error) {
+	count := 0
+	ra := db.newReadAhead()
+	for _, key := range keys {
+		e, err := ra.getEntry(key)
+		if err == nil && e.seq > seq {
+			e.value, err = db.GetAt(key, seq)
+		}
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		if err := fn(key, e.value); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Import loads JSON Lines as written by Export into db and returns the
+// number of records written. Blank lines are skipped; records are applied
+// in order, so a later line for the same key wins.
+func Import(db *DB, r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	count := 0
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var rec exportRecord
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return count, fmt.Errorf("line %d: %w", line, err)
+			}
+			if err := db.Put(rec.Key, rec.Value); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportPartitioned(t *testing.T) {
+	dir := "test_export_partitioned"
+	out := "test_export_partitioned_out"
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(out)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := db.Export(&buf, Partitioned(out, 3)); err != nil {
+		t.Fatal(err)
+	}
+	var m ExportManifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Partitions) != 3 {
+		t.Fatalf("expected 3 partitions, got %d", len(m.Partitions))
+	}
+
+	// Діапазони мають бути впорядковані та не перетинатися
+	total := 0
+	prevEnd := ""
+	for _, p := range m.Partitions {
+		if p.StartKey <= prevEnd {
+			t.Errorf("partition %s starts at %s, not after %s", p.File, p.StartKey, prevEnd)
+		}
+		prevEnd = p.EndKey
+
+		f, err := os.Open(filepath.Join(out, p.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := 0
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var rec exportRecord
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Key < p.StartKey || rec.Key > p.EndKey {
+				t.Errorf("key %s outside of partition range [%s, %s]", rec.Key, p.StartKey, p.EndKey)
+			}
+			lines++
+		}
+		f.Close()
+		if lines != p.Count {
+			t.Errorf("expected %d lines in %s, got %d", p.Count, p.File, lines)
+		}
+		total += lines
+	}
+	if total != 10 {
+		t.Errorf("expected 10 exported records, got %d", total)
+	}
+
+	if _, err := os.Stat(filepath.Join(out, exportManifestName)); err != nil {
+		t.Errorf("manifest not written: %v", err)
+	}
+	if err := db.Export(&buf, Partitioned(out, 0)); err == nil {
+		t.Error("expected error for zero partitions")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src, dst := "test_export_src", "test_export_dst"
+	defer os.RemoveAll(src)
+	defer os.RemoveAll(dst)
+
+	db, err := Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	data := map[string]string{
+		"plain":   "value",
+		"quoted":  `say "hi"`,
+		"newline": "line1\nline2",
+		"ключ":    "значення",
+		"":        "empty key",
+	}
+	for k, v := range data {
+		if err := db.Put(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := db.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != len(data) {
+		t.Fatalf("expected %d lines, got %d", len(data), lines)
+	}
+
+	target, err := Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	n, err := Import(target, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Fatalf("imported %d records", n)
+	}
+	for k, v := range data {
+		if got, err := target.Get(k); err != nil || got != v {
+			t.Errorf("%q = %q, %v", k, got, err)
+		}
+	}
+}
+
+func TestExport_Snapshot(t *testing.T) {
+	dir := "test_export_snapshot"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.Put("a", "old")
+	db.Put("b", "old")
+	keys, seq := db.keysInRange("", "")
+
+	// Записи після знімка не потрапляють в експорт
+	db.Put("a", "new")
+	db.Put("c", "new")
+
+	var buf bytes.Buffer
+	if _, err := db.exportKeys(&buf, keys, seq); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"key":"a","value":"old"}` + "\n" + `{"key":"b","value":"old"}` + "\n"
+	if buf.String() != want {
+		t.Fatalf("export = %q", buf.String())
+	}
+}
+
+func TestImport_BadLine(t *testing.T) {
+	dir := "test_import_bad"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	in := `{"key":"a","value":"1"}` + "\n\n" + `{"key":` + "\n"
+	n, err := Import(db, strings.NewReader(in))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected error on line 3, got %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("imported %d records before the error", n)
+	}
+}
@@ -0,0 +1,91 @@
+package datastore
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// ExpvarOptions configures Options.Expvar.
+type ExpvarOptions struct {
+	// Prefix starts the name of every variable, e.g. "datastore.puts".
+	// Empty means "datastore.".
+	Prefix string
+}
+
+// expvarCounters are the variables published for a DB, by name after the
+// prefix. Unlike the others, segments waits for db.mu.
+var expvarCounters = map[string]func(db *DB) any{
+	"puts":              func(db *DB) any { return db.puts.Load() },
+	"gets":              func(db *DB) any { return db.gets.Load() },
+	"misses":            func(db *DB) any { return db.misses.Load() },
+	"segments":          func(db *DB) any { return db.segmentTotal() },
+	"write_queue_depth": func(db *DB) any { return db.queueDepth() },
+	"bytes_written":     func(db *DB) any { return db.bytesWritten.Load() },
+}
+
+// expvars maps the prefixes published to the open DB whose counters they
+// show. expvar cannot remove variables, so a prefix stays published after
+// Close, showing null, and a DB opened later under it takes it over.
+var expvars struct {
+	mu  sync.Mutex
+	dbs map[string]*DB
+}
+
+// publishExpvars publishes the counters of db under prefix. It fails if
+// another open DB or another package publishes the names.
+func (db *DB) publishExpvars(prefix string) error {
+	if prefix == "" {
+		prefix = "datastore."
+	}
+	expvars.mu.Lock()
+	defer expvars.mu.Unlock()
+	cur, known := expvars.dbs[prefix]
+	if cur != nil {
+		return fmt.Errorf("expvar prefix %q is used by the DB in %s", prefix, cur.dir)
+	}
+	if !known {
+		for name := range expvarCounters {
+			if expvar.Get(prefix+name) != nil {
+				return fmt.Errorf("expvar %s is already published", prefix+name)
+			}
+		}
+		for name, read := range expvarCounters {
+			read := read
+			expvar.Publish(prefix+name, expvar.Func(func() any {
+				expvars.mu.Lock()
+				db := expvars.dbs[prefix]
+				expvars.mu.Unlock()
+				if db == nil {
+					return nil
+				}
+				return read(db)
+			}))
+		}
+		if expvars.dbs == nil {
+			expvars.dbs = make(map[string]*DB)
+		}
+	}
+	expvars.dbs[prefix] = db
+	db.expvarPrefix = prefix
+	return nil
+}
+
+// unpublishExpvars detaches the variables of db from it.
+func (db *DB) unpublishExpvars() {
+	if db.expvarPrefix == "" {
+		return
+	}
+	expvars.mu.Lock()
+	defer expvars.mu.Unlock()
+	if expvars.dbs[db.expvarPrefix] == db {
+		expvars.dbs[db.expvarPrefix] = nil
+	}
+}
+
+// segmentTotal returns the number of frozen and active segments.
+func (db *DB) segmentTotal() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.segments) + len(db.stripes)
+}
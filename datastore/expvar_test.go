@@ -0,0 +1,128 @@
+package datastore
+
+import (
+	"expvar"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestExpvar(t *testing.T) {
+	dir := "test_expvar"
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(dir + "_other")
+
+	opts := Options{Expvar: &ExpvarOptions{Prefix: "test_expvar."}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	db.Get("key")
+	db.Get("missing")
+	st := db.Stats()
+	for name, want := range map[string]any{
+		"puts": st.Puts, "gets": st.Gets, "misses": st.Misses, "segments": len(db.Segments()),
+		"write_queue_depth": st.WriteQueueDepth, "bytes_written": st.BytesWritten,
+	} {
+		if got := expvar.Get("test_expvar." + name).String(); got != fmt.Sprint(want) {
+			t.Errorf("%s = %s, want %v", name, got, want)
+		}
+	}
+	if st.Misses != 1 || st.Gets != 2 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	// Префікс відкритої бази зайнятий
+	if _, err := OpenWithOptions(dir+"_other", opts); err == nil {
+		t.Error("expected error for a prefix in use")
+	}
+	db.Close()
+	if got := expvar.Get("test_expvar.puts").String(); got != "null" {
+		t.Errorf("expected null after Close, got %s", got)
+	}
+
+	db, err = OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := expvar.Get("test_expvar.gets").String(); got != "0" {
+		t.Errorf("expected the reopened DB published, got %s", got)
+	}
+}
+
+// openFilesFS рахує відкриті файли
+type openFilesFS struct {
+	OSFS
+	open atomic.Int64
+}
+
+type countedFile struct {
+	File
+	fs   *openFilesFS
+	once sync.Once
+}
+
+func (f *countedFile) Close() error {
+	f.once.Do(func() { f.fs.open.Add(-1) })
+	return f.File.Close()
+}
+
+func (o *openFilesFS) track(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	o.open.Add(1)
+	return &countedFile{File: f, fs: o}, nil
+}
+
+func (o *openFilesFS) Open(name string) (File, error)   { return o.track(o.OSFS.Open(name)) }
+func (o *openFilesFS) Create(name string) (File, error) { return o.track(o.OSFS.Create(name)) }
+func (o *openFilesFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return o.track(o.OSFS.OpenFile(name, flag, perm))
+}
+
+func TestExpvar_FailedOpenClosesFiles(t *testing.T) {
+	dir := "test_expvar_failed"
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(dir + "_other")
+	t.Setenv("SEG_MAX", "100")
+
+	opts := Options{Expvar: &ExpvarOptions{Prefix: "test_expvar_failed."}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Друга база з кількома сегментами й журналом аудиту
+	ofs := &openFilesFS{}
+	other, err := OpenWithOptions(dir+"_other", Options{FS: ofs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := other.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other.Close()
+	if n := ofs.open.Load(); n != 0 {
+		t.Fatalf("expected no files open after Close, got %d", n)
+	}
+
+	opts.FS = ofs
+	opts.Audit = &AuditOptions{}
+	if _, err := OpenWithOptions(dir+"_other", opts); err == nil {
+		t.Fatal("expected error for a prefix in use")
+	}
+	if n := ofs.open.Load(); n != 0 {
+		t.Errorf("expected the failed Open to close its files, %d left open", n)
+	}
+}
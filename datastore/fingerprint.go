@@ -0,0 +1,197 @@
+package datastore
+
+import (
+	"hash/fnv"
+	"hash/maphash"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// HashFunc maps a key to the 64-bit fingerprint stored by IndexFingerprint.
+// Fingerprints only live in memory and are recomputed on Open, so the
+// function may change between runs.
+type HashFunc func(key string) uint64
+
+// HashXXH64 is xxHash64, the default HashFunc.
+func HashXXH64(key string) uint64 {
+	return xxhash.Sum64String(key)
+}
+
+// HashFNV1a is 64-bit FNV-1a.
+func HashFNV1a(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+var maphashSeed = maphash.MakeSeed()
+
+// HashMaphash is hash/maphash with a per-process random seed.
+func HashMaphash(key string) uint64 {
+	return maphash.String(maphashSeed, key)
+}
+
+// fingerprintIndex stores fingerprints instead of keys. get may return the
+// position of a different key with the same fingerprint, so readers compare
+// the key of the entry they read; ascend reads every key back from disk.
+// A key whose fingerprint is taken by another live key is kept in full in
+// overflow, which put and remove find out by reading the key of the entry
+// a fingerprint points to.
+type fingerprintIndex struct {
+	hash     HashFunc
+	keyAt    func(pos position) (string, error)
+	m        map[uint64]position
+	overflow map[string]position // Keys colliding with the one in m
+}
+
+func newFingerprintIndex(hash HashFunc, keyAt func(position) (string, error)) *fingerprintIndex {
+	if hash == nil {
+		hash = HashXXH64
+	}
+	return &fingerprintIndex{hash: hash, keyAt: keyAt, m: make(map[uint64]position)}
+}
+
+func (f *fingerprintIndex) get(key string) (position, bool) {
+	if pos, ok := f.overflow[key]; ok {
+		return pos, true
+	}
+	pos, ok := f.m[f.hash(key)]
+	return pos, ok
+}
+
+// holds reports whether the entry at pos is not of a key other than key.
+// An unreadable entry counts as key's.
+func (f *fingerprintIndex) holds(pos position, key string) bool {
+	k, err := f.keyAt(pos)
+	return err != nil || k == key
+}
+
+func (f *fingerprintIndex) put(key string, pos position) {
+	if _, ok := f.overflow[key]; ok {
+		f.overflow[key] = pos
+		return
+	}
+	fp := f.hash(key)
+	if cur, ok := f.m[fp]; ok && !f.holds(cur, key) {
+		if f.overflow == nil {
+			f.overflow = make(map[string]position)
+		}
+		f.overflow[key] = pos
+		return
+	}
+	f.m[fp] = pos
+}
+
+func (f *fingerprintIndex) remove(key string) {
+	if _, ok := f.overflow[key]; ok {
+		delete(f.overflow, key)
+		return
+	}
+	fp := f.hash(key)
+	cur, ok := f.m[fp]
+	if !ok || !f.holds(cur, key) {
+		return
+	}
+	delete(f.m, fp)
+	// A colliding key takes over the fingerprint.
+	for k, pos := range f.overflow {
+		if f.hash(k) == fp {
+			f.m[fp] = pos
+			delete(f.overflow, k)
+			break
+		}
+	}
+}
+
+// verified returns a get for keys that only answers with the entries of
+// the keys themselves, read back at once.
+func (f *fingerprintIndex) verified(keys []string) func(key string) (position, bool) {
+	owned := make(map[string]position, len(keys))
+	for _, key := range keys {
+		if pos, ok := f.get(key); ok && f.holds(pos, key) {
+			owned[key] = pos
+		}
+	}
+	return func(key string) (position, bool) {
+		pos, ok := owned[key]
+		return pos, ok
+	}
+}
+
+// repoint moves key from old to pos like put, comparing positions rather
+// than reading keys back: a merge replaces the segments old is in first.
+func (f *fingerprintIndex) repoint(key string, old, pos position) {
+	if cur, ok := f.overflow[key]; ok {
+		if cur == old {
+			f.overflow[key] = pos
+		}
+		return
+	}
+	if fp := f.hash(key); f.m[fp] == old {
+		f.m[fp] = pos
+	}
+}
+
+// removeAt removes key, indexed at old, like repoint.
+func (f *fingerprintIndex) removeAt(key string, old position) {
+	if cur, ok := f.overflow[key]; ok {
+		if cur == old {
+			delete(f.overflow, key)
+		}
+		return
+	}
+	if fp := f.hash(key); f.m[fp] == old {
+		delete(f.m, fp)
+		for k, pos := range f.overflow {
+			if f.hash(k) == fp {
+				f.m[fp] = pos
+				delete(f.overflow, k)
+				break
+			}
+		}
+	}
+}
+
+func (f *fingerprintIndex) len() int {
+	return len(f.m) + len(f.overflow)
+}
+
+func (f *fingerprintIndex) ascend(start, end string, fn func(key string, pos position) bool) {
+	items := make([]btreeItem, 0, len(f.m))
+	for _, pos := range f.m {
+		key, err := f.keyAt(pos)
+		if err != nil {
+			continue
+		}
+		if key >= start && (end == "" || key < end) {
+			items = append(items, btreeItem{key: key, pos: pos})
+		}
+	}
+	for key, pos := range f.overflow {
+		if key >= start && (end == "" || key < end) {
+			items = append(items, btreeItem{key: key, pos: pos})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	for _, it := range items {
+		if !fn(it.key, it.pos) {
+			return
+		}
+	}
+}
+
+func (f *fingerprintIndex) rebase(from, to int) {
+	for fp, pos := range f.m {
+		if pos.segID == from {
+			pos.segID = to
+			f.m[fp] = pos
+		}
+	}
+	for key, pos := range f.overflow {
+		if pos.segID == from {
+			pos.segID = to
+			f.overflow[key] = pos
+		}
+	}
+}
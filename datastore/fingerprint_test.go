@@ -0,0 +1,157 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintIndex_RotateMergeReopen(t *testing.T) {
+	for name, h := range map[string]HashFunc{"xxh64": HashXXH64, "fnv1a": HashFNV1a, "maphash": HashMaphash} {
+		t.Run(name, func(t *testing.T) {
+			dir := "test_fingerprint_" + name
+			defer os.RemoveAll(dir)
+			t.Setenv("SEG_MAX", "100")
+
+			opts := Options{IndexType: IndexFingerprint, Hash: h}
+			db, err := OpenWithOptions(dir, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for round := 0; round < 3; round++ {
+				for i := 0; i < 10; i++ {
+					if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("v%d-%d", i, round)); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := db.merge(); err != nil {
+				t.Fatal(err)
+			}
+			check := func(db *DB) {
+				t.Helper()
+				for i := 0; i < 10; i++ {
+					if v, err := db.Get(fmt.Sprintf("key%d", i)); err != nil || v != fmt.Sprintf("v%d-2", i) {
+						t.Errorf("key%d = %q, %v", i, v, err)
+					}
+				}
+			}
+			check(db)
+			db.Close()
+
+			// Після перевідкриття відбитки будуються заново
+			reopened, err := OpenWithOptions(dir, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reopened.Close()
+			check(reopened)
+		})
+	}
+}
+
+func TestFingerprintIndex_CollisionVerifiedOnRead(t *testing.T) {
+	dir := "test_fingerprint_collision"
+	defer os.RemoveAll(dir)
+
+	// Усі ключі з префіксом "a" мають однаковий відбиток
+	hash := func(key string) uint64 {
+		if strings.HasPrefix(key, "a") {
+			return 1
+		}
+		return HashXXH64(key)
+	}
+	db, err := OpenWithOptions(dir, Options{IndexType: IndexFingerprint, Hash: hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("apple", "red"); err != nil {
+		t.Fatal(err)
+	}
+	// Відсутній ключ з тим самим відбитком не повинен повертати чуже значення
+	if _, err := db.Get("avocado"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	res, err := db.GetMulti([]string{"apple", "avocado"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res["apple"] != "red" {
+		t.Fatalf("GetMulti = %v", res)
+	}
+	if n, err := db.IncrInt64("avocado", 1); err != nil || n != 1 {
+		t.Fatalf("IncrInt64 = %d, %v", n, err)
+	}
+}
+
+func TestFingerprintIndex_CollidingKeys(t *testing.T) {
+	dir := "test_fingerprint_colliding"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "100")
+
+	hash := func(key string) uint64 {
+		if strings.HasPrefix(key, "a") {
+			return 1
+		}
+		return HashXXH64(key)
+	}
+	opts := Options{IndexType: IndexFingerprint, Hash: hash}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	// Ключі з однаковим відбитком живуть поруч
+	for _, kv := range [][2]string{{"apple", "red"}, {"avocado", "green"}, {"apricot", "orange"}, {"avocado", "ripe"}} {
+		if err := db.Put(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(want map[string]string) {
+		t.Helper()
+		for _, key := range []string{"apple", "avocado", "apricot"} {
+			v, err := db.Get(key)
+			if w, ok := want[key]; ok && (err != nil || v != w) {
+				t.Errorf("Get(%s) = %q, %v, want %q", key, v, err, w)
+			}
+			if _, ok := want[key]; !ok && !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected %s deleted, got %q, %v", key, v, err)
+			}
+		}
+		if n := db.index.len(); n != len(want) {
+			t.Errorf("index holds %d keys, want %d", n, len(want))
+		}
+	}
+	check(map[string]string{"apple": "red", "avocado": "ripe", "apricot": "orange"})
+
+	// Видалення одного ключа не зачіпає інших
+	if err := db.Delete("apple"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"avocado": "ripe", "apricot": "orange"}
+	check(want)
+
+	// І після злиття та перевідкриття, коли журнал відтворюється
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(want)
+	db.Close()
+	if db, err = OpenWithOptions(dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	check(want)
+	var keys []string
+	db.RangeKeys("", "", func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if fmt.Sprint(keys) != "[apricot avocado]" {
+		t.Errorf("keys = %v", keys)
+	}
+}
@@ -0,0 +1,279 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// segmentMagic starts every segment written with a header.
+	segmentMagic = "DSKV"
+	// segmentHeaderSize is magic (4 bytes) + version (2) + reserved (2).
+	segmentHeaderSize = 8
+)
+
+// On-disk format versions.
+const (
+	// FormatLegacy marks segments written before headers existed. They are
+	// plain concatenated entries and are still readable.
+	FormatLegacy uint16 = 0
+	// FormatV1 adds the segment header.
+	FormatV1 uint16 = 1
+	// FormatV2 ends every entry with a kind byte, needed for merge operands.
+	FormatV2 uint16 = 2
+	// FormatV3 adds a sequence number after the kind byte.
+	FormatV3 uint16 = 3
+	// FormatV4 keeps the V3 layout and adds tombstones, needed for Delete.
+	FormatV4 uint16 = 4
+	// FormatV5 ends every entry with a CRC-32C of all its preceding bytes.
+	FormatV5 uint16 = 5
+	// FormatV6 adds the write time, in Unix nanoseconds, after the
+	// sequence number.
+	FormatV6 uint16 = 6
+	// FormatV7 keeps the V6 layout and adds kindBatchFlag, needed for
+	// atomic multi-entry writes such as Rename.
+	FormatV7 uint16 = 7
+	// FormatV8 adds the expiry time, in Unix nanoseconds or zero for none,
+	// after the write time, needed for WithTTL.
+	FormatV8 uint16 = 8
+	// FormatV9 keeps the V8 layout and adds kindEncodedFlag, marking
+	// values stored encoded by Options.Codecs.
+	FormatV9 uint16 = 9
+	// FormatV10 keeps the V9 layout and adds kindHistory, needed for
+	// Options.KeepVersions.
+	FormatV10 uint16 = 10
+
+	// CurrentFormat is the newest version this package can read and write.
+	CurrentFormat = FormatV10
+)
+
+// ErrUnsupportedFormat is returned for format versions this package cannot
+// read or write.
+var ErrUnsupportedFormat = errors.New("unsupported segment format version")
+
+// ErrChecksum is returned when an entry does not match its checksum.
+var ErrChecksum = errors.New("entry checksum mismatch")
+
+// errTornBatch is met when a segment ends before the last entry of an
+// atomic batch.
+var errTornBatch = errors.New("segment ends inside an atomic batch")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// formatSpec describes how one format version lays out segments and
+// entries. Every version listed in formatSpecs is readable.
+type formatSpec struct {
+	header     bool // Segment starts with magic + version
+	kind       bool // Entries end with a kind byte
+	seq        bool // Entries end with a uint64 sequence number, after the kind
+	tombstones bool // Kind byte may be kindTombstone
+	timestamp  bool // Entries store a uint64 write time, after the sequence number
+	checksum   bool // Entries end with a CRC-32C, after the sequence number and write time
+	batches    bool // Kind byte may carry kindBatchFlag
+	expiry     bool // Entries store a uint64 expiry time, after the write time
+	codecs     bool // Kind byte may carry kindEncodedFlag
+	history    bool // Kind byte may be kindHistory
+}
+
+var formatSpecs = map[uint16]formatSpec{
+	FormatLegacy: {header: false},
+	FormatV1:     {header: true},
+	FormatV2:     {header: true, kind: true},
+	FormatV3:     {header: true, kind: true, seq: true},
+	FormatV4:     {header: true, kind: true, seq: true, tombstones: true},
+	FormatV5:     {header: true, kind: true, seq: true, tombstones: true, checksum: true},
+	FormatV6:     {header: true, kind: true, seq: true, tombstones: true, timestamp: true, checksum: true},
+	FormatV7:     {header: true, kind: true, seq: true, tombstones: true, timestamp: true, checksum: true, batches: true},
+	FormatV8:     {header: true, kind: true, seq: true, tombstones: true, timestamp: true, checksum: true, batches: true, expiry: true},
+	FormatV9:     {header: true, kind: true, seq: true, tombstones: true, timestamp: true, checksum: true, batches: true, expiry: true, codecs: true},
+	FormatV10:    {header: true, kind: true, seq: true, tombstones: true, timestamp: true, checksum: true, batches: true, expiry: true, codecs: true, history: true},
+}
+
+// trailerSize is the number of bytes stored after an entry's value.
+func (s formatSpec) trailerSize() int {
+	n := 0
+	if s.kind {
+		n++
+	}
+	if s.seq {
+		n += 8
+	}
+	if s.timestamp {
+		n += 8
+	}
+	if s.expiry {
+		n += 8
+	}
+	if s.checksum {
+		n += 4
+	}
+	return n
+}
+
+func specFor(version uint16) (formatSpec, error) {
+	spec, ok := formatSpecs[version]
+	if !ok {
+		return formatSpec{}, fmt.Errorf("%w: %d", ErrUnsupportedFormat, version)
+	}
+	return spec, nil
+}
+
+// writeFormat resolves the version new segments are written in. Zero means
+// CurrentFormat; the legacy format is only available through Migrate.
+func writeFormat(requested uint16) (uint16, error) {
+	if requested == FormatLegacy {
+		return CurrentFormat, nil
+	}
+	if _, err := specFor(requested); err != nil {
+		return 0, err
+	}
+	return requested, nil
+}
+
+// segmentPreamble returns the bytes a segment of the given version starts
+// with, which is empty for headerless versions.
+func segmentPreamble(version uint16) []byte {
+	if !formatSpecs[version].header {
+		return nil
+	}
+	buf := make([]byte, segmentHeaderSize)
+	copy(buf[0:4], segmentMagic)
+	binary.LittleEndian.PutUint16(buf[4:6], version)
+	return buf
+}
+
+// readSegmentHeader detects the format version of a segment of the given
+// size and returns it with the offset of its first entry. Empty files
+// report CurrentFormat since the header is written with the first entry;
+// files without the magic are legacy.
+func readSegmentHeader(r io.ReaderAt, size int64) (uint16, int64, error) {
+	if size == 0 {
+		return CurrentFormat, 0, nil
+	}
+	if size < segmentHeaderSize {
+		return FormatLegacy, 0, nil
+	}
+	hdr := make([]byte, segmentHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return 0, 0, fmt.Errorf("failed to read segment header: %w", err)
+	}
+	if string(hdr[0:4]) != segmentMagic {
+		return FormatLegacy, 0, nil
+	}
+	version := binary.LittleEndian.Uint16(hdr[4:6])
+	if _, err := specFor(version); err != nil {
+		return 0, 0, err
+	}
+	return version, segmentHeaderSize, nil
+}
+
+// encodeEntry encodes e in the entry layout of the given version: the
+// legacy layout produced by Encode followed by the version's trailer.
+func encodeEntry(e *entry, version uint16) ([]byte, error) {
+	spec := formatSpecs[version]
+	if !spec.kind && e.kind != kindValue {
+		return nil, fmt.Errorf("%w: entry kind %d needs format %d or newer", ErrUnsupportedFormat, e.kind, FormatV2)
+	}
+	if !spec.tombstones && e.kind == kindTombstone {
+		return nil, fmt.Errorf("%w: tombstones need format %d or newer", ErrUnsupportedFormat, FormatV4)
+	}
+	if !spec.history && e.kind == kindHistory {
+		return nil, fmt.Errorf("%w: history entries need format %d or newer", ErrUnsupportedFormat, FormatV10)
+	}
+	if !spec.expiry && e.expires != 0 {
+		return nil, fmt.Errorf("%w: expiring entries need format %d or newer", ErrUnsupportedFormat, FormatV8)
+	}
+	if !spec.codecs && e.encoded {
+		return nil, fmt.Errorf("%w: encoded values need format %d or newer", ErrUnsupportedFormat, FormatV9)
+	}
+	buf := e.Encode()
+	if spec.kind {
+		kind := e.kind
+		// Formats without batches only get whole batches, migrated from
+		// recovered segments, so the flag can be dropped.
+		if e.batch && spec.batches {
+			kind |= kindBatchFlag
+		}
+		if e.encoded {
+			kind |= kindEncodedFlag
+		}
+		buf = append(buf, byte(kind))
+	}
+	if spec.seq {
+		buf = binary.LittleEndian.AppendUint64(buf, e.seq)
+	}
+	if spec.timestamp {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.ts))
+	}
+	if spec.expiry {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.expires))
+	}
+	if spec.checksum {
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+	}
+	return buf, nil
+}
+
+// decodeEntry reads one entry in the layout of the given version and
+// returns its encoded size. An entry failing ErrChecksum was read in full,
+// so its size is returned as well.
+func decodeEntry(e *entry, r io.Reader, version uint16) (int, error) {
+	n, err := e.DecodeFromReader(r)
+	if err != nil {
+		return 0, err
+	}
+	spec := formatSpecs[version]
+	size := spec.trailerSize()
+	if size == 0 {
+		return n, nil
+	}
+	trailer := make([]byte, size)
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	if spec.checksum {
+		want := binary.LittleEndian.Uint32(trailer[size-4:])
+		if entryChecksum(e, trailer[:size-4]) != want {
+			return n + size, ErrChecksum
+		}
+	}
+	if spec.kind {
+		e.kind = entryKind(trailer[0])
+	}
+	if spec.batches {
+		e.batch = e.kind&kindBatchFlag != 0
+		e.kind &^= kindBatchFlag
+	}
+	if spec.codecs {
+		e.encoded = e.kind&kindEncodedFlag != 0
+		e.kind &^= kindEncodedFlag
+	}
+	if spec.seq {
+		e.seq = binary.LittleEndian.Uint64(trailer[1:9])
+	}
+	if spec.timestamp {
+		e.ts = int64(binary.LittleEndian.Uint64(trailer[9:17]))
+	}
+	if spec.expiry {
+		e.expires = int64(binary.LittleEndian.Uint64(trailer[17:25]))
+	}
+	return n + size, nil
+}
+
+// entryChecksum returns the CRC-32C of e's encoding up to its checksum,
+// where rest holds the trailer bytes before it.
+func entryChecksum(e *entry, rest []byte) uint32 {
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], uint32(len(e.key)))
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(len(e.value)))
+	crc := crc32.Update(0, castagnoli, hdr[:])
+	crc = crc32.Update(crc, castagnoli, []byte(e.key))
+	crc = crc32.Update(crc, castagnoli, []byte(e.value))
+	return crc32.Update(crc, castagnoli, rest)
+}
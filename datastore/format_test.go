@@ -0,0 +1,107 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSegmentHeader_Written(t *testing.T) {
+	dir := "test_segment_header"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	data, err := os.ReadFile(db.stripes[0].active.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != segmentMagic {
+		t.Errorf("expected segment to start with %q, got %q", segmentMagic, data[:4])
+	}
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	v, err := db.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "value" {
+		t.Errorf("expected value, got %s", v)
+	}
+}
+
+func TestSegmentHeader_Legacy(t *testing.T) {
+	dir := "test_segment_legacy"
+	defer os.RemoveAll(dir)
+
+	// Сегменти без заголовка, записані старою версією
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	frozen := entry{key: "old", value: "frozen"}
+	active := entry{key: "new", value: "active"}
+	if err := os.WriteFile(filepath.Join(dir, "segment-0.data"), frozen.Encode(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, activeName), active.Encode(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Старий активний сегмент має бути заморожений
+	if len(db.segments) != 2 {
+		t.Errorf("expected legacy active segment to be frozen, got %d segments", len(db.segments))
+	}
+	for key, expected := range map[string]string{"old": "frozen", "new": "active"} {
+		v, err := db.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Errorf("expected %s, got %s", expected, v)
+		}
+	}
+
+	if err := db.Put("fresh", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if db.stripes[0].active.version != CurrentFormat {
+		t.Errorf("expected active segment version %d, got %d", CurrentFormat, db.stripes[0].active.version)
+	}
+}
+
+func TestSegmentHeader_UnknownVersion(t *testing.T) {
+	dir := "test_segment_unknown_version"
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := segmentPreamble(CurrentFormat)
+	data[4]++
+	if err := os.WriteFile(filepath.Join(dir, "segment-0.data"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Open(dir)
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
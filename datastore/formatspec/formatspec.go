@@ -0,0 +1,469 @@
+// Package formatspec is the reference description of the datastore on-disk
+// format. It ships canonical segments for every format version together
+// with a validator, so other implementations and refactors of datastore can
+// prove byte-level compatibility.
+//
+// A segment is an optional 8-byte header (magic "DSKV", little-endian
+// uint16 version, 2 reserved zero bytes) followed by entries laid out as
+// [key length uint32][value length uint32][key][value][trailer]. The
+// trailer depends on the version: legacy and V1 entries have none, V2
+// entries end with a kind byte and V3 entries with a kind byte followed by
+// a little-endian uint64 sequence number. V4 keeps the V3 layout and adds
+// the tombstone kind. V5 appends a little-endian CRC-32C (Castagnoli) of
+// all the entry's preceding bytes. V6 adds the write time, a little-endian
+// int64 of Unix nanoseconds, between the sequence number and the checksum.
+// V7 keeps the V6 layout and marks atomic batches: every entry of a batch
+// but the last has BatchFlag set in its kind byte, and a segment never ends
+// inside a batch. V8 adds the expiry time, a little-endian int64 of Unix
+// nanoseconds or zero for none, between the write time and the checksum.
+// V9 keeps the V8 layout and marks encoded values with EncodedFlag in the
+// kind byte: such a value starts with the number of codecs applied to it
+// and their IDs, one byte each in the order they were applied, followed by
+// the encoded bytes. V10 keeps the V9 layout and adds the history kind.
+package formatspec
+
+import (
+	"bytes"
+	"embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Format versions, matching datastore.FormatLegacy and friends.
+const (
+	Legacy uint16 = 0
+	V1     uint16 = 1
+	V2     uint16 = 2
+	V3     uint16 = 3
+	V4     uint16 = 4
+	V5     uint16 = 5
+	V6     uint16 = 6
+	V7     uint16 = 7
+	V8     uint16 = 8
+	V9     uint16 = 9
+	V10    uint16 = 10
+
+	// Latest is the newest version described by this package.
+	Latest = V10
+)
+
+const (
+	// Magic starts every segment written with a header.
+	Magic = "DSKV"
+	// HeaderSize is magic (4 bytes) + version (2) + reserved (2).
+	HeaderSize = 8
+	// entryHeaderSize holds the key and value lengths.
+	entryHeaderSize = 8
+)
+
+// Kind tells what an entry's value means. Only V2 and newer store it.
+type Kind uint8
+
+const (
+	KindValue        Kind = 0
+	KindMergeOperand Kind = 1
+	// KindHistory marks an older value retained by compaction. Readers
+	// must not treat it as the current value of its key. V10 and newer.
+	KindHistory Kind = 2
+	// KindTombstone marks a deleted key; its value is empty. V4 and newer.
+	KindTombstone Kind = 3
+
+	// BatchFlag is or-ed into the kind byte of every entry of an atomic
+	// batch but the last. V7 and newer.
+	BatchFlag Kind = 0x80
+	// EncodedFlag is or-ed into the kind byte of values stored encoded.
+	// V9 and newer.
+	EncodedFlag Kind = 0x40
+)
+
+// Entry is a decoded entry.
+type Entry struct {
+	Key   string
+	Value string
+	Kind  Kind
+	Seq   uint64 // V3 and newer
+	// Timestamp is the write time in Unix nanoseconds. V6 and newer.
+	Timestamp int64
+	// Batch tells that the next entry belongs to the same atomic batch.
+	// V7 and newer.
+	Batch bool
+	// Expires is when the entry expires in Unix nanoseconds, zero for
+	// never. V8 and newer.
+	Expires int64
+	// Encoded tells that Value is encoded, starting with its codec IDs.
+	// V9 and newer.
+	Encoded bool
+}
+
+// Segment is a decoded segment.
+type Segment struct {
+	Version uint16
+	Entries []Entry
+}
+
+var (
+	// ErrUnsupportedVersion is returned for versions this package does not
+	// describe.
+	ErrUnsupportedVersion = errors.New("formatspec: unsupported format version")
+	// ErrCorrupt is wrapped by every structural error Validate reports.
+	ErrCorrupt = errors.New("formatspec: corrupt segment")
+)
+
+type layout struct {
+	header    bool
+	kind      bool
+	seq       bool
+	timestamp bool
+	checksum  bool
+	batches   bool
+	expiry    bool
+	codecs    bool
+	history   bool // KindHistory is allowed
+	maxKind   Kind // Highest kind allowed
+}
+
+var layouts = map[uint16]layout{
+	Legacy: {},
+	V1:     {header: true},
+	V2:     {header: true, kind: true, maxKind: KindMergeOperand},
+	V3:     {header: true, kind: true, seq: true, maxKind: KindMergeOperand},
+	V4:     {header: true, kind: true, seq: true, maxKind: KindTombstone},
+	V5:     {header: true, kind: true, seq: true, checksum: true, maxKind: KindTombstone},
+	V6:     {header: true, kind: true, seq: true, timestamp: true, checksum: true, maxKind: KindTombstone},
+	V7:     {header: true, kind: true, seq: true, timestamp: true, checksum: true, batches: true, maxKind: KindTombstone},
+	V8:     {header: true, kind: true, seq: true, timestamp: true, checksum: true, batches: true, expiry: true, maxKind: KindTombstone},
+	V9:     {header: true, kind: true, seq: true, timestamp: true, checksum: true, batches: true, expiry: true, codecs: true, maxKind: KindTombstone},
+	V10:    {header: true, kind: true, seq: true, timestamp: true, checksum: true, batches: true, expiry: true, codecs: true, history: true, maxKind: KindTombstone},
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func (l layout) trailerSize() int {
+	n := 0
+	if l.kind {
+		n++
+	}
+	if l.seq {
+		n += 8
+	}
+	if l.timestamp {
+		n += 8
+	}
+	if l.expiry {
+		n += 8
+	}
+	if l.checksum {
+		n += 4
+	}
+	return n
+}
+
+func layoutFor(version uint16) (layout, error) {
+	l, ok := layouts[version]
+	if !ok {
+		return layout{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	return l, nil
+}
+
+// Versions lists every described version, oldest first.
+func Versions() []uint16 {
+	return []uint16{Legacy, V1, V2, V3, V4, V5, V6, V7, V8, V9, V10}
+}
+
+// EncodeEntry returns the canonical encoding of e in the given version.
+// Fields the version does not store are dropped.
+func EncodeEntry(version uint16, e Entry) ([]byte, error) {
+	l, err := layoutFor(version)
+	if err != nil {
+		return nil, err
+	}
+	if !l.kind && e.Kind != KindValue {
+		return nil, fmt.Errorf("formatspec: entry kind %d needs version %d or newer", e.Kind, V2)
+	}
+	if (e.Kind > l.maxKind || e.Kind == KindHistory && !l.history) && l.kind {
+		return nil, fmt.Errorf("formatspec: entry kind %d is not allowed in version %d", e.Kind, version)
+	}
+	if e.Batch && !l.batches {
+		return nil, fmt.Errorf("formatspec: atomic batches need version %d or newer", V7)
+	}
+	if e.Encoded && !l.codecs {
+		return nil, fmt.Errorf("formatspec: encoded values need version %d or newer", V9)
+	}
+	buf := make([]byte, entryHeaderSize, entryHeaderSize+len(e.Key)+len(e.Value)+l.trailerSize())
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(e.Key)))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(e.Value)))
+	buf = append(buf, e.Key...)
+	buf = append(buf, e.Value...)
+	if l.kind {
+		kind := e.Kind
+		if e.Batch {
+			kind |= BatchFlag
+		}
+		if e.Encoded {
+			kind |= EncodedFlag
+		}
+		buf = append(buf, byte(kind))
+	}
+	if l.seq {
+		buf = binary.LittleEndian.AppendUint64(buf, e.Seq)
+	}
+	if l.timestamp {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Timestamp))
+	}
+	if l.expiry {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(e.Expires))
+	}
+	if l.checksum {
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, castagnoli))
+	}
+	return buf, nil
+}
+
+// EncodeSegment returns the canonical encoding of a segment holding
+// entries in order.
+func EncodeSegment(version uint16, entries []Entry) ([]byte, error) {
+	l, err := layoutFor(version)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if l.header && len(entries) > 0 {
+		var hdr [HeaderSize]byte
+		copy(hdr[0:4], Magic)
+		binary.LittleEndian.PutUint16(hdr[4:6], version)
+		buf.Write(hdr[:])
+	}
+	for _, e := range entries {
+		b, err := EncodeEntry(version, e)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// Validate decodes a whole segment and checks it against the spec. Data
+// without the magic is read as a legacy segment; an empty segment is valid
+// and reports Latest, since headers are written together with the first
+// entry.
+func Validate(data []byte) (*Segment, error) {
+	seg := &Segment{Version: Latest}
+	if len(data) == 0 {
+		return seg, nil
+	}
+	off := 0
+	seg.Version = Legacy
+	if len(data) >= HeaderSize && string(data[0:4]) == Magic {
+		seg.Version = binary.LittleEndian.Uint16(data[4:6])
+		if _, err := layoutFor(seg.Version); err != nil {
+			return nil, err
+		}
+		if data[6] != 0 || data[7] != 0 {
+			return nil, fmt.Errorf("%w: reserved header bytes are not zero", ErrCorrupt)
+		}
+		off = HeaderSize
+	}
+	l := layouts[seg.Version]
+	for off < len(data) {
+		if len(data)-off < entryHeaderSize {
+			return nil, fmt.Errorf("%w: truncated entry header at offset %d", ErrCorrupt, off)
+		}
+		kl := int64(binary.LittleEndian.Uint32(data[off : off+4]))
+		vl := int64(binary.LittleEndian.Uint32(data[off+4 : off+8]))
+		valEnd := int64(off) + entryHeaderSize + kl + vl
+		end := valEnd + int64(l.trailerSize())
+		if end > int64(len(data)) {
+			return nil, fmt.Errorf("%w: entry at offset %d runs past end of segment", ErrCorrupt, off)
+		}
+		keyStart := off + entryHeaderSize
+		valStart := keyStart + int(kl)
+		e := Entry{
+			Key:   string(data[keyStart:valStart]),
+			Value: string(data[valStart : valStart+int(vl)]),
+		}
+		if l.kind {
+			e.Kind = Kind(data[valEnd])
+			if l.batches {
+				e.Batch = e.Kind&BatchFlag != 0
+				e.Kind &^= BatchFlag
+			}
+			if l.codecs {
+				e.Encoded = e.Kind&EncodedFlag != 0
+				e.Kind &^= EncodedFlag
+				if e.Encoded && (vl == 0 || vl < 1+int64(data[valStart])) {
+					return nil, fmt.Errorf("%w: encoded value at offset %d misses its codec IDs", ErrCorrupt, off)
+				}
+			}
+			if e.Kind > l.maxKind || e.Kind == KindHistory && !l.history {
+				return nil, fmt.Errorf("%w: unknown entry kind %d at offset %d", ErrCorrupt, e.Kind, off)
+			}
+		}
+		if l.seq {
+			e.Seq = binary.LittleEndian.Uint64(data[valEnd+1 : valEnd+9])
+		}
+		if l.timestamp {
+			e.Timestamp = int64(binary.LittleEndian.Uint64(data[valEnd+9 : valEnd+17]))
+		}
+		if l.expiry {
+			e.Expires = int64(binary.LittleEndian.Uint64(data[valEnd+17 : valEnd+25]))
+		}
+		if l.checksum {
+			want := binary.LittleEndian.Uint32(data[end-4 : end])
+			if crc32.Checksum(data[off:end-4], castagnoli) != want {
+				return nil, fmt.Errorf("%w: checksum mismatch at offset %d", ErrCorrupt, off)
+			}
+		}
+		seg.Entries = append(seg.Entries, e)
+		off = int(end)
+	}
+	if n := len(seg.Entries); n > 0 && seg.Entries[n-1].Batch {
+		return nil, fmt.Errorf("%w: segment ends inside an atomic batch", ErrCorrupt)
+	}
+	return seg, nil
+}
+
+// Case is a canonical segment: Entries encoded in Version give exactly
+// Segment.
+type Case struct {
+	Name    string
+	Version uint16
+	Entries []Entry
+	Segment []byte
+}
+
+//go:embed golden/*.seg
+var golden embed.FS
+
+// caseEntries returns the entries of the canonical segment for version.
+// They cover empty keys and values, non-ASCII bytes, overwrites and, where
+// the version supports them, merge operands, tombstones, sequence
+// numbers, which count writes from 1, write times, one second apart from
+// CaseEpoch except within a batch, an atomic batch renaming a key, a
+// value expiring CaseTTL after it was written and a value encoded by
+// CaseCodec.
+func caseEntries(version uint16) []Entry {
+	entries := []Entry{
+		{Key: "key", Value: "value"},
+		{Key: "", Value: "empty key"},
+		{Key: "empty value", Value: ""},
+		{Key: "ключ", Value: "значення"},
+		{Key: "bin", Value: "\x00\x01\xff"},
+		{Key: "key", Value: "overwritten"},
+	}
+	if layouts[version].kind {
+		entries = append(entries,
+			Entry{Key: "counter", Value: "1"},
+			Entry{Key: "counter", Value: "+2", Kind: KindMergeOperand},
+		)
+	}
+	if layouts[version].maxKind >= KindTombstone {
+		entries = append(entries, Entry{Key: "bin", Kind: KindTombstone})
+	}
+	if layouts[version].batches {
+		entries = append(entries,
+			Entry{Key: "renamed", Value: "overwritten", Batch: true},
+			Entry{Key: "key", Kind: KindTombstone},
+		)
+	}
+	if layouts[version].expiry {
+		entries = append(entries, Entry{Key: "session", Value: "token"})
+	}
+	if layouts[version].codecs {
+		entries = append(entries, Entry{Key: "doc", Value: string([]byte{1, CaseCodec}) + "tnemucod", Encoded: true})
+	}
+	if layouts[version].seq {
+		for i := range entries {
+			entries[i].Seq = uint64(i + 1)
+		}
+	}
+	if layouts[version].timestamp {
+		ts := CaseEpoch
+		for i := range entries {
+			if i > 0 && !entries[i-1].Batch {
+				// A batch is written at once
+				ts += 1e9
+			}
+			entries[i].Timestamp = ts
+		}
+	}
+	if layouts[version].expiry {
+		for i := range entries {
+			if entries[i].Key == "session" {
+				entries[i].Expires = entries[i].Timestamp + CaseTTL
+			}
+		}
+	}
+	return entries
+}
+
+// CaseEpoch is the write time, in Unix nanoseconds, of the first entry of
+// the canonical segments that store write times.
+const CaseEpoch int64 = 1700000000e9
+
+// CaseTTL is the time to live, in nanoseconds, of the expiring entry of
+// the canonical segments that store expiry times.
+const CaseTTL int64 = 3600e9
+
+// CaseCodec is the ID of the codec that encoded the value of "doc" in the
+// canonical segments that store encoded values. It reverses the bytes of
+// "document".
+const CaseCodec = 0x80
+
+func goldenName(version uint16) string {
+	return fmt.Sprintf("golden/v%d.seg", version)
+}
+
+// Cases returns the canonical segment of every version, oldest first.
+func Cases() ([]Case, error) {
+	var cases []Case
+	for _, v := range Versions() {
+		data, err := golden.ReadFile(goldenName(v))
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, Case{
+			Name:    fmt.Sprintf("v%d", v),
+			Version: v,
+			Entries: caseEntries(v),
+			Segment: data,
+		})
+	}
+	return cases, nil
+}
+
+// MismatchError reports the first byte where an encoding differs from the
+// canonical one.
+type MismatchError struct {
+	Case   string
+	Offset int
+	Want   int // Byte expected at Offset, -1 past the end
+	Got    int // Byte found at Offset, -1 past the end
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("formatspec: case %s differs at offset %d: want %d, got %d", e.Case, e.Offset, e.Want, e.Got)
+}
+
+// Verify checks that got is byte-for-byte the canonical segment of c.
+func Verify(c Case, got []byte) error {
+	n := min(len(got), len(c.Segment))
+	for i := 0; i < n; i++ {
+		if got[i] != c.Segment[i] {
+			return &MismatchError{Case: c.Name, Offset: i, Want: int(c.Segment[i]), Got: int(got[i])}
+		}
+	}
+	if len(got) == len(c.Segment) {
+		return nil
+	}
+	e := &MismatchError{Case: c.Name, Offset: n, Want: -1, Got: -1}
+	if n < len(c.Segment) {
+		e.Want = int(c.Segment[n])
+	} else {
+		e.Got = int(got[n])
+	}
+	return e
+}
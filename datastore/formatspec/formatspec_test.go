@@ -0,0 +1,239 @@
+package formatspec_test
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/formatspec"
+)
+
+var update = flag.Bool("update", false, "rewrite golden segments")
+
+func TestGolden(t *testing.T) {
+	cases, err := formatspec.Cases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		got, err := formatspec.EncodeSegment(c.Version, c.Entries)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+		if *update {
+			path := filepath.Join("golden", fmt.Sprintf("v%d.seg", c.Version))
+			if err := os.WriteFile(path, got, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := formatspec.Verify(c, got); err != nil {
+			t.Error(err)
+		}
+
+		// Канонічний сегмент має декодуватися назад у ті самі записи
+		seg, err := formatspec.Validate(c.Segment)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name, err)
+		}
+		if seg.Version != c.Version || !reflect.DeepEqual(seg.Entries, c.Entries) {
+			t.Errorf("%s: decoded %+v", c.Name, seg)
+		}
+	}
+}
+
+// Сегменти, записані datastore, мають збігатися з еталонними байт-у-байт
+func TestDatastoreConformance(t *testing.T) {
+	cases, err := formatspec.Cases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		dir := "test_formatspec_" + c.Name
+		defer os.RemoveAll(dir)
+
+		writeVersion := c.Version
+		if writeVersion == formatspec.Legacy {
+			writeVersion = formatspec.V1
+		}
+		// Годинник видає час записів еталонного сегмента по черзі
+		var writes int64
+		clock := func() time.Time {
+			writes++
+			return time.Unix(0, formatspec.CaseEpoch+(writes-1)*1e9)
+		}
+		opts := datastore.Options{FormatVersion: writeVersion, Clock: clock}
+		if writeVersion >= formatspec.V9 {
+			opts.Codecs = &datastore.CodecOptions{Policies: []datastore.CodecPolicy{
+				{Prefix: "doc", Codecs: []datastore.Codec{reverseCodec{}}},
+			}}
+		}
+		db, err := datastore.OpenWithOptions(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(c.Entries); i++ {
+			e := c.Entries[i]
+			switch {
+			case e.Batch:
+				// Пакет у еталоні — це перейменування ключа
+				i++
+				err = db.Rename(c.Entries[i].Key, e.Key, false)
+			case e.Expires != 0:
+				err = db.Put(e.Key, e.Value, datastore.WithTTL(time.Duration(e.Expires-e.Timestamp)))
+			case e.Encoded:
+				err = db.Put(e.Key, string(reverse([]byte(e.Value[2:]))))
+			case e.Kind == formatspec.KindMergeOperand:
+				err = db.MergeValue(e.Key, e.Value)
+			case e.Kind == formatspec.KindTombstone:
+				err = db.Delete(e.Key)
+			default:
+				err = db.Put(e.Key, e.Value)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if c.Version == formatspec.Legacy {
+			if err := datastore.Migrate(dir, datastore.FormatLegacy); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := os.ReadFile(filepath.Join(dir, "segment-0.data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := formatspec.Verify(c, got); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// reverseCodec is formatspec.CaseCodec.
+type reverseCodec struct{}
+
+func (reverseCodec) ID() byte                            { return formatspec.CaseCodec }
+func (reverseCodec) Encode(value []byte) ([]byte, error) { return reverse(value), nil }
+func (reverseCodec) Decode(data []byte) ([]byte, error)  { return reverse(data), nil }
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
+
+func TestValidate_Corrupt(t *testing.T) {
+	valid, err := formatspec.EncodeSegment(formatspec.V2, []formatspec.Entry{{Key: "k", Value: "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := valid[:len(valid)-1]
+	if _, err := formatspec.Validate(truncated); !errors.Is(err, formatspec.ErrCorrupt) {
+		t.Errorf("truncated: err = %v", err)
+	}
+
+	badKind := append([]byte(nil), valid...)
+	badKind[len(badKind)-1] = 9
+	if _, err := formatspec.Validate(badKind); !errors.Is(err, formatspec.ErrCorrupt) {
+		t.Errorf("bad kind: err = %v", err)
+	}
+
+	badVersion := append([]byte(nil), valid...)
+	badVersion[4] = 99
+	if _, err := formatspec.Validate(badVersion); !errors.Is(err, formatspec.ErrUnsupportedVersion) {
+		t.Errorf("bad version: err = %v", err)
+	}
+
+	// Операнд злиття не можна закодувати у форматі без байта типу
+	_, err = formatspec.EncodeEntry(formatspec.V1, formatspec.Entry{Key: "k", Kind: formatspec.KindMergeOperand})
+	if err == nil {
+		t.Error("expected error encoding operand in V1")
+	}
+
+	// Надгробки з'явилися лише у V4
+	_, err = formatspec.EncodeEntry(formatspec.V3, formatspec.Entry{Key: "k", Kind: formatspec.KindTombstone})
+	if err == nil {
+		t.Error("expected error encoding tombstone in V3")
+	}
+
+	// Записи історії з'явилися лише у V10
+	for _, v := range []uint16{formatspec.V3, formatspec.V9} {
+		if _, err := formatspec.EncodeEntry(v, formatspec.Entry{Key: "k", Kind: formatspec.KindHistory}); err == nil {
+			t.Errorf("expected error encoding history in version %d", v)
+		}
+	}
+	history, err := formatspec.EncodeSegment(formatspec.V10, []formatspec.Entry{{Key: "k", Value: "old", Kind: formatspec.KindHistory}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := formatspec.Validate(history); err != nil {
+		t.Errorf("history in V10: err = %v", err)
+	}
+	history[4] = byte(formatspec.V9)
+	if _, err := formatspec.Validate(history); !errors.Is(err, formatspec.ErrCorrupt) {
+		t.Errorf("history in V9: err = %v", err)
+	}
+
+	// У V5 зіпсований байт значення ловить контрольна сума
+	v5, err := formatspec.EncodeSegment(formatspec.V5, []formatspec.Entry{{Key: "k", Value: "value"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v5[formatspec.HeaderSize+10] ^= 0xff
+	if _, err := formatspec.Validate(v5); !errors.Is(err, formatspec.ErrCorrupt) {
+		t.Errorf("bad checksum: err = %v", err)
+	}
+
+	// Сегмент не може обриватися посеред атомарного пакета
+	torn, err := formatspec.EncodeSegment(formatspec.V7, []formatspec.Entry{{Key: "k", Value: "v", Batch: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := formatspec.Validate(torn); !errors.Is(err, formatspec.ErrCorrupt) {
+		t.Errorf("torn batch: err = %v", err)
+	}
+
+	// Закодоване значення починається з ідентифікаторів кодеків
+	encoded, err := formatspec.EncodeSegment(formatspec.V9, []formatspec.Entry{{Key: "k", Value: "\x02\x01", Encoded: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := formatspec.Validate(encoded); !errors.Is(err, formatspec.ErrCorrupt) {
+		t.Errorf("missing codec IDs: err = %v", err)
+	}
+	_, err = formatspec.EncodeEntry(formatspec.V8, formatspec.Entry{Key: "k", Value: "\x00", Encoded: true})
+	if err == nil {
+		t.Error("expected error encoding an encoded value in V8")
+	}
+}
+
+func TestVerify_ReportsOffset(t *testing.T) {
+	cases, err := formatspec.Cases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cases[len(cases)-1]
+	got := append([]byte(nil), c.Segment...)
+	got[10] ^= 0xff
+
+	var mismatch *formatspec.MismatchError
+	if err := formatspec.Verify(c, got); !errors.As(err, &mismatch) || mismatch.Offset != 10 {
+		t.Fatalf("err = %v", err)
+	}
+	if err := formatspec.Verify(c, c.Segment[:5]); !errors.As(err, &mismatch) || mismatch.Offset != 5 || mismatch.Got != -1 {
+		t.Fatalf("short: err = %v", err)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package datastore
+
+// freeSpace is unknown on platforms other than Linux.
+func freeSpace(dir string) (int64, bool) { return 0, false }
@@ -0,0 +1,45 @@
+package datastore
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Sources of fsync calls reported to Options.OnSlowSync.
+const (
+	SyncSourceWriter    = "writer"
+	SyncSourceCompactor = "compactor"
+)
+
+// syncFile fsyncs f, recording how long it took for source and reporting
+// it to Options.OnSlowSync when it exceeds Options.SlowSyncThreshold.
+func (db *DB) syncFile(f File, source string) error {
+	start := time.Now()
+	err := f.Sync()
+	d := time.Since(start)
+
+	if source == SyncSourceCompactor {
+		db.compactorSync.observe(d)
+	} else {
+		db.writerSync.observe(d)
+	}
+	if db.opts.SlowSyncThreshold > 0 && d > db.opts.SlowSyncThreshold {
+		db.log(slog.LevelWarn, "slow fsync", "source", source, "duration", d)
+		if db.opts.OnSlowSync != nil {
+			db.opts.OnSlowSync(source, d)
+		}
+	}
+	return err
+}
+
+// syncDir fsyncs dir, making the files created, renamed and removed in it
+// durable. Filesystems that cannot open directories, such as MemFS, have
+// nothing to sync.
+func syncDir(fsys FS, dir string) error {
+	d, err := fsys.Open(dir)
+	if err != nil {
+		return nil
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,219 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDeviceBytesPerSec = 100 << 20
+	// cpuSlice is how much busy time a background task accumulates before
+	// it is paced.
+	cpuSlice = 5 * time.Millisecond
+)
+
+// errStopped is returned by background tasks interrupted by Close.
+var errStopped = errors.New("background task stopped")
+
+// GovernorOptions budgets background work such as compaction as a share of
+// host capacity, so the store stays out of the way of the application
+// embedding it.
+type GovernorOptions struct {
+	// CPUFraction is the share of host CPUs, in (0, 1], background work
+	// may keep busy. Zero means unlimited.
+	CPUFraction float64
+	// IOFraction is the share of DeviceBytesPerSec background work may read
+	// and write. Zero means unlimited.
+	IOFraction float64
+	// DeviceBytesPerSec is the storage throughput IOFraction applies to.
+	// Defaults to 100 MiB/s.
+	DeviceBytesPerSec int64
+}
+
+// governor is the scheduler shared by all background tasks of a DB. A nil
+// governor imposes no limits.
+type governor struct {
+	io       *tokenBucket
+	cpuShare float64 // Share of a single core; zero means unlimited
+}
+
+func newGovernor(opts *GovernorOptions) *governor {
+	if opts == nil {
+		return nil
+	}
+	g := &governor{}
+	if opts.IOFraction > 0 {
+		capacity := opts.DeviceBytesPerSec
+		if capacity <= 0 {
+			capacity = defaultDeviceBytesPerSec
+		}
+		g.io = newTokenBucket(opts.IOFraction * float64(capacity))
+	}
+	if opts.CPUFraction > 0 {
+		// Background tasks run on one goroutine each, so a budget of a
+		// core or more needs no pacing.
+		if share := opts.CPUFraction * float64(runtime.NumCPU()); share < 1 {
+			g.cpuShare = share
+		}
+	}
+	return g
+}
+
+// bgTask tracks the budget use of one background job.
+type bgTask struct {
+	g         *governor
+	quit      <-chan struct{}
+	busySince time.Time
+
+	limit *tokenBucket // Job-specific I/O limit, on top of the governor's
+	gate  *gate        // Holds the job while paused
+}
+
+// start begins a background task that stops pacing with errStopped once
+// quit is closed.
+func (g *governor) start(quit <-chan struct{}) *bgTask {
+	return &bgTask{g: g, quit: quit, busySince: time.Now()}
+}
+
+// step accounts for n bytes of I/O and the CPU time used since the last
+// pause, sleeping as needed to stay within budget.
+func (t *bgTask) step(n int) error {
+	if t.gate != nil {
+		if err := t.gate.wait(t.quit); err != nil {
+			return err
+		}
+	}
+	if t.limit != nil {
+		if err := sleep(t.limit.reserve(n), t.quit); err != nil {
+			return err
+		}
+	}
+	if t.g == nil {
+		return nil
+	}
+	if t.g.io != nil {
+		if err := sleep(t.g.io.reserve(n), t.quit); err != nil {
+			return err
+		}
+	}
+	if t.g.cpuShare > 0 {
+		busy := time.Since(t.busySince)
+		if busy < cpuSlice {
+			return nil
+		}
+		idle := time.Duration(float64(busy) * (1 - t.g.cpuShare) / t.g.cpuShare)
+		if err := sleep(idle, t.quit); err != nil {
+			return err
+		}
+		t.busySince = time.Now()
+	}
+	return nil
+}
+
+// quitOrDone returns a channel closed once quit is closed or ctx is done,
+// for tasks the caller can cancel, and a func to call when the task ends.
+func quitOrDone(quit <-chan struct{}, ctx context.Context) (<-chan struct{}, func()) {
+	if ctx.Done() == nil {
+		return quit, func() {}
+	}
+	ch, end := make(chan struct{}), make(chan struct{})
+	go func() {
+		select {
+		case <-quit:
+		case <-ctx.Done():
+		case <-end:
+		}
+		close(ch)
+	}()
+	return ch, func() { close(end) }
+}
+
+func sleep(d time.Duration, quit <-chan struct{}) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-quit:
+		return errStopped
+	}
+}
+
+// gate lets background jobs through unless it is closed.
+type gate struct {
+	mu     sync.Mutex
+	closed chan struct{} // Non-nil while closed; closing it reopens the gate
+}
+
+func (g *gate) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed == nil {
+		g.closed = make(chan struct{})
+	}
+}
+
+func (g *gate) open() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed != nil {
+		close(g.closed)
+		g.closed = nil
+	}
+}
+
+func (g *gate) isClosed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.closed != nil
+}
+
+// wait blocks while the gate is closed, returning errStopped once quit is
+// closed.
+func (g *gate) wait(quit <-chan struct{}) error {
+	g.mu.Lock()
+	ch := g.closed
+	g.mu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-quit:
+		return errStopped
+	}
+}
+
+// tokenBucket refills at rate tokens per second up to one second's worth.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// reserve takes n tokens, going into debt if needed, and returns how long
+// the caller has to wait for the debt to be repaid.
+func (b *tokenBucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
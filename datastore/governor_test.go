@@ -0,0 +1,264 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(1000)
+	if d := b.reserve(1000); d != 0 {
+		t.Errorf("expected full bucket to grant 1000 tokens immediately, got wait %v", d)
+	}
+	d := b.reserve(500)
+	if d < 400*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("expected ~500ms wait for 500 tokens at 1000/s, got %v", d)
+	}
+}
+
+func TestGovernor_ThrottlesMerge(t *testing.T) {
+	dir := "test_governor_merge"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "500")
+
+	db, err := OpenWithOptions(dir, Options{
+		Governor: &GovernorOptions{IOFraction: 1, DeviceBytesPerSec: 4000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 40; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// ~4.4KB читання та стільки ж запису при 4KB/s мають зайняти понад секунду
+	start := time.Now()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected throttled merge to take at least 1s, took %v", elapsed)
+	}
+
+	for i := 0; i < 40; i++ {
+		v, err := db.Get(fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != strings.Repeat("v", 100) {
+			t.Errorf("unexpected value for key%d", i)
+		}
+	}
+}
+
+func TestMerge_ConcurrentWrites(t *testing.T) {
+	dir := "test_merge_concurrent_writes"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "old"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Записи під час злиття не повинні загубитися
+	done := make(chan error)
+	go func() { done <- db.Merge() }()
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "new"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		v, err := db.Get(fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "new" {
+			t.Errorf("key%d: expected new, got %s", i, v)
+		}
+	}
+
+	// Після перевідкриття порядок сегментів має зберегтися
+	db.Close()
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for i := 0; i < 20; i++ {
+		v, err := reopened.Get(fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != "new" {
+			t.Errorf("key%d after reopen: expected new, got %s", i, v)
+		}
+	}
+}
+
+func TestCompactionBytesPerSec(t *testing.T) {
+	dir := "test_compaction_rate"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "500")
+
+	db, err := OpenWithOptions(dir, Options{CompactionBytesPerSec: 4000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 40; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Без Governor обмеження злиття все одно діє
+	start := time.Now()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected throttled merge to take at least 1s, took %v", elapsed)
+	}
+}
+
+func TestPauseCompaction(t *testing.T) {
+	dir := "test_compaction_pause"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%5), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := len(db.Segments())
+
+	// Злиття чекає, поки компакцію не відновлять
+	db.PauseCompaction()
+	done := make(chan error)
+	go func() { done <- db.Merge() }()
+	select {
+	case err := <-done:
+		t.Fatalf("expected paused merge to wait, got %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Читання та запис працюють під час паузи
+	if err := db.Put("key0", "new"); err != nil {
+		t.Fatal(err)
+	}
+	db.ResumeCompaction()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if after := len(db.Segments()); after >= before {
+		t.Errorf("expected merge to reduce %d segments, got %d", before, after)
+	}
+	if v, err := db.Get("key0"); err != nil || v != "new" {
+		t.Errorf("expected new, got %q, %v", v, err)
+	}
+}
+
+func TestPauseCompaction_Close(t *testing.T) {
+	dir := "test_compaction_pause_close"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Close перериває призупинене злиття
+	db.PauseCompaction()
+	done := make(chan error)
+	go func() { done <- db.Merge() }()
+	time.Sleep(50 * time.Millisecond)
+	db.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected interrupted merge to fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("merge still paused after Close")
+	}
+}
+
+func TestMergeContext(t *testing.T) {
+	dir := "test_merge_context"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := len(db.Segments())
+
+	// Скасування контексту перериває призупинене злиття
+	db.PauseCompaction()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := db.MergeContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if after := len(db.Segments()); after != before {
+		t.Errorf("expected %d segments after cancelled merge, got %d", before, after)
+	}
+
+	db.ResumeCompaction()
+	if err := db.MergeContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := db.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatalf("key%d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package datastore
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ErrNotHash is returned by hash operations on a key holding another value.
+var ErrNotHash = errors.New("value is not a hash")
+
+// Hashes are stored like lists: HSet and HDel write merge operands with
+// the fields they change, and reads and merges fold them. A folded hash is
+// hashMagic followed by its fields and values, alternating and sorted by
+// field, encoded like list elements; an operand is hashOpMagic, an op byte
+// and the fields and values, or field names, it applies to.
+const (
+	hashMagic   = "\x00hash\x01"
+	hashOpMagic = "\x00hash\x02"
+
+	hashOpSet = 's'
+	hashOpDel = 'd'
+)
+
+// HSet sets field of the hash at key to value, creating the hash if
+// needed. Like RPush it writes a single merge operand and does not read
+// the hash, so changing a field costs the same however many the hash has.
+func (db *DB) HSet(key, field, value string) error {
+	op := appendListElems(append([]byte(hashOpMagic), hashOpSet), []string{field, value})
+	return db.write(key, string(op), kindMergeOperand)
+}
+
+// HDel removes fields from the hash at key. Missing fields are ignored; a
+// hash left without fields reads as empty.
+func (db *DB) HDel(key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	op := appendListElems(append([]byte(hashOpMagic), hashOpDel), fields)
+	return db.write(key, string(op), kindMergeOperand)
+}
+
+// HGet returns field of the hash at key, ErrNotFound if the hash or the
+// field is missing.
+func (db *DB) HGet(key, field string) (string, error) {
+	fields, err := db.HGetAll(key)
+	if err != nil {
+		return "", err
+	}
+	v, ok := fields[field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// HGetAll returns the fields of the hash at key. A missing key reads as an
+// empty hash.
+func (db *DB) HGetAll(key string) (map[string]string, error) {
+	v, err := db.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeHash(v)
+}
+
+func foldHash(existing string, exists bool, operands []string) (string, error) {
+	fields := map[string]string{}
+	if exists {
+		var err error
+		if fields, err = decodeHash(existing); err != nil {
+			return "", err
+		}
+	}
+	for _, op := range operands {
+		body, ok := strings.CutPrefix(op, hashOpMagic)
+		if !ok || body == "" {
+			return "", ErrNotHash
+		}
+		elems, err := decodeListElems(body[1:])
+		if err != nil {
+			return "", ErrNotHash
+		}
+		switch body[0] {
+		case hashOpSet:
+			if len(elems)%2 != 0 {
+				return "", ErrNotHash
+			}
+			for i := 0; i < len(elems); i += 2 {
+				fields[elems[i]] = elems[i+1]
+			}
+		case hashOpDel:
+			for _, f := range elems {
+				delete(fields, f)
+			}
+		default:
+			return "", ErrNotHash
+		}
+	}
+	return encodeHash(fields), nil
+}
+
+func encodeHash(fields map[string]string) string {
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		names = append(names, f)
+	}
+	slices.Sort(names)
+	elems := make([]string, 0, 2*len(names))
+	for _, f := range names {
+		elems = append(elems, f, fields[f])
+	}
+	return string(appendListElems([]byte(hashMagic), elems))
+}
+
+func decodeHash(v string) (map[string]string, error) {
+	body, ok := strings.CutPrefix(v, hashMagic)
+	if !ok {
+		return nil, ErrNotHash
+	}
+	elems, err := decodeListElems(body)
+	if err != nil || len(elems)%2 != 0 {
+		return nil, ErrNotHash
+	}
+	fields := make(map[string]string, len(elems)/2)
+	for i := 0; i < len(elems); i += 2 {
+		fields[elems[i]] = elems[i+1]
+	}
+	return fields, nil
+}
@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	dir := "test_hash"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{}
+	for i := 0; i < 10; i++ {
+		field, value := fmt.Sprintf("field%d", i%4), fmt.Sprintf("v%d", i)
+		if err := db.HSet("user:1", field, value); err != nil {
+			t.Fatal(err)
+		}
+		want[field] = value
+	}
+	if err := db.HDel("user:1", "field0", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	delete(want, "field0")
+	if v, err := db.HGet("user:1", "field1"); err != nil || v != want["field1"] {
+		t.Fatalf("HGet = %q, %v", v, err)
+	}
+	if _, err := db.HGet("user:1", "field0"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("HGet(deleted) err = %v", err)
+	}
+
+	// Поля переживають злиття й повторне відкриття
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got, err := db.HGetAll("user:1"); err != nil || !maps.Equal(got, want) {
+		t.Fatalf("HGetAll = %v, %v; want %v", got, err, want)
+	}
+	if got, err := db.HGetAll("missing"); err != nil || len(got) != 0 {
+		t.Errorf("HGetAll(missing) = %v, %v", got, err)
+	}
+
+	// Хеш і список не змішуються
+	if err := db.RPush("user:1", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.HGetAll("user:1"); !errors.Is(err, ErrNotHash) && !errors.Is(err, ErrNotList) {
+		t.Errorf("expected a type error, got %v", err)
+	}
+}
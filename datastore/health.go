@@ -0,0 +1,108 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+)
+
+// Names of the checks of a HealthReport.
+const (
+	HealthActiveWritable = "active_writable"
+	HealthDiskHeadroom   = "disk_headroom"
+	HealthWriteQueue     = "write_queue"
+	HealthCompaction     = "compaction"
+)
+
+// HealthCheck is the outcome of one self-check.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// HealthReport is the outcome of Health. Healthy is set when every check
+// passed.
+type HealthReport struct {
+	Time    time.Time     `json:"time"`
+	Healthy bool          `json:"healthy"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+// Health runs cheap self-checks meant for load-balancer health probes:
+//   - the active segments accept writes;
+//   - the disk, and the quota if MaxTotalBytes is set, leave room for every
+//     active segment and one merge output to fill up;
+//   - the write queues are not full;
+//   - the latest merge, if any, succeeded.
+//
+// Free disk space is only known on Linux with OSFS; elsewhere that part of
+// the check passes.
+func (db *DB) Health() HealthReport {
+	r := HealthReport{Time: time.Now(), Healthy: true}
+	for _, c := range []HealthCheck{
+		db.checkWritable(),
+		db.checkHeadroom(),
+		db.checkWriteQueue(),
+		db.checkCompaction(),
+	} {
+		r.Healthy = r.Healthy && c.OK
+		r.Checks = append(r.Checks, c)
+	}
+	return r
+}
+
+func (db *DB) checkWritable() HealthCheck {
+	c := HealthCheck{Name: HealthActiveWritable, OK: true}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, st := range db.stripes {
+		// An empty write fails on a closed or read-only file.
+		if _, err := st.active.file.Write(nil); err != nil {
+			c.OK, c.Detail = false, fmt.Sprintf("%s: %v", st.active.path, err)
+			break
+		}
+	}
+	return c
+}
+
+func (db *DB) checkHeadroom() HealthCheck {
+	c := HealthCheck{Name: HealthDiskHeadroom, OK: true}
+	db.mu.RLock()
+	need := db.maxSegmentSize() * int64(len(db.stripes)+1)
+	used := db.totalSize()
+	db.mu.RUnlock()
+	if limit := db.opts.MaxTotalBytes; limit > 0 && limit-used < need {
+		c.OK, c.Detail = false, fmt.Sprintf("%d of %d quota bytes left, need %d", max(limit-used, 0), limit, need)
+		return c
+	}
+	if _, ok := db.fs.(OSFS); !ok {
+		return c
+	}
+	if free, ok := freeSpace(db.dir); ok {
+		c.Detail = fmt.Sprintf("%d bytes free, need %d", free, need)
+		c.OK = free >= need
+	}
+	return c
+}
+
+func (db *DB) checkWriteQueue() HealthCheck {
+	c := HealthCheck{Name: HealthWriteQueue, OK: true}
+	size := 0
+	for _, st := range db.stripes {
+		size += st.queue.size
+	}
+	depth := db.queueDepth()
+	c.OK = depth < size
+	c.Detail = fmt.Sprintf("%d of %d queued", depth, size)
+	return c
+}
+
+func (db *DB) checkCompaction() HealthCheck {
+	c := HealthCheck{Name: HealthCompaction, OK: true}
+	if records := db.compactions.list(); len(records) > 0 {
+		if last := records[0]; last.Err != "" {
+			c.OK, c.Detail = false, last.Err
+		}
+	}
+	return c
+}
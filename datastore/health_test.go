@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	dir := "test_health"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{WriteQueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	failed := func() []string {
+		var names []string
+		for _, c := range db.Health().Checks {
+			if !c.OK {
+				names = append(names, c.Name)
+			}
+		}
+		return names
+	}
+	if names := failed(); len(names) != 0 {
+		t.Fatalf("unexpected failed checks %v", names)
+	}
+
+	// Повна черга записів; writer тримає db.mu, тож лише ця перевірка
+	release := stallWriter(t, db)
+	c := db.checkWriteQueue()
+	release()
+	if c.OK {
+		t.Errorf("expected %s to fail: %+v", HealthWriteQueue, c)
+	}
+
+	// Останнє злиття завершилося помилкою
+	db.compactions.add(CompactionRecord{Err: "disk full"})
+	if names := failed(); len(names) != 1 || names[0] != HealthCompaction {
+		t.Errorf("expected %s to fail, got %v", HealthCompaction, names)
+	}
+	db.compactions.add(CompactionRecord{})
+
+	// Активний сегмент не приймає записів
+	db.mu.Lock()
+	st := db.stripes[0]
+	file := st.active.file
+	st.active.file, err = db.fs.Open(st.active.path)
+	db.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := db.Health()
+	db.mu.Lock()
+	st.active.file.Close()
+	st.active.file = file
+	db.mu.Unlock()
+	if report.Healthy || report.Checks[0].Name != HealthActiveWritable || report.Checks[0].OK {
+		t.Errorf("expected %s to fail, got %+v", HealthActiveWritable, report)
+	}
+}
+
+func TestHealth_Quota(t *testing.T) {
+	dir := "test_health_quota"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "1000")
+
+	db, err := OpenWithOptions(dir, Options{MaxTotalBytes: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Квота не вміщує активний сегмент і результат злиття
+	for _, c := range db.Health().Checks {
+		if c.Name == HealthDiskHeadroom && c.OK {
+			t.Errorf("expected %s to fail: %+v", HealthDiskHeadroom, c)
+		}
+	}
+}
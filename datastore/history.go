@@ -0,0 +1,248 @@
+package datastore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+)
+
+// CurrentSeq returns the sequence number of the latest write. Every write
+// gets the next number; they survive restarts only in FormatV3 and newer.
+func (db *DB) CurrentSeq() uint64 {
+	return db.seq.Load()
+}
+
+// GetAt returns the value key had right after the write with sequence
+// number seq: its newest version whose sequence number is not above seq.
+// Only versions still on disk can be found, and entries written in formats
+// without sequence numbers count as older than any stamped one. Unless the
+// current version qualifies, GetAt scans every segment, so it is meant for
+// auditing rather than hot paths.
+func (db *DB) GetAt(key string, seq uint64) (string, error) {
+	db.mu.RLock()
+	if pos, ok := db.index.get(key); ok && db.operands[key] == nil {
+		e, err := db.readAt(pos)
+		if err == nil && e.key == key && e.seq <= seq {
+			err = db.decodeEntryValue(&e)
+			v := e.value
+			if err == nil {
+				v, err = db.derefLocked(v)
+			}
+			db.mu.RUnlock()
+			return v, err
+		}
+	}
+	fn := db.mergeFn
+	db.mu.RUnlock()
+
+	versions, err := db.keyVersions(key)
+	if err != nil {
+		return "", err
+	}
+	var ops []string
+	for _, e := range versions {
+		if e.seq > seq {
+			continue
+		}
+		if e.kind == kindTombstone {
+			break
+		}
+		if e.kind != kindMergeOperand {
+			return foldAt(key, fn, e.value, true, ops)
+		}
+		ops = append(ops, e.value)
+	}
+	if len(ops) == 0 {
+		return "", ErrNotFound
+	}
+	return foldAt(key, fn, "", false, ops)
+}
+
+// Version is one value a key has had.
+type Version struct {
+	Seq   uint64 // Zero for entries written without sequence numbers
+	Value string
+	// Deleted marks a Delete of the key; Value is empty.
+	Deleted bool
+}
+
+// GetHistory returns the values of key still on disk, newest first, one
+// per write: merge operands contribute the value they produced. How far
+// back it reaches depends on Options.KeepVersions for compacted segments;
+// segments not compacted yet hold every write. Like GetAt it scans every
+// segment.
+func (db *DB) GetHistory(key string) ([]Version, error) {
+	db.mu.RLock()
+	fn := db.mergeFn
+	db.mu.RUnlock()
+
+	versions, err := db.keyVersions(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	// Replay oldest first so every operand folds onto the value before it.
+	res := make([]Version, len(versions))
+	var cur string
+	exists := false
+	for i := len(versions) - 1; i >= 0; i-- {
+		e := versions[i]
+		switch e.kind {
+		case kindTombstone:
+			cur, exists = "", false
+			res[len(versions)-1-i] = Version{Seq: e.seq, Deleted: true}
+			continue
+		case kindMergeOperand:
+			if cur, err = foldAt(key, fn, cur, exists, []string{e.value}); err != nil {
+				return nil, err
+			}
+		default:
+			cur = e.value
+		}
+		exists = true
+		res[len(versions)-1-i] = Version{Seq: e.seq, Value: cur}
+	}
+	slices.Reverse(res)
+	return res, nil
+}
+
+// foldAt applies fn to operands given newest first.
+func foldAt(key string, fn MergeFunc, base string, exists bool, ops []string) (string, error) {
+	if len(ops) == 0 {
+		return base, nil
+	}
+	if fn == nil {
+		return "", ErrNoMergeOperator
+	}
+	oldestFirst := make([]string, len(ops))
+	for i, op := range ops {
+		oldestFirst[len(ops)-1-i] = op
+	}
+	return fn(key, base, exists, oldestFirst)
+}
+
+// keyVersions returns every entry of key still on disk, newest first.
+// Merged segments are not in write order, so entries are ordered by
+// sequence number and unstamped ones by segment and offset.
+func (db *DB) keyVersions(key string) ([]entry, error) {
+	var found []entry
+	err := db.eachEntry(func(e *entry) {
+		if e.key == key {
+			found = append(found, *e)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Newest segment and offset first, then by sequence number.
+	slices.Reverse(found)
+	sort.SliceStable(found, func(i, j int) bool { return found[i].seq > found[j].seq })
+	return found, nil
+}
+
+// eachEntry calls fn for every entry on disk, oldest segment first. Writes
+// made after it starts are not visited.
+func (db *DB) eachEntry(fn func(e *entry)) error {
+	db.mu.RLock()
+	segs := append(append([]*segment(nil), db.segments...), db.actives()...)
+	sizes := make([]int64, len(segs))
+	for i, s := range segs {
+		sizes[i] = s.size
+		s.ref()
+		s.mu.RLock()
+	}
+	db.mu.RUnlock()
+	defer func() {
+		for _, s := range segs {
+			s.mu.RUnlock()
+			db.unref(s)
+		}
+	}()
+
+	for i, s := range segs {
+		r := bufio.NewReader(io.NewSectionReader(s.reader(), s.dataStart, sizes[i]-s.dataStart))
+		for {
+			var e entry
+			_, err := decodeEntry(&e, r, s.version)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err == nil {
+				err = db.decodeEntryValue(&e)
+			}
+			if err != nil {
+				return err
+			}
+			fn(&e)
+		}
+	}
+	return nil
+}
+
+// ChangeOp is the kind of write a Change records.
+type ChangeOp uint8
+
+const (
+	ChangePut ChangeOp = iota
+	ChangeDelete
+	// ChangeMerge is a MergeValue; Value holds the operand.
+	ChangeMerge
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangePut:
+		return "put"
+	case ChangeDelete:
+		return "delete"
+	case ChangeMerge:
+		return "merge"
+	}
+	return "unknown"
+}
+
+// Change is a committed write.
+type Change struct {
+	Seq   uint64
+	Op    ChangeOp
+	Key   string
+	Value string // Empty for deletes
+}
+
+// Changes returns up to limit writes with sequence numbers above after,
+// in sequence order, for tailing the DB from a saved position. A limit of
+// zero or less means no limit.
+//
+// Changes reads what is still on disk: writes that a merge compacted away
+// are skipped, but the newest write of every key survives, so a consumer
+// that applies the changes in order still ends up with the current
+// contents. Entries written in formats without sequence numbers are never
+// returned. Like GetHistory it scans every segment.
+func (db *DB) Changes(after uint64, limit int) ([]Change, error) {
+	var changes []Change
+	err := db.eachEntry(func(e *entry) {
+		if e.seq <= after {
+			return
+		}
+		c := Change{Seq: e.seq, Key: e.key, Value: e.value}
+		switch e.kind {
+		case kindTombstone:
+			c.Op = ChangeDelete
+		case kindMergeOperand:
+			c.Op = ChangeMerge
+		}
+		changes = append(changes, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Seq < changes[j].Seq })
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
@@ -0,0 +1,274 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestGetAt(t *testing.T) {
+	dir := "test_get_at"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "100")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs := make([]uint64, 5)
+	for i := range seqs {
+		if err := db.Put("k", "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put("other", "x"); err != nil {
+			t.Fatal(err)
+		}
+		seqs[i] = db.CurrentSeq()
+	}
+	if seqs[4] != 10 {
+		t.Fatalf("CurrentSeq = %d, want 10", seqs[4])
+	}
+
+	check := func(db *DB) {
+		t.Helper()
+		for i, seq := range seqs {
+			if v, err := db.GetAt("k", seq); err != nil || v != "v"+strconv.Itoa(i) {
+				t.Errorf("GetAt(%d) = %q, %v", seq, v, err)
+			}
+		}
+		if _, err := db.GetAt("k", 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetAt before first write: %v", err)
+		}
+	}
+	check(db)
+	db.Close()
+
+	// Номери послідовності переживають перевідкриття
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	check(reopened)
+	if reopened.CurrentSeq() != 10 {
+		t.Fatalf("CurrentSeq after reopen = %d", reopened.CurrentSeq())
+	}
+	if err := reopened.Put("k", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if reopened.CurrentSeq() != 11 {
+		t.Fatalf("CurrentSeq after put = %d", reopened.CurrentSeq())
+	}
+
+	// Злиття відкидає історію, але поточне значення лишається доступним
+	if err := reopened.merge(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := reopened.GetAt("k", reopened.CurrentSeq()); err != nil || v != "new" {
+		t.Fatalf("GetAt(current) = %q, %v", v, err)
+	}
+}
+
+func TestGetAt_MergeOperands(t *testing.T) {
+	dir := "test_get_at_operands"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.RegisterMerge(sumMerge)
+
+	if err := db.Put("n", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MergeValue("n", "2"); err != nil {
+		t.Fatal(err)
+	}
+	atTwo := db.CurrentSeq()
+	if err := db.MergeValue("n", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.GetAt("n", atTwo); err != nil || v != "3" {
+		t.Fatalf("GetAt = %q, %v; want 3", v, err)
+	}
+	if v, err := db.GetAt("n", db.CurrentSeq()); err != nil || v != "6" {
+		t.Fatalf("GetAt(current) = %q, %v; want 6", v, err)
+	}
+}
+
+func TestKeepVersions(t *testing.T) {
+	dir := "test_keep_versions"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "80")
+
+	opts := Options{KeepVersions: 3}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if err := db.Put("k", "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put("pad", "xxxxxxxxxx"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Два злиття поспіль не повинні дублювати чи губити історію
+	for i := 0; i < 2; i++ {
+		if err := db.merge(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	reopened, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if v, err := reopened.Get("k"); err != nil || v != "v5" {
+		t.Fatalf("Get = %q, %v; want v5", v, err)
+	}
+
+	hist, err := reopened.GetHistory("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for i, h := range hist {
+		values = append(values, h.Value)
+		if i > 0 && h.Seq >= hist[i-1].Seq {
+			t.Errorf("history not newest first: %+v", hist)
+		}
+	}
+	// Частина записів може ще лежати в активному сегменті, тож перевіряємо
+	// лише три найновіші версії
+	if len(values) < 3 || values[0] != "v5" || values[1] != "v4" || values[2] != "v3" {
+		t.Fatalf("history = %v", values)
+	}
+	if v, err := reopened.GetAt("k", hist[1].Seq); err != nil || v != "v4" {
+		t.Fatalf("GetAt = %q, %v", v, err)
+	}
+}
+
+func TestKeepVersions_NeedsFormat(t *testing.T) {
+	dir := "test_keep_versions_v1"
+	defer os.RemoveAll(dir)
+
+	// Записи історії потребують FormatV10
+	for _, v := range []uint16{FormatV1, FormatV9} {
+		if _, err := OpenWithOptions(dir, Options{KeepVersions: 2, FormatVersion: v}); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Fatalf("format %d: expected ErrUnsupportedFormat, got %v", v, err)
+		}
+	}
+}
+
+func TestGetHistory_Operands(t *testing.T) {
+	dir := "test_history_operands"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.RegisterMerge(sumMerge)
+
+	db.Put("n", "1")
+	db.MergeValue("n", "2")
+	db.MergeValue("n", "3")
+	hist, err := db.GetHistory("n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 3 || hist[0].Value != "6" || hist[1].Value != "3" || hist[2].Value != "1" {
+		t.Fatalf("history = %+v", hist)
+	}
+	if _, err := db.GetHistory("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	dir := "test_changes"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "100")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.RegisterMerge(func(key, base string, exists bool, ops []string) (string, error) {
+		for _, op := range ops {
+			base += op
+		}
+		return base, nil
+	})
+	for i := 0; i < 5; i++ {
+		if err := db.Put("k"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MergeValue("k2", "+"); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := db.Changes(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 7 {
+		t.Fatalf("expected 7 changes, got %+v", all)
+	}
+	for i, c := range all {
+		if c.Seq != uint64(i+1) {
+			t.Fatalf("changes out of order: %+v", all)
+		}
+	}
+	if all[5].Op != ChangeDelete || all[5].Key != "k1" || all[6].Op != ChangeMerge || all[6].Value != "+" {
+		t.Errorf("unexpected tail %+v", all[5:])
+	}
+
+	// Продовження з позиції з обмеженням
+	page, err := db.Changes(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Seq != 4 || page[1].Seq != 5 {
+		t.Errorf("unexpected page %+v", page)
+	}
+
+	// Після злиття лишаються останні записи кожного ключа
+	if err := db.Put("k0", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := db.Changes(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := make(map[string]string)
+	for _, c := range after {
+		switch c.Op {
+		case ChangePut:
+			state[c.Key] = c.Value
+		case ChangeDelete:
+			delete(state, c.Key)
+		case ChangeMerge:
+			state[c.Key] += c.Value
+		}
+	}
+	if len(state) != 4 || state["k0"] != "v2" || state["k2"] != "v+" {
+		t.Errorf("replayed state %v", state)
+	}
+}
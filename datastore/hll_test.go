@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestHLL(t *testing.T) {
+	dir := "test_hll"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "4096")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	near := func(got, want uint64) bool {
+		return float64(got) > 0.97*float64(want) && float64(got) < 1.03*float64(want)
+	}
+	for i := 0; i < 10000; i += 100 {
+		batch := make([]string, 0, 100)
+		for j := i; j < i+100; j++ {
+			batch = append(batch, fmt.Sprintf("user%d", j))
+		}
+		if err := db.PFAdd("visitors:mon", batch...); err != nil {
+			t.Fatal(err)
+		}
+		// Повторні відвідувачі не рахуються
+		if err := db.PFAdd("visitors:mon", batch[:10]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := db.PFCount("visitors:mon"); err != nil || !near(n, 10000) {
+		t.Fatalf("PFCount = %d, %v", n, err)
+	}
+
+	// Злиття об'єднує скетчі
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 5000; i < 15000; i++ {
+		if err := db.PFAdd("visitors:tue", fmt.Sprintf("user%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := db.PFCount("visitors:mon", "visitors:tue", "missing"); err != nil || !near(n, 15000) {
+		t.Fatalf("PFCount(union) = %d, %v", n, err)
+	}
+	if n, err := db.PFCount("missing"); err != nil || n != 0 {
+		t.Errorf("PFCount(missing) = %d, %v", n, err)
+	}
+
+	if err := db.Put("plain", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PFCount("plain"); !errors.Is(err, ErrNotHLL) {
+		t.Errorf("expected ErrNotHLL, got %v", err)
+	}
+}
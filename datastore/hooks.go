@@ -0,0 +1,125 @@
+package datastore
+
+import (
+	"sync"
+)
+
+// Hooks are callbacks run after writes are committed and merges finish,
+// for maintaining derived data, audit logs or replication without polling.
+// Every field is optional.
+//
+// By default hooks run synchronously: write hooks on the writer goroutine
+// before the write returns, OnMergeComplete on the merging goroutine. Such
+// hooks may read from the DB but must not write to it or start a merge.
+// With Async set they run in commit order on a dispatch goroutine instead,
+// which Close drains before returning.
+type Hooks struct {
+	// OnPut is called for every committed value: Put, IncrInt64 and the
+	// other full-value writes. Merge operands are not reported.
+	OnPut func(key, value string)
+	// OnDelete is called when Delete removes a key.
+	OnDelete func(key string)
+	// OnMergeComplete is called after every merge; rec.Err is set if it
+	// failed.
+	OnMergeComplete func(rec CompactionRecord)
+	// OnCorruption is called for every corrupt entry the scrubber finds,
+	// on the scrubbing goroutine unless Async is set.
+	OnCorruption func(c Corruption)
+
+	Async bool
+}
+
+// hookQueue runs hooks on a dispatch goroutine in the order they were
+// queued.
+type hookQueue struct {
+	mu     sync.Mutex
+	queue  []func()
+	closed bool
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+func newHookQueue() *hookQueue {
+	q := &hookQueue{wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+func (q *hookQueue) push(fn func()) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.queue = append(q.queue, fn)
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *hookQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *hookQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		fns, closed := q.queue, q.closed
+		q.queue = nil
+		q.mu.Unlock()
+		for _, fn := range fns {
+			fn()
+		}
+		if len(fns) > 0 {
+			continue
+		}
+		if closed {
+			return
+		}
+		<-q.wake
+	}
+}
+
+// close runs the hooks already queued, drops later ones and waits for the
+// dispatch goroutine to exit.
+func (q *hookQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+	<-q.done
+}
+
+// runHook runs fn as configured by Hooks.Async.
+func (db *DB) runHook(fn func()) {
+	if db.hookQueue != nil {
+		db.hookQueue.push(fn)
+	} else {
+		fn()
+	}
+}
+
+// committed notifies the watchers of e and runs the write hooks.
+func (db *DB) committed(e entry) {
+	db.notifyWatchers(e)
+	h := db.opts.Hooks
+	if h == nil {
+		return
+	}
+	switch {
+	case e.kind == kindValue && h.OnPut != nil:
+		db.runHook(func() { h.OnPut(e.key, e.value) })
+	case e.kind == kindTombstone && h.OnDelete != nil:
+		db.runHook(func() { h.OnDelete(e.key) })
+	}
+}
+
+// mergeComplete runs the OnMergeComplete hook.
+func (db *DB) mergeComplete(rec CompactionRecord) {
+	if h := db.opts.Hooks; h != nil && h.OnMergeComplete != nil {
+		db.runHook(func() { h.OnMergeComplete(rec) })
+	}
+}
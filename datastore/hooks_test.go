@@ -0,0 +1,109 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hookLog збирає виклики хуків
+type hookLog struct {
+	mu     sync.Mutex
+	calls  []string
+	merges []CompactionRecord
+}
+
+func (l *hookLog) add(call string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, call)
+}
+
+func (l *hookLog) hooks(async bool) *Hooks {
+	return &Hooks{
+		OnPut:    func(key, value string) { l.add("put " + key + "=" + value) },
+		OnDelete: func(key string) { l.add("delete " + key) },
+		OnMergeComplete: func(rec CompactionRecord) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.merges = append(l.merges, rec)
+		},
+		Async: async,
+	}
+}
+
+func TestHooks(t *testing.T) {
+	dir := "test_hooks"
+	defer os.RemoveAll(dir)
+
+	log := &hookLog{}
+	db, err := OpenWithOptions(dir, Options{Hooks: log.hooks(false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	// Синхронний хук уже виконано, коли Put повертається
+	if len(log.calls) != 1 {
+		t.Fatalf("expected hook to run before Put returns, got %v", log.calls)
+	}
+	if _, err := db.IncrInt64("n", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("missing"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MergeValue("m", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"put a=1", "put n=5", "delete a"}
+	if fmt.Sprint(log.calls) != fmt.Sprint(want) {
+		t.Errorf("expected %q, got %q", want, log.calls)
+	}
+}
+
+func TestHooks_AsyncAndMerge(t *testing.T) {
+	dir := "test_hooks_async"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	log := &hookLog{}
+	db, err := OpenWithOptions(dir, Options{Hooks: log.hooks(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%5), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	// Close чекає на всі хуки з черги
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.calls) != 20 {
+		t.Errorf("expected 20 put hooks, got %d", len(log.calls))
+	}
+	for i, call := range log.calls {
+		if want := fmt.Sprintf("put key%d=", i%5); !strings.HasPrefix(call, want) {
+			t.Errorf("expected hooks in commit order, call %d is %q", i, call)
+		}
+	}
+	if len(log.merges) != 1 || log.merges[0].Err != "" || log.merges[0].BytesAfter >= log.merges[0].BytesBefore {
+		t.Errorf("unexpected merge records %+v", log.merges)
+	}
+}
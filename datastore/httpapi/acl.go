@@ -0,0 +1,298 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// ACLPrefix is the reserved key prefix the ACL is stored under. Like every
+// reserved key, see datastore.Reserved, keys with it cannot be read,
+// written, scanned or watched through Handler, whatever the grants say;
+// SetACLRules writes them.
+const ACLPrefix = datastore.ACLPrefix
+
+// aclKey holds the JSON ACLRules.
+const aclKey = ACLPrefix + "rules"
+
+// ACLRules maps bearer tokens to roles and roles to access per key prefix.
+type ACLRules struct {
+	// Tokens maps every token to the roles it holds.
+	Tokens map[string][]string `json:"tokens"`
+	Grants []Grant             `json:"grants"`
+}
+
+// Grant gives a role access to the keys starting with Prefix. For each
+// key the grants with the longest matching prefix apply, so a grant on
+// "users/admin/" can narrow one on "users/"; among those the highest
+// access wins.
+type Grant struct {
+	Role   string `json:"role"`
+	Prefix string `json:"prefix"`
+	Access Access `json:"access"`
+}
+
+func (a Access) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Access) UnmarshalText(text []byte) error {
+	access, err := ParseAccess(string(text))
+	*a = access
+	return err
+}
+
+// LoadACLRules reads ACLRules from a JSON file.
+func LoadACLRules(path string) (ACLRules, error) {
+	var rules ACLRules
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return rules, fmt.Errorf("httpapi: %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// SetACLRules stores rules in db, where every ACL watching db picks them
+// up.
+func SetACLRules(db *datastore.DB, rules ACLRules) error {
+	for _, g := range rules.Grants {
+		if g.Access > AccessWrite {
+			return fmt.Errorf("httpapi: unknown access %d for role %q", g.Access, g.Role)
+		}
+	}
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return db.PutReserved(aclKey, string(b))
+}
+
+// ACL enforces the rules stored in a DB, reloading them whenever they
+// change.
+type ACL struct {
+	db      *datastore.DB
+	watcher *datastore.Watcher
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	rules  ACLRules
+	closed bool
+}
+
+// NewACL loads the rules stored in db and watches them until Close. A DB
+// without rules grants nothing.
+func NewACL(db *datastore.DB) (*ACL, error) {
+	a := &ACL{db: db, done: make(chan struct{})}
+	// Watch before loading so no change in between is missed.
+	a.watcher = db.Watch(ACLPrefix, 16)
+	if err := a.Reload(); err != nil {
+		a.watcher.Close()
+		return nil, err
+	}
+	go a.watch()
+	return a, nil
+}
+
+func (a *ACL) watch() {
+	defer close(a.done)
+	w := a.watcher
+	for {
+		for range w.Changes() {
+			a.Reload()
+		}
+		if !errors.Is(w.Err(), datastore.ErrWatchOverflow) {
+			return
+		}
+		// Changes were dropped; reload the latest rules and go on.
+		a.mu.Lock()
+		if a.closed {
+			a.mu.Unlock()
+			return
+		}
+		w = a.db.Watch(ACLPrefix, 16)
+		a.watcher = w
+		a.mu.Unlock()
+		a.Reload()
+	}
+}
+
+// Reload reads the rules again. The ACL calls it on every change; a
+// failed reload keeps the previous rules.
+func (a *ACL) Reload() error {
+	var rules ACLRules
+	v, err := a.db.Get(aclKey)
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal([]byte(v), &rules); err != nil {
+			return fmt.Errorf("httpapi: invalid ACL rules: %w", err)
+		}
+	}
+	a.mu.Lock()
+	a.rules = rules
+	a.mu.Unlock()
+	return nil
+}
+
+// Rules returns the rules in force.
+func (a *ACL) Rules() ACLRules {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.rules
+}
+
+// Close stops watching the rules.
+func (a *ACL) Close() {
+	a.mu.Lock()
+	a.closed = true
+	w := a.watcher
+	a.mu.Unlock()
+	w.Close()
+	<-a.done
+}
+
+// roles returns the roles of token, or false if the token is unknown.
+func (a *ACL) roles(token string) (map[string]bool, bool) {
+	if token == "" {
+		return nil, false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	// Compare against every token so timing does not reveal prefixes.
+	var roles []string
+	found := false
+	for known, r := range a.rules.Tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			roles, found = r, true
+		}
+	}
+	set := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		set[r] = true
+	}
+	return set, found
+}
+
+// grants returns the access roles have per granted prefix.
+func (a *ACL) grants(roles map[string]bool) map[string]Access {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	m := make(map[string]Access)
+	for _, g := range a.rules.Grants {
+		if roles[g.Role] {
+			m[g.Prefix] = max(m[g.Prefix], g.Access)
+		}
+	}
+	// The reserved prefix is out of reach of every grant.
+	m[ACLPrefix] = AccessNone
+	return m
+}
+
+// keyAccess returns the access grants give to key.
+func keyAccess(grants map[string]Access, key string) Access {
+	best, access := -1, AccessNone
+	for prefix, a := range grants {
+		if len(prefix) > best && strings.HasPrefix(key, prefix) {
+			best, access = len(prefix), a
+		}
+	}
+	return access
+}
+
+// rangeAccess returns the access grants give to every key in [start,
+// end), an empty end meaning no upper bound: the access at start, as long
+// as the prefix granting it spans the range, lowered by the grants on
+// longer prefixes within the range.
+func rangeAccess(grants map[string]Access, start, end string) Access {
+	best := ""
+	found := false
+	for prefix := range grants {
+		if (!found || len(prefix) > len(best)) && strings.HasPrefix(start, prefix) {
+			best, found = prefix, true
+		}
+	}
+	if !found {
+		return AccessNone
+	}
+	if pe := prefixEnd(best); pe != "" && (end == "" || end > pe) {
+		return AccessNone
+	}
+	access := grants[best]
+	for prefix, a := range grants {
+		if len(prefix) <= len(best) || !strings.HasPrefix(prefix, best) {
+			continue
+		}
+		pe := prefixEnd(prefix)
+		if (end == "" || prefix < end) && (pe == "" || pe > start) {
+			access = min(access, a)
+		}
+	}
+	return access
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or "" if there is none.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// RequireACL serves h only within the grants of the caller's token, taken
+// like StaticTokens does. Key routes need AccessRead for GET and
+// AccessWrite otherwise on the key, lock routes AccessWrite on the key
+// they lock, scans AccessRead on their whole range and watches on every
+// key with their prefix; the health report needs only a known token.
+// Ranges reaching into ACLPrefix are refused, even for a grant on every
+// key. Unknown tokens get 401, missing grants 403.
+func RequireACL(h http.Handler, acl *ACL) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roles, ok := acl.roles(bearerToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="db"`)
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		grants := acl.grants(roles)
+		q := r.URL.Query()
+		need, have := AccessRead, AccessRead
+		switch {
+		case r.URL.Path == HealthPath:
+		case r.URL.Path == WatchPath:
+			prefix := q.Get("prefix")
+			have = rangeAccess(grants, prefix, prefixEnd(prefix))
+		case r.URL.Path == Prefix || r.URL.Path == Prefix+"/":
+			have = rangeAccess(grants, q.Get("start"), q.Get("end"))
+		case strings.HasPrefix(r.URL.Path, Prefix+"/"):
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				need = AccessWrite
+			}
+			have = keyAccess(grants, strings.TrimPrefix(r.URL.Path, Prefix+"/"))
+		case strings.HasPrefix(r.URL.Path, LockPath+"/"):
+			need = AccessWrite
+			have = keyAccess(grants, strings.TrimPrefix(r.URL.Path, LockPath+"/"))
+		}
+		if have < need {
+			http.Error(w, fmt.Sprintf("%s access required", need), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, withIdentity(r))
+	})
+}
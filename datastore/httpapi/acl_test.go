@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestRequireACL(t *testing.T) {
+	dir := "test_httpapi_acl"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = SetACLRules(db, ACLRules{
+		Tokens: map[string][]string{"alice": {"users"}, "bob": {"viewer"}, "root": {"admin"}},
+		Grants: []Grant{
+			{Role: "users", Prefix: "users/", Access: AccessWrite},
+			{Role: "users", Prefix: "users/admin/", Access: AccessNone},
+			{Role: "viewer", Prefix: "users/", Access: AccessRead},
+			{Role: "admin", Prefix: "", Access: AccessWrite},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl, err := NewACL(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer acl.Close()
+
+	h := RequireACL(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), acl)
+	serve := func(method, target, token string) int {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, tc := range []struct {
+		method, target, token string
+		code                  int
+	}{
+		{http.MethodGet, "/db/users/1", "", http.StatusUnauthorized},
+		{http.MethodGet, "/db/users/1", "mallory", http.StatusUnauthorized},
+		{http.MethodPut, "/db/users/1", "alice", http.StatusOK},
+		{http.MethodGet, "/db/orders/1", "alice", http.StatusForbidden},
+		// Довший префікс звужує доступ
+		{http.MethodGet, "/db/users/admin/1", "alice", http.StatusForbidden},
+		{http.MethodGet, "/db/users/1", "bob", http.StatusOK},
+		{http.MethodDelete, "/db/users/1", "bob", http.StatusForbidden},
+		{http.MethodGet, "/db?start=users/&end=users0", "bob", http.StatusOK},
+		{http.MethodGet, "/db?start=users/&end=v", "bob", http.StatusForbidden},
+		{http.MethodGet, "/db?start=users/&end=users0", "alice", http.StatusForbidden},
+		{http.MethodGet, "/db?start=users/b&end=users/c", "alice", http.StatusOK},
+		{http.MethodGet, "/watch?prefix=users/", "bob", http.StatusOK},
+		{http.MethodGet, "/watch?prefix=user", "bob", http.StatusForbidden},
+		{http.MethodGet, "/health", "bob", http.StatusOK},
+		{http.MethodPost, "/lock/users/1?ttl=1s", "alice", http.StatusOK},
+		{http.MethodPost, "/lock/users/1?ttl=1s", "bob", http.StatusForbidden},
+		// Правила недоступні навіть адміністратору
+		{http.MethodGet, "/db/" + url.PathEscape(aclKey), "root", http.StatusForbidden},
+		{http.MethodGet, "/db?start=&end=", "root", http.StatusForbidden},
+		{http.MethodGet, "/db?start=a&end=", "root", http.StatusOK},
+	} {
+		if code := serve(tc.method, tc.target, tc.token); code != tc.code {
+			t.Errorf("%s %s as %q: got %d, want %d", tc.method, tc.target, tc.token, code, tc.code)
+		}
+	}
+
+	// Зміна правил підхоплюється без перезапуску
+	err = SetACLRules(db, ACLRules{
+		Tokens: map[string][]string{"bob": {"viewer"}},
+		Grants: []Grant{{Role: "viewer", Prefix: "orders/", Access: AccessWrite}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for serve(http.MethodPut, "/db/orders/1", "bob") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("rules not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if code := serve(http.MethodGet, "/db/users/1", "alice"); code != http.StatusUnauthorized {
+		t.Errorf("removed token: got %d", code)
+	}
+
+	// Зіпсовані правила не скасовують попередні
+	if err := db.PutReserved(aclKey, "{"); err != nil {
+		t.Fatal(err)
+	}
+	if err := acl.Reload(); err == nil {
+		t.Error("expected error for invalid rules")
+	}
+	if code := serve(http.MethodPut, "/db/orders/1", "bob"); code != http.StatusOK {
+		t.Errorf("after invalid rules: got %d", code)
+	}
+}
+
+func TestHandler_HidesACL(t *testing.T) {
+	dir := "test_httpapi_acl_hidden"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := SetACLRules(db, ACLRules{Tokens: map[string][]string{"root": {"admin"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Без RequireACL правила теж недоступні
+	h := Handler(db)
+	if _, err := db.TryLock("a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	lockKey := url.PathEscape(datastore.LockPrefix + "a")
+	for _, target := range []string{"/db/" + url.PathEscape(aclKey), "/lock/" + url.PathEscape(aclKey) + "?ttl=1s", "/db/" + lockKey} {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete} {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(`{"value":"{}"}`)))
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("%s %s: got %d, want 403", method, target, rec.Code)
+			}
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db?start=", nil))
+	var resp ScanResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != 1 || resp.Entries[0].Key != "a" {
+		t.Errorf("expected the scan to leave out the ACL, got %+v", resp.Entries)
+	}
+	if v, err := db.Get(aclKey); err != nil || !strings.Contains(v, "root") {
+		t.Errorf("expected the rules intact, got %q, %v", v, err)
+	}
+}
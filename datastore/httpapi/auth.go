@@ -0,0 +1,255 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Access is what an authenticated caller may do. Each level includes the
+// ones below it.
+type Access uint8
+
+const (
+	AccessNone Access = iota
+	// AccessRead allows gets, scans and watches.
+	AccessRead
+	// AccessWrite also allows puts and deletes.
+	AccessWrite
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessNone:
+		return "none"
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	}
+	return "unknown"
+}
+
+// ParseAccess parses the names String returns.
+func ParseAccess(s string) (Access, error) {
+	switch s {
+	case "none":
+		return AccessNone, nil
+	case "read":
+		return AccessRead, nil
+	case "write":
+		return AccessWrite, nil
+	}
+	return AccessNone, fmt.Errorf("httpapi: unknown access %q", s)
+}
+
+// ErrUnauthenticated is returned by authenticators for requests without
+// valid credentials.
+var ErrUnauthenticated = errors.New("httpapi: unauthenticated")
+
+// Authenticator decides what the sender of a request may do.
+type Authenticator interface {
+	// Authenticate returns the access of r's sender, or
+	// ErrUnauthenticated if r carries no valid credentials.
+	Authenticate(r *http.Request) (Access, error)
+}
+
+// AuthenticatorFunc adapts a function to Authenticator.
+type AuthenticatorFunc func(r *http.Request) (Access, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (Access, error) { return f(r) }
+
+// StaticTokens authenticates "Authorization: Bearer <token>" headers
+// against a fixed set of tokens. Browsers cannot set headers on WebSocket
+// handshakes, so the token is also accepted as the access_token query
+// parameter.
+type StaticTokens map[string]Access
+
+func (t StaticTokens) Authenticate(r *http.Request) (Access, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return AccessNone, ErrUnauthenticated
+	}
+	// Compare against every token so timing does not reveal prefixes.
+	access, found := AccessNone, false
+	for known, a := range t {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			access, found = a, true
+		}
+	}
+	if !found {
+		return AccessNone, ErrUnauthenticated
+	}
+	return access, nil
+}
+
+// bearerToken returns the token r carries, or "" if none.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("access_token")
+	}
+	return token
+}
+
+// LoadTokens reads StaticTokens from a file of "<token> <access>" lines.
+// Blank lines and lines starting with # are skipped.
+func LoadTokens(path string) (StaticTokens, error) {
+	return loadAccess(path)
+}
+
+// LoadClientCerts reads ClientCerts from a file of "<common name>
+// <access>" lines, like LoadTokens.
+func LoadClientCerts(path string) (ClientCerts, error) {
+	return loadAccess(path)
+}
+
+func loadAccess(path string) (map[string]Access, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := make(map[string]Access)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("httpapi: %s:%d: want \"<name> <access>\"", path, line)
+		}
+		access, err := ParseAccess(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		m[fields[0]] = access
+	}
+	return m, sc.Err()
+}
+
+// ClientCerts authenticates requests by the verified TLS client
+// certificate, looking up its subject common name. It needs a server
+// that requests client certificates, see TLSOptions.ClientCAFile.
+type ClientCerts map[string]Access
+
+func (c ClientCerts) Authenticate(r *http.Request) (Access, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return AccessNone, ErrUnauthenticated
+	}
+	access, ok := c[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+	if !ok {
+		return AccessNone, ErrUnauthenticated
+	}
+	return access, nil
+}
+
+// AnyOf tries each authenticator in turn and returns the first access
+// granted, so callers can present either a token or a client certificate.
+func AnyOf(auths ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (Access, error) {
+		for _, a := range auths {
+			access, err := a.Authenticate(r)
+			if errors.Is(err, ErrUnauthenticated) {
+				continue
+			}
+			return access, err
+		}
+		return AccessNone, ErrUnauthenticated
+	})
+}
+
+// identityKey is the context key of the identity of an authenticated
+// caller, see withIdentity.
+type identityKey struct{}
+
+// withIdentity returns r carrying the identity of its sender, whose
+// credentials have been checked: the common name of the verified client
+// certificate, else the bearer token.
+func withIdentity(r *http.Request) *http.Request {
+	var id string
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		id = "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	} else if token := bearerToken(r); token != "" {
+		id = "token:" + token
+	} else {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+// RequireAuth serves h only to callers auth grants enough access: reads
+// (GET and HEAD, watches included) need AccessRead, everything else
+// AccessWrite. Unauthenticated requests get 401, insufficient access 403.
+// h sees the identity of the caller, see LimitOptions.ClientID.
+func RequireAuth(h http.Handler, auth Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		need := AccessWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			need = AccessRead
+		}
+		access, err := auth.Authenticate(r)
+		switch {
+		case errors.Is(err, ErrUnauthenticated):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="db"`)
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		case access < need:
+			http.Error(w, fmt.Sprintf("%s access required", need), http.StatusForbidden)
+		default:
+			h.ServeHTTP(w, withIdentity(r))
+		}
+	})
+}
+
+// TLSOptions configures TLS for a listener.
+type TLSOptions struct {
+	// CertFile and KeyFile hold the PEM server certificate and key.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, if set, holds the PEM CAs client certificates are
+	// verified against, enabling mutual TLS.
+	ClientCAFile string
+	// RequireClientCert rejects connections without a valid client
+	// certificate. Otherwise a certificate is verified if presented, so
+	// token and certificate callers can share the listener.
+	RequireClientCert bool
+}
+
+// Config builds the server TLS config.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("httpapi: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if o.ClientCAFile == "" {
+		if o.RequireClientCert {
+			return nil, errors.New("httpapi: RequireClientCert needs ClientCAFile")
+		}
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(o.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("httpapi: %w", err)
+	}
+	cfg.ClientCAs = x509.NewCertPool()
+	if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("httpapi: no certificates in %s", o.ClientCAFile)
+	}
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if o.RequireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
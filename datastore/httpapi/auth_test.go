@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequireAuth_Tokens(t *testing.T) {
+	dir := "test_httpapi_auth"
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir, 0o755)
+	path := filepath.Join(dir, "tokens")
+	os.WriteFile(path, []byte("# токени\nreader read\n\nwriter write\n"), 0o600)
+	tokens, err := LoadTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), tokens)
+	for _, tc := range []struct {
+		method, token, query string
+		code                 int
+	}{
+		{http.MethodGet, "", "", http.StatusUnauthorized},
+		{http.MethodGet, "wrong", "", http.StatusUnauthorized},
+		{http.MethodGet, "reader", "", http.StatusOK},
+		{http.MethodPut, "reader", "", http.StatusForbidden},
+		{http.MethodPut, "writer", "", http.StatusOK},
+		{http.MethodDelete, "writer", "", http.StatusOK},
+		// Токен у запиті для WebSocket з браузера
+		{http.MethodGet, "", "?access_token=reader", http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, "/db/key"+tc.query, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("%s with %q%s: got %d, want %d", tc.method, tc.token, tc.query, rec.Code, tc.code)
+		}
+	}
+
+	os.WriteFile(path, []byte("token admin\n"), 0o600)
+	if _, err := LoadTokens(path); err == nil {
+		t.Error("expected error for unknown access")
+	}
+}
+
+// writeCert creates a certificate signed by parent, or self-signed if
+// parent is nil, and writes it and its key as PEM files.
+func writeCert(t *testing.T, dir, name string, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func TestRequireAuth_MutualTLS(t *testing.T) {
+	dir := "test_httpapi_mtls"
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir, 0o755)
+
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test ca"}, NotAfter: notAfter,
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	writeCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "server"}, NotAfter: notAfter,
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCert(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "dashboard"}, NotAfter: notAfter,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	opts := TLSOptions{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	cfg, err := opts.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := AnyOf(StaticTokens{"writer": AccessWrite}, ClientCerts{"dashboard": AccessRead})
+	srv := httptest.NewUnstartedServer(RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), auth))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(method string, certs []tls.Certificate, token string) int {
+		t.Helper()
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs}}}
+		req, _ := http.NewRequest(method, srv.URL+"/db/key", strings.NewReader("{}"))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Сертифікат дає лише читання, токен на тому ж слухачі дає запис
+	if code := do(http.MethodGet, []tls.Certificate{clientCert}, ""); code != http.StatusOK {
+		t.Errorf("cert read: %d", code)
+	}
+	if code := do(http.MethodPut, []tls.Certificate{clientCert}, ""); code != http.StatusForbidden {
+		t.Errorf("cert write: %d", code)
+	}
+	if code := do(http.MethodPut, nil, "writer"); code != http.StatusOK {
+		t.Errorf("token write: %d", code)
+	}
+	if code := do(http.MethodGet, nil, ""); code != http.StatusUnauthorized {
+		t.Errorf("anonymous read: %d", code)
+	}
+
+	if _, err := (TLSOptions{CertFile: opts.CertFile, KeyFile: opts.KeyFile, RequireClientCert: true}).Config(); err == nil {
+		t.Error("expected error for RequireClientCert without a CA")
+	}
+}
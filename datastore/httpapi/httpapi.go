@@ -0,0 +1,204 @@
+// Package httpapi serves a datastore.DB over HTTP with JSON bodies. It is
+// the protocol package client speaks to every shard:
+//
+//	GET    /db/{key}                      {"key": ..., "value": ...}, 404 if missing
+//	PUT    /db/{key}  {"value": ...}      sets the key; POST is accepted too
+//	DELETE /db/{key}                      removes the key
+//	GET    /db?start=&end=&limit=         {"entries": [...], "next": ...}
+//	GET    /watch?prefix=&buffer=         WebSocket of Event messages
+//	GET    /health                        datastore.HealthReport, 503 if unhealthy
+//	POST   /lock/{key}?ttl=&wait=         {"token": ...}, 409 if held
+//	DELETE /lock/{key}?token=             releases the lock, 409 if not held
+//
+// Scans return keys in [start, end) in ascending order, at most limit of
+// them; a non-empty next is the start of the following page. A watch
+// streams every later write to keys with the prefix as a JSON text
+// message, for dashboards that show keys live. A lock is taken for ttl,
+// waiting up to wait for its holder to let go, and its token is the
+// fencing token of datastore.DB.TryLock.
+//
+// Handler serves anyone who can connect; wrap it in RequireAuth to demand
+// tokens or client certificates, or in RequireACL for per-prefix grants
+// stored in the DB itself, and serve it with TLSOptions for HTTPS. RateLimit
+// and LimitListener keep one client from starving the others, and Trace
+// records OpenTelemetry spans of the requests.
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+const (
+	// Prefix is the path the key routes start with.
+	Prefix = "/db"
+	// HealthPath is the route of the health report, for load balancers.
+	HealthPath = "/health"
+
+	defaultScanLimit = 1000
+	maxScanLimit     = 10000
+)
+
+// Entry is a key and its value.
+type Entry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// PutRequest is the body of a PUT.
+type PutRequest struct {
+	Value string `json:"value"`
+}
+
+// ScanResponse is one page of a scan.
+type ScanResponse struct {
+	Entries []Entry `json:"entries"`
+	Next    string  `json:"next,omitempty"`
+}
+
+// Handler serves db under Prefix, its locks under LockPath and the watch
+// at WatchPath. Reserved keys, see datastore.Reserved, are left out.
+func Handler(db *datastore.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == WatchPath:
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			watch(db, w, r)
+		case r.URL.Path == HealthPath:
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("Allow", "GET, HEAD")
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			health(db, w)
+		case r.URL.Path == Prefix || r.URL.Path == Prefix+"/":
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			scan(db, w, r)
+		case reservedPath(r.URL.Path):
+			http.Error(w, "reserved key", http.StatusForbidden)
+		case strings.HasPrefix(r.URL.Path, LockPath+"/"):
+			serveLock(db, w, r)
+		case strings.HasPrefix(r.URL.Path, Prefix+"/"):
+			key := strings.TrimPrefix(r.URL.Path, Prefix+"/")
+			switch r.Method {
+			case http.MethodGet:
+				get(db, w, r, key)
+			case http.MethodPut, http.MethodPost:
+				put(db, w, r, key)
+			case http.MethodDelete:
+				if err := db.DeleteContext(r.Context(), key); err != nil {
+					writeError(w, err)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func get(db *datastore.DB, w http.ResponseWriter, r *http.Request, key string) {
+	value, err := db.GetContext(r.Context(), key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, Entry{Key: key, Value: value})
+}
+
+func put(db *datastore.DB, w http.ResponseWriter, r *http.Request, key string) {
+	var req PutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := db.PutContext(r.Context(), key, req.Value); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reservedPath reports whether path is a key or lock route of a reserved
+// key.
+func reservedPath(path string) bool {
+	for _, prefix := range []string{Prefix + "/", LockPath + "/"} {
+		if strings.HasPrefix(path, prefix) && datastore.Reserved(strings.TrimPrefix(path, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func scan(db *datastore.DB, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultScanLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxScanLimit)
+	}
+	resp := ScanResponse{Entries: []Entry{}}
+	err := db.RangeScan(q.Get("start"), q.Get("end"), func(key, value string) bool {
+		if len(resp.Entries) == limit {
+			resp.Next = key
+			return false
+		}
+		resp.Entries = append(resp.Entries, Entry{Key: key, Value: value})
+		return true
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func health(db *datastore.DB, w http.ResponseWriter) {
+	report := db.Health()
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, datastore.ErrBusy):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, datastore.ErrLocked), errors.Is(err, datastore.ErrNotLocked):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, datastore.ErrReservedKey):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
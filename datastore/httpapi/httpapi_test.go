@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestHandler(t *testing.T) {
+	dir := "test_httpapi"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := Handler(db)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := serve(http.MethodPut, "/db/a%2Fb", `{"value":"v1"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("put: %d %s", rec.Code, rec.Body)
+	}
+	rec := serve(http.MethodGet, "/db/a%2Fb", "")
+	var e Entry
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil || e.Key != "a/b" || e.Value != "v1" {
+		t.Fatalf("get: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodDelete, "/db/a%2Fb", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/db/a%2Fb", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPut, "/db/x", "not json"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for bad body, got %d", rec.Code)
+	}
+
+	// Скан сторінками
+	for i := 0; i < 5; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var page ScanResponse
+	rec = serve(http.MethodGet, "/db?start=key1&limit=2", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].Key != "key1" || page.Next != "key3" {
+		t.Errorf("unexpected page %+v", page)
+	}
+	rec = serve(http.MethodGet, "/db?start=key3&end=key4", "")
+	page = ScanResponse{}
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if len(page.Entries) != 1 || page.Next != "" {
+		t.Errorf("unexpected last page %+v", page)
+	}
+
+	var report datastore.HealthReport
+	rec = serve(http.MethodGet, HealthPath, "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || rec.Code != http.StatusOK || !report.Healthy {
+		t.Errorf("health: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,324 @@
+package httpapi
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// clientIdleTimeout is how long the buckets of a client are kept after
+	// its last request.
+	clientIdleTimeout = time.Minute
+	// defaultMaxClients is the default LimitOptions.MaxClients.
+	defaultMaxClients = 10000
+)
+
+// LimitOptions configures RateLimit. Zero fields are not limited.
+type LimitOptions struct {
+	// OpsPerSec is the requests a client may send per second, in bursts of
+	// up to a second's worth.
+	OpsPerSec float64
+	// BytesPerSec is the request and response body bytes a client may
+	// transfer per second. A request is charged once it is served, so a
+	// large one is let through and the client waits off its debt after.
+	BytesPerSec float64
+	// ClientID names the client a request counts against. Nil means the
+	// token or client certificate RequireAuth or RequireACL checked, so
+	// RateLimit goes inside them, else the remote IP address. Credentials
+	// are never taken unchecked: a client could send a new token with
+	// every request.
+	ClientID func(r *http.Request) string
+	// MaxClients bounds the clients whose buckets are kept. Clients seen
+	// while that many are share one set of buckets until idle ones are
+	// dropped. Zero means 10000.
+	MaxClients int
+}
+
+// RateLimit serves h within the limits of opts, per client. Requests over
+// a limit get 429 with a Retry-After header; package client retries them
+// after backing off.
+func RateLimit(h http.Handler, opts LimitOptions) http.Handler {
+	l := &limiter{opts: opts, clients: make(map[string]*clientLimits)}
+	if l.opts.ClientID == nil {
+		l.opts.ClientID = clientID
+	}
+	if l.opts.MaxClients <= 0 {
+		l.opts.MaxClients = defaultMaxClients
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := l.client(l.opts.ClientID(r))
+		if wait := c.admit(); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		if c.bytes == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		cw := &countingWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r)
+		c.bytes.take(float64(body.n + cw.n))
+	})
+}
+
+// clientID is the default LimitOptions.ClientID.
+func clientID(r *http.Request) string {
+	if id, ok := r.Context().Value(identityKey{}).(string); ok {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// limiter holds the buckets of the clients seen lately.
+type limiter struct {
+	opts LimitOptions
+
+	mu       sync.Mutex
+	clients  map[string]*clientLimits
+	overflow *clientLimits // Shared by the clients over MaxClients
+	pruned   time.Time
+}
+
+type clientLimits struct {
+	ops, bytes *bucket // Nil if not limited
+	seen       time.Time
+}
+
+// admit takes a request from the buckets of c and returns how long the
+// client has to wait if it is over a limit.
+func (c *clientLimits) admit() time.Duration {
+	var wait time.Duration
+	if c.bytes != nil {
+		wait = c.bytes.debt()
+	}
+	if c.ops != nil && wait == 0 {
+		wait = c.ops.tryTake(1)
+	}
+	return wait
+}
+
+func (l *limiter) client(id string) *clientLimits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	c, ok := l.clients[id]
+	// A full map is pruned at most once a second, not on every request of
+	// a new client.
+	if since := now.Sub(l.pruned); since > clientIdleTimeout || !ok && len(l.clients) >= l.opts.MaxClients && since > time.Second {
+		for id, c := range l.clients {
+			if now.Sub(c.seen) > clientIdleTimeout {
+				delete(l.clients, id)
+			}
+		}
+		l.pruned = now
+	}
+	if !ok {
+		if len(l.clients) >= l.opts.MaxClients {
+			if l.overflow == nil {
+				l.overflow = l.newClient()
+			}
+			return l.overflow
+		}
+		c = l.newClient()
+		l.clients[id] = c
+	}
+	c.seen = now
+	return c
+}
+
+func (l *limiter) newClient() *clientLimits {
+	c := &clientLimits{}
+	if l.opts.OpsPerSec > 0 {
+		c.ops = newBucket(l.opts.OpsPerSec)
+	}
+	if l.opts.BytesPerSec > 0 {
+		c.bytes = newBucket(l.opts.BytesPerSec)
+	}
+	return c
+}
+
+// bucket is a token bucket holding up to a second's worth of tokens.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64) *bucket {
+	return &bucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// refill adds the tokens earned since the last call. The caller must hold
+// b.mu.
+func (b *bucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// tryTake takes n tokens if there are as many and returns zero, or how
+// long until there will be.
+func (b *bucket) tryTake(n float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens >= n {
+		b.tokens -= n
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take takes n tokens, going into debt if needed.
+func (b *bucket) take(n float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens -= n
+}
+
+// debt returns how long until the bucket is out of debt.
+func (b *bucket) debt() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the body bytes of a response and keeps its status.
+type countingWriter struct {
+	http.ResponseWriter
+	n    int64
+	code int
+}
+
+func (w *countingWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// status returns the status of the response, 200 if none was written.
+func (w *countingWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Hijack hands the connection of a watch over to its WebSocket, whose
+// frames are no longer counted.
+func (w *countingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// LimitListener returns a listener that accepts at most total connections
+// at a time, waiting for one to close before accepting more, and at most
+// perClient from one remote IP address, closing the ones over it at once.
+// Zero disables either limit.
+func LimitListener(l net.Listener, total, perClient int) net.Listener {
+	ll := &limitListener{Listener: l, perClient: perClient, open: make(map[string]int)}
+	if total > 0 {
+		ll.slots = make(chan struct{}, total)
+	}
+	return ll
+}
+
+type limitListener struct {
+	net.Listener
+	slots     chan struct{} // Nil if unlimited
+	perClient int
+
+	mu   sync.Mutex
+	open map[string]int // Connections by remote IP
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		if l.slots != nil {
+			l.slots <- struct{}{}
+		}
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.release()
+			return nil, err
+		}
+		host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			host = conn.RemoteAddr().String()
+		}
+		l.mu.Lock()
+		full := l.perClient > 0 && l.open[host] >= l.perClient
+		if !full {
+			l.open[host]++
+		}
+		l.mu.Unlock()
+		if full {
+			conn.Close()
+			l.release()
+			continue
+		}
+		return &limitConn{Conn: conn, l: l, host: host}, nil
+	}
+}
+
+// release frees a connection slot.
+func (l *limitListener) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+type limitConn struct {
+	net.Conn
+	l    *limitListener
+	host string
+	once sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.l.mu.Lock()
+		if c.l.open[c.host]--; c.l.open[c.host] == 0 {
+			delete(c.l.open, c.host)
+		}
+		c.l.mu.Unlock()
+		c.l.release()
+	})
+	return err
+}
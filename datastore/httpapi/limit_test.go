@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	tokens := StaticTokens{"alice": AccessWrite, "bob": AccessWrite, "carol": AccessWrite}
+	h := RequireAuth(RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	}), LimitOptions{OpsPerSec: 2, BytesPerSec: 100}), tokens)
+	serve := func(token string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/db/key", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := serve("alice", "v"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: %d", i, rec.Code)
+		}
+	}
+	rec := serve("alice", "v")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 429 with Retry-After 1, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// Інший клієнт має власні ліміти
+	if rec := serve("bob", "v"); rec.Code != http.StatusOK {
+		t.Errorf("expected bob served, got %d", rec.Code)
+	}
+
+	// Великий запит пропускається, а борг зупиняє наступні
+	if rec := serve("carol", strings.Repeat("x", 500)); rec.Code != http.StatusOK {
+		t.Fatalf("large request: %d", rec.Code)
+	}
+	rec = serve("carol", "v")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "5" {
+		t.Errorf("expected 429 with Retry-After 5, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimit_UncheckedTokens(t *testing.T) {
+	h := RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), LimitOptions{OpsPerSec: 2})
+	codes := make([]int, 3)
+	for i := range codes {
+		// Новий токен на кожен запит не дає нових лімітів
+		req := httptest.NewRequest(http.MethodGet, "/db/key", nil)
+		req.Header.Set("Authorization", "Bearer "+strconv.Itoa(i))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes[i] = rec.Code
+	}
+	if codes[2] != http.StatusTooManyRequests {
+		t.Errorf("expected unchecked tokens to share the limits of the address, got %v", codes)
+	}
+}
+
+func TestRateLimit_MaxClients(t *testing.T) {
+	h := RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), LimitOptions{OpsPerSec: 1, MaxClients: 2})
+	serve := func(addr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/db/key", nil)
+		req.RemoteAddr = addr + ":1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, addr := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if code := serve(addr); code != http.StatusOK {
+			t.Fatalf("%s: %d", addr, code)
+		}
+	}
+	// Клієнти понад MaxClients ділять одні ліміти
+	if code := serve("10.0.0.4"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the clients over MaxClients limited together, got %d", code)
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := LimitListener(inner, 0, 1)
+	defer l.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	first, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	conn := <-accepted
+
+	// Друге з'єднання з тієї ж адреси закривається одразу
+	second, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the second connection closed, got %v", err)
+	}
+
+	conn.Close()
+	third, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Error("expected a connection accepted once the first closed")
+	}
+}
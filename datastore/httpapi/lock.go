@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// LockPath is the path the lock routes start with.
+const LockPath = "/lock"
+
+// LockResponse is the body of a taken lock.
+type LockResponse struct {
+	Token uint64 `json:"token"`
+}
+
+func serveLock(db *datastore.DB, w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, LockPath+"/")
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodPost:
+		ttl, err := time.ParseDuration(q.Get("ttl"))
+		if err != nil || ttl <= 0 {
+			http.Error(w, "invalid ttl", http.StatusBadRequest)
+			return
+		}
+		var wait time.Duration
+		if v := q.Get("wait"); v != "" {
+			if wait, err = time.ParseDuration(v); err != nil || wait < 0 {
+				http.Error(w, "invalid wait", http.StatusBadRequest)
+				return
+			}
+		}
+		var token uint64
+		if wait > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), wait)
+			defer cancel()
+			token, err = db.Lock(ctx, key, ttl)
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = datastore.ErrLocked
+			}
+		} else {
+			token, err = db.TryLock(key, ttl)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, LockResponse{Token: token})
+	case http.MethodDelete:
+		token, err := strconv.ParseUint(q.Get("token"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusBadRequest)
+			return
+		}
+		if err := db.Unlock(key, token); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestLockRoutes(t *testing.T) {
+	dir := "test_httpapi_lock"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := Handler(db)
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/lock/a%2Fb?ttl=1m")
+	var lock LockResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &lock); err != nil || rec.Code != http.StatusOK || lock.Token == 0 {
+		t.Fatalf("lock: %d %s", rec.Code, rec.Body)
+	}
+	if _, err := db.TryLock("a/b", time.Minute); !errors.Is(err, datastore.ErrLocked) {
+		t.Errorf("expected the lock held in the DB, got %v", err)
+	}
+	// Зайнятий замок: 409 одразу і після очікування
+	if rec := serve(http.MethodPost, "/lock/a%2Fb?ttl=1m"); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a held lock, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/lock/a%2Fb?ttl=1m&wait=30ms"); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 after waiting, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/lock/c?ttl=0s"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad ttl, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodDelete, fmt.Sprintf("/lock/a%%2Fb?token=%d", lock.Token+1)); rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a wrong token, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodDelete, fmt.Sprintf("/lock/a%%2Fb?token=%d", lock.Token)); rec.Code != http.StatusNoContent {
+		t.Errorf("unlock: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodGet, "/lock/a%2Fb"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/MikhailoSafronov/design-db-practice/datastore/httpapi"
+
+// Trace records a server span of tp for every request to h, continuing
+// the trace of the caller as the global propagator extracts it from the
+// headers. The handlers pass the span on, so with Options.TracerProvider
+// set the spans of the DB nest inside it.
+func Trace(h http.Handler, tp trace.TracerProvider) http.Handler {
+	tracer := tp.Tracer(tracerName)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routeOf(r.URL.Path)
+		ctx, span := tracer.Start(ctx, r.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", r.Method), attribute.String("http.route", route)))
+		defer span.End()
+		cw := &countingWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r.WithContext(ctx))
+		code := cw.status()
+		span.SetAttributes(attribute.Int("http.response.status_code", code), attribute.Int64("http.response.body.size", cw.n))
+		if code >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(code))
+		}
+	})
+}
+
+// routeOf returns the route serving path, with the key as {key}, so spans
+// do not record keys.
+func routeOf(path string) string {
+	for _, prefix := range []string{Prefix, LockPath} {
+		if strings.HasPrefix(path, prefix+"/") && len(path) > len(prefix)+1 {
+			return prefix + "/{key}"
+		}
+	}
+	return path
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestTrace(t *testing.T) {
+	dir := "test_httpapi_trace"
+	defer os.RemoveAll(dir)
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	db, err := datastore.OpenWithOptions(dir, datastore.Options{TracerProvider: tp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	h := Trace(Handler(db), tp)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPut, "/db/users%2F1", strings.NewReader(`{"value":"v"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	put, server := spans[0], spans[1]
+	if server.Name() != "PUT /db/{key}" || server.SpanKind().String() != "server" {
+		t.Errorf("unexpected server span %s %s", server.Name(), server.SpanKind())
+	}
+	// Спан сервера продовжує трасу клієнта, а спан запису — його
+	if server.SpanContext().TraceID().String() != traceID || !server.Parent().IsRemote() {
+		t.Errorf("expected the server span in the caller's trace, got %s", server.SpanContext().TraceID())
+	}
+	if put.Name() != "datastore.Put" || put.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("expected datastore.Put under the server span, got %s under %s", put.Name(), put.Parent().SpanID())
+	}
+	for _, kv := range server.Attributes() {
+		if kv.Key == "http.response.status_code" && kv.Value.AsInt64() != http.StatusNoContent {
+			t.Errorf("expected status 204, got %d", kv.Value.AsInt64())
+		}
+	}
+}
+
+func TestRouteOf(t *testing.T) {
+	for path, want := range map[string]string{
+		"/db/a/b":  "/db/{key}",
+		"/db":      "/db",
+		"/db/":     "/db/",
+		"/lock/x":  "/lock/{key}",
+		"/health":  "/health",
+		"/unknown": "/unknown",
+	} {
+		if got := routeOf(path); got != want {
+			t.Errorf("routeOf(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
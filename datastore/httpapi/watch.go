@@ -0,0 +1,130 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+const (
+	// WatchPath is the route of the watch WebSocket.
+	WatchPath = "/watch"
+
+	defaultWatchBuffer = 256
+	maxWatchBuffer     = 4096
+	watchWriteTimeout  = 10 * time.Second
+)
+
+// Event is one write streamed by a watch.
+type Event struct {
+	Seq   uint64 `json:"seq"`
+	Op    string `json:"op"` // "put", "delete" or "merge"
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// watch upgrades r to a WebSocket and sends every write to keys with the
+// prefix as an Event text message. At most buffer events wait for a slow
+// client; past that the server closes with 1013 (try again later) and the
+// client should reconnect and re-read the keys it shows.
+func watch(db *datastore.DB, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	buffer := defaultWatchBuffer
+	if v := q.Get("buffer"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid buffer", http.StatusBadRequest)
+			return
+		}
+		buffer = min(n, maxWatchBuffer)
+	}
+	// Watch before the handshake so no write after it is missed.
+	watcher := db.Watch(q.Get("prefix"), buffer)
+	defer watcher.Close()
+
+	conn, brw, err := upgrade(w, r)
+	if errors.Is(err, errNotWebSocket) {
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	// The reader answers pings and notices the client leaving; writes of
+	// both goroutines are serialised by mu.
+	var mu sync.Mutex
+	send := func(op byte, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+		return writeFrame(brw.Writer, op, payload)
+	}
+	sendClose := func(code uint16, reason string) {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(watchWriteTimeout))
+		writeClose(brw.Writer, code, reason)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readLoop(brw.Reader, send, sendClose)
+	}()
+
+	for {
+		select {
+		case c, ok := <-watcher.Changes():
+			if !ok {
+				if errors.Is(watcher.Err(), datastore.ErrWatchOverflow) {
+					sendClose(closeTryAgain, "client too slow")
+				} else {
+					sendClose(closeGoingAway, "server closing")
+				}
+				return
+			}
+			if datastore.Reserved(c.Key) {
+				continue
+			}
+			data, _ := json.Marshal(Event{Seq: c.Seq, Op: c.Op.String(), Key: c.Key, Value: c.Value})
+			if err := send(opText, data); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// readLoop handles client frames until the connection closes.
+func readLoop(r *bufio.Reader, send func(byte, []byte) error, sendClose func(uint16, string)) {
+	for {
+		op, payload, err := readFrame(r)
+		if errors.Is(err, errFrameTooBig) {
+			sendClose(closeTooBig, "frame too big")
+			return
+		}
+		if err != nil {
+			return
+		}
+		switch op {
+		case opPing:
+			if send(opPong, payload) != nil {
+				return
+			}
+		case opClose:
+			sendClose(closeNormal, "")
+			return
+		}
+	}
+}
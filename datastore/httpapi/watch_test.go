@@ -0,0 +1,151 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// dialWatch opens a watch as a WebSocket client would.
+func dialWatch(t *testing.T, srv *httptest.Server, query string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET %s?%s HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: %s\r\n\r\n", WatchPath, query, key)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Приклад з RFC 6455
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake failed: %s %v", resp.Status, resp.Header)
+	}
+	return conn, r
+}
+
+// readServerFrame reads one unmasked frame.
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := uint64(hdr[1])
+	switch n {
+	case 126:
+		var ext uint16
+		binary.Read(r, binary.BigEndian, &ext)
+		n = uint64(ext)
+	case 127:
+		binary.Read(r, binary.BigEndian, &n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return hdr[0] & 0x0F, payload
+}
+
+func writeClientFrame(conn net.Conn, op byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+}
+
+func TestWatch(t *testing.T) {
+	dir := "test_httpapi_watch"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	srv := httptest.NewServer(Handler(db))
+	defer srv.Close()
+
+	conn, r := dialWatch(t, srv, "prefix=user/")
+	db.Put("order/1", "x")
+	db.Put("user/1", "alice")
+	db.Delete("user/1")
+
+	// Події приходять по порядку і лише для префікса
+	for _, want := range []Event{{Seq: 2, Op: "put", Key: "user/1", Value: "alice"}, {Seq: 3, Op: "delete", Key: "user/1"}} {
+		op, payload := readServerFrame(t, r)
+		var got Event
+		if err := json.Unmarshal(payload, &got); err != nil || op != opText || got != want {
+			t.Fatalf("got %d %s, want %+v", op, payload, want)
+		}
+	}
+
+	writeClientFrame(conn, opPing, []byte("hi"))
+	if op, payload := readServerFrame(t, r); op != opPong || string(payload) != "hi" {
+		t.Errorf("expected pong, got %d %q", op, payload)
+	}
+	writeClientFrame(conn, opClose, binary.BigEndian.AppendUint16(nil, closeNormal))
+	if op, _ := readServerFrame(t, r); op != opClose {
+		t.Errorf("expected close echo, got %d", op)
+	}
+
+	// Звичайний GET без рукостискання відхиляється
+	resp, err := http.Get(srv.URL + WatchPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("expected 426, got %d", resp.StatusCode)
+	}
+}
+
+func TestWatch_SlowClient(t *testing.T) {
+	dir := "test_httpapi_watch_slow"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	srv := httptest.NewServer(Handler(db))
+	defer srv.Close()
+
+	_, r := dialWatch(t, srv, "buffer=1")
+	// Великі значення заповнюють буфери сокета, поки клієнт не читає
+	big := strings.Repeat("x", 1<<16)
+	for i := 0; i < 200; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), big); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Клієнт дочитує все, що встигло надійти, і отримує закриття 1013
+	for {
+		op, payload := readServerFrame(t, r)
+		if op == opClose {
+			if code := binary.BigEndian.Uint16(payload); code != closeTryAgain {
+				t.Errorf("expected close code %d, got %d", closeTryAgain, code)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestIncrInt64_Concurrent(t *testing.T) {
+	dir := "test_incr"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const workers, perWorker = 20, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				if _, err := db.IncrInt64("counter", 1); err != nil {
+					t.Errorf("IncrInt64: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Жоден інкремент не повинен загубитися
+	got, err := db.GetInt64("counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != workers*perWorker {
+		t.Fatalf("counter = %d, want %d", got, workers*perWorker)
+	}
+}
+
+func TestIncrInt64_ExistingAndInvalid(t *testing.T) {
+	dir := "test_incr_existing"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.PutInt64("n", 40); err != nil {
+		t.Fatal(err)
+	}
+	n, err := db.IncrInt64("n", 2)
+	if err != nil || n != 42 {
+		t.Fatalf("IncrInt64 = %d, %v; want 42", n, err)
+	}
+	n, err = db.IncrInt64("n", -50)
+	if err != nil || n != -8 {
+		t.Fatalf("IncrInt64 = %d, %v; want -8", n, err)
+	}
+
+	// Нечислове значення не змінюється
+	if err := db.Put("s", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.IncrInt64("s", 1); err == nil {
+		t.Fatal("expected error for non-numeric value")
+	}
+	if v, _ := db.Get("s"); v != "abc" {
+		t.Fatalf("value changed to %q", v)
+	}
+}
@@ -0,0 +1,122 @@
+package datastore
+
+import (
+	"log/slog"
+	"sort"
+)
+
+// IndexType selects the in-memory structure used to map keys to positions.
+type IndexType int
+
+const (
+	// IndexHash keeps keys in a Go map. Lookups are fastest, but ordered
+	// iteration has to sort all keys first.
+	IndexHash IndexType = iota
+	// IndexBTree keeps keys in an ordered B-tree, so range scans only visit
+	// the keys they return.
+	IndexBTree
+	// IndexFingerprint keeps only a 64-bit fingerprint of every key, which
+	// makes the index much smaller when keys are long. Reads verify the
+	// full key on disk; ordered iteration reads every key back, so range
+	// scans are slow.
+	IndexFingerprint
+	// IndexLazy keeps only the recently used shards of the index in
+	// memory and spills the rest to disk, for directories whose keys do
+	// not fit in RAM. Lookups of cold keys load their shard from disk, and
+	// ordered iteration reads every shard. See Options.LazyIndex.
+	IndexLazy
+	// IndexCompact stores keys in large shared byte slabs and positions in
+	// a flat hash table, taking about half the memory of IndexHash for
+	// short keys. Ordered iteration sorts all keys, as with IndexHash.
+	IndexCompact
+	// IndexCOW keeps keys in a persistent hash trie that writers copy on
+	// change and publish once they are done, so Get reads without taking
+	// the DB lock and is not held up by writes, rotations or merges, short
+	// of adding what it read to the cache or folding merge operands. Each
+	// write allocates a copy of the path to its key, and ordered iteration
+	// sorts all keys, as with IndexHash.
+	IndexCOW
+)
+
+// keydir maps keys to the position of their latest entry.
+type keydir interface {
+	get(key string) (position, bool)
+	put(key string, pos position)
+	remove(key string)
+	len() int
+	// ascend calls fn for keys in [start, end) in ascending order until fn
+	// returns false. An empty end means no upper bound.
+	ascend(start, end string, fn func(key string, pos position) bool)
+	// rebase moves every position in segment from to segment to.
+	rebase(from, to int)
+}
+
+func (db *DB) newKeydir(opts Options) (keydir, error) {
+	if opts.IndexStorage == IndexDisk {
+		return newDiskIndex(db.fs, db.dir, opts.Hash, func(err error) {
+			db.log(slog.LevelError, "index file I/O failed", "err", err)
+		})
+	}
+	switch opts.IndexType {
+	case IndexBTree:
+		return &btreeIndex{}, nil
+	case IndexFingerprint:
+		return newFingerprintIndex(opts.Hash, db.keyAt), nil
+	case IndexCompact:
+		return newCompactIndex(opts.Hash), nil
+	case IndexCOW:
+		return newCOWIndex(opts.Hash), nil
+	case IndexLazy:
+		var lo LazyIndexOptions
+		if opts.LazyIndex != nil {
+			lo = *opts.LazyIndex
+		}
+		return newLazyIndex(db.fs, db.dir, opts.Hash, lo, func(err error) {
+			db.log(slog.LevelError, "index shard I/O failed", "err", err)
+		})
+	}
+	return make(hashIndex), nil
+}
+
+type hashIndex map[string]position
+
+func (h hashIndex) get(key string) (position, bool) {
+	pos, ok := h[key]
+	return pos, ok
+}
+
+func (h hashIndex) put(key string, pos position) {
+	h[key] = pos
+}
+
+func (h hashIndex) remove(key string) {
+	delete(h, key)
+}
+
+func (h hashIndex) len() int {
+	return len(h)
+}
+
+func (h hashIndex) ascend(start, end string, fn func(key string, pos position) bool) {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		if key >= start && (end == "" || key < end) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !fn(key, h[key]) {
+			return
+		}
+	}
+}
+
+func (h hashIndex) rebase(from, to int) {
+	for key, pos := range h {
+		if pos.segID == from {
+			pos.segID = to
+			h[key] = pos
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//go:build go1.23
+
+package datastore
+
+import (
+	"errors"
+	"iter"
+	"log/slog"
+)
+
+// All returns an iterator over every key and its value in ascending key
+// order, for use as
+//
+//	for key, value := range db.All() { ... }
+//
+// The keys are listed when iteration starts and each value is read when
+// its key is reached, so a write made during iteration shows up if it
+// changes a key not visited yet, a key deleted before it is reached is
+// skipped and keys added after the start are not visited. A read error
+// ends the iteration early and is logged; use RangeScan to handle it.
+func (db *DB) All() iter.Seq2[string, string] {
+	return db.iterate("", "")
+}
+
+// Prefix is All limited to the keys starting with prefix.
+func (db *DB) Prefix(prefix string) iter.Seq2[string, string] {
+	return db.iterate(prefix, prefixEnd(prefix))
+}
+
+func (db *DB) iterate(start, end string) iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		ra := db.newReadAhead()
+		for _, key := range db.scanKeys(start, end) {
+			value, err := ra.get(key)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				db.log(slog.LevelError, "iteration stopped by a read error", "key", key, "err", err)
+				return
+			}
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build go1.23
+
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	dir := "test_iter_all"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		db.Put("k"+strconv.Itoa(i), "v"+strconv.Itoa(i))
+	}
+	db.Put("other", "x")
+
+	var got []string
+	for k, v := range db.All() {
+		got = append(got, k+"="+v)
+		if k == "k1" {
+			// Запис під час обходу: зміна ще не відвіданого ключа видна,
+			// видалений ключ пропускається, новий — ні
+			db.Put("k3", "changed")
+			db.Delete("k4")
+			db.Put("k2a", "new")
+		}
+	}
+	want := "[k0=v0 k1=v1 k2=v2 k3=changed other=x]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("All = %v, want %s", got, want)
+	}
+
+	got = got[:0]
+	for k := range db.Prefix("k") {
+		got = append(got, k)
+		if len(got) == 2 {
+			break
+		}
+	}
+	if fmt.Sprint(got) != "[k0 k1]" {
+		t.Fatalf("Prefix with break = %v", got)
+	}
+}
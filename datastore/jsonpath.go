@@ -0,0 +1,199 @@
+package datastore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidJSONPath is returned for a path QueryJSON or ScanWhereJSON
+// cannot parse.
+var ErrInvalidJSONPath = errors.New("invalid JSONPath")
+
+// QueryJSON parses the value at key as JSON and returns the values path
+// selects in it, decoded like encoding/json decodes into an any. Paths
+// support a subset of JSONPath: the root $, children .name and ['name'],
+// indexes [n], negative ones counting from the end, wildcards .* and [*]
+// and recursive descent ..name and ..*. A path matching nothing returns no
+// values and no error.
+func (db *DB) QueryJSON(key, path string) ([]any, error) {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(v), &doc); err != nil {
+		return nil, fmt.Errorf("value of %q: %w", key, err)
+	}
+	return p.eval(doc), nil
+}
+
+// ScanWhereJSON calls fn, in ascending key order until it returns false,
+// for every key starting with prefix whose value is JSON in which path
+// selects a value pred accepts. Values that are not JSON are skipped.
+func (db *DB) ScanWhereJSON(prefix, path string, pred func(v any) bool, fn func(key, value string) bool) error {
+	p, err := parseJSONPath(path)
+	if err != nil {
+		return err
+	}
+	return db.RangeScan(prefix, prefixEnd(prefix), func(key, value string) bool {
+		var doc any
+		if json.Unmarshal([]byte(value), &doc) != nil {
+			return true
+		}
+		for _, v := range p.eval(doc) {
+			if pred(v) {
+				return fn(key, value)
+			}
+		}
+		return true
+	})
+}
+
+// jsonStep selects children of a value: the member name, the element at
+// index, or all of them if wildcard. With descend it applies to the value
+// and all its descendants.
+type jsonStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+	descend  bool
+}
+
+type jsonPath []jsonStep
+
+func parseJSONPath(path string) (jsonPath, error) {
+	bad := func(why string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidJSONPath, path, why)
+	}
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, bad("must start with $")
+	}
+	var p jsonPath
+	for rest != "" {
+		var step jsonStep
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, bad("unclosed [")
+			}
+			sel := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case sel == "*":
+				step.wildcard = true
+			case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+				step.name = sel[1 : len(sel)-1]
+			default:
+				n, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, bad("bad selector [" + sel + "]")
+				}
+				step.index, step.isIndex = n, true
+			}
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			if r, ok := strings.CutPrefix(rest, "."); ok {
+				step.descend, rest = true, r
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			switch name {
+			case "":
+				return nil, bad("empty name")
+			case "*":
+				step.wildcard = true
+			default:
+				step.name = name
+			}
+		default:
+			return nil, bad("unexpected " + strconv.Quote(rest[:1]))
+		}
+		p = append(p, step)
+	}
+	return p, nil
+}
+
+func (p jsonPath) eval(doc any) []any {
+	nodes := []any{doc}
+	for _, step := range p {
+		var next []any
+		for _, n := range nodes {
+			if step.descend {
+				walkJSON(n, func(d any) { next = step.children(d, next) })
+			} else {
+				next = step.children(n, next)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// children appends the children of v step selects to out.
+func (step jsonStep) children(v any, out []any) []any {
+	switch v := v.(type) {
+	case map[string]any:
+		if step.wildcard {
+			for _, name := range sortedMembers(v) {
+				out = append(out, v[name])
+			}
+		} else if c, ok := v[step.name]; ok && !step.isIndex {
+			out = append(out, c)
+		}
+	case []any:
+		if step.wildcard {
+			return append(out, v...)
+		}
+		if step.isIndex {
+			i := step.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				out = append(out, v[i])
+			}
+		}
+	}
+	return out
+}
+
+// sortedMembers returns the member names of obj in order, so matches come
+// out the same on every query.
+func sortedMembers(obj map[string]any) []string {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// walkJSON calls fn for v and each of its descendants.
+func walkJSON(v any, fn func(any)) {
+	fn(v)
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range sortedMembers(v) {
+			walkJSON(v[name], fn)
+		}
+	case []any:
+		for _, c := range v {
+			walkJSON(c, fn)
+		}
+	}
+}
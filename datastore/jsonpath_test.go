@@ -0,0 +1,99 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestQueryJSON(t *testing.T) {
+	dir := "test_jsonpath"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	doc := `{"name":"alice","age":31,"tags":["admin","dev"],"address":{"city":"Kyiv","geo":{"city":"x"}}}`
+	if err := db.Put("user:1", doc); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string][]any{
+		"$.name":           {"alice"},
+		"$['age']":         {31.0},
+		"$.tags[-1]":       {"dev"},
+		"$.tags[*]":        {"admin", "dev"},
+		"$..city":          {"Kyiv", "x"},
+		"$.address.*.city": {"x"},
+		"$.missing.deep":   nil,
+		"$.tags[5]":        nil,
+	} {
+		got, err := db.QueryJSON("user:1", path)
+		if err != nil {
+			t.Fatalf("QueryJSON(%q): %v", path, err)
+		}
+		if len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Errorf("QueryJSON(%q) = %v, want %v", path, got, want)
+		}
+	}
+	for _, path := range []string{"name", "$.", "$[1", "$[x]", "$name"} {
+		if _, err := db.QueryJSON("user:1", path); !errors.Is(err, ErrInvalidJSONPath) {
+			t.Errorf("QueryJSON(%q) err = %v", path, err)
+		}
+	}
+	if _, err := db.QueryJSON("missing", "$.name"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("QueryJSON(missing) err = %v", err)
+	}
+}
+
+func TestScanWhereJSON(t *testing.T) {
+	dir := "test_jsonpath_scan"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for k, v := range map[string]string{
+		"user:1":  `{"age":31,"tags":["admin"]}`,
+		"user:2":  `{"age":17}`,
+		"user:3":  `{"age":45,"tags":["dev","admin"]}`,
+		"user:4":  `not json`,
+		"order:1": `{"age":99}`,
+	} {
+		if err := db.Put(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var keys []string
+	collect := func(key, _ string) bool {
+		keys = append(keys, key)
+		return true
+	}
+	adult := func(v any) bool { age, ok := v.(float64); return ok && age >= 18 }
+	if err := db.ScanWhereJSON("user:", "$.age", adult, collect); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(keys, []string{"user:1", "user:3"}) {
+		t.Errorf("adults = %v", keys)
+	}
+
+	// Збіг будь-якого з вибраних значень
+	keys = nil
+	admin := func(v any) bool { return v == "admin" }
+	if err := db.ScanWhereJSON("user:", "$.tags[*]", admin, collect); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(keys, []string{"user:1", "user:3"}) {
+		t.Errorf("admins = %v", keys)
+	}
+	if err := db.ScanWhereJSON("", "age", admin, collect); !errors.Is(err, ErrInvalidJSONPath) {
+		t.Errorf("expected ErrInvalidJSONPath, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package datastore
+
+import (
+	"hash/maphash"
+)
+
+const (
+	keyFilterBitsPerKey = 10
+	keyFilterProbes     = 7
+)
+
+var keyFilterSeed = maphash.MakeSeed()
+
+// keyFilter is a Bloom filter over the keys of the entries in a frozen
+// segment. Merges consult the filters of the segments older than the ones
+// they compact to drop tombstones that no longer hide anything. Filters
+// live in memory only: they are built when a segment is frozen, merged or
+// scanned in full, and a segment without one may hold any key.
+type keyFilter struct {
+	bits []uint64
+}
+
+func keyHash(key string) uint64 {
+	return maphash.String(keyFilterSeed, key)
+}
+
+// newKeyFilter returns a filter over the keys with the given hashes.
+func newKeyFilter(hashes []uint64) *keyFilter {
+	n := max(len(hashes)*keyFilterBitsPerKey, 64)
+	f := &keyFilter{bits: make([]uint64, (n+63)/64)}
+	for _, h := range hashes {
+		f.probe(h, func(word int, bit uint64) bool {
+			f.bits[word] |= bit
+			return true
+		})
+	}
+	return f
+}
+
+// mayContain reports whether the key with hash h may be in the filter.
+func (f *keyFilter) mayContain(h uint64) bool {
+	return f.probe(h, func(word int, bit uint64) bool {
+		return f.bits[word]&bit != 0
+	})
+}
+
+// probe calls fn for the bits of h, derived by double hashing, until fn
+// returns false.
+func (f *keyFilter) probe(h uint64, fn func(word int, bit uint64) bool) bool {
+	n := uint64(len(f.bits) * 64)
+	h1, h2 := h, h>>32|1
+	for i := uint64(0); i < keyFilterProbes; i++ {
+		b := (h1 + i*h2) % n
+		if !fn(int(b/64), 1<<(b%64)) {
+			return false
+		}
+	}
+	return true
+}
+
+// keyHashes collects the key hashes of a segment until its filter is
+// built. complete is cleared once an entry is missed, such as the ones a
+// checkpoint lets recovery skip.
+type keyHashes struct {
+	hashes   []uint64
+	complete bool
+}
+
+func (k *keyHashes) add(key string) {
+	if k.complete {
+		k.hashes = append(k.hashes, keyHash(key))
+	}
+}
+
+// filter builds the filter of the collected keys, nil if some were missed.
+func (k *keyHashes) filter() *keyFilter {
+	if !k.complete {
+		return nil
+	}
+	return newKeyFilter(k.hashes)
+}
+
+// mayHoldKey reports whether any of segs may hold an entry of key.
+func mayHoldKey(segs []*keyFilter, key string) bool {
+	if len(segs) == 0 {
+		return false
+	}
+	h := keyHash(key)
+	for _, f := range segs {
+		if f == nil || f.mayContain(h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+// Package kvfs exposes a datastore.DB as a read-only fs.FS. Keys are file
+// paths and values file contents; directories are implied by the keys
+// below them, so "static/css/site.css" makes "static" and "static/css"
+// directories. Keys that are not valid fs.FS paths, such as ones with a
+// leading slash or empty elements, cannot be opened. A key that is also
+// the prefix of other keys opens as a file.
+package kvfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// FS is a read-only view of a DB. It implements fs.ReadFileFS,
+// fs.ReadDirFS and fs.StatFS.
+type FS struct {
+	db *datastore.DB
+}
+
+// New returns an FS over db. Reads go straight to db, so they see writes
+// made after New.
+func New(db *datastore.DB) *FS {
+	return &FS{db: db}
+}
+
+var (
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+)
+
+// Open opens the file or directory name.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	info, value, err := f.stat(name, "open")
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dir{info: info, fsys: f, name: name}, nil
+	}
+	return &file{Reader: strings.NewReader(value), info: info}, nil
+}
+
+// ReadFile returns the value of the key name.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	info, value, err := f.stat(name, "readfile")
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errors.New("is a directory")}
+	}
+	return []byte(value), nil
+}
+
+// Stat describes the file or directory name.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, _, err := f.stat(name, "stat")
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadDir lists the directory name in name order.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	info, _, err := f.stat(name, "readdir")
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return f.entries(name)
+}
+
+// stat looks name up as a key, then as a directory. The value of a file
+// is returned along with its info.
+func (f *FS) stat(name, op string) (*fileInfo, string, error) {
+	if name != "." {
+		value, meta, err := f.db.GetWithMeta(name)
+		if err == nil {
+			return &fileInfo{name: base(name), size: int64(len(value)), mode: 0o444, modTime: meta.Modified}, value, nil
+		}
+		if !errors.Is(err, datastore.ErrNotFound) {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: err}
+		}
+	}
+	prefix := dirPrefix(name)
+	if name != "." && !f.db.HasKeys(prefix, prefixEnd(prefix)) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return &fileInfo{name: base(name), mode: fs.ModeDir | 0o555}, "", nil
+}
+
+// entries returns the files and directories directly in the directory
+// name, sorted by name. Keys that are not valid paths are left out.
+func (f *FS) entries(name string) ([]fs.DirEntry, error) {
+	prefix := dirPrefix(name)
+	var list []fs.DirEntry
+	seen := make(map[string]bool)
+	var err error
+	f.db.RangeKeys(prefix, prefixEnd(prefix), func(key string) bool {
+		child, _, _ := strings.Cut(key[len(prefix):], "/")
+		if seen[child] || !fs.ValidPath(prefix+child) {
+			return true
+		}
+		seen[child] = true
+		var info *fileInfo
+		if info, _, err = f.stat(prefix+child, "readdir"); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// Deleted since the keys were listed
+				err = nil
+				return true
+			}
+			return false
+		}
+		list = append(list, fs.FileInfoToDirEntry(info))
+		return true
+	})
+	slices.SortFunc(list, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return list, err
+}
+
+// dirPrefix returns the prefix of the keys in the directory name.
+func dirPrefix(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name + "/"
+}
+
+// prefixEnd returns the smallest key after every key starting with
+// prefix, which ends with a slash unless it is empty.
+func prefixEnd(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return prefix[:len(prefix)-1] + "0"
+}
+
+func base(name string) string {
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *fileInfo) Sys() any           { return nil }
+
+// file is an opened value. It also implements io.Seeker and io.ReaderAt,
+// which http.FileServer uses.
+type file struct {
+	*strings.Reader
+	info *fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Close() error               { return nil }
+
+// dir is an opened directory. Its entries are listed on the first
+// ReadDir call.
+type dir struct {
+	info    *fileInfo
+	fsys    *FS
+	name    string
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.entries(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		list := d.entries
+		d.entries = nil
+		return list, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	list := d.entries[:n]
+	d.entries = d.entries[n:]
+	return list, nil
+}
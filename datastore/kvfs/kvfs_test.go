@@ -0,0 +1,107 @@
+package kvfs_test
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/kvfs"
+)
+
+func openDB(t *testing.T, dir string, kv ...string) *datastore.DB {
+	t.Helper()
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(kv); i += 2 {
+		if err := db.Put(kv[i], kv[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestFS(t *testing.T) {
+	dir := "test_kvfs"
+	defer os.RemoveAll(dir)
+	db := openDB(t, dir,
+		"index.html", "<h1>{{.}}</h1>",
+		"static/css/site.css", "body{}",
+		"static/app.js", "run()",
+		"a", "file",
+		"a.txt", "text",
+		"a/b", "nested",
+		"/absolute", "invisible",
+	)
+	defer db.Close()
+	fsys := kvfs.New(db)
+
+	// Стандартна перевірка реалізації fs.FS
+	if err := fstest.TestFS(fsys, "index.html", "static/css/site.css", "static/app.js", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := fs.ReadFile(fsys, "static/app.js"); err != nil || string(b) != "run()" {
+		t.Fatalf("ReadFile = %q, %v", b, err)
+	}
+	if _, err := fsys.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Open(missing) err = %v", err)
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// Ключ "a" затуляє однойменний каталог
+	if got := strings.Join(names, ","); got != "a,a.txt,index.html,static" {
+		t.Fatalf("ReadDir(.) = %s", got)
+	}
+	if info, err := fs.Stat(fsys, "static/css"); err != nil || !info.IsDir() {
+		t.Fatalf("Stat(static/css) = %v, %v", info, err)
+	}
+}
+
+func TestFS_Consumers(t *testing.T) {
+	dir := "test_kvfs_consumers"
+	defer os.RemoveAll(dir)
+	db := openDB(t, dir, "templates/hello.html", "Hello, {{.}}!", "public/robots.txt", "User-agent: *")
+	defer db.Close()
+	fsys := kvfs.New(db)
+
+	tmpl, err := template.ParseFS(fsys, "templates/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tmpl.ExecuteTemplate(&out, "hello.html", "world"); err != nil || out.String() != "Hello, world!" {
+		t.Fatalf("template = %q, %v", out.String(), err)
+	}
+
+	public, err := fs.Sub(fsys, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.FileServer(http.FS(public)))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/robots.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "User-agent: *" {
+		t.Fatalf("GET robots.txt = %d %q", resp.StatusCode, body)
+	}
+}
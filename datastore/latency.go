@@ -0,0 +1,103 @@
+package datastore
+
+import (
+	"sync"
+	"time"
+)
+
+// Histogram buckets double from 1µs, so the last one covers ~67s and
+// above.
+const (
+	latencyBuckets    = 27
+	latencyBucketBase = time.Microsecond
+)
+
+// LatencySummary summarises a latency distribution. Percentiles are upper
+// bounds of the histogram bucket they fall into.
+type LatencySummary struct {
+	Count uint64
+	Sum   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+
+	// Buckets is the full histogram, for exporting it.
+	Buckets []LatencyBucket
+}
+
+// LatencyBucket counts the durations above the previous bucket's bound
+// and up to UpperBound. The last bucket has no bound and counts the rest.
+type LatencyBucket struct {
+	UpperBound time.Duration // Zero in the last bucket
+	Count      uint64
+}
+
+// latencyHistogram counts durations in exponential buckets.
+type latencyHistogram struct {
+	mu     sync.Mutex
+	counts [latencyBuckets]uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	b := 0
+	for limit := latencyBucketBase; d > limit && b < latencyBuckets-1; limit *= 2 {
+		b++
+	}
+	h.mu.Lock()
+	h.counts[b]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+	h.mu.Unlock()
+}
+
+// since observes the time elapsed since start, for use with defer.
+func (h *latencyHistogram) since(start time.Time) {
+	h.observe(time.Since(start))
+}
+
+func (h *latencyHistogram) summary() LatencySummary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := LatencySummary{Count: h.count, Sum: h.sum, Max: h.max}
+	s.Buckets = make([]LatencyBucket, latencyBuckets)
+	limit := latencyBucketBase
+	for b := range s.Buckets {
+		s.Buckets[b].Count = h.counts[b]
+		if b < latencyBuckets-1 {
+			s.Buckets[b].UpperBound = limit
+		}
+		limit *= 2
+	}
+	if h.count == 0 {
+		return s
+	}
+	s.Mean = h.sum / time.Duration(h.count)
+	s.P50 = h.quantile(0.50)
+	s.P90 = h.quantile(0.90)
+	s.P99 = h.quantile(0.99)
+	return s
+}
+
+// quantile returns the upper bound of the bucket holding quantile q, capped
+// at the largest observed value. The caller must hold h.mu.
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	rank := uint64(q*float64(h.count-1)) + 1
+	var seen uint64
+	limit := latencyBucketBase
+	for b := 0; b < latencyBuckets; b++ {
+		seen += h.counts[b]
+		if seen >= rank {
+			break
+		}
+		limit *= 2
+	}
+	return min(limit, h.max)
+}
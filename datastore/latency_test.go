@@ -0,0 +1,121 @@
+package datastore
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	for i := 0; i < 99; i++ {
+		h.observe(10 * time.Microsecond)
+	}
+	h.observe(time.Second)
+
+	s := h.summary()
+	if s.Count != 100 {
+		t.Errorf("expected 100 observations, got %d", s.Count)
+	}
+	// 10µs потрапляє в кошик до 16µs
+	if s.P50 != 16*time.Microsecond {
+		t.Errorf("expected p50 16µs, got %v", s.P50)
+	}
+	if s.P99 != 16*time.Microsecond {
+		t.Errorf("expected p99 16µs, got %v", s.P99)
+	}
+	if s.Max != time.Second {
+		t.Errorf("expected max 1s, got %v", s.Max)
+	}
+}
+
+func TestSyncLatency(t *testing.T) {
+	dir := "test_sync_latency"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "50")
+
+	var mu sync.Mutex
+	alerts := map[string]int{}
+	db, err := OpenWithOptions(dir, Options{
+		SlowSyncThreshold: time.Nanosecond,
+		OnSlowSync: func(source string, d time.Duration) {
+			mu.Lock()
+			alerts[source]++
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := db.Put("key", strings.Repeat("v", 40)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := db.Stats()
+	if st.WriterSyncLatency.Count == 0 {
+		t.Error("expected writer fsyncs to be recorded")
+	}
+	if st.CompactorSyncLatency.Count == 0 {
+		t.Error("expected compactor fsyncs to be recorded")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if alerts[SyncSourceWriter] == 0 || alerts[SyncSourceCompactor] == 0 {
+		t.Errorf("expected slow sync alerts from both sources, got %v", alerts)
+	}
+}
+
+func TestOperationLatency(t *testing.T) {
+	dir := "test_operation_latency"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "50")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := db.Put("key", strings.Repeat("v", 40)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := db.Stats()
+	if st.PutLatency.Count != 5 || st.QueueLatency.Count != 5 {
+		t.Errorf("expected 5 puts to be timed, got %d and %d", st.PutLatency.Count, st.QueueLatency.Count)
+	}
+	if st.GetLatency.Count != 1 || st.MergeLatency.Count != 1 {
+		t.Errorf("expected 1 get and 1 merge, got %d and %d", st.GetLatency.Count, st.MergeLatency.Count)
+	}
+	// Очікування в черзі не довше за весь запис
+	if st.QueueLatency.Sum > st.PutLatency.Sum {
+		t.Errorf("queue wait %v exceeds put latency %v", st.QueueLatency.Sum, st.PutLatency.Sum)
+	}
+	var n uint64
+	for _, b := range st.PutLatency.Buckets {
+		n += b.Count
+	}
+	if n != st.PutLatency.Count {
+		t.Errorf("buckets hold %d of %d puts", n, st.PutLatency.Count)
+	}
+}
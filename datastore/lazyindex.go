@@ -0,0 +1,339 @@
+package datastore
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultLazyShards    = 1024
+	defaultLazyHotShards = 64
+
+	lazyIndexDir = "index-shards"
+)
+
+// LazyIndexOptions configures IndexLazy.
+type LazyIndexOptions struct {
+	// Shards is the number of shards keys are spread over by hash. Zero
+	// means 1024.
+	Shards int
+	// HotShards is the number of shards kept in memory; the least recently
+	// used one is written to disk when another has to be loaded. Zero
+	// means 64.
+	HotShards int
+}
+
+// lazyIndex spreads keys over shards by hash and keeps only the recently
+// used shards in memory. Cold shards live in files under index-shards in
+// the DB directory, which are scratch space rebuilt by every Open: a
+// lookup in a cold shard loads it whole and spills the coldest hot one.
+// Positions moved by rebase while a shard is on disk are fixed up when it
+// is loaded, so rotation does not rewrite cold shards.
+//
+// Unlike the other keydirs it is safe for concurrent use, as get loads
+// shards under db.mu held for reading.
+type lazyIndex struct {
+	mu      sync.Mutex
+	fs      FS
+	dir     string
+	hash    HashFunc
+	hot     int
+	shards  []lazyShard
+	lru     *list.List // Numbers of the loaded shards, most recent first
+	count   int
+	onError func(error)
+
+	loads, spills uint64
+}
+
+type lazyShard struct {
+	keys    map[string]position // Nil while the shard is on disk
+	elem    *list.Element
+	n       int
+	dirty   bool // keys differ from the file
+	onDisk  bool
+	rebases [][2]int // Applied to the file's positions on load
+}
+
+func newLazyIndex(fsys FS, dir string, hash HashFunc, opts LazyIndexOptions, onError func(error)) (*lazyIndex, error) {
+	if hash == nil {
+		hash = HashXXH64
+	}
+	if opts.Shards <= 0 {
+		opts.Shards = defaultLazyShards
+	}
+	if opts.HotShards <= 0 {
+		opts.HotShards = defaultLazyHotShards
+	}
+	dir = filepath.Join(dir, lazyIndexDir)
+	// Shards left by a DB that was not closed are stale.
+	if err := fsys.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := fsys.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &lazyIndex{
+		fs:      fsys,
+		dir:     dir,
+		hash:    hash,
+		hot:     opts.HotShards,
+		shards:  make([]lazyShard, opts.Shards),
+		lru:     list.New(),
+		onError: onError,
+	}, nil
+}
+
+func (l *lazyIndex) get(key string) (position, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, err := l.shard(key)
+	if err != nil {
+		l.onError(err)
+		return position{}, false
+	}
+	pos, ok := s.keys[key]
+	return pos, ok
+}
+
+func (l *lazyIndex) put(key string, pos position) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, err := l.shard(key)
+	if err != nil {
+		l.onError(err)
+		return
+	}
+	if _, ok := s.keys[key]; !ok {
+		s.n++
+		l.count++
+	}
+	s.keys[key] = pos
+	s.dirty = true
+}
+
+func (l *lazyIndex) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, err := l.shard(key)
+	if err != nil {
+		l.onError(err)
+		return
+	}
+	if _, ok := s.keys[key]; ok {
+		delete(s.keys, key)
+		s.n--
+		l.count--
+		s.dirty = true
+	}
+}
+
+func (l *lazyIndex) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// ascend reads every cold shard without loading it, sorts the keys in
+// range and calls fn without holding l.mu.
+func (l *lazyIndex) ascend(start, end string, fn func(key string, pos position) bool) {
+	inRange := func(key string) bool { return key >= start && (end == "" || key < end) }
+	var items []btreeItem
+	l.mu.Lock()
+	for i := range l.shards {
+		s := &l.shards[i]
+		if s.keys != nil {
+			for key, pos := range s.keys {
+				if inRange(key) {
+					items = append(items, btreeItem{key: key, pos: pos})
+				}
+			}
+			continue
+		}
+		if !s.onDisk {
+			continue
+		}
+		err := l.readShard(i, func(key string, pos position) {
+			if inRange(key) {
+				items = append(items, btreeItem{key: key, pos: pos})
+			}
+		})
+		if err != nil {
+			l.onError(err)
+		}
+	}
+	l.mu.Unlock()
+
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+	for _, it := range items {
+		if !fn(it.key, it.pos) {
+			return
+		}
+	}
+}
+
+func (l *lazyIndex) rebase(from, to int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.shards {
+		s := &l.shards[i]
+		if s.keys == nil {
+			if s.onDisk {
+				s.rebases = append(s.rebases, [2]int{from, to})
+			}
+			continue
+		}
+		for key, pos := range s.keys {
+			if pos.segID == from {
+				pos.segID = to
+				s.keys[key] = pos
+				s.dirty = true
+			}
+		}
+	}
+}
+
+// counters returns how many shards were loaded from and spilled to disk.
+func (l *lazyIndex) counters() (loads, spills uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.loads, l.spills
+}
+
+// close removes the shard files.
+func (l *lazyIndex) close() error {
+	return l.fs.RemoveAll(l.dir)
+}
+
+// shard returns the loaded shard of key. The caller must hold l.mu.
+func (l *lazyIndex) shard(key string) (*lazyShard, error) {
+	i := int(l.hash(key) % uint64(len(l.shards)))
+	s := &l.shards[i]
+	if s.keys != nil {
+		l.lru.MoveToFront(s.elem)
+		return s, nil
+	}
+
+	keys := make(map[string]position, s.n)
+	if s.onDisk {
+		err := l.readShard(i, func(key string, pos position) { keys[key] = pos })
+		if err != nil {
+			return nil, err
+		}
+		l.loads++
+	}
+	s.keys, s.dirty = keys, len(s.rebases) > 0
+	s.rebases = nil
+	s.elem = l.lru.PushFront(i)
+
+	for l.lru.Len() > l.hot {
+		if err := l.spill(l.lru.Back().Value.(int)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// spill writes shard i to disk, unless the file is up to date, and drops
+// it from memory. The caller must hold l.mu.
+func (l *lazyIndex) spill(i int) error {
+	s := &l.shards[i]
+	path := l.shardPath(i)
+	switch {
+	case s.n == 0:
+		if s.onDisk {
+			if err := l.fs.Remove(path); err != nil {
+				return err
+			}
+		}
+		s.onDisk = false
+	case s.dirty || !s.onDisk:
+		if err := l.writeShard(path, s.keys); err != nil {
+			return err
+		}
+		s.onDisk = true
+		l.spills++
+	}
+	l.lru.Remove(s.elem)
+	s.keys, s.elem, s.dirty = nil, nil, false
+	return nil
+}
+
+func (l *lazyIndex) shardPath(i int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("shard-%d", i))
+}
+
+// writeShard writes keys as a sequence of key length, key, segment ID,
+// offset and size records.
+func (l *lazyIndex) writeShard(path string, keys map[string]position) error {
+	tmp := path + ".tmp"
+	f, err := l.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	rec := make([]byte, 0, 4+3*8)
+	for key, pos := range keys {
+		rec = binary.LittleEndian.AppendUint32(rec[:0], uint32(len(key)))
+		w.Write(rec)
+		w.WriteString(key)
+		rec = binary.LittleEndian.AppendUint64(rec[:0], uint64(pos.segID))
+		rec = binary.LittleEndian.AppendUint64(rec, uint64(pos.offset))
+		rec = binary.LittleEndian.AppendUint64(rec, uint64(pos.size))
+		w.Write(rec)
+	}
+	// Shards are rebuilt on every Open, so they are not synced.
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return l.fs.Rename(tmp, path)
+}
+
+// readShard calls fn for every key of the spilled shard i, with the
+// pending rebases applied. The caller must hold l.mu.
+func (l *lazyIndex) readShard(i int, fn func(key string, pos position)) error {
+	f, err := l.fs.Open(l.shardPath(i))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	hdr := make([]byte, 4)
+	rec := make([]byte, 3*8)
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("index shard %d: %w", i, err)
+		}
+		key := make([]byte, binary.LittleEndian.Uint32(hdr))
+		if _, err := io.ReadFull(r, key); err != nil {
+			return fmt.Errorf("index shard %d: %w", i, err)
+		}
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return fmt.Errorf("index shard %d: %w", i, err)
+		}
+		pos := position{
+			segID:  int(int64(binary.LittleEndian.Uint64(rec[0:8]))),
+			offset: int64(binary.LittleEndian.Uint64(rec[8:16])),
+			size:   int64(binary.LittleEndian.Uint64(rec[16:24])),
+		}
+		for _, rb := range l.shards[i].rebases {
+			if pos.segID == rb[0] {
+				pos.segID = rb[1]
+			}
+		}
+		fn(string(key), pos)
+	}
+}
@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLazyIndex(t *testing.T) {
+	dir := "test_lazy_index"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "2000")
+
+	opts := Options{IndexType: IndexLazy, LazyIndex: &LazyIndexOptions{Shards: 16, HotShards: 2}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		if err := db.Put("key"+strconv.Itoa(i), "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 300; i += 3 {
+		if err := db.Delete("key" + strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Ротації переносять позиції в шардах, що лежать на диску
+	if db.segmentCount() < 2 {
+		t.Fatalf("expected rotations, got %d segments", db.segmentCount())
+	}
+
+	check := func(db *DB) {
+		t.Helper()
+		for i := 0; i < 300; i++ {
+			v, err := db.Get("key" + strconv.Itoa(i))
+			if i%3 == 0 {
+				if err == nil {
+					t.Fatalf("deleted key%d = %q", i, v)
+				}
+				continue
+			}
+			if err != nil || v != "v"+strconv.Itoa(i) {
+				t.Fatalf("Get(key%d) = %q, %v", i, v, err)
+			}
+		}
+		if n := db.Count(); n != 200 {
+			t.Fatalf("Count = %d, want 200", n)
+		}
+		var prev string
+		n := 0
+		db.RangeScan("", "", func(k, v string) bool {
+			if k <= prev {
+				t.Fatalf("RangeScan out of order: %q after %q", k, prev)
+			}
+			prev = k
+			n++
+			return true
+		})
+		if n != 200 {
+			t.Fatalf("RangeScan returned %d keys", n)
+		}
+	}
+	check(db)
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	st := db.Stats()
+	if st.IndexShardLoads == 0 || st.IndexShardSpills == 0 {
+		t.Errorf("expected shard traffic, got %d loads, %d spills", st.IndexShardLoads, st.IndexShardSpills)
+	}
+	db.Close()
+	if _, err := os.Stat(filepath.Join(dir, lazyIndexDir)); !os.IsNotExist(err) {
+		t.Errorf("shard files left after Close: %v", err)
+	}
+
+	reopened, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	check(reopened)
+}
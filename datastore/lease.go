@@ -0,0 +1,271 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LeasePrefix is the prefix of the keys leases are kept under: a record
+// per lease, written with the lease TTL, and a key per key attached to it.
+const LeasePrefix = "\x00lease\x00"
+
+// leaseCheckInterval is how often expired leases are revoked.
+const leaseCheckInterval = time.Second
+
+// ErrLeaseNotFound is returned for a lease that expired or was revoked.
+var ErrLeaseNotFound = errors.New("lease not found")
+
+// LeaseID names a lease granted by Grant.
+type LeaseID uint64
+
+func leaseKey(id LeaseID) string {
+	return fmt.Sprintf("%s%016x", LeasePrefix, uint64(id))
+}
+
+// leaseMemberKey records that key was attached to the lease id.
+func leaseMemberKey(id LeaseID, key string) string {
+	return leaseKey(id) + "/" + key
+}
+
+// WithLease attaches the key to the lease id: it is deleted with the
+// lease, once the lease expires or is revoked, unless it has been written
+// since without the lease. Put fails with ErrLeaseNotFound if the lease
+// has already expired. Needs FormatV8 or newer.
+func WithLease(id LeaseID) PutOption {
+	return func(o *putOptions) { o.lease = id }
+}
+
+// Grant creates a lease that expires ttl from now unless KeepAlive renews
+// it. IDs are never reused.
+func (db *DB) Grant(ttl time.Duration) (LeaseID, error) {
+	if ttl <= 0 {
+		return 0, errors.New("lease TTL must be positive")
+	}
+	var id LeaseID
+	err := db.send(writeRequest{key: LeasePrefix, reserved: true, batch: func() ([]entry, error) {
+		// The record is the only entry, so it is stamped with the next
+		// sequence number.
+		id = LeaseID(db.seq.Load() + 1)
+		return []entry{{key: leaseKey(id), value: strconv.FormatInt(int64(ttl), 10), ttl: ttl}}, nil
+	}})
+	if err != nil {
+		return 0, err
+	}
+	db.setLeaseDeadline(id, db.now().Add(ttl).UnixNano())
+	return id, nil
+}
+
+// KeepAlive renews the lease id for the TTL it was granted with, which it
+// returns, counted from now. Holders call it well within the TTL.
+func (db *DB) KeepAlive(id LeaseID) (time.Duration, error) {
+	var ttl time.Duration
+	err := db.send(writeRequest{key: leaseKey(id), reserved: true, batch: func() ([]entry, error) {
+		e, alive, err := db.leaseRecordLocked(id)
+		if err != nil {
+			return nil, err
+		}
+		if !alive {
+			return nil, ErrLeaseNotFound
+		}
+		n, err := strconv.ParseInt(e.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("lease %d: bad TTL %q", id, e.value)
+		}
+		ttl = time.Duration(n)
+		return []entry{{key: e.key, value: e.value, ttl: ttl}}, nil
+	}})
+	if err != nil {
+		return 0, err
+	}
+	db.setLeaseDeadline(id, db.now().Add(ttl).UnixNano())
+	return ttl, nil
+}
+
+// Revoke ends the lease id at once, deleting the keys attached to it.
+func (db *DB) Revoke(id LeaseID) error {
+	_, err := db.endLease(id, false)
+	return err
+}
+
+// TimeToLive returns the time left before the lease id expires.
+func (db *DB) TimeToLive(id LeaseID) (time.Duration, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	e, alive, err := db.leaseRecordLocked(id)
+	if err != nil {
+		return 0, err
+	}
+	if !alive {
+		return 0, ErrLeaseNotFound
+	}
+	return time.Duration(db.expiresAt(e.ts, e.expires) - db.now().UnixNano()), nil
+}
+
+// leaseRecordLocked reads the record of the lease id and reports whether
+// the lease is alive. The caller must hold db.mu.
+func (db *DB) leaseRecordLocked(id LeaseID) (*entry, bool, error) {
+	key := leaseKey(id)
+	pos, ok := db.index.get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	e, err := db.readAt(pos)
+	if err != nil || e.key != key {
+		return nil, false, err
+	}
+	return &e, !db.expired(db.expiresAt(e.ts, e.expires)), nil
+}
+
+// putLeased writes a Put with WithLease: the value and the membership
+// key of the lease, in one batch. The batch may write the reserved
+// membership key, so key is checked on its own.
+func (db *DB) putLeased(key, value string, o *putOptions) error {
+	if Reserved(key) && !o.reserved {
+		return ErrReservedKey
+	}
+	return db.send(writeRequest{key: key, put: o, reserved: true, batch: func() ([]entry, error) {
+		if err := db.checkPut(key, o); err != nil {
+			return nil, err
+		}
+		if _, alive, err := db.leaseRecordLocked(o.lease); err != nil || !alive {
+			if err == nil {
+				err = ErrLeaseNotFound
+			}
+			return nil, err
+		}
+		if o.written != nil {
+			*o.written = db.seq.Load() + 1
+		}
+		return []entry{{key: key, value: value, ttl: o.ttl}, {key: leaseMemberKey(o.lease, key)}}, nil
+	}})
+}
+
+// endLease deletes the record of the lease id, its membership keys and
+// the keys still attached to it. With expiredOnly set it leaves a lease
+// that is still alive, returning false. The keys are those the lease
+// holds when the batch runs, so a key attached concurrently is either
+// deleted or fails to attach.
+func (db *DB) endLease(id LeaseID, expiredOnly bool) (bool, error) {
+	ended := false
+	err := db.send(writeRequest{key: leaseKey(id), reserved: true, batch: func() ([]entry, error) {
+		rec, alive, err := db.leaseRecordLocked(id)
+		if err != nil {
+			return nil, err
+		}
+		if alive && expiredOnly {
+			db.leases[id] = db.expiresAt(rec.ts, rec.expires)
+			return nil, errSkipWrite
+		}
+		if !alive && !expiredOnly {
+			return nil, ErrLeaseNotFound
+		}
+		ended = true
+		delete(db.leases, id)
+		return db.leaseTombstonesLocked(id)
+	}})
+	return ended, err
+}
+
+// leaseTombstonesLocked returns the deletes ending the lease id. A key is
+// still attached if its latest write is the one its membership key was
+// written right after. The caller must hold db.mu.
+func (db *DB) leaseTombstonesLocked(id LeaseID) ([]entry, error) {
+	record := leaseKey(id)
+	prefix := record + "/"
+	var members []string
+	db.index.ascend(prefix, prefixEnd(prefix), func(key string, _ position) bool {
+		members = append(members, key)
+		return true
+	})
+	dels := []entry{{key: record, kind: kindTombstone}}
+	for _, m := range members {
+		key := strings.TrimPrefix(m, prefix)
+		mseq, ok, err := db.versionLocked(m)
+		if err != nil {
+			return nil, err
+		}
+		seq, exists, err := db.versionLocked(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok && exists && seq+1 == mseq {
+			dels = append(dels, entry{key: key, kind: kindTombstone})
+		}
+		dels = append(dels, entry{key: m, kind: kindTombstone})
+	}
+	return dels, nil
+}
+
+// setLeaseDeadline records when the lease id expires, for leaseReaper.
+func (db *DB) setLeaseDeadline(id LeaseID, deadline int64) {
+	db.mu.Lock()
+	db.leases[id] = deadline
+	db.mu.Unlock()
+}
+
+// loadLeases fills db.leases from the lease records in the index. Open
+// calls it before the DB is shared.
+func (db *DB) loadLeases() error {
+	var ids []LeaseID
+	db.index.ascend(LeasePrefix, prefixEnd(LeasePrefix), func(key string, _ position) bool {
+		if id, err := strconv.ParseUint(strings.TrimPrefix(key, LeasePrefix), 16, 64); err == nil {
+			ids = append(ids, LeaseID(id))
+		}
+		return true
+	})
+	for _, id := range ids {
+		rec, _, err := db.leaseRecordLocked(id)
+		if err != nil {
+			return err
+		}
+		if rec != nil {
+			db.leases[id] = db.expiresAt(rec.ts, rec.expires)
+		}
+	}
+	return nil
+}
+
+// leaseReaper revokes the leases that expired, every leaseCheckInterval.
+func (db *DB) leaseReaper() {
+	defer db.wg.Done()
+	ticker := time.NewTicker(leaseCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			db.expireLeases()
+		case <-db.quit:
+			return
+		}
+	}
+}
+
+// expireLeases revokes the leases whose deadline has passed and returns
+// how many it did.
+func (db *DB) expireLeases() int {
+	now := db.now().UnixNano()
+	var due []LeaseID
+	db.mu.RLock()
+	for id, deadline := range db.leases {
+		if deadline <= now {
+			due = append(due, id)
+		}
+	}
+	db.mu.RUnlock()
+	n := 0
+	for _, id := range due {
+		ended, err := db.endLease(id, true)
+		if err != nil {
+			db.log(slog.LevelError, "revoking expired lease failed", "lease", id, "err", err)
+			continue
+		}
+		if ended {
+			n++
+		}
+	}
+	return n
+}
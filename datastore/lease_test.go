@@ -0,0 +1,170 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	dir := "test_lease"
+	defer os.RemoveAll(dir)
+
+	var now atomic.Int64
+	now.Store(time.Unix(1700000000, 0).UnixNano())
+	opts := Options{Clock: func() time.Time { return time.Unix(0, now.Load()) }}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	id, err := db.Grant(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"svc/a", "svc/b", "svc/c"} {
+		if err := db.Put(key, "addr", WithLease(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Перезаписаний без оренди ключ від неї відв'язується
+	if err := db.Put("svc/c", "static"); err != nil {
+		t.Fatal(err)
+	}
+
+	now.Add(int64(6 * time.Second))
+	if ttl, err := db.KeepAlive(id); err != nil || ttl != 10*time.Second {
+		t.Fatalf("KeepAlive = %v, %v", ttl, err)
+	}
+	now.Add(int64(6 * time.Second))
+	if n := db.expireLeases(); n != 0 {
+		t.Fatalf("expected the renewed lease to live, %d revoked", n)
+	}
+	if ttl, err := db.TimeToLive(id); err != nil || ttl != 4*time.Second {
+		t.Errorf("TimeToLive = %v, %v", ttl, err)
+	}
+
+	// Переживає перевідкриття
+	db.Close()
+	if db, err = OpenWithOptions(dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("svc/a"); err != nil || v != "addr" {
+		t.Fatalf("Get(svc/a) = %q, %v", v, err)
+	}
+
+	now.Add(int64(5 * time.Second))
+	if n := db.expireLeases(); n != 1 {
+		t.Fatalf("expected 1 lease revoked, got %d", n)
+	}
+	for _, key := range []string{"svc/a", "svc/b"} {
+		if _, err := db.Get(key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected %s deleted with its lease, got %v", key, err)
+		}
+	}
+	if v, err := db.Get("svc/c"); err != nil || v != "static" {
+		t.Errorf("Get(svc/c) = %q, %v", v, err)
+	}
+	if _, err := db.KeepAlive(id); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("expected ErrLeaseNotFound on KeepAlive, got %v", err)
+	}
+	if err := db.Put("svc/d", "addr", WithLease(id)); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("expected ErrLeaseNotFound on Put, got %v", err)
+	}
+	var keys []string
+	db.mu.RLock()
+	db.index.ascend(LeasePrefix, prefixEnd(LeasePrefix), func(key string, _ position) bool {
+		keys = append(keys, key)
+		return true
+	})
+	db.mu.RUnlock()
+	if len(keys) != 0 {
+		t.Errorf("expected no lease keys left, got %q", keys)
+	}
+}
+
+func TestLease_Revoke(t *testing.T) {
+	dir := "test_lease_revoke"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	id, err := db.Grant(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.Grant(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other <= id {
+		t.Errorf("expected lease IDs to grow, got %d after %d", other, id)
+	}
+	if err := db.Put("job/1", "w1", WithLease(id)); err != nil {
+		t.Fatal(err)
+	}
+	// Ключ переходить до іншої оренди
+	if err := db.Put("job/2", "w1", WithLease(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("job/2", "w2", WithLease(other)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Revoke(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("job/1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected job/1 deleted, got %v", err)
+	}
+	if v, err := db.Get("job/2"); err != nil || v != "w2" {
+		t.Errorf("Get(job/2) = %q, %v", v, err)
+	}
+	if err := db.Revoke(id); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("expected ErrLeaseNotFound, got %v", err)
+	}
+}
+
+func TestLease_RecordsReserved(t *testing.T) {
+	dir := "test_lease_reserved"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	id, err := db.Grant(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("svc/a", "addr", WithLease(id)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Запис оренди не можна видалити чи підмінити звичайним записом
+	if err := db.Delete(leaseKey(id)); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Delete: err = %v", err)
+	}
+	if err := db.Put(leaseMemberKey(id, "svc/b"), ""); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Put: err = %v", err)
+	}
+	if err := db.Put(leaseKey(id)+"/x", "", WithLease(id)); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Put with lease: err = %v", err)
+	}
+	if n := db.Count(); n != 1 {
+		t.Errorf("Count = %d, want only svc/a", n)
+	}
+	if err := db.Revoke(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("svc/a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected svc/a deleted with its lease, got %v", err)
+	}
+}
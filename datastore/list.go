@@ -0,0 +1,162 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// ErrNotList is returned by list operations on a key holding another value.
+var ErrNotList = errors.New("value is not a list")
+
+// Lists are stored as merge operands: RPush appends its elements without
+// reading the list, LPop records how many elements it took off the head,
+// and reads and merges fold them, see withBuiltins. A folded list is
+// listMagic followed by its elements, each prefixed with its length as a
+// uvarint; an operand is listOpMagic, an op byte and its argument.
+const (
+	listMagic   = "\x00list\x01"
+	listOpMagic = "\x00list\x02"
+
+	listOpPush = 'p' // Elements to append, encoded like a list
+	listOpPop  = 'd' // Number of elements to drop from the head, a uvarint
+)
+
+// RPush appends values to the tail of the list at key, creating it if
+// needed. It writes a single merge operand and does not read the list, so
+// pushes stay cheap however long the list grows.
+func (db *DB) RPush(key string, values ...string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	op := appendListElems(append([]byte(listOpMagic), listOpPush), values)
+	return db.write(key, string(op), kindMergeOperand)
+}
+
+// LPop removes and returns the head of the list at key. It returns
+// ErrNotFound if the list is empty or missing; popping the last element
+// deletes the key.
+func (db *DB) LPop(key string) (string, error) {
+	var head string
+	found := false
+	err := db.send(writeRequest{key: key, batch: func() ([]entry, error) {
+		v, exists, err := db.getLocked(key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errSkipWrite
+		}
+		elems, err := decodeList(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(elems) == 0 {
+			return nil, errSkipWrite
+		}
+		head, found = elems[0], true
+		if len(elems) == 1 {
+			return []entry{{key: key, kind: kindTombstone}}, nil
+		}
+		op := binary.AppendUvarint(append([]byte(listOpMagic), listOpPop), 1)
+		return []entry{{key: key, value: string(op), kind: kindMergeOperand}}, nil
+	}})
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", ErrNotFound
+	}
+	return head, nil
+}
+
+// LRange returns the elements of the list at key from start to stop, both
+// included. Negative indexes count from the tail, -1 being the last
+// element. A missing key reads as an empty list.
+func (db *DB) LRange(key string, start, stop int) ([]string, error) {
+	v, err := db.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	elems, err := decodeList(v)
+	if err != nil {
+		return nil, err
+	}
+	n := len(elems)
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return nil, nil
+	}
+	return elems[start : stop+1], nil
+}
+
+func foldList(existing string, exists bool, operands []string) (string, error) {
+	var elems []string
+	if exists {
+		var err error
+		if elems, err = decodeList(existing); err != nil {
+			return "", err
+		}
+	}
+	for _, op := range operands {
+		body, ok := strings.CutPrefix(op, listOpMagic)
+		if !ok || body == "" {
+			return "", ErrNotList
+		}
+		switch body[0] {
+		case listOpPush:
+			pushed, err := decodeListElems(body[1:])
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, pushed...)
+		case listOpPop:
+			n, size := binary.Uvarint([]byte(body[1:]))
+			if size <= 0 {
+				return "", ErrNotList
+			}
+			elems = elems[min(n, uint64(len(elems))):]
+		default:
+			return "", ErrNotList
+		}
+	}
+	return string(appendListElems([]byte(listMagic), elems)), nil
+}
+
+func decodeList(v string) ([]string, error) {
+	body, ok := strings.CutPrefix(v, listMagic)
+	if !ok {
+		return nil, ErrNotList
+	}
+	return decodeListElems(body)
+}
+
+func decodeListElems(data string) ([]string, error) {
+	var elems []string
+	for len(data) > 0 {
+		n, size := binary.Uvarint([]byte(data[:min(len(data), binary.MaxVarintLen64)]))
+		if size <= 0 || uint64(len(data)-size) < n {
+			return nil, ErrNotList
+		}
+		elems = append(elems, data[size:size+int(n)])
+		data = data[size+int(n):]
+	}
+	return elems, nil
+}
+
+func appendListElems(buf []byte, elems []string) []byte {
+	for _, e := range elems {
+		buf = binary.AppendUvarint(buf, uint64(len(e)))
+		buf = append(buf, e...)
+	}
+	return buf
+}
@@ -0,0 +1,111 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	dir := "test_list"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := db.RPush("jobs", fmt.Sprintf("job%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.RPush("jobs", "job10", "job11"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, 2, []string{"job0", "job1", "job2"}},
+		{-2, -1, []string{"job10", "job11"}},
+		{10, 100, []string{"job10", "job11"}},
+		{5, 4, nil},
+	} {
+		if got, err := db.LRange("jobs", tc.start, tc.stop); err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("LRange(%d, %d) = %v, %v", tc.start, tc.stop, got, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := db.LPop("jobs"); err != nil || v != fmt.Sprintf("job%d", i) {
+			t.Fatalf("LPop = %q, %v", v, err)
+		}
+	}
+
+	// Злиття згортає операнди списку без зареєстрованого оператора
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got, err := db.LRange("jobs", 0, -1); err != nil || len(got) != 9 || got[0] != "job3" {
+		t.Fatalf("LRange after reopen = %v, %v", got, err)
+	}
+	for i := 3; i < 12; i++ {
+		if _, err := db.LPop("jobs"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Останній LPop видаляє ключ
+	if _, err := db.Get("jobs"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected empty list to be deleted, got %v", err)
+	}
+	if _, err := db.LPop("jobs"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestList_WrongType(t *testing.T) {
+	dir := "test_list_wrong_type"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.RegisterMerge(func(key, existing string, exists bool, operands []string) (string, error) {
+		for _, op := range operands {
+			existing += op
+		}
+		return existing, nil
+	})
+
+	if err := db.Put("plain", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.LRange("plain", 0, -1); !errors.Is(err, ErrNotList) {
+		t.Errorf("LRange: expected ErrNotList, got %v", err)
+	}
+	if _, err := db.LPop("plain"); !errors.Is(err, ErrNotList) {
+		t.Errorf("LPop: expected ErrNotList, got %v", err)
+	}
+
+	// Зареєстрований оператор працює для інших ключів
+	if err := db.MergeValue("log", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MergeValue("log", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("log"); err != nil || v != "ab" {
+		t.Errorf("Get(log) = %q, %v", v, err)
+	}
+}
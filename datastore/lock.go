@@ -0,0 +1,73 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// LockPrefix is the prefix of the keys locks are kept under, so locking a
+// key leaves its value alone.
+const LockPrefix = "\x00lock\x00"
+
+// lockPollInterval is how often Lock retries a held lock.
+const lockPollInterval = 10 * time.Millisecond
+
+var (
+	// ErrLocked is returned by TryLock while someone else holds the lock.
+	ErrLocked = errors.New("lock is held")
+	// ErrNotLocked is returned by Unlock if the token no longer holds the
+	// lock: it expired, and may have been taken by someone else since.
+	ErrNotLocked = errors.New("lock not held")
+)
+
+// TryLock takes the lock named key for ttl if no one holds it, and fails
+// with ErrLocked otherwise. It returns a fencing token, greater than that
+// of every earlier holder of any lock of db: the resources a lock guards
+// can refuse requests carrying a token older than one they have seen, so
+// a holder whose lock expired midway cannot overwrite its successor.
+// Needs FormatV8 or newer.
+func (db *DB) TryLock(key string, ttl time.Duration) (uint64, error) {
+	if ttl <= 0 {
+		return 0, errors.New("lock TTL must be positive")
+	}
+	token, err := db.PutWithVersion(LockPrefix+key, "", IfAbsent(), WithTTL(ttl), reservedWrite())
+	if errors.Is(err, ErrKeyExists) {
+		return 0, ErrLocked
+	}
+	return token, err
+}
+
+// Lock is TryLock waiting for the lock to be released or to expire, until
+// ctx is done.
+func (db *DB) Lock(ctx context.Context, key string, ttl time.Duration) (uint64, error) {
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		token, err := db.TryLock(key, ttl)
+		if !errors.Is(err, ErrLocked) {
+			return token, err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// Unlock releases the lock named key if token, as returned by TryLock or
+// Lock, still holds it, and fails with ErrNotLocked otherwise.
+func (db *DB) Unlock(key string, token uint64) error {
+	lockKey := LockPrefix + key
+	return db.send(writeRequest{key: lockKey, reserved: true, batch: func() ([]entry, error) {
+		seq, held, err := db.versionLocked(lockKey)
+		if err != nil {
+			return nil, err
+		}
+		if !held || seq != token {
+			return nil, ErrNotLocked
+		}
+		return []entry{{key: lockKey, kind: kindTombstone}}, nil
+	}})
+}
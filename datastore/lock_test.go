@@ -0,0 +1,189 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	dir := "test_lock"
+	defer os.RemoveAll(dir)
+
+	var now atomic.Int64
+	now.Store(time.Unix(1700000000, 0).UnixNano())
+	db, err := OpenWithOptions(dir, Options{Clock: func() time.Time { return time.Unix(0, now.Load()) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("res", "value"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := db.TryLock("res", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.TryLock("res", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+	// Блокування не чіпає значення ключа
+	if v, err := db.Get("res"); err != nil || v != "value" {
+		t.Errorf("Get(res) = %q, %v", v, err)
+	}
+	if err := db.Unlock("res", token+1); !errors.Is(err, ErrNotLocked) {
+		t.Errorf("expected ErrNotLocked for a wrong token, got %v", err)
+	}
+	if err := db.Unlock("res", token); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unlock("res", token); !errors.Is(err, ErrNotLocked) {
+		t.Errorf("expected ErrNotLocked after unlock, got %v", err)
+	}
+
+	// Після закінчення TTL замок бере інший власник з більшим токеном
+	old, err := db.TryLock("res", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old <= token {
+		t.Errorf("expected token above %d, got %d", token, old)
+	}
+	now.Add(int64(2 * time.Second))
+	next, err := db.TryLock("res", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= old {
+		t.Errorf("expected token above %d, got %d", old, next)
+	}
+	if err := db.Unlock("res", old); !errors.Is(err, ErrNotLocked) {
+		t.Errorf("expected ErrNotLocked for an expired holder, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.Lock(ctx, "res", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestLock_Exclusive(t *testing.T) {
+	dir := "test_lock_exclusive"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var held atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				token, err := db.Lock(context.Background(), "res", time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if held.Add(1) != 1 {
+					t.Error("lock held twice")
+				}
+				held.Add(-1)
+				if err := db.Unlock("res", token); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLock_TokenSurvivesMerge(t *testing.T) {
+	dir := "test_lock_merge"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("res", "value"); err != nil {
+		t.Fatal(err)
+	}
+	rotate(t, db)
+	token, err := db.TryLock("res", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Unlock("res", token); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("res"); err != nil {
+		t.Fatal(err)
+	}
+	seq := db.CurrentSeq()
+	rotate(t, db)
+	// Злиття відкидає надгробки з найновішими номерами
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := db.CurrentSeq(); got < seq {
+		t.Errorf("CurrentSeq went back from %d to %d", seq, got)
+	}
+	next, err := db.TryLock("res", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= seq {
+		t.Errorf("token %d reused, latest write was %d", next, seq)
+	}
+}
+
+func TestLock_RecordsReserved(t *testing.T) {
+	dir := "test_lock_reserved"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	token, err := db.TryLock("res", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Чужий запис чи видалення не може зняти або підмінити замок
+	if err := db.Delete(LockPrefix + "res"); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Delete: err = %v", err)
+	}
+	if err := db.Put(LockPrefix+"res", "", WithTTL(time.Hour)); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Put: err = %v", err)
+	}
+	if _, err := db.TryLock("res", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+	if n := db.Count(); n != 0 {
+		t.Errorf("Count = %d, want the lock left out", n)
+	}
+	if err := db.Unlock("res", token); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,15 @@
+package datastore
+
+import (
+	"context"
+	"log/slog"
+)
+
+// log emits a structured record to Options.Logger, if one is set.
+func (db *DB) log(level slog.Level, msg string, args ...any) {
+	l := db.opts.Logger
+	if l == nil || !l.Enabled(context.Background(), level) {
+		return
+	}
+	l.Log(context.Background(), level, msg, args...)
+}
@@ -0,0 +1,105 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer захищає буфер від одночасного запису з фонових горутин
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) records(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var recs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func findRecord(recs []map[string]any, msg string) map[string]any {
+	for _, rec := range recs {
+		if rec["msg"] == msg {
+			return rec
+		}
+	}
+	return nil
+}
+
+func TestLogger(t *testing.T) {
+	dir := "test_logger"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%5), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	buf := &syncBuffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	db, err = OpenWithOptions(dir, Options{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", strings.Repeat("v", 200)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	recs := buf.records(t)
+	// Відновлення звітує про всі прочитані записи
+	rec := findRecord(recs, "recovery finished")
+	if rec == nil {
+		t.Fatalf("expected recovery record, got %v", recs)
+	}
+	if rec["entries"] != float64(20) || rec["keys"] != float64(5) {
+		t.Errorf("expected 20 entries and 5 keys, got %v", rec)
+	}
+	if findRecord(recs, "segment scanned") == nil {
+		t.Error("expected debug records for scanned segments")
+	}
+	if findRecord(recs, "segment rotated") == nil {
+		t.Error("expected rotation record")
+	}
+	if findRecord(recs, "merge started") == nil {
+		t.Error("expected merge start record")
+	}
+	rec = findRecord(recs, "merge finished")
+	if rec == nil {
+		t.Fatal("expected merge finish record")
+	}
+	if rec["reclaimed"].(float64) <= 0 {
+		t.Errorf("expected merge to reclaim bytes, got %v", rec)
+	}
+}
@@ -0,0 +1,270 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// manifestName records which segment files are the active ones, one per
+// stripe, the merges that are not finished, see mergeIntent, and the
+// latest sequence number, see manifest. Segments are written under their
+// final name from the start, so rotation never renames a file that is
+// open for appending: it points the manifest at a new file and the old one
+// is simply frozen.
+const manifestName = "MANIFEST"
+
+// segmentPath returns the path of the data file of segment id.
+func segmentPath(dir string, id int) string {
+	return filepath.Join(dir, fmt.Sprintf("segment-%d.data", id))
+}
+
+// mergeIntent records a merge whose inputs may still be on disk: its
+// output, written to tmp, takes the place of segments ids, oldest first,
+// under the ID of the newest. The merged segment may lack tombstones the
+// older inputs need, so Open finishes the merge, see finishMerges. It is
+// written to the manifest before the output is renamed into place and
+// left out once the older inputs are removed.
+type mergeIntent struct {
+	tmp  string
+	ids  []int
+	olds []*segment // Inputs to remove, nil for intents read back
+}
+
+// done tells whether the files of the inputs to remove are gone.
+func (in mergeIntent) done() bool {
+	for _, s := range in.olds {
+		if !s.removed.Load() {
+			return false
+		}
+	}
+	return true
+}
+
+// manifest is what the manifest file records. seq is the sequence number
+// of the latest write when it was written: merges may drop the entries
+// that carry the latest ones, and numbers must not be given out twice.
+type manifest struct {
+	actives []int
+	merges  []mergeIntent
+	seq     uint64
+}
+
+// readManifest returns the manifest recorded in dir, one without active
+// segments if there is no manifest yet.
+func readManifest(fsys FS, dir string) (manifest, error) {
+	var m manifest
+	f, err := fsys.Open(filepath.Join(dir, manifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return m, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "active" && m.actives == nil:
+			if m.actives, err = parseIDs(fields[1:]); err != nil {
+				return m, err
+			}
+		case len(fields) >= 4 && fields[0] == "merge":
+			ids, err := parseIDs(fields[2:])
+			if err != nil {
+				return m, err
+			}
+			m.merges = append(m.merges, mergeIntent{tmp: fields[1], ids: ids})
+		case len(fields) == 2 && fields[0] == "seq":
+			if m.seq, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+				return m, fmt.Errorf("manifest: bad sequence number %q", fields[1])
+			}
+		}
+	}
+	if m.actives == nil {
+		return m, errors.New("manifest: no active segment")
+	}
+	return m, nil
+}
+
+func parseIDs(fields []string) ([]int, error) {
+	ids := make([]int, 0, len(fields))
+	for _, f := range fields {
+		id, err := strconv.Atoi(f)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("manifest: bad segment %q", f)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// writeManifest records m. The manifest is written to a temporary file,
+// renamed into place and the directory synced.
+func writeManifest(fsys FS, dir string, m manifest) error {
+	path := filepath.Join(dir, manifestName)
+	tmp := path + ".tmp"
+	f, err := fsys.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer fsys.Remove(tmp)
+	var b strings.Builder
+	b.WriteString("active")
+	for _, id := range m.actives {
+		b.WriteString(" " + strconv.Itoa(id))
+	}
+	b.WriteString("\nseq " + strconv.FormatUint(m.seq, 10) + "\n")
+	for _, in := range m.merges {
+		b.WriteString("merge " + in.tmp)
+		for _, id := range in.ids {
+			b.WriteString(" " + strconv.Itoa(id))
+		}
+		b.WriteString("\n")
+	}
+	if _, err := io.WriteString(f, b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(fsys, dir)
+}
+
+// saveManifest records actives as the active segments, together with the
+// merges whose older inputs are not all removed yet. The caller must hold
+// db.mu.
+func (db *DB) saveManifest(actives []int) error {
+	n := len(db.merges)
+	db.merges = slices.DeleteFunc(db.merges, mergeIntent.done)
+	if len(db.merges) < n {
+		// The removals must not be lost once the intents are.
+		if err := syncDir(db.fs, db.dir); err != nil {
+			return err
+		}
+	}
+	return writeManifest(db.fs, db.dir, manifest{actives: actives, merges: db.merges, seq: db.seq.Load()})
+}
+
+// finishMerges completes the merges the manifest records as unfinished:
+// an output still under its temporary name is moved into place and the
+// older inputs are removed.
+func (db *DB) finishMerges() error {
+	m, err := readManifest(db.fs, db.dir)
+	if err != nil || len(m.merges) == 0 {
+		return err
+	}
+	for _, in := range m.merges {
+		merged := in.ids[len(in.ids)-1]
+		err := db.fs.Rename(filepath.Join(db.dir, in.tmp), segmentPath(db.dir, merged))
+		if err == nil {
+			db.log(slog.LevelWarn, "finished an interrupted merge", "segment", merged)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, id := range in.ids[:len(in.ids)-1] {
+			err := db.fs.Remove(segmentPath(db.dir, id))
+			if err == nil {
+				db.log(slog.LevelWarn, "removed a merged segment", "segment", id)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	if err := syncDir(db.fs, db.dir); err != nil {
+		return err
+	}
+	m.merges = nil
+	return writeManifest(db.fs, db.dir, m)
+}
+
+// loadManifest returns the IDs of the active segments, given the IDs of
+// the segment files in the directory and whether current-data is among
+// them. A store written before the manifest existed has its active
+// segment in current-data; it is renamed to the next free ID once, before
+// it is opened.
+func (db *DB) loadManifest(ids []int, legacy bool) ([]int, error) {
+	m, err := readManifest(db.fs, db.dir)
+	if err != nil {
+		return nil, err
+	}
+	// Recovery only raises it to what the segments still hold.
+	db.seq.Store(max(db.seq.Load(), m.seq))
+	actives := m.actives
+	if actives == nil {
+		id := 0
+		if len(ids) > 0 {
+			id = ids[len(ids)-1] + 1
+		}
+		actives = []int{id}
+		if err := db.saveManifest(actives); err != nil {
+			return nil, err
+		}
+	}
+	if !legacy {
+		return actives, nil
+	}
+	if len(actives) > 1 || slices.Contains(ids, actives[0]) {
+		return nil, fmt.Errorf("both %s and segment %d exist", activeName, actives[0])
+	}
+	db.log(slog.LevelInfo, "adopting legacy active segment", "segment", actives[0])
+	if err := db.fs.Rename(filepath.Join(db.dir, activeName), segmentPath(db.dir, actives[0])); err != nil {
+		return nil, err
+	}
+	return actives, nil
+}
+
+// nextActive points the manifest at a new active segment for st, with the
+// next free ID, and opens it. st itself is left as it is: should this
+// fail, the file st writes is still complete, and Open freezes it.
+func (db *DB) nextActive(st *stripe) (*segment, int, error) {
+	id := db.nextID
+	ids := db.activeIDs()
+	ids[st.n] = id
+	if err := db.saveManifest(ids); err != nil {
+		return nil, 0, err
+	}
+	db.nextID++
+	s, err := db.openActive(id, st)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.version = db.format
+	s.collected.complete = true
+	return s, id, nil
+}
+
+// openActive opens the data file of segment id as the active segment of
+// st, creating it if needed.
+func (db *DB) openActive(id int, st *stripe) (*segment, error) {
+	p := segmentPath(db.dir, id)
+	f, err := db.fs.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s, err := openSegment(f, st.segID(), p)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
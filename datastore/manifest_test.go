@@ -0,0 +1,125 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifest_Rotation(t *testing.T) {
+	dir := "test_manifest_rotation"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	rfs := &recordingFS{}
+	db, err := OpenWithOptions(dir, Options{FS: rfs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(db.segments) == 0 {
+		t.Fatal("no segment was frozen")
+	}
+	// Ротація не перейменовує файли сегментів, тільки маніфест
+	for _, op := range rfs.ops {
+		if strings.HasPrefix(op, "rename ") && !strings.HasSuffix(op, manifestName) {
+			t.Errorf("unexpected %s", op)
+		}
+	}
+	m, err := readManifest(OSFS{}, dir)
+	ids := m.actives
+	if err != nil || len(ids) != 1 || ids[0] != db.stripes[0].id {
+		t.Fatalf("manifest = %v, %v; active is %d", ids, err, db.stripes[0].id)
+	}
+	id := ids[0]
+	if db.stripes[0].active.path != segmentPath(dir, id) {
+		t.Fatalf("active path = %s", db.stripes[0].active.path)
+	}
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.stripes[0].id != id {
+		t.Fatalf("reopened active = %d, want %d", db.stripes[0].id, id)
+	}
+	for i := 0; i < 30; i++ {
+		if _, err := db.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatalf("key%d: %v", i, err)
+		}
+	}
+}
+
+func TestManifest_InterruptedRotation(t *testing.T) {
+	dir := "test_manifest_interrupted"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Збій після запису маніфесту, до створення нового файлу
+	if err := writeManifest(OSFS{}, dir, manifest{actives: []int{1}}); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if len(db.segments) != 1 || db.segments[0].id != 0 || db.stripes[0].id != 1 {
+		t.Fatalf("segments = %d, active = %d", len(db.segments), db.stripes[0].id)
+	}
+	if v, err := db.Get("k"); err != nil || v != "v" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+}
+
+func TestManifest_LegacyActive(t *testing.T) {
+	dir := "test_manifest_legacy"
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	frozen := entry{key: "old", value: "frozen"}
+	active := entry{key: "new", value: "active"}
+	if err := os.WriteFile(filepath.Join(dir, "segment-3.data"), frozen.Encode(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, activeName), active.Encode(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// current-data стає наступним за номером сегментом
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.segIdx(4) < 0 {
+		t.Fatalf("segment 4 is missing, active is %s", db.stripes[0].active.path)
+	}
+	if _, err := os.Stat(filepath.Join(dir, activeName)); !os.IsNotExist(err) {
+		t.Fatalf("%s still exists: %v", activeName, err)
+	}
+	for k, want := range map[string]string{"old": "frozen", "new": "active"} {
+		if v, err := db.Get(k); err != nil || v != want {
+			t.Fatalf("Get(%s) = %q, %v", k, v, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestOpenInMemory(t *testing.T) {
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := OpenInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%10), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(db.Segments()) < 2 {
+		t.Fatalf("expected rotation, got %d segments", len(db.Segments()))
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 40; i < 50; i++ {
+		v, err := db.Get(fmt.Sprintf("key%d", i%10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != fmt.Sprintf("value%d", i) {
+			t.Errorf("expected value%d, got %s", i, v)
+		}
+	}
+
+	// На диску нічого не повинно з'явитися
+	if _, err := os.Stat("mem"); !os.IsNotExist(err) {
+		t.Errorf("expected no directory on disk, got %v", err)
+	}
+}
+
+func TestMemFS_Reopen(t *testing.T) {
+	t.Setenv("SEG_MAX", "200")
+	mfs := NewMemFS()
+
+	db, err := OpenWithOptions("data", Options{FS: mfs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Той самий MemFS зберігає дані між відкриттями
+	db, err = OpenWithOptions("data", Options{FS: mfs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 30; i++ {
+		if _, err := db.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Errorf("key%d: %v", i, err)
+		}
+	}
+}
+
+func TestMemFS_Files(t *testing.T) {
+	mfs := NewMemFS()
+	if err := mfs.MkdirAll("a/b", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := mfs.Create("a/b/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Відкритий файл переживає перейменування
+	if err := mfs.Rename("a/b/f", "a/g"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := f.ReadAt(buf, 0); err != nil || string(buf) != "hello" {
+		t.Errorf("expected hello, got %q, %v", buf, err)
+	}
+	f.Close()
+
+	if _, err := mfs.Open("a/b/f"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+	ents, err := mfs.ReadDir("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 2 || ents[0].Name() != "b" || !ents[0].IsDir() || ents[1].Name() != "g" {
+		t.Errorf("unexpected entries %v", ents)
+	}
+	if err := mfs.RemoveAll("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mfs.ReadDir("a"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist, got %v", err)
+	}
+}
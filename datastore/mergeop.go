@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNoMergeOperator is returned when merge operands have to be folded but
+// no MergeFunc is registered.
+var ErrNoMergeOperator = errors.New("no merge operator registered")
+
+// MergeFunc folds operands, oldest first, into the existing value of key.
+// exists is false when the key has no value apart from the operands.
+type MergeFunc func(key, existing string, exists bool, operands []string) (string, error)
+
+// operandChain tracks the merge operands written since the last full value
+// of a key.
+type operandChain struct {
+	base    position
+	hasBase bool
+	ops     []position
+}
+
+// RegisterMerge sets the operator Get and compaction use to fold operands
+// written by MergeValue. It has to be registered again after every Open,
+// before operands are read or compacted.
+func (db *DB) RegisterMerge(fn MergeFunc) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.mergeFn = withBuiltins(fn)
+}
+
+// withBuiltins returns the merge operator that folds the operands of lists,
+// hashes, HyperLogLogs and bitmaps itself and hands any other to fn.
+func withBuiltins(fn MergeFunc) MergeFunc {
+	return func(key, existing string, exists bool, operands []string) (string, error) {
+		if len(operands) > 0 {
+			switch {
+			case strings.HasPrefix(operands[0], listOpMagic):
+				return foldList(existing, exists, operands)
+			case strings.HasPrefix(operands[0], hashOpMagic):
+				return foldHash(existing, exists, operands)
+			case strings.HasPrefix(operands[0], hllOpMagic):
+				return foldHLL(existing, exists, operands)
+			case strings.HasPrefix(operands[0], bitmapOpMagic):
+				return foldBitmap(existing, exists, operands)
+			}
+		}
+		if fn == nil {
+			return "", ErrNoMergeOperator
+		}
+		return fn(key, existing, exists, operands)
+	}
+}
+
+// MergeValue appends operand for key without reading the current value.
+// Get and compaction fold the operands into the value with the registered
+// MergeFunc, which makes read-modify-write patterns such as counters and
+// list appends race-free and cheap.
+func (db *DB) MergeValue(key, operand string) error {
+	return db.write(key, operand, kindMergeOperand)
+}
+
+// indexEntry records that the latest entry of key is at pos. The caller
+// must hold db.mu.
+func (db *DB) indexEntry(key string, kind entryKind, pos position) {
+	before := db.keyBytes(key)
+	defer func() { db.liveBytes += db.keyBytes(key) - before }()
+	db.supersede(key, kind, pos)
+	if kind == kindTombstone {
+		delete(db.operands, key)
+		db.index.remove(key)
+		return
+	}
+	if kind == kindMergeOperand {
+		chain := db.operands[key]
+		if chain == nil {
+			chain = &operandChain{}
+			if prev, ok := db.index.get(key); ok {
+				chain.base, chain.hasBase = prev, true
+			}
+			db.operands[key] = chain
+		}
+		chain.ops = append(chain.ops, pos)
+	} else {
+		delete(db.operands, key)
+	}
+	db.index.put(key, pos)
+}
+
+// keyBytes returns the size of the entries the value of key is read from.
+// The caller must hold db.mu.
+func (db *DB) keyBytes(key string) int64 {
+	if chain, ok := db.operands[key]; ok {
+		var n int64
+		if chain.hasBase {
+			n += chain.base.size
+		}
+		for _, p := range chain.ops {
+			n += p.size
+		}
+		return n
+	}
+	if pos, ok := db.index.get(key); ok {
+		return pos.size
+	}
+	return 0
+}
+
+// fold reads the base value and operands of chain and applies the merge
+// operator. An expired base counts as missing; while it has not expired
+// yet, expires is when it will, since the result changes then. The caller
+// must hold db.mu.
+func (db *DB) fold(key string, chain *operandChain) (v string, expires int64, err error) {
+	if db.mergeFn == nil {
+		return "", 0, ErrNoMergeOperator
+	}
+	var base string
+	exists := chain.hasBase
+	if exists {
+		e, err := db.readAt(chain.base)
+		if err != nil {
+			return "", 0, err
+		}
+		base, exists = e.value, e.key == key && !db.expired(db.expiresAt(e.ts, e.expires))
+		if exists {
+			expires = db.expiresAt(e.ts, e.expires)
+			if err := db.decodeEntryValue(&e); err != nil {
+				return "", 0, err
+			}
+			if base, err = db.derefLocked(e.value); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+	ops := make([]string, len(chain.ops))
+	for i, pos := range chain.ops {
+		e, err := db.readAt(pos)
+		if err != nil {
+			return "", 0, err
+		}
+		ops[i] = e.value
+	}
+	if !exists {
+		base = ""
+	}
+	v, err = db.mergeFn(key, base, exists, ops)
+	return v, expires, err
+}
+
+// readAt reads the entry at pos. The caller must hold db.mu.
+func (db *DB) readAt(pos position) (entry, error) {
+	s, err := db.segmentFor(pos)
+	if err != nil {
+		return entry{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readEntry(pos.offset)
+}
+
+// keyAt reads the key of the entry at pos. The caller must hold db.mu.
+func (db *DB) keyAt(pos position) (string, error) {
+	e, err := db.readAt(pos)
+	return e.key, err
+}
+
+// rebase moves positions in segment from to segment to.
+func (c *operandChain) rebase(from, to int) {
+	if c.hasBase && c.base.segID == from {
+		c.base.segID = to
+	}
+	for i := range c.ops {
+		if c.ops[i].segID == from {
+			c.ops[i].segID = to
+		}
+	}
+}
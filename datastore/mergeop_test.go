@@ -0,0 +1,148 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sumMerge додає числові операнди до наявного значення
+func sumMerge(key, existing string, exists bool, operands []string) (string, error) {
+	var total int64
+	if exists {
+		n, err := strconv.ParseInt(existing, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		total = n
+	}
+	for _, op := range operands {
+		n, err := strconv.ParseInt(op, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		total += n
+	}
+	return strconv.FormatInt(total, 10), nil
+}
+
+func TestMergeValue(t *testing.T) {
+	dir := "test_merge_value"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "60")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.RegisterMerge(sumMerge)
+
+	if err := db.Put("base", "10"); err != nil {
+		t.Fatal(err)
+	}
+	// Операнди розкидані по кількох сегментах
+	for i := 0; i < 10; i++ {
+		if err := db.MergeValue("counter", "1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.MergeValue("base", "2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(db *DB, key, expected string) {
+		t.Helper()
+		v, err := db.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != expected {
+			t.Errorf("%s: expected %s, got %s", key, expected, v)
+		}
+	}
+	check(db, "counter", "10")
+	check(db, "base", "30")
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db, "counter", "10")
+	check(db, "base", "30")
+
+	if err := db.MergeValue("counter", "5"); err != nil {
+		t.Fatal(err)
+	}
+	check(db, "counter", "15")
+
+	res, err := db.GetMulti([]string{"counter", "base"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["counter"] != "15" || res["base"] != "30" {
+		t.Errorf("unexpected GetMulti result %v", res)
+	}
+	db.Close()
+
+	// Після перевідкриття без оператора операнди не можна згорнути
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.Get("counter"); !errors.Is(err, ErrNoMergeOperator) {
+		t.Errorf("expected ErrNoMergeOperator, got %v", err)
+	}
+	reopened.RegisterMerge(sumMerge)
+	check(reopened, "counter", "15")
+
+	// Звичайний Put скидає операнди
+	if err := reopened.Put("counter", "0"); err != nil {
+		t.Fatal(err)
+	}
+	check(reopened, "counter", "0")
+}
+
+func TestMerge_DuplicatesWithinSegment(t *testing.T) {
+	dir := "test_merge_duplicates"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "100")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Обидва записи ключа потрапляють в один сегмент
+	for i := 0; i < 6; i++ {
+		if err := db.Put("key", fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(fmt.Sprintf("filler%d", i), strings.Repeat("f", 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := db.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "value5" {
+		t.Errorf("expected value5, got %s", v)
+	}
+}
+
+func TestEncodeEntry_KindNeedsFormatV2(t *testing.T) {
+	e := entry{key: "key", value: "1", kind: kindMergeOperand}
+	if _, err := encodeEntry(&e, FormatV1); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
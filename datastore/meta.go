@@ -0,0 +1,132 @@
+package datastore
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Meta describes the latest write of a key.
+type Meta struct {
+	// Seq is the sequence number of the write, zero for entries written
+	// before FormatV3. It serves as the version for PutIfVersion.
+	Seq uint64
+	// Modified is when the write was made, zero for entries written before
+	// FormatV6. For merged values both describe the newest operand.
+	Modified time.Time
+	// Size is the on-disk size of the entries the value is read from, as
+	// counted by LiveSize.
+	Size int64
+	// TTL is the time left before the key expires, zero if it never
+	// does. See WithTTL.
+	TTL time.Duration
+}
+
+// now returns the current time of Options.Clock.
+func (db *DB) now() time.Time {
+	if db.opts.Clock != nil {
+		return db.opts.Clock()
+	}
+	return time.Now()
+}
+
+// GetMeta returns the metadata of the latest write of key without folding
+// or copying its value.
+func (db *DB) GetMeta(key string) (Meta, error) {
+	bp := getEntryBuf()
+	defer putEntryBuf(bp)
+	_, m, err := db.lookupMeta(key, bp, false)
+	return m, err
+}
+
+// GetWithMeta returns the value of key together with the metadata of its
+// latest write, both read at the same point, so a caller can tell whether
+// a cached copy is still fresh.
+func (db *DB) GetWithMeta(key string) (string, Meta, error) {
+	db.gets.Add(1)
+	defer db.getLatency.since(time.Now())
+	if db.evictor != nil {
+		db.evictor.touch(key)
+	}
+
+	bp := getEntryBuf()
+	defer putEntryBuf(bp)
+	v, m, err := db.lookupMeta(key, bp, true)
+	if err != nil {
+		return "", Meta{}, err
+	}
+	return string(v), m, nil
+}
+
+// lookupMeta reads the latest entry of key into *buf. With fold set the
+// returned value is the current value of key, folded from merge operands
+// if it has them; otherwise it is the value of the latest entry only.
+func (db *DB) lookupMeta(key string, buf *[]byte, fold bool) ([]byte, Meta, error) {
+	db.mu.RLock()
+	pos, ok := db.index.get(key)
+	if !ok {
+		db.mu.RUnlock()
+		return nil, Meta{}, ErrNotFound
+	}
+	size := db.keyBytes(key)
+	var folded []byte
+	var expires int64
+	chain, chained := db.operands[key]
+	if chained && fold {
+		v, exp, err := db.fold(key, chain)
+		if err != nil {
+			db.mu.RUnlock()
+			return nil, Meta{}, err
+		}
+		folded, expires = []byte(v), exp
+	}
+	s, err := db.segmentFor(pos)
+	if err != nil {
+		db.mu.RUnlock()
+		return nil, Meta{}, err
+	}
+	s.ref()
+	defer db.unref(s)
+	s.mu.RLock()
+	db.mu.RUnlock()
+	e, err := s.readEntryInto(pos.offset, pos.size, buf)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, Meta{}, err
+	}
+	if string(e.key) != key {
+		// Fingerprint collision with another key
+		return nil, Meta{}, ErrNotFound
+	}
+	if !chained {
+		if db.expired(db.expiresAt(e.ts, e.expires)) {
+			return nil, Meta{}, ErrNotFound
+		}
+		expires = db.expiresAt(e.ts, e.expires)
+	}
+	m := Meta{Seq: e.seq, Modified: modTime(e.ts), Size: size}
+	if expires != 0 {
+		m.TTL = time.Duration(expires - db.now().UnixNano())
+	}
+	if folded != nil {
+		return folded, m, nil
+	}
+	v, err := db.decodeValue(e.value, e.encoded)
+	if err != nil {
+		return nil, Meta{}, fmt.Errorf("value of %q: %w", key, err)
+	}
+	if db.dedup != nil && bytes.HasPrefix(v, []byte(dedupRefMagic)) {
+		v, err := db.deref(string(v))
+		return []byte(v), m, err
+	}
+	return v, m, nil
+}
+
+// modTime converts an entry's write time, keeping zero for entries that
+// do not have one.
+func modTime(ts int64) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ts)
+}
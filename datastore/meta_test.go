@@ -0,0 +1,114 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetMeta(t *testing.T) {
+	dir := "test_get_meta"
+	defer os.RemoveAll(dir)
+
+	now := time.Unix(1700000000, 0)
+	opts := Options{Clock: func() time.Time { return now }}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("k", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if err := db.Put("k", "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Обидва записи однакового розміру
+	m, err := db.GetMeta("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Seq != 2 || !m.Modified.Equal(now) || m.Size != (db.stripes[0].active.size-segmentHeaderSize)/2 {
+		t.Fatalf("meta = %+v", m)
+	}
+	if _, err := db.GetMeta("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetMeta(missing) err = %v", err)
+	}
+	db.Delete("k")
+	if _, err := db.GetMeta("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetMeta(deleted) err = %v", err)
+	}
+
+	// Для злитого значення — мета останнього операнда
+	now = now.Add(time.Minute)
+	db.Put("c", "1")
+	now = now.Add(time.Minute)
+	db.MergeValue("c", "2")
+	if m, err := db.GetMeta("c"); err != nil || !m.Modified.Equal(now) {
+		t.Fatalf("GetMeta(c) = %+v, %v", m, err)
+	}
+	db.Close()
+
+	// Час запису переживає перевідкриття
+	reopened, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if m, err := reopened.GetMeta("c"); err != nil || !m.Modified.Equal(now) {
+		t.Fatalf("after reopen GetMeta(c) = %+v, %v", m, err)
+	}
+}
+
+func TestGetMeta_OldFormat(t *testing.T) {
+	dir := "test_get_meta_v5"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{FormatVersion: FormatV5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put("k", "v")
+	// Записи без часу дають нульовий Modified
+	if m, err := db.GetMeta("k"); err != nil || !m.Modified.IsZero() || m.Seq != 1 {
+		t.Fatalf("meta = %+v, %v", m, err)
+	}
+}
+
+func TestGetWithMeta(t *testing.T) {
+	dir := "test_get_with_meta"
+	defer os.RemoveAll(dir)
+
+	now := time.Unix(1700000000, 0)
+	db, err := OpenWithOptions(dir, Options{Clock: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.RegisterMerge(sumMerge)
+
+	db.Put("k", "v")
+	v, m, err := db.GetWithMeta("k")
+	if err != nil || v != "v" || m.Seq != 1 || !m.Modified.Equal(now) || m.TTL != 0 {
+		t.Fatalf("GetWithMeta = %q, %+v, %v", v, m, err)
+	}
+	if lm, _ := db.GetMeta("k"); lm != m {
+		t.Fatalf("GetMeta = %+v, want %+v", lm, m)
+	}
+
+	// Злите значення повертається згорнутим разом із метою останнього операнда
+	db.Put("c", "1")
+	now = now.Add(time.Second)
+	db.MergeValue("c", "2")
+	v, m, err = db.GetWithMeta("c")
+	if err != nil || v != "3" || m.Seq != 3 || !m.Modified.Equal(now) {
+		t.Fatalf("GetWithMeta(c) = %q, %+v, %v", v, m, err)
+	}
+
+	if _, _, err := db.GetWithMeta("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetWithMeta(missing) err = %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package datastore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"path/filepath"
+)
+
+// Migrate rewrites every segment in dir into the target format version.
+// Segments already in that version are left untouched. Each segment is
+// rewritten into a temporary file and renamed over the original, so an
+// interrupted migration leaves every segment readable in either its old or
+// its new version.
+//
+// Migrate works offline: dir must not be open by a DB while it runs.
+func Migrate(dir string, targetVersion uint16) error {
+	return MigrateFS(OSFS{}, dir, targetVersion)
+}
+
+// MigrateFS is Migrate for a directory of fsys.
+func MigrateFS(fsys FS, dir string, targetVersion uint16) error {
+	if _, err := specFor(targetVersion); err != nil {
+		return err
+	}
+
+	ents, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	removeCheckpointFile(fsys, dir)
+	for _, e := range ents {
+		if e.IsDir() || (e.Name() != activeName && !segRE.MatchString(e.Name())) {
+			continue
+		}
+		if err := migrateSegment(fsys, filepath.Join(dir, e.Name()), targetVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateSegment(fsys FS, path string, target uint16) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s, err := openSegment(f, 0, path)
+	if err != nil {
+		return err
+	}
+	if s.size == 0 || s.version == target {
+		return nil
+	}
+
+	tmp := path + ".migrate"
+	out, err := fsys.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer fsys.Remove(tmp)
+
+	if err := copySegment(s, out, target); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, path)
+}
+
+// copySegment writes every entry of s to dst in the target version.
+func copySegment(s *segment, dst io.Writer, target uint16) error {
+	w := bufio.NewWriter(dst)
+	if _, err := w.Write(segmentPreamble(target)); err != nil {
+		return err
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.file, s.dataStart, s.size-s.dataStart))
+	for {
+		var e entry
+		_, err := decodeEntry(&e, r, s.version)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		data, err := encodeEntry(&e, target)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
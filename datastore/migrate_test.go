@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	dir := "test_migrate"
+	defer os.RemoveAll(dir)
+
+	// Каталог зі старими сегментами без заголовка
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	for i := 0; i < 5; i++ {
+		e := entry{key: fmt.Sprintf("key%d", i), value: fmt.Sprintf("value%d", i)}
+		data = append(data, e.Encode()...)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "segment-0.data"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(dir, CurrentFormat); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := os.ReadFile(filepath.Join(dir, "segment-0.data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(migrated[:4]) != segmentMagic {
+		t.Fatalf("expected migrated segment to start with %q", segmentMagic)
+	}
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		v, err := db.Get(fmt.Sprintf("key%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != fmt.Sprintf("value%d", i) {
+			t.Errorf("expected value%d, got %s", i, v)
+		}
+	}
+}
+
+func TestMigrate_UnknownVersion(t *testing.T) {
+	dir := "test_migrate_unknown"
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(dir, CurrentFormat+1); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestOpen_FormatVersion(t *testing.T) {
+	dir := "test_open_format_version"
+	defer os.RemoveAll(dir)
+
+	if _, err := OpenWithOptions(dir, Options{FormatVersion: CurrentFormat + 1}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
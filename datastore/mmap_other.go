@@ -0,0 +1,18 @@
+//go:build !linux
+
+package datastore
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile fails on platforms other than Linux, so IndexDisk cannot be
+// used there.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errors.New("memory-mapped index files are only supported on Linux")
+}
+
+func munmap(b []byte) error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package datastore
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type pendingRead struct {
+	key string
+	pos position
+	// cache is set once the value is read if it may be cached.
+	cache bool
+}
+
+// GetMulti returns the values of all keys that exist; missing keys are left
+// out of the result. Positions are resolved under a single index lock and
+// reads are issued per segment in offset order. Every key counts as a Get
+// in Stats, and values read from disk are cached like Get caches them.
+func (db *DB) GetMulti(keys []string) (map[string]string, error) {
+	defer db.observeGets(len(keys), time.Now())
+	db.gets.Add(uint64(len(keys)))
+	if db.evictor != nil {
+		for _, key := range keys {
+			db.evictor.touch(key)
+		}
+	}
+	res := make(map[string]string, len(keys))
+	bySeg := make(map[*segment][]pendingRead)
+
+	var queued map[string]pendingWrite
+	for _, key := range keys {
+		if w, ok := db.pending.get(key); ok {
+			if queued == nil {
+				queued = make(map[string]pendingWrite)
+			}
+			queued[key] = w
+		}
+	}
+
+	db.mu.RLock()
+	for _, key := range keys {
+		if w, ok := queued[key]; ok {
+			if !w.deleted {
+				res[key] = w.value
+			}
+			continue
+		}
+		if db.cache != nil {
+			if v, ok := db.cache.get(key); ok {
+				res[key] = v
+				continue
+			}
+		}
+		pos, ok := db.index.get(key)
+		if !ok {
+			continue
+		}
+		if chain, ok := db.operands[key]; ok {
+			v, expires, err := db.fold(key, chain)
+			if err != nil {
+				db.mu.RUnlock()
+				return nil, err
+			}
+			if db.cache != nil && expires == 0 {
+				db.cache.add(key, v)
+			}
+			res[key] = v
+			continue
+		}
+		s, err := db.segmentFor(pos)
+		if err != nil {
+			db.mu.RUnlock()
+			return nil, err
+		}
+		bySeg[s] = append(bySeg[s], pendingRead{key: key, pos: pos})
+	}
+	// Pin the segments before letting writers and merge in.
+	for s := range bySeg {
+		s.ref()
+		s.mu.RLock()
+	}
+	db.mu.RUnlock()
+
+	var firstErr error
+	var refs []string
+	for s, reads := range bySeg {
+		if firstErr == nil {
+			refs, firstErr = db.readAll(s, reads, res, refs)
+		}
+		s.mu.RUnlock()
+		db.unref(s)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	// References are resolved once no segment is pinned any more.
+	for _, key := range refs {
+		if res[key], firstErr = db.deref(res[key]); firstErr != nil {
+			return nil, firstErr
+		}
+	}
+	if db.cache != nil {
+		// As in get, only values no write replaced meanwhile are cached.
+		db.mu.RLock()
+		for _, reads := range bySeg {
+			for _, r := range reads {
+				if cur, ok := db.index.get(r.key); r.cache && ok && cur == r.pos {
+					db.cache.add(r.key, res[r.key])
+				}
+			}
+		}
+		db.mu.RUnlock()
+	}
+	var misses uint64
+	for _, key := range keys {
+		if _, ok := res[key]; !ok {
+			misses++
+		}
+	}
+	db.misses.Add(misses)
+	return res, nil
+}
+
+// observeGets records n reads served together since start in the Get
+// latency, each taking an equal share of the time.
+func (db *DB) observeGets(n int, start time.Time) {
+	if n == 0 {
+		return
+	}
+	d := time.Since(start) / time.Duration(n)
+	for i := 0; i < n; i++ {
+		db.getLatency.observe(d)
+	}
+}
+
+// readAll reads reads from s into res, marking those that may be cached,
+// and appends the keys whose values are dedup references to refs. The
+// caller must hold s.mu.
+func (db *DB) readAll(s *segment, reads []pendingRead, res map[string]string, refs []string) ([]string, error) {
+	sort.Slice(reads, func(i, j int) bool { return reads[i].pos.offset < reads[j].pos.offset })
+	for i, r := range reads {
+		e, err := s.readEntry(r.pos.offset)
+		if err != nil {
+			return refs, err
+		}
+		if e.key == r.key && !db.expired(db.expiresAt(e.ts, e.expires)) {
+			if err := db.decodeEntryValue(&e); err != nil {
+				return refs, err
+			}
+			res[r.key] = e.value
+			reads[i].cache = db.expiresAt(e.ts, e.expires) == 0
+			if db.dedup != nil && strings.HasPrefix(e.value, dedupRefMagic) {
+				refs = append(refs, r.key)
+			}
+		}
+	}
+	return refs, nil
+}
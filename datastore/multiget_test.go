@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGetMulti(t *testing.T) {
+	dir := "test_get_multi"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "100")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Ключі розкидані по кількох сегментах
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat(fmt.Sprint(i%10), 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(db.segments) < 2 {
+		t.Fatalf("expected several segments, got %d", len(db.segments))
+	}
+
+	keys := []string{"key0", "key5", "key19", "missing"}
+	res, err := db.GetMulti(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Errorf("expected 3 values, got %d", len(res))
+	}
+	if _, ok := res["missing"]; ok {
+		t.Error("expected missing key to be absent")
+	}
+	for _, key := range keys[:3] {
+		expected, err := db.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res[key] != expected {
+			t.Errorf("key %s: expected %s, got %s", key, expected, res[key])
+		}
+	}
+}
+
+func TestGetMulti_CountsLikeGet(t *testing.T) {
+	dir := "test_get_multi_stats"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{CacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, key := range []string{"a", "b"} {
+		if err := db.Put(key, "value-"+key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := db.Stats()
+	if _, err := db.GetMulti([]string{"a", "b", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	st := db.Stats()
+	if st.Gets-before.Gets != 3 || st.Misses-before.Misses != 1 {
+		t.Errorf("gets +%d, misses +%d, want +3 and +1", st.Gets-before.Gets, st.Misses-before.Misses)
+	}
+	if n := st.GetLatency.Count - before.GetLatency.Count; n != 3 {
+		t.Errorf("GetLatency counted %d reads, want 3", n)
+	}
+
+	// Прочитані з диска значення потрапляють у кеш, як і після Get
+	for _, key := range []string{"a", "b"} {
+		if v, ok := db.cache.get(key); !ok || v != "value-"+key {
+			t.Errorf("cache has %s = %q, %v", key, v, ok)
+		}
+	}
+}
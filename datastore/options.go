@@ -0,0 +1,205 @@
+package datastore
+
+import (
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options configures a DB opened with OpenWithOptions. The zero value
+// gives the same behaviour as Open.
+type Options struct {
+	// CacheBytes is the byte budget of the in-process LRU value cache.
+	// Zero disables the cache.
+	CacheBytes int64
+
+	// IndexType selects the in-memory key index. IndexBTree keeps keys
+	// ordered, making RangeScan and ForEach cheap; the on-disk format is the
+	// same for both.
+	IndexType IndexType
+
+	// Hash computes the key fingerprints kept by IndexFingerprint, spreads
+	// keys over the shards of IndexLazy, places them in the tables of
+	// IndexCompact and IndexDisk and in the trie of IndexCOW. Nil means
+	// HashXXH64.
+	Hash HashFunc
+
+	// LazyIndex sizes the shards of IndexLazy. Nil means the defaults.
+	LazyIndex *LazyIndexOptions
+
+	// IndexStorage moves the keydir out of Go memory. Zero means
+	// IndexMemory.
+	IndexStorage IndexStorage
+
+	// Clock stamps the write time of new entries, see GetMeta. Nil means
+	// time.Now.
+	Clock func() time.Time
+
+	// MaxSegmentSize is the size at which active segments rotate, see
+	// SetMaxSegmentSize. Zero means DefaultMaxSegmentSize.
+	MaxSegmentSize int64
+
+	// SyncWrites fsyncs the active segment after every write, so a write
+	// that returned survives a crash. WithSync overrides it per Put.
+	SyncWrites bool
+
+	// FormatVersion is the on-disk format new segments are written in.
+	// Zero means CurrentFormat. Pinning an older version lets nodes that
+	// have not been upgraded yet keep reading the directory; use Migrate to
+	// rewrite existing segments.
+	FormatVersion uint16
+
+	// SlowSyncThreshold and OnSlowSync raise an alert for every fsync that
+	// takes longer than the threshold; source is SyncSourceWriter or
+	// SyncSourceCompactor. The callback runs synchronously while the DB
+	// holds internal locks, so it must not call back into the DB.
+	SlowSyncThreshold time.Duration
+	OnSlowSync        func(source string, d time.Duration)
+
+	// AutoTune enables the adaptive controller that adjusts segment size,
+	// compaction trigger and cache budget within the given bounds.
+	AutoTune *AutoTuneOptions
+
+	// ChangeRetention keeps merges from compacting segments frozen less
+	// than this long ago, so Changes and WatchFrom can replay every write
+	// of that window. Zero lets merges compact any frozen segment.
+	ChangeRetention time.Duration
+
+	// KeepVersions is the number of versions per key, the current one
+	// included, that compaction retains for GetHistory and GetAt. Zero or
+	// one keeps only the current value. Needs FormatV10 or newer.
+	KeepVersions int
+
+	// MaxAge makes every entry expire once it was written longer ago than
+	// this, even if it is the latest version of its key, like a TTL all
+	// writes get: it reads as missing and merges drop it, along with the
+	// versions kept for KeepVersions that are as old. A shorter TTL still
+	// applies. Zero keeps entries until they are overwritten. Needs FormatV6
+	// or newer.
+	MaxAge time.Duration
+
+	// WriteQueueSize is the number of writes queued for the writer before
+	// Backpressure applies. Zero means 100. The queue is sharded by key,
+	// one shard per CPU, and the writer takes all the shards hold at once
+	// and applies them together, with one fsync for those that ask for it.
+	WriteQueueSize int
+	Backpressure   Backpressure
+
+	// WriteStripes is the number of active segments written in parallel,
+	// each fed by its own queue and writer. Keys are hashed to a stripe,
+	// so the writes to a key keep their order; writes to different keys
+	// may be reported to watchers out of sequence order, and reads can see
+	// a write before its fsync finishes. An atomic write spanning stripes
+	// freezes the active segment of every stripe it touches, and the
+	// active segments of an earlier Open are frozen too. Checkpoint needs
+	// a single stripe. Zero or one means one active segment.
+	WriteStripes int
+
+	// Consistency selects when reads see writes queued by PutAsync. Zero
+	// means ConsistencyCommitted.
+	Consistency Consistency
+
+	// Hooks are called after commits and merges. Nil disables them.
+	Hooks *Hooks
+
+	// Audit records every committed write in an audit log, see WithActor.
+	// Nil disables it.
+	Audit *AuditOptions
+
+	// Logger receives structured records of recovery, rotation, merges,
+	// offloads and recoverable problems. Nil disables logging.
+	Logger *slog.Logger
+
+	// FS is the filesystem the DB keeps its files in. Nil means OSFS.
+	FS FS
+
+	// WriteBuffer buffers writes to the active segment in memory and
+	// writes them out in larger chunks, once the buffer fills up, its
+	// flush interval passes, the segment rotates or Flush is called.
+	// Buffered writes are readable but lost on a crash. Nil writes every
+	// entry straight through.
+	WriteBuffer *WriteBufferOptions
+
+	// Preallocate reserves disk space for a full active segment whenever
+	// one is created, with fallocate on Linux, which reduces
+	// fragmentation and makes a full disk fail Open or the write that
+	// rotates the segment instead of a write in the middle of it. The
+	// space a frozen segment did not use is released. It is a no-op on
+	// other platforms and on filesystems without file descriptors.
+	Preallocate bool
+
+	// Tier moves cold segments to an object store. Nil keeps every
+	// segment local.
+	Tier *TierOptions
+
+	// Governor budgets CPU and I/O of background work. Nil means
+	// unlimited.
+	Governor *GovernorOptions
+
+	// MergeWidth makes background merges partial: each compacts the
+	// MergeWidth adjacent segments with the smallest total size instead of
+	// every frozen segment. Zero merges them all.
+	MergeWidth int
+
+	// CompactionBytesPerSec caps the bytes merge reads and writes per
+	// second, on top of any Governor budget. Zero means unlimited.
+	CompactionBytesPerSec int64
+
+	// Scrub enables the background scrubber. Nil disables it; call Scrub
+	// instead.
+	Scrub *ScrubOptions
+
+	// MaxTotalBytes caps the total size of the segments, as reported by
+	// Size, so a runaway writer cannot fill the disk. Writes that would
+	// exceed it are handled as QuotaPolicy says; deletes are always
+	// accepted. Zero means unlimited.
+	MaxTotalBytes int64
+	QuotaPolicy   QuotaPolicy
+
+	// RecoveryProgress, if set, is called while Open rebuilds the index:
+	// after every segment and at most every 100ms within one, so
+	// applications can show startup progress of large directories. It
+	// runs on the opening goroutine.
+	RecoveryProgress func(RecoveryProgress)
+	// RecoveryMode decides whether Open fails on unreadable entries or
+	// skips them. Zero means RecoveryStrict.
+	RecoveryMode RecoveryMode
+
+	// Eviction makes the DB a persistent cache that deletes the coldest
+	// keys, read with Get or written, once their live size exceeds the
+	// budget, instead of failing writes. Evictions are ordinary deletes:
+	// hooks and watchers see them and merges reclaim the space. Needs
+	// FormatV4 or newer. Nil never evicts.
+	Eviction *EvictionOptions
+
+	// Dedup stores large values once per distinct content, with the keys
+	// holding them referencing it, and merges reclaim the content no key
+	// references any more. Hooks, reads and exports see the values as
+	// usual; Changes and WatchFrom replays see the references, and scans
+	// also visit the internal keys holding the content. Needs FormatV7 or
+	// newer and cannot be combined with KeepVersions or Eviction. Nil
+	// stores every value inline.
+	Dedup *DedupOptions
+
+	// Codecs compresses or encrypts values on disk, with codecs chosen by
+	// key prefix. Encoded values are marked as such and name their codecs,
+	// so changing the policies later leaves existing values readable as
+	// long as their codecs are still given. Needs FormatV9 or newer. Nil
+	// stores values as they are.
+	Codecs *CodecOptions
+
+	// TracerProvider, if set, records OpenTelemetry spans of reads, writes
+	// and merges: Get, GetContext, the writes of Put, Delete and the
+	// other write methods, and Merge, with the attributes named Attr*.
+	// Methods taking a context make their spans children of its span.
+	// Nil records none.
+	TracerProvider trace.TracerProvider
+
+	// Expvar publishes the puts, gets, misses, segment count, write queue
+	// depth and bytes written through package expvar, for environments
+	// without Prometheus; /debug/vars serves them once the program
+	// imports expvar's HTTP handler. Only one open DB may use a prefix.
+	// Nil publishes nothing.
+	Expvar *ExpvarOptions
+}
@@ -0,0 +1,236 @@
+// Package parquetexport writes the contents of a datastore.DB as Parquet
+// files so analytics systems can read them without a custom ETL step.
+package parquetexport
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	// jsonGroup is the column group holding expanded JSON fields.
+	jsonGroup = "json"
+	batchSize = 1024
+)
+
+// Options configures Export.
+type Options struct {
+	// ExpandJSON adds a "json.<field>" column for every top-level field of
+	// values that are JSON objects. Column types are inferred from the data:
+	// numbers become DOUBLE, booleans BOOLEAN and anything else a string
+	// holding the field's JSON text.
+	ExpandJSON bool
+}
+
+type fieldKind int
+
+const (
+	kindUnknown fieldKind = iota
+	kindNumber
+	kindBool
+	kindString
+)
+
+// Export writes every live key of db to w as a single Parquet file with
+// key, value, sequence and timestamp columns, the last two taken from
+// datastore.Meta. They are nullable and left empty for entries written in
+// formats that do not record them, before FormatV3 and FormatV6.
+//
+// With ExpandJSON the keyspace is read twice: once to infer the schema and
+// once to write rows. Fields that first appear between the passes are
+// dropped, and fields that no longer match the type of their column are
+// written as null.
+func Export(db *datastore.DB, w io.Writer, opts Options) error {
+	var fields map[string]fieldKind
+	if opts.ExpandJSON {
+		fields = make(map[string]fieldKind)
+		err := db.ForEach(func(_, value string) bool {
+			obj, ok := parseObject(value)
+			if !ok {
+				return true
+			}
+			for name, raw := range obj {
+				fields[name] = mergeKind(fields[name], kindOf(raw))
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	schema := newSchema(fields)
+	pw := parquet.NewWriter(w, schema)
+	b := &rowBuilder{schema: schema, fields: fields}
+
+	rows := make([]parquet.Row, 0, batchSize)
+	var err error
+	db.RangeKeys("", "", func(key string) bool {
+		value, meta, gerr := db.GetWithMeta(key)
+		if errors.Is(gerr, datastore.ErrNotFound) {
+			return true
+		}
+		if gerr != nil {
+			err = gerr
+			return false
+		}
+		rows = append(rows, b.build(key, value, meta))
+		if len(rows) == batchSize {
+			if _, err = pw.WriteRows(rows); err != nil {
+				return false
+			}
+			rows = rows[:0]
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		if _, err := pw.WriteRows(rows); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
+
+func newSchema(fields map[string]fieldKind) *parquet.Schema {
+	root := parquet.Group{
+		"key":       parquet.String(),
+		"value":     parquet.String(),
+		"sequence":  parquet.Optional(parquet.Int(64)),
+		"timestamp": parquet.Optional(parquet.Timestamp(parquet.Nanosecond)),
+	}
+	if len(fields) > 0 {
+		group := parquet.Group{}
+		for name, kind := range fields {
+			switch kind {
+			case kindNumber:
+				group[name] = parquet.Optional(parquet.Leaf(parquet.DoubleType))
+			case kindBool:
+				group[name] = parquet.Optional(parquet.Leaf(parquet.BooleanType))
+			default:
+				group[name] = parquet.Optional(parquet.String())
+			}
+		}
+		root[jsonGroup] = group
+	}
+	return parquet.NewSchema("datastore", root)
+}
+
+type rowBuilder struct {
+	schema *parquet.Schema
+	fields map[string]fieldKind
+}
+
+func (b *rowBuilder) build(key, value string, meta datastore.Meta) parquet.Row {
+	row := make(parquet.Row, 0, len(b.schema.Columns()))
+	row = append(row, b.value(parquet.ValueOf(key), "key"))
+	row = append(row, b.value(parquet.ValueOf(value), "value"))
+	if meta.Seq != 0 {
+		row = append(row, b.value(parquet.ValueOf(int64(meta.Seq)), "sequence"))
+	} else {
+		row = append(row, b.null("sequence"))
+	}
+	if !meta.Modified.IsZero() {
+		row = append(row, b.value(parquet.ValueOf(meta.Modified.UnixNano()), "timestamp"))
+	} else {
+		row = append(row, b.null("timestamp"))
+	}
+
+	if len(b.fields) > 0 {
+		obj, _ := parseObject(value)
+		names := make([]string, 0, len(b.fields))
+		for name := range b.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			raw, ok := obj[name]
+			if ok && string(raw) != "null" {
+				if v, match := fieldValue(b.fields[name], raw); match {
+					row = append(row, b.value(v, jsonGroup, name))
+					continue
+				}
+			}
+			row = append(row, b.null(jsonGroup, name))
+		}
+	}
+
+	sort.Slice(row, func(i, j int) bool { return row[i].Column() < row[j].Column() })
+	return row
+}
+
+// value places a non-null v in the column at path.
+func (b *rowBuilder) value(v parquet.Value, path ...string) parquet.Value {
+	leaf, _ := b.schema.Lookup(path...)
+	return v.Level(0, leaf.MaxDefinitionLevel, leaf.ColumnIndex)
+}
+
+// null places a null in the optional column at path.
+func (b *rowBuilder) null(path ...string) parquet.Value {
+	leaf, _ := b.schema.Lookup(path...)
+	return parquet.Value{}.Level(0, leaf.MaxDefinitionLevel-1, leaf.ColumnIndex)
+}
+
+func parseObject(value string) (map[string]json.RawMessage, bool) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &obj); err != nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+func kindOf(raw json.RawMessage) fieldKind {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return kindString
+	}
+	switch v.(type) {
+	case nil:
+		return kindUnknown
+	case float64:
+		return kindNumber
+	case bool:
+		return kindBool
+	default:
+		return kindString
+	}
+}
+
+// mergeKind widens the inferred type of a column; mixed types fall back to
+// strings.
+func mergeKind(a, b fieldKind) fieldKind {
+	switch {
+	case a == kindUnknown:
+		return b
+	case b == kindUnknown || a == b:
+		return a
+	default:
+		return kindString
+	}
+}
+
+// fieldValue converts raw for a column of kind, reporting false if it does
+// not fit a DOUBLE or BOOLEAN column.
+func fieldValue(kind fieldKind, raw json.RawMessage) (parquet.Value, bool) {
+	var v any
+	_ = json.Unmarshal(raw, &v)
+	switch kind {
+	case kindNumber:
+		f, ok := v.(float64)
+		return parquet.ValueOf(f), ok
+	case kindBool:
+		b, ok := v.(bool)
+		return parquet.ValueOf(b), ok
+	}
+	if s, ok := v.(string); ok {
+		return parquet.ValueOf(s), true
+	}
+	return parquet.ValueOf(string(raw)), true
+}
@@ -0,0 +1,122 @@
+package parquetexport
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestExport(t *testing.T) {
+	dir := "test_parquet_export"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	values := map[string]string{
+		"user1": `{"name":"Ann","age":30,"admin":true}`,
+		"user2": `{"name":"Bob","age":25.5}`,
+		"raw":   "not json",
+	}
+	for k, v := range values {
+		if err := db.Put(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Export(db, &buf, Options{ExpandJSON: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.NumRows() != 3 {
+		t.Fatalf("expected 3 rows, got %d", f.NumRows())
+	}
+
+	// Перевіряємо, що JSON-поля отримали правильні типи колонок
+	schema := f.Schema()
+	for path, kind := range map[string]parquet.Kind{
+		"age":   parquet.Double,
+		"admin": parquet.Boolean,
+		"name":  parquet.ByteArray,
+	} {
+		leaf, ok := schema.Lookup(jsonGroup, path)
+		if !ok {
+			t.Errorf("column json.%s missing", path)
+			continue
+		}
+		if leaf.Node.Type().Kind() != kind {
+			t.Errorf("column json.%s: expected %v, got %v", path, kind, leaf.Node.Type().Kind())
+		}
+	}
+
+	r := parquet.NewReader(bytes.NewReader(buf.Bytes()))
+	defer r.Close()
+	keyCol, _ := schema.Lookup("key")
+	nameCol, _ := schema.Lookup(jsonGroup, "name")
+	seqCol, _ := schema.Lookup("sequence")
+	tsCol, _ := schema.Lookup("timestamp")
+	rows := make([]parquet.Row, 3)
+	n, _ := r.ReadRows(rows)
+	if n != 3 {
+		t.Fatalf("expected to read 3 rows, got %d", n)
+	}
+	for _, row := range rows {
+		key := row[keyCol.ColumnIndex].String()
+		name := row[nameCol.ColumnIndex]
+		// Номер і час запису беруться з метаданих
+		meta, err := db.GetMeta(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq := row[seqCol.ColumnIndex]; seq.IsNull() || seq.Int64() != int64(meta.Seq) {
+			t.Errorf("%s: expected sequence %d, got %v", key, meta.Seq, seq)
+		}
+		if ts := row[tsCol.ColumnIndex]; ts.IsNull() || ts.Int64() != meta.Modified.UnixNano() {
+			t.Errorf("%s: expected timestamp %v, got %v", key, meta.Modified, ts)
+		}
+		switch key {
+		case "user1":
+			if name.String() != "Ann" {
+				t.Errorf("expected Ann for user1, got %s", name)
+			}
+		case "raw":
+			if !name.IsNull() {
+				t.Errorf("expected null name for raw, got %s", name)
+			}
+		}
+	}
+}
+
+func TestExport_MismatchedFieldIsNull(t *testing.T) {
+	// Значення переписане між проходами: колонка вже DOUBLE, а поле — рядок
+	fields := map[string]fieldKind{"age": kindNumber, "admin": kindBool}
+	b := &rowBuilder{schema: newSchema(fields), fields: fields}
+	row := b.build("user1", `{"age":"thirty","admin":1}`, datastore.Meta{})
+
+	for _, name := range []string{"age", "admin"} {
+		col, _ := b.schema.Lookup(jsonGroup, name)
+		if v := row[col.ColumnIndex]; !v.IsNull() {
+			t.Errorf("json.%s: expected null, got %v", name, v)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := parquet.NewWriter(&buf, b.schema)
+	if _, err := w.WriteRows([]parquet.Row{row}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,40 @@
+package datastore
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves disk blocks for the first size bytes of f without
+// changing its size, so appends up to size cannot fail with ENOSPC and
+// the file is laid out contiguously. Files not backed by a file
+// descriptor are skipped; filesystems without fallocate report an error.
+func preallocate(f File, size int64) error {
+	return withFd(f, func(fd int) error {
+		return unix.Fallocate(fd, unix.FALLOC_FL_KEEP_SIZE, 0, size)
+	})
+}
+
+// releasePreallocated frees the blocks reserved past the end of f.
+func releasePreallocated(f File, size int64) error {
+	return withFd(f, func(fd int) error {
+		return unix.Ftruncate(fd, size)
+	})
+}
+
+func withFd(f File, fn func(fd int) error) error {
+	sc, ok := f.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	conn, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var opErr error
+	if err := conn.Control(func(fd uintptr) { opErr = fn(int(fd)) }); err != nil {
+		return err
+	}
+	return opErr
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package datastore
+
+// preallocate is a no-op on platforms without fallocate.
+func preallocate(f File, size int64) error { return nil }
+
+func releasePreallocated(f File, size int64) error { return nil }
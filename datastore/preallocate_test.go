@@ -0,0 +1,64 @@
+//go:build linux
+
+package datastore
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func allocatedBytes(t *testing.T, path string) (size, allocated int64) {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	return fi.Size(), st.Blocks * 512
+}
+
+func TestPreallocate(t *testing.T) {
+	dir := "test_preallocate"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{Preallocate: true, MaxSegmentSize: 1 << 20})
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		t.Skip("filesystem does not support fallocate")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Розмір файлу не змінюється, але місце під увесь сегмент зарезервоване
+	size, allocated := allocatedBytes(t, db.stripes[0].active.path)
+	if size != db.stripes[0].active.size {
+		t.Fatalf("file size %d, segment size %d", size, db.stripes[0].active.size)
+	}
+	if allocated < 1<<20 {
+		t.Fatalf("only %d bytes allocated", allocated)
+	}
+
+	value := string(make([]byte, 64<<10))
+	for db.segmentCount() == 0 {
+		if err := db.Put("big", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Заморожений сегмент звільняє невикористаний хвіст
+	frozen := db.segments[0]
+	size, allocated = allocatedBytes(t, frozen.path)
+	if allocated > size+64<<10 {
+		t.Errorf("frozen segment of %d bytes keeps %d allocated", size, allocated)
+	}
+	if _, allocated := allocatedBytes(t, db.stripes[0].active.path); allocated < 1<<20 {
+		t.Errorf("new active segment has only %d bytes allocated", allocated)
+	}
+}
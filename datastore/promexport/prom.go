@@ -0,0 +1,94 @@
+// Package promexport serves the counters and latency histograms of a
+// datastore.DB in the Prometheus text exposition format, so they can be
+// scraped without linking a Prometheus client library.
+package promexport
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// Handler serves the metrics of db, e.g. under /metrics. Every metric name
+// starts with namespace followed by an underscore; an empty namespace
+// means "datastore".
+func Handler(db *datastore.DB, namespace string) http.Handler {
+	if namespace == "" {
+		namespace = "datastore"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		write(bw, namespace, db.Stats())
+		bw.Flush()
+	})
+}
+
+func write(w *bufio.Writer, ns string, st datastore.Stats) {
+	counter(w, ns+"_puts_total", "Writes committed.", st.Puts)
+	counter(w, ns+"_gets_total", "Get calls.", st.Gets)
+	counter(w, ns+"_misses_total", "Get calls that found no key.", st.Misses)
+	counter(w, ns+"_written_bytes_total", "Bytes appended to segments.", st.BytesWritten)
+	counter(w, ns+"_writes_rejected_total", "Writes refused because the write queue was full.", st.WritesRejected)
+	gauge(w, ns+"_write_queue_depth", "Writes waiting for the writer.", float64(st.WriteQueueDepth))
+
+	histogram(w, ns+"_put_latency_seconds", "Write latency from enqueueing to acknowledgement.", "", st.PutLatency)
+	histogram(w, ns+"_queue_latency_seconds", "Time writes wait for the writer.", "", st.QueueLatency)
+	histogram(w, ns+"_get_latency_seconds", "Get latency.", "", st.GetLatency)
+	histogram(w, ns+"_merge_duration_seconds", "Merge duration.", "", st.MergeLatency)
+
+	name := ns + "_fsync_latency_seconds"
+	header(w, name, "Fsync latency by source.", "histogram")
+	samples(w, name, `source="writer",`, st.WriterSyncLatency)
+	samples(w, name, `source="compactor",`, st.CompactorSyncLatency)
+}
+
+func header(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func counter(w *bufio.Writer, name, help string, v uint64) {
+	header(w, name, help, "counter")
+	fmt.Fprintf(w, "%s %d\n", name, v)
+}
+
+func gauge(w *bufio.Writer, name, help string, v float64) {
+	header(w, name, help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+}
+
+func histogram(w *bufio.Writer, name, help, labels string, s datastore.LatencySummary) {
+	header(w, name, help, "histogram")
+	samples(w, name, labels, s)
+}
+
+// samples writes the series of one histogram. labels is empty or a list of
+// label pairs, each followed by a comma.
+func samples(w *bufio.Writer, name, labels string, s datastore.LatencySummary) {
+	var cumulative uint64
+	for _, b := range s.Buckets {
+		cumulative += b.Count
+		if b.UpperBound == 0 {
+			break
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, seconds(b.UpperBound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, s.Count)
+	if labels != "" {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, seconds(s.Sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, s.Count)
+}
+
+func seconds(d time.Duration) string {
+	return formatFloat(d.Seconds())
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
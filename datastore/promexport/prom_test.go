@@ -0,0 +1,57 @@
+package promexport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestHandler(t *testing.T) {
+	dir := "test_promexport"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(db, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE datastore_put_latency_seconds histogram\n",
+		"datastore_puts_total 1\n",
+		"datastore_put_latency_seconds_bucket{le=\"+Inf\"} 1\n",
+		"datastore_put_latency_seconds_count 1\n",
+		"datastore_get_latency_seconds_count 1\n",
+		"datastore_merge_duration_seconds_count 0\n",
+		"datastore_fsync_latency_seconds_count{source=\"writer\"} 0\n",
+		"datastore_get_latency_seconds_bucket{le=\"1e-06\"} ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+
+	// Кошики накопичувальні і закінчуються загальною кількістю
+	var last string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "datastore_put_latency_seconds_bucket") {
+			last = line
+		}
+	}
+	if !strings.HasSuffix(last, "} 1") {
+		t.Errorf("unexpected last bucket %q", last)
+	}
+}
@@ -0,0 +1,155 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConflict is returned by PutIfVersion and Put with IfVersion when the
+// key has been written since the given version was read.
+var ErrConflict = errors.New("version conflict")
+
+// PutOption configures a single Put.
+type PutOption func(*putOptions)
+
+type putOptions struct {
+	ttl      time.Duration
+	sync     bool
+	ifAbsent bool
+	lease    LeaseID
+	// version is checked only if hasVersion is set; zero stands for an
+	// absent key.
+	version    uint64
+	hasVersion bool
+	// written, if set, receives the version of the write.
+	written *uint64
+	// reserved lets the write reach a reserved key.
+	reserved bool
+}
+
+// WithTTL makes the value expire d after it is written. Expired keys read
+// as missing and are dropped by the next merge of their segment; until
+// then they still count in Count and LiveSize. Zero or negative d means no
+// expiry. Needs FormatV8 or newer.
+func WithTTL(d time.Duration) PutOption {
+	return func(o *putOptions) { o.ttl = d }
+}
+
+// WithSync overrides Options.SyncWrites for this write: with sync set Put
+// returns only once the entry has been fsynced, without it the entry may
+// be lost on a crash.
+func WithSync(sync bool) PutOption {
+	return func(o *putOptions) { o.sync = sync }
+}
+
+// IfAbsent makes Put fail with ErrKeyExists if the key has a value.
+func IfAbsent() PutOption {
+	return func(o *putOptions) { o.ifAbsent = true }
+}
+
+// IfVersion makes Put fail with ErrConflict unless the latest write of the
+// key has the given sequence number, as reported by GetMeta. Zero expects
+// the key to be absent.
+func IfVersion(seq uint64) PutOption {
+	return func(o *putOptions) { o.version, o.hasVersion = seq, true }
+}
+
+// PutWithVersion is Put returning the version of the write, the sequence
+// number GetMeta and GetWithMeta report as Meta.Seq.
+func (db *DB) PutWithVersion(key, value string, opts ...PutOption) (uint64, error) {
+	var version uint64
+	opts = append(opts[:len(opts):len(opts)], func(o *putOptions) { o.written = &version })
+	if err := db.Put(key, value, opts...); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// PutIfVersion stores value under key only if the key has not been written
+// since it was read at version, and returns the new version. It fails with
+// ErrConflict otherwise, which lets a caller retry a read-modify-write
+// without holding a lock in between. Version zero expects the key to be
+// absent. Needs FormatV3 or newer.
+func (db *DB) PutIfVersion(key, value string, version uint64) (uint64, error) {
+	return db.PutWithVersion(key, value, IfVersion(version))
+}
+
+// checkPut checks the preconditions of a Put of key. The caller must hold
+// db.mu.
+func (db *DB) checkPut(key string, o *putOptions) error {
+	if !o.ifAbsent && !o.hasVersion {
+		return nil
+	}
+	if o.hasVersion && !formatSpecs[db.format].seq {
+		return fmt.Errorf("%w: versions need format %d or newer", ErrUnsupportedFormat, FormatV3)
+	}
+	seq, exists, err := db.versionLocked(key)
+	if err != nil {
+		return err
+	}
+	if o.ifAbsent && exists {
+		return ErrKeyExists
+	}
+	if o.hasVersion && seq != o.version {
+		return ErrConflict
+	}
+	return nil
+}
+
+// versionLocked returns the sequence number of the latest write of key,
+// zero if the key is absent. The caller must hold db.mu.
+func (db *DB) versionLocked(key string) (uint64, bool, error) {
+	pos, ok := db.index.get(key)
+	if !ok {
+		return 0, false, nil
+	}
+	e, err := db.readAt(pos)
+	if err != nil || e.key != key {
+		return 0, false, err
+	}
+	if _, chained := db.operands[key]; !chained && db.expired(db.expiresAt(e.ts, e.expires)) {
+		return 0, false, nil
+	}
+	return e.seq, true, nil
+}
+
+// syncWrite returns the results of apply after req wrote written to the
+// active segment of st, which is to be fsynced if Options.SyncWrites or the
+// options of a Put ask for it. The caller must hold db.mu.
+func (db *DB) syncWrite(req writeRequest, st *stripe, written []entry) ([]entry, *segment, error) {
+	sync := db.syncWrites.Load()
+	if req.put != nil {
+		sync = req.put.sync
+	}
+	if !sync {
+		return written, nil, nil
+	}
+	if err := db.flushActive(st); err != nil {
+		return nil, nil, err
+	}
+	return written, st.active, nil
+}
+
+// expired reports whether an entry with the given expiry time has expired.
+func (db *DB) expired(expires int64) bool {
+	return expires != 0 && expires <= db.now().UnixNano()
+}
+
+// expiresAt returns the expiry time of an entry written at ts, given the
+// one it was written with, under Options.MaxAge.
+func (db *DB) expiresAt(ts, expires int64) int64 {
+	return agedExpiry(ts, expires, db.opts.MaxAge)
+}
+
+// agedExpiry returns the earlier of expires and the time an entry written
+// at ts becomes older than maxAge, zero if neither applies.
+func agedExpiry(ts, expires int64, maxAge time.Duration) int64 {
+	if maxAge <= 0 || ts == 0 {
+		return expires
+	}
+	if aged := ts + int64(maxAge); expires == 0 || aged < expires {
+		return aged
+	}
+	return expires
+}
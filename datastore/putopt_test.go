@@ -0,0 +1,311 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPut_WithTTL(t *testing.T) {
+	dir := "test_put_ttl"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "100")
+
+	var now atomic.Int64
+	now.Store(time.Unix(1700000000, 0).UnixNano())
+	opts := Options{CacheBytes: 1 << 20, Clock: func() time.Time { return time.Unix(0, now.Load()) }}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("session", "token", WithTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("user", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("session"); err != nil || v != "token" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	m, err := db.GetMeta("session")
+	if err != nil || m.TTL != time.Minute {
+		t.Fatalf("meta = %+v, %v", m, err)
+	}
+
+	// Після закінчення TTL ключ зникає, навіть якщо раніше був у кеші
+	now.Add(int64(time.Minute))
+	if _, err := db.Get("session"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(expired) err = %v", err)
+	}
+	if _, err := db.GetMeta("session"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetMeta(expired) err = %v", err)
+	}
+	if res, err := db.GetMulti([]string{"session", "user"}); err != nil || len(res) != 1 {
+		t.Fatalf("GetMulti = %v, %v", res, err)
+	}
+	if stored, err := db.SetNX("session", "new"); err != nil || !stored {
+		t.Fatalf("SetNX(expired) = %v, %v", stored, err)
+	}
+	if v, err := db.Get("session"); err != nil || v != "new" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+
+	// Злиття прибирає прострочені ключі з індексу
+	if err := db.Put("tmp", "x", WithTTL(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.Put(k, "filler"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now.Add(int64(time.Second))
+	before := db.Count()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Count(); n != before-1 {
+		t.Fatalf("Count = %d after merge, want %d", n, before-1)
+	}
+	if _, err := db.Get("tmp"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(tmp) err = %v", err)
+	}
+}
+
+func TestPut_MaxAge(t *testing.T) {
+	dir := "test_put_max_age"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "100")
+
+	var now atomic.Int64
+	now.Store(time.Unix(1700000000, 0).UnixNano())
+	opts := Options{
+		CacheBytes:   1 << 20,
+		KeepVersions: 3,
+		MaxAge:       time.Hour,
+		Clock:        func() time.Time { return time.Unix(0, now.Load()) },
+	}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"old", "hist"} {
+		if err := db.Put(k, "v1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Get("old"); err != nil {
+		t.Fatal(err)
+	}
+	now.Add(int64(40 * time.Minute))
+	if err := db.Put("hist", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("ttl", "x", WithTTL(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Старші за MaxAge записи зникають, навіть останні версії ключа
+	now.Add(int64(30 * time.Minute))
+	if _, err := db.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(old) err = %v", err)
+	}
+	if _, err := db.Get("ttl"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(ttl) err = %v", err)
+	}
+	m, err := db.GetMeta("hist")
+	if err != nil || m.TTL != 30*time.Minute {
+		t.Fatalf("meta = %+v, %v", m, err)
+	}
+
+	// Злиття прибирає їх разом зі старими версіями
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.Put(k, "filler"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := db.Count()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Count(); n != before-2 {
+		t.Fatalf("Count = %d after merge, want %d", n, before-2)
+	}
+	if h, err := db.GetHistory("hist"); err != nil || len(h) != 1 || h[0].Value != "v2" {
+		t.Fatalf("GetHistory = %+v, %v", h, err)
+	}
+}
+
+func TestPut_MaxAgeNeedsFormatV6(t *testing.T) {
+	dir := "test_put_max_age_v5"
+	defer os.RemoveAll(dir)
+
+	_, err := OpenWithOptions(dir, Options{FormatVersion: FormatV5, MaxAge: time.Hour})
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestPut_TTLNeedsFormatV8(t *testing.T) {
+	dir := "test_put_ttl_v7"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{FormatVersion: FormatV7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("k", "v", WithTTL(time.Minute)); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("err = %v", err)
+	}
+	if err := db.Put("k", "v"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPut_Preconditions(t *testing.T) {
+	dir := "test_put_preconditions"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put("k", "v1", IfAbsent()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("k", "v2", IfAbsent()); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("IfAbsent err = %v", err)
+	}
+
+	m, err := db.GetMeta("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("k", "v2", IfVersion(m.Seq)); err != nil {
+		t.Fatal(err)
+	}
+	// Версія застаріла після попереднього запису
+	if err := db.Put("k", "v3", IfVersion(m.Seq)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("IfVersion err = %v", err)
+	}
+	if err := db.Put("new", "v", IfVersion(0)); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("k"); err != nil || v != "v2" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+}
+
+func TestPut_WithSync(t *testing.T) {
+	dir := "test_put_sync"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "1048576")
+
+	db, err := OpenWithOptions(dir, Options{SyncWrites: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	syncs := func() uint64 { return db.writerSync.summary().Count }
+	if err := db.Put("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := syncs(); n != 1 {
+		t.Fatalf("syncs = %d, want 1", n)
+	}
+	if err := db.Put("b", "2", WithSync(false)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := syncs(); n != 2 {
+		t.Fatalf("syncs = %d, want 2", n)
+	}
+}
+
+func TestPutIfVersion(t *testing.T) {
+	dir := "test_put_if_version"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	v1, err := db.PutWithVersion("k", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, m, err := db.GetWithMeta("k"); err != nil || m.Seq != v1 {
+		t.Fatalf("meta = %+v, %v; want seq %d", m, err, v1)
+	}
+	v2, err := db.PutIfVersion("k", "b", v1)
+	if err != nil || v2 <= v1 {
+		t.Fatalf("PutIfVersion = %d, %v", v2, err)
+	}
+	if _, err := db.PutIfVersion("k", "c", v1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale version err = %v", err)
+	}
+
+	// Оптимістичні інкременти з повтором при конфлікті не губляться
+	const workers, rounds = 4, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				for {
+					v, m, err := db.GetWithMeta("counter")
+					if errors.Is(err, ErrNotFound) {
+						v = "0"
+					} else if err != nil {
+						t.Error(err)
+						return
+					}
+					n, _ := strconv.Atoi(v)
+					_, err = db.PutIfVersion("counter", strconv.Itoa(n+1), m.Seq)
+					if err == nil {
+						break
+					}
+					if !errors.Is(err, ErrConflict) {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v, err := db.Get("counter"); err != nil || v != strconv.Itoa(workers*rounds) {
+		t.Fatalf("counter = %q, %v", v, err)
+	}
+}
+
+func TestPutIfVersion_NeedsSeq(t *testing.T) {
+	dir := "test_put_if_version_v2"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{FormatVersion: FormatV2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.PutIfVersion("k", "v", 0); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package datastore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+)
+
+// ErrQuotaExceeded is returned by writes that would grow the DB past
+// Options.MaxTotalBytes.
+var ErrQuotaExceeded = errors.New("disk quota exceeded")
+
+// QuotaPolicy decides what happens to writes that would exceed
+// Options.MaxTotalBytes.
+type QuotaPolicy int
+
+const (
+	// QuotaReject fails the write with ErrQuotaExceeded. Space comes back
+	// once deletes and overwrites are merged away.
+	QuotaReject QuotaPolicy = iota
+	// QuotaEvictOldest drops the oldest frozen segments, and with them the
+	// keys last written there, until the write fits. Evicted keys are not
+	// reported to hooks or watchers. If no frozen segment can be dropped,
+	// because only the active one is left, the oldest is offloaded or a
+	// merge or offload is running, the write fails with ErrQuotaExceeded.
+	QuotaEvictOldest
+)
+
+// totalSize returns the size of every segment. The caller must hold
+// db.mu.
+func (db *DB) totalSize() int64 {
+	var total int64
+	for _, s := range append(db.segments, db.actives()...) {
+		total += s.size
+	}
+	return total
+}
+
+// checkQuota makes room for n more bytes as Options.QuotaPolicy says. The
+// caller must hold db.mu.
+func (db *DB) checkQuota(n int64) error {
+	limit := db.opts.MaxTotalBytes
+	if limit <= 0 {
+		return nil
+	}
+	for db.totalSize()+n > limit {
+		if db.opts.QuotaPolicy != QuotaEvictOldest || !db.evictOldest() {
+			db.quotaRejections.Add(1)
+			return ErrQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// evictOldest drops the oldest frozen segment and removes the keys whose
+// latest write it holds from the index, and reports whether it did. The
+// caller must hold db.mu. Merges and offloads swap segments by position,
+// so eviction gives up while one runs rather than wait for it under
+// db.mu.
+func (db *DB) evictOldest() bool {
+	if len(db.segments) == 0 || db.segments[0].remote != nil || !db.mergeMu.TryLock() {
+		return false
+	}
+	defer db.mergeMu.Unlock()
+
+	s := db.segments[0]
+	db.removeCheckpoint()
+	keys, err := segmentKeys(s)
+	if err != nil {
+		db.log(slog.LevelError, "eviction failed", "segment", s.id, "err", err)
+		return false
+	}
+	evicted := 0
+	for _, key := range keys {
+		pos, indexed := db.index.get(key)
+		chain := db.operands[key]
+		inSegment := func(p position) bool { return p.segID == s.id }
+		if (indexed && inSegment(pos)) ||
+			(chain != nil && (chain.hasBase && inSegment(chain.base) || slices.ContainsFunc(chain.ops, inSegment))) {
+			db.liveBytes -= db.keyBytes(key)
+			db.index.remove(key)
+			delete(db.operands, key)
+			if db.cache != nil {
+				db.cache.remove(key)
+			}
+			if db.evictor != nil {
+				db.evictor.remove(key)
+			}
+			evicted++
+		}
+	}
+	db.segments = db.segments[1:]
+	db.retire([]*segment{s}, "")
+
+	db.evictedSegments.Add(1)
+	db.evictedKeys.Add(uint64(evicted))
+	db.event(EventEvict, "evicted segment %d (%d bytes, %d keys)", s.id, s.size, evicted)
+	db.log(slog.LevelInfo, "segment evicted", "segment", s.id, "bytes", s.size, "keys", evicted)
+	return true
+}
+
+// segmentKeys returns the distinct keys of the entries in s.
+func segmentKeys(s *segment) ([]string, error) {
+	seen := make(map[string]bool)
+	var keys []string
+	r := bufio.NewReader(io.NewSectionReader(s.reader(), s.dataStart, s.size-s.dataStart))
+	for {
+		var e entry
+		_, err := decodeEntry(&e, r, s.version)
+		if errors.Is(err, io.EOF) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !seen[e.key] {
+			seen[e.key] = true
+			keys = append(keys, e.key)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestQuota_Reject(t *testing.T) {
+	dir := "test_quota_reject"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := OpenWithOptions(dir, Options{MaxTotalBytes: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var i int
+	for ; i < 100; i++ {
+		err = db.Put(fmt.Sprintf("key%d", i), "value")
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v after %d puts", err, i)
+	}
+	if size, _ := db.Size(); size > 1000 {
+		t.Errorf("size %d exceeds the quota", size)
+	}
+	if st := db.Stats(); st.QuotaRejections != 1 {
+		t.Errorf("QuotaRejections = %d", st.QuotaRejections)
+	}
+
+	// Видалення приймаються навіть понад квоту, злиття звільняє місце
+	for j := 0; j < i; j++ {
+		if err := db.Delete(fmt.Sprintf("key%d", j)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("after", "merge"); err != nil {
+		t.Errorf("expected room after merge, got %v", err)
+	}
+}
+
+func TestQuota_EvictOldest(t *testing.T) {
+	dir := "test_quota_evict"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "200")
+
+	opts := Options{MaxTotalBytes: 1000, QuotaPolicy: QuotaEvictOldest}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), "value"); err != nil {
+			t.Fatalf("put %d: %v", i, err)
+		}
+	}
+	if size, _ := db.Size(); size > 1000 {
+		t.Errorf("size %d exceeds the quota", size)
+	}
+	st := db.Stats()
+	if st.EvictedSegments == 0 || st.EvictedKeys == 0 {
+		t.Fatalf("expected evictions, got %+v", st)
+	}
+
+	// Найстаріші ключі витіснено, найновіші лишилися
+	if _, err := db.Get("key00"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected key00 evicted, got %v", err)
+	}
+	if v, err := db.Get("key99"); err != nil || v != "value" {
+		t.Errorf("key99 = %q, %v", v, err)
+	}
+	count := 0
+	db.ForEach(func(string, string) bool { count++; return true })
+	if uint64(count)+st.EvictedKeys != 100 {
+		t.Errorf("%d keys left and %d evicted, want 100 in total", count, st.EvictedKeys)
+	}
+	db.Close()
+
+	// Витіснені сегменти видалено з диска
+	db, err = OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Get("key00"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected key00 to stay evicted after reopen, got %v", err)
+	}
+	if v, err := db.Get("key99"); err != nil || v != "value" {
+		t.Errorf("key99 after reopen = %q, %v", v, err)
+	}
+}
@@ -0,0 +1,192 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// readAheadRun is the number of consecutive forward reads from a
+	// segment after which a scan switches to windowed reads.
+	readAheadRun = 3
+	// readAheadGap is the largest skip between two reads that still counts
+	// as sequential.
+	readAheadGap = 64 << 10
+	// Window sizes start small and double while the scan stays sequential.
+	readAheadMinWindow = 64 << 10
+	readAheadMaxWindow = 1 << 20
+)
+
+// readAhead serves the reads of one scan. Keys are visited in key order,
+// which follows file order only for some segments (e.g. ones written in
+// key order), so it watches the offsets requested from every segment and
+// switches that segment to large buffered reads once they keep moving
+// forward. Random Get reads never go through it.
+type readAhead struct {
+	db      *DB
+	windows map[*segment]*readWindow
+}
+
+// readWindow tracks the access pattern of one segment and the bytes read
+// ahead from it. Segment data never changes once written, so the buffer
+// stays valid for the whole scan.
+type readWindow struct {
+	next    int64 // Offset just past the previous entry read
+	run     int   // Consecutive sequential reads
+	size    int   // Size of the next window
+	advised bool
+	start   int64 // File offset of buf[0]
+	buf     []byte
+}
+
+func (db *DB) newReadAhead() *readAhead {
+	return &readAhead{db: db, windows: make(map[*segment]*readWindow)}
+}
+
+// get is Get for scans: it reads through the segment windows and leaves the
+// cache alone, so a scan does not evict the working set of point reads.
+func (r *readAhead) get(key string) (string, error) {
+	if w, ok := r.db.pending.get(key); ok {
+		r.db.gets.Add(1)
+		return w.result()
+	}
+	if r.db.cache != nil {
+		if v, ok := r.db.cache.get(key); ok {
+			r.db.gets.Add(1)
+			return v, nil
+		}
+	}
+	e, err := r.getEntry(key)
+	return e.value, err
+}
+
+// getEntry returns the latest entry of key, bypassing the cache. Operands
+// are folded into the value, which keeps the newest operand's sequence
+// number.
+func (r *readAhead) getEntry(key string) (entry, error) {
+	db := r.db
+	db.gets.Add(1)
+	db.mu.RLock()
+	pos, ok := db.index.get(key)
+	if !ok {
+		db.mu.RUnlock()
+		return entry{}, ErrNotFound
+	}
+	if chain, ok := db.operands[key]; ok {
+		defer db.mu.RUnlock()
+		last, err := db.readAt(pos)
+		if err != nil {
+			return entry{}, err
+		}
+		v, expires, err := db.fold(key, chain)
+		return entry{key: key, value: v, seq: last.seq, ts: last.ts, expires: expires}, err
+	}
+	s, err := db.segmentFor(pos)
+	if err != nil {
+		db.mu.RUnlock()
+		return entry{}, err
+	}
+	limit := s.size
+	s.ref()
+	defer db.unref(s)
+	s.mu.RLock()
+	db.mu.RUnlock()
+	e, err := r.read(s, pos.offset, limit)
+	s.mu.RUnlock()
+	if err != nil {
+		return entry{}, err
+	}
+	if e.key != key || db.expired(db.expiresAt(e.ts, e.expires)) {
+		return entry{}, ErrNotFound
+	}
+	if err := db.decodeEntryValue(&e); err != nil {
+		return entry{}, err
+	}
+	e.value, err = db.deref(e.value)
+	return e, err
+}
+
+// read reads the entry at offset of s, whose first limit bytes are
+// written. The caller must hold s.mu.
+func (r *readAhead) read(s *segment, offset, limit int64) (entry, error) {
+	w := r.windows[s]
+	if w == nil {
+		w = &readWindow{next: -1, size: readAheadMinWindow}
+		r.windows[s] = w
+	}
+	if w.next >= 0 && offset >= w.next && offset-w.next <= readAheadGap {
+		w.run++
+	} else {
+		w.run = 0
+	}
+
+	e, n, ok := w.buffered(offset, s.version)
+	if !ok && w.run >= readAheadRun {
+		if err := r.fill(s, w, offset, limit); err != nil {
+			return entry{}, err
+		}
+		e, n, ok = w.buffered(offset, s.version)
+	}
+	if !ok {
+		var err error
+		if e, err = s.readEntry(offset); err != nil {
+			return entry{}, err
+		}
+		n = entrySize(&e, s.version)
+	}
+	w.next = offset + int64(n)
+	return e, nil
+}
+
+// fill reads the next window of s starting at offset.
+func (r *readAhead) fill(s *segment, w *readWindow, offset, limit int64) error {
+	if !w.advised {
+		if s.file != nil {
+			adviseSequential(s.file)
+		}
+		w.advised = true
+	}
+	n := min(int64(w.size), limit-offset)
+	if n <= 0 {
+		return nil
+	}
+	if int64(cap(w.buf)) < n {
+		w.buf = make([]byte, n)
+	}
+	w.buf = w.buf[:n]
+	read, err := s.readAt(w.buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	w.buf, w.start = w.buf[:read], offset
+	w.size = min(w.size*2, readAheadMaxWindow)
+	r.db.readAheadBytes.Add(uint64(read))
+	return nil
+}
+
+// buffered decodes the entry at offset if the window holds all of it.
+func (w *readWindow) buffered(offset int64, version uint16) (entry, int, bool) {
+	rel := offset - w.start
+	if w.buf == nil || rel < 0 || rel+8 > int64(len(w.buf)) {
+		return entry{}, 0, false
+	}
+	kl := binary.LittleEndian.Uint32(w.buf[rel : rel+4])
+	vl := binary.LittleEndian.Uint32(w.buf[rel+4 : rel+8])
+	total := 8 + int64(kl) + int64(vl) + int64(formatSpecs[version].trailerSize())
+	if rel+total > int64(len(w.buf)) {
+		return entry{}, 0, false
+	}
+	var e entry
+	n, err := decodeEntry(&e, bytes.NewReader(w.buf[rel:rel+total]), version)
+	if err != nil {
+		return entry{}, 0, false
+	}
+	return e, n, true
+}
+
+// entrySize is the encoded size of e in the given version.
+func entrySize(e *entry, version uint16) int {
+	return 8 + len(e.key) + len(e.value) + formatSpecs[version].trailerSize()
+}
@@ -0,0 +1,25 @@
+package datastore
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// adviseSequential tells the kernel that f is about to be read
+// sequentially, which enlarges its readahead. Files not backed by a file
+// descriptor are skipped and errors are ignored: the hint is only an
+// optimization.
+func adviseSequential(f File) {
+	sc, ok := f.(syscall.Conn)
+	if !ok {
+		return
+	}
+	conn, err := sc.SyscallConn()
+	if err != nil {
+		return
+	}
+	conn.Control(func(fd uintptr) {
+		_ = unix.Fadvise(int(fd), 0, 0, unix.FADV_SEQUENTIAL)
+	})
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package datastore
+
+// adviseSequential is a no-op on platforms without posix_fadvise; windowed
+// reads still apply.
+func adviseSequential(f File) {}
@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadAhead_SequentialScan(t *testing.T) {
+	dir := "test_readahead"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Записуємо в порядку ключів, тож скан читає файл послідовно
+	for i := 0; i < 500; i++ {
+		if err := db.Put(fmt.Sprintf("key%04d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	big := strings.Repeat("x", 2*readAheadMaxWindow)
+	if err := db.Put("key9999", big); err != nil {
+		t.Fatal(err)
+	}
+
+	// Точкові читання не використовують read-ahead
+	for i := 0; i < 500; i += 7 {
+		if _, err := db.Get(fmt.Sprintf("key%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := db.Stats().ReadAheadBytes; n != 0 {
+		t.Fatalf("Get read ahead %d bytes", n)
+	}
+
+	count := 0
+	err = db.ForEach(func(key, value string) bool {
+		want := big
+		if key != "key9999" {
+			want = fmt.Sprintf("value%d", count)
+		}
+		if value != want {
+			t.Errorf("%s: unexpected value of length %d", key, len(value))
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 501 {
+		t.Fatalf("visited %d keys", count)
+	}
+	if db.Stats().ReadAheadBytes == 0 {
+		t.Fatal("sequential scan did not read ahead")
+	}
+}
+
+func TestReadAhead_RandomOrderStaysUnbuffered(t *testing.T) {
+	dir := "test_readahead_random"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Ключі у зворотному порядку: скан іде по файлу назад
+	for i := 99; i >= 0; i-- {
+		if err := db.Put(fmt.Sprintf("key%02d", i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.ForEach(func(_, _ string) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Stats().ReadAheadBytes; n != 0 {
+		t.Fatalf("backward scan read ahead %d bytes", n)
+	}
+}
@@ -0,0 +1,110 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+const (
+	// minEntryRead is the smallest read of an entry whose size is not
+	// known, so most entries come in with a single ReadAt.
+	minEntryRead = 512
+	// maxPooledEntryBuf is the largest buffer returned to the pool, so a
+	// few huge values do not stay pinned.
+	maxPooledEntryBuf = 1 << 20
+)
+
+var entryBufs = sync.Pool{New: func() any {
+	b := make([]byte, 0, 4096)
+	return &b
+}}
+
+func getEntryBuf() *[]byte {
+	return entryBufs.Get().(*[]byte)
+}
+
+func putEntryBuf(b *[]byte) {
+	if cap(*b) <= maxPooledEntryBuf {
+		entryBufs.Put(b)
+	}
+}
+
+// entryView is an entry decoded in place: key and value alias the buffer
+// it was read into.
+type entryView struct {
+	key     []byte
+	value   []byte
+	kind    entryKind
+	seq     uint64
+	ts      int64
+	expires int64
+	encoded bool
+}
+
+// readEntryInto reads the entry at offset into *buf, growing it as needed,
+// and decodes it in place. hint is the expected encoded size, as kept in
+// positions; with a right hint the entry takes a single ReadAt, otherwise
+// at least minEntryRead bytes are read and the rest of a longer entry with
+// a second one. The caller must hold s.mu.
+func (s *segment) readEntryInto(offset, hint int64, buf *[]byte) (entryView, error) {
+	spec := formatSpecs[s.version]
+	trailer := spec.trailerSize()
+	want := int(max(hint, minEntryRead))
+	b := growBuf(*buf, want)
+	n, err := s.readAt(b, offset)
+	if n < 8 {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return entryView{}, fmt.Errorf("failed to read entry header: %w", err)
+	}
+	kl := int(binary.LittleEndian.Uint32(b[0:4]))
+	vl := int(binary.LittleEndian.Uint32(b[4:8]))
+	total := 8 + kl + vl + trailer
+	if n < total {
+		b = growBuf(b[:n], total)
+		if _, err := s.readAt(b[n:total], offset+int64(n)); err != nil {
+			*buf = b
+			return entryView{}, fmt.Errorf("failed to read entry body: %w", err)
+		}
+	}
+	b = b[:total]
+	*buf = b
+
+	v := entryView{key: b[8 : 8+kl], value: b[8+kl : 8+kl+vl]}
+	t := b[8+kl+vl:]
+	if spec.checksum && crc32.Checksum(b[:total-4], castagnoli) != binary.LittleEndian.Uint32(t[trailer-4:]) {
+		return entryView{}, fmt.Errorf("decode error: %w", ErrChecksum)
+	}
+	if spec.kind {
+		v.kind = entryKind(t[0]) &^ kindBatchFlag
+	}
+	if spec.codecs {
+		v.encoded = v.kind&kindEncodedFlag != 0
+		v.kind &^= kindEncodedFlag
+	}
+	if spec.seq {
+		v.seq = binary.LittleEndian.Uint64(t[1:9])
+	}
+	if spec.timestamp {
+		v.ts = int64(binary.LittleEndian.Uint64(t[9:17]))
+	}
+	if spec.expiry {
+		v.expires = int64(binary.LittleEndian.Uint64(t[17:25]))
+	}
+	return v, nil
+}
+
+// growBuf returns b resliced to n bytes, reallocated if its capacity is
+// too small. Reallocation keeps the contents.
+func growBuf(b []byte, n int) []byte {
+	if cap(b) >= n {
+		return b[:n]
+	}
+	nb := make([]byte, n)
+	copy(nb, b)
+	return nb
+}
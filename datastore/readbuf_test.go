@@ -0,0 +1,70 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGetAppend(t *testing.T) {
+	dir := "test_get_append"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "1000")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	long := strings.Repeat("x", 3*minEntryRead)
+	for _, kv := range [][2]string{{"a", "1"}, {"long", long}, {"b", "2"}} {
+		if err := db.Put(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := []byte("prefix:")
+	dst, err = db.GetAppend("a", dst)
+	if err != nil || string(dst) != "prefix:1" {
+		t.Fatalf("GetAppend = %q, %v", dst, err)
+	}
+	// Значення довше за мінімальне читання потребує другого ReadAt
+	if v, err := db.GetAppend("long", nil); err != nil || string(v) != long {
+		t.Fatalf("GetAppend(long) = %d bytes, %v", len(v), err)
+	}
+	if v, err := db.Get("long"); err != nil || v != long {
+		t.Fatalf("Get(long) = %d bytes, %v", len(v), err)
+	}
+	if _, err := db.GetAppend("missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetAppend_NoAllocs(t *testing.T) {
+	dir := "test_get_append_allocs"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		var err error
+		if buf, err = db.GetAppend("key", buf[:0]); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("GetAppend allocates %.1f times per call", allocs)
+	}
+	// Get виділяє лише рядок результату
+	if allocs := testing.AllocsPerRun(100, func() { db.Get("key") }); allocs > 1 {
+		t.Errorf("Get allocates %.1f times per call", allocs)
+	}
+}
@@ -0,0 +1,152 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// RecoveryMode decides how Open treats entries it cannot decode.
+type RecoveryMode int
+
+const (
+	// RecoveryStrict fails Open on the first unreadable entry.
+	RecoveryStrict RecoveryMode = iota
+	// RecoveryTolerant skips unreadable entries and reports each through
+	// the corruption event, log, stats and Hooks.OnCorruption, like the
+	// scrubber. An entry failing its checksum is skipped alone; any other
+	// error loses the rest of its segment, since the next entry cannot be
+	// found. In the active segment, which new writes are appended to, the
+	// rest is cut off as in RecoveryRepairTail.
+	RecoveryTolerant
+	// RecoveryRepairTail cuts the active segment off before its first
+	// unreadable entry, which is how a crash mid-write leaves it, and is
+	// strict about frozen segments.
+	RecoveryRepairTail
+)
+
+// recoveryProgressInterval is the minimum time between progress reports
+// within a segment.
+const recoveryProgressInterval = 100 * time.Millisecond
+
+// RecoveryProgress reports how far Open got rebuilding the index.
+type RecoveryProgress struct {
+	// Segments is the number of segments to scan, the active one included,
+	// and SegmentsScanned how many are done.
+	Segments        int
+	SegmentsScanned int
+	// TotalBytes is the size of those segments and BytesScanned the bytes
+	// read so far. Offloaded segments are scanned from their small hint
+	// files but count with their full size once done.
+	TotalBytes   int64
+	BytesScanned int64
+	// Entries is the number of entries read so far.
+	Entries int
+	Elapsed time.Duration
+}
+
+// recoveryProgress throttles the Options.RecoveryProgress callback.
+type recoveryProgress struct {
+	fn           func(RecoveryProgress)
+	p            RecoveryProgress
+	start, last  time.Time
+	segmentStart int64 // BytesScanned before the current segment
+}
+
+func newRecoveryProgress(fn func(RecoveryProgress), segs []*segment) *recoveryProgress {
+	rp := &recoveryProgress{fn: fn, start: time.Now(), p: RecoveryProgress{Segments: len(segs)}}
+	for _, s := range segs {
+		rp.p.TotalBytes += s.size
+	}
+	return rp
+}
+
+// entry counts an entry read from the current segment, which ends at
+// offset; offset zero leaves the byte count alone.
+func (rp *recoveryProgress) entry(offset int64) {
+	rp.p.Entries++
+	if offset > 0 {
+		rp.p.BytesScanned = rp.segmentStart + offset
+	}
+	if rp.p.Entries%256 == 0 {
+		rp.report(false)
+	}
+}
+
+// segmentDone counts a scanned segment of size bytes and reports it.
+func (rp *recoveryProgress) segmentDone(size int64) {
+	rp.p.SegmentsScanned++
+	rp.segmentStart += size
+	rp.p.BytesScanned = rp.segmentStart
+	rp.report(true)
+}
+
+func (rp *recoveryProgress) report(force bool) {
+	if rp.fn == nil {
+		return
+	}
+	now := time.Now()
+	if !force && now.Sub(rp.last) < recoveryProgressInterval {
+		return
+	}
+	rp.last = now
+	rp.p.Elapsed = now.Sub(rp.start)
+	rp.fn(rp.p)
+}
+
+// recoveryError handles err, met decoding the entry of s at offset, as
+// Options.RecoveryMode says. It returns the bytes to skip to the next
+// entry, or zero to stop scanning s, and the error to fail Open with.
+func (db *DB) recoveryError(s *segment, offset int64, n int, err error) (int64, error) {
+	mode := db.opts.RecoveryMode
+	active := s.id < 0
+	if mode == RecoveryStrict || mode == RecoveryRepairTail && !active {
+		return 0, fmt.Errorf("segment %s at offset %d: %w", s.path, offset, err)
+	}
+	db.corrupted(Corruption{Segment: s.id, Path: s.path, Offset: offset, Err: err})
+	if mode == RecoveryTolerant && errors.Is(err, ErrChecksum) && n > 0 {
+		return int64(n), nil
+	}
+	if active {
+		return 0, db.truncateActive(s, offset)
+	}
+	db.log(slog.LevelWarn, "skipping rest of segment", "segment", s.id, "offset", offset, "bytes", s.size-offset)
+	return 0, nil
+}
+
+// truncateActive cuts the active segment s off at size. File has no
+// Truncate, so the prefix is copied to a new file that replaces it.
+func (db *DB) truncateActive(s *segment, size int64) error {
+	db.removeCheckpoint()
+	tmp := s.path + ".repair"
+	f, err := db.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, io.NewSectionReader(s.file, 0, size)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Not renamed over while open; Open fails if this does not finish.
+	s.file.Close()
+	if err := db.fs.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	nf, err := db.fs.OpenFile(s.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	db.log(slog.LevelWarn, "active segment truncated", "path", s.path, "bytes", size, "dropped", s.size-size)
+	s.file, s.size = nf, size
+	return nil
+}
@@ -0,0 +1,166 @@
+package datastore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecoveryProgress(t *testing.T) {
+	dir := "test_recovery_progress"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size, _ := db.Size()
+	segments := len(db.Segments())
+	db.Close()
+
+	var reports []RecoveryProgress
+	db, err = OpenWithOptions(dir, Options{RecoveryProgress: func(p RecoveryProgress) {
+		reports = append(reports, p)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Звіт після кожного сегмента, лічильники лише зростають
+	if len(reports) < segments {
+		t.Fatalf("expected at least %d reports, got %d", segments, len(reports))
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].BytesScanned < reports[i-1].BytesScanned || reports[i].Entries < reports[i-1].Entries {
+			t.Fatalf("progress went back: %+v then %+v", reports[i-1], reports[i])
+		}
+	}
+	last := reports[len(reports)-1]
+	if last.SegmentsScanned != last.Segments || last.Segments != segments ||
+		last.BytesScanned != size || last.TotalBytes != size || last.Entries != 50 {
+		t.Errorf("unexpected final report %+v, want %d segments and %d bytes", last, segments, size)
+	}
+}
+
+func TestRecoveryMode_RepairTail(t *testing.T) {
+	dir := "test_recovery_repair_tail"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size, _ := db.Size()
+	db.Close()
+
+	// Обірваний запис у кінці активного сегмента
+	f, err := os.OpenFile(db.stripes[0].active.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0x20, 0, 0, 0, 3, 0})
+	f.Close()
+
+	if _, err := Open(dir); err == nil {
+		t.Fatal("expected strict recovery to fail on a torn tail")
+	}
+	db, err = OpenWithOptions(dir, Options{RecoveryMode: RecoveryRepairTail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.Size(); got != size {
+		t.Errorf("size after repair = %d, want %d", got, size)
+	}
+	if err := db.Put("after", "repair"); err != nil {
+		t.Fatal(err)
+	}
+	if st := db.Stats(); st.CorruptEntries != 1 {
+		t.Errorf("CorruptEntries = %d", st.CorruptEntries)
+	}
+	db.Close()
+
+	// Після ремонту каталог знову відкривається у суворому режимі
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, key := range []string{"key0", "key4", "after"} {
+		if _, err := db.Get(key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+}
+
+func TestRecoveryMode_Tolerant(t *testing.T) {
+	dir := "test_recovery_tolerant"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	// Псуємо значення одного запису в замороженому сегменті
+	path := filepath.Join(dir, "segment-0.data")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte("value-1"))
+	if i < 0 {
+		t.Fatal("value-1 not in segment-0")
+	}
+	data[i] ^= 0xFF
+	os.WriteFile(path, data, 0o644)
+
+	for _, mode := range []RecoveryMode{RecoveryStrict, RecoveryRepairTail} {
+		if _, err := OpenWithOptions(dir, Options{RecoveryMode: mode}); !errors.Is(err, ErrChecksum) {
+			t.Errorf("mode %d: expected ErrChecksum, got %v", mode, err)
+		}
+	}
+
+	var reported []Corruption
+	db, err = OpenWithOptions(dir, Options{
+		RecoveryMode: RecoveryTolerant,
+		Hooks:        &Hooks{OnCorruption: func(c Corruption) { reported = append(reported, c) }},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if len(reported) != 1 || reported[0].Segment != 0 || !errors.Is(reported[0].Err, ErrChecksum) {
+		t.Fatalf("unexpected corruption reports %+v", reported)
+	}
+	// Лише пошкоджений запис втрачено
+	if _, err := db.Get("key1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected key1 lost, got %v", err)
+	}
+	for _, key := range []string{"key0", "key2", "key9"} {
+		if _, err := db.Get(key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package datastore
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrReservedKey is returned for writes to keys with a reserved prefix,
+// see Reserved.
+var ErrReservedKey = errors.New("key has a reserved prefix")
+
+// ACLPrefix is reserved for the access rules of package httpapi.
+const ACLPrefix = "\x00acl\x00"
+
+// reservedPrefixes start the keys the DB keeps its own records under.
+// They all start with a zero byte.
+var reservedPrefixes = []string{dedupBlobPrefix, LockPrefix, LeasePrefix, zsetPrefix, ACLPrefix}
+
+// Reserved reports whether key has a reserved prefix. Such keys are only
+// written by the features that own them: Put, Delete and the other writes
+// refuse them with ErrReservedKey, and scans, exports and Count leave them
+// out.
+func Reserved(key string) bool {
+	if key == "" || key[0] != 0 {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// PutReserved is Put for a key with a reserved prefix, for the package
+// owning the prefix.
+func (db *DB) PutReserved(key, value string) error {
+	return db.send(writeRequest{key: key, value: value, kind: kindValue, reserved: true})
+}
+
+// reservedWrite lets a Put reach a reserved key.
+func reservedWrite() PutOption {
+	return func(o *putOptions) { o.reserved = true }
+}
+
+// scanReserved is RangeScan over the keys starting with prefix, for the
+// feature owning the reserved prefix.
+func (db *DB) scanReserved(prefix string, fn func(key, value string) bool) error {
+	var keys []string
+	db.mu.RLock()
+	db.index.ascend(prefix, prefixEnd(prefix), func(key string, _ position) bool {
+		keys = append(keys, key)
+		return true
+	})
+	db.mu.RUnlock()
+	ra := db.newReadAhead()
+	for _, key := range keys {
+		value, err := ra.get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(key, value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// checkReserved refuses entries a caller asked to write if any has a
+// reserved key.
+func checkReserved(entries []entry) error {
+	for _, e := range entries {
+		if Reserved(e.key) {
+			return ErrReservedKey
+		}
+	}
+	return nil
+}
+
+// reservedKeys returns the number of keys with a reserved prefix and the
+// live bytes they take, see LiveSize. The caller must hold db.mu.
+func (db *DB) reservedKeys() (int, int64) {
+	n, size := 0, int64(0)
+	db.index.ascend("\x00", "\x01", func(key string, _ position) bool {
+		if Reserved(key) {
+			n++
+			size += db.keyBytes(key)
+		}
+		return true
+	})
+	return n, size
+}
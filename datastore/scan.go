@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"errors"
+	"slices"
+)
+
+// RangeScan calls fn for every key in [start, end) in ascending key order
+// until fn returns false. An empty end means no upper bound. Keys written
+// after the scan starts may or may not be visited.
+func (db *DB) RangeScan(start, end string, fn func(key, value string) bool) error {
+	ra := db.newReadAhead()
+	for _, key := range db.scanKeys(start, end) {
+		value, err := ra.get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(key, value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// ForEach calls fn for every key in ascending order until fn returns false.
+func (db *DB) ForEach(fn func(key, value string) bool) error {
+	return db.RangeScan("", "", fn)
+}
+
+// RangeKeys calls fn for every key in [start, end) in ascending order until
+// fn returns false, without reading values. An empty end means no upper
+// bound. The keys are listed before fn is first called; to only check for
+// any, use HasKeys.
+func (db *DB) RangeKeys(start, end string, fn func(key string) bool) {
+	keys, _ := db.keysInRange(start, end)
+	for _, key := range keys {
+		if !fn(key) {
+			return
+		}
+	}
+}
+
+// HasKeys reports whether any key is in [start, end), stopping at the
+// first one rather than listing them like RangeKeys. An empty end means no
+// upper bound.
+func (db *DB) HasKeys(start, end string) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	found := false
+	db.index.ascend(start, end, func(key string, _ position) bool {
+		found = !Reserved(key)
+		return !found
+	})
+	return found
+}
+
+// scanKeys returns the keys a scan of [start, end) visits: the indexed
+// ones and, under ConsistencyEnqueued, those only queued so far.
+func (db *DB) scanKeys(start, end string) []string {
+	keys, _ := db.keysInRange(start, end)
+	if queued := db.pending.keysInRange(start, end); len(queued) > 0 {
+		keys = append(keys, queued...)
+		slices.Sort(keys)
+		keys = slices.Compact(keys)
+	}
+	return keys
+}
+
+// keysInRange returns the indexed keys in [start, end) in ascending order,
+// leaving out reserved ones, and the sequence number of the last write
+// they reflect.
+func (db *DB) keysInRange(start, end string) ([]string, uint64) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var keys []string
+	db.index.ascend(start, end, func(key string, _ position) bool {
+		if !Reserved(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys, db.seq.Load()
+}
@@ -0,0 +1,90 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestRangeScan(t *testing.T) {
+	for _, it := range []IndexType{IndexHash, IndexBTree, IndexFingerprint} {
+		t.Run(fmt.Sprintf("index=%d", it), func(t *testing.T) {
+			dir := fmt.Sprintf("test_range_scan_%d", it)
+			defer os.RemoveAll(dir)
+
+			db, err := OpenWithOptions(dir, Options{IndexType: it})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			for i := 9; i >= 0; i-- {
+				if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var keys []string
+			err = db.RangeScan("key3", "key7", func(key, value string) bool {
+				if value != "value"+key[3:] {
+					t.Errorf("unexpected value %s for %s", value, key)
+				}
+				keys = append(keys, key)
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []string{"key3", "key4", "key5", "key6"}
+			if fmt.Sprint(keys) != fmt.Sprint(expected) {
+				t.Errorf("expected %v, got %v", expected, keys)
+			}
+
+			// ForEach повертає всі ключі по порядку та зупиняється на false
+			count := 0
+			err = db.ForEach(func(key, value string) bool {
+				if key != fmt.Sprintf("key%d", count) {
+					t.Errorf("expected key%d, got %s", count, key)
+				}
+				count++
+				return count < 5
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 5 {
+				t.Errorf("expected ForEach to stop after 5 keys, got %d", count)
+			}
+		})
+	}
+}
+
+func TestRangeKeys(t *testing.T) {
+	dir := "test_range_keys"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, k := range []string{"b", "a", "d", "c"} {
+		db.Put(k, "v")
+	}
+	var keys []string
+	db.RangeKeys("b", "", func(key string) bool {
+		keys = append(keys, key)
+		return key != "c"
+	})
+	// Зупиняється, щойно fn повертає false
+	if fmt.Sprint(keys) != "[b c]" {
+		t.Fatalf("keys = %v", keys)
+	}
+
+	if !db.HasKeys("c", "d") || !db.HasKeys("d", "") {
+		t.Error("expected keys in [c, d) and from d")
+	}
+	if db.HasKeys("b0", "c") || db.HasKeys("e", "") {
+		t.Error("expected no keys in [b0, c) or from e")
+	}
+}
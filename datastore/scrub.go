@@ -0,0 +1,185 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultScrubInterval    = 24 * time.Hour
+	defaultScrubBytesPerSec = 1 << 20
+	scrubBufferSize         = 64 << 10
+)
+
+// errOffloaded is returned by reads of a segment offloaded while it was
+// being scrubbed.
+var errOffloaded = errors.New("segment was offloaded")
+
+// ScrubOptions configures the scrubber, which slowly rereads frozen local
+// segments and verifies every entry, so latent corruption such as bad
+// sectors is found before a Get hits it. Entries are checked against their
+// checksum in FormatV5 and newer; older segments only get their framing
+// checked.
+type ScrubOptions struct {
+	// Interval between scrub passes. Zero means 24 hours.
+	Interval time.Duration
+	// BytesPerSec caps the bytes a pass reads per second, on top of any
+	// Governor budget. Zero means 1 MiB/s.
+	BytesPerSec int64
+}
+
+// Corruption describes an entry that failed verification. The rest of its
+// segment cannot be framed and is not checked.
+type Corruption struct {
+	Segment int
+	Path    string
+	Offset  int64
+	Err     error
+}
+
+func (c Corruption) Error() string {
+	return fmt.Sprintf("segment %d (%s) at offset %d: %v", c.Segment, c.Path, c.Offset, c.Err)
+}
+
+func (c Corruption) Unwrap() error { return c.Err }
+
+// Scrub verifies every frozen local segment once and returns the
+// corruption it found, which is also reported as by the background
+// scrubber. Reads are paced by Options.Scrub if it is set.
+func (db *DB) Scrub(ctx context.Context) ([]Corruption, error) {
+	found, err := db.scrub(ctx.Done())
+	if errors.Is(err, errStopped) {
+		err = ctx.Err()
+	}
+	return found, err
+}
+
+// scrubber runs a scrub pass every interval until the DB is closed.
+func (db *DB) scrubber(interval time.Duration) {
+	defer db.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := db.scrub(db.quit); errors.Is(err, errStopped) {
+				return
+			}
+		case <-db.quit:
+			return
+		}
+	}
+}
+
+func (db *DB) scrub(quit <-chan struct{}) ([]Corruption, error) {
+	db.mu.RLock()
+	segs := append([]*segment(nil), db.segments[db.localSuffix():]...)
+	db.mu.RUnlock()
+
+	task := db.governor.start(quit)
+	task.limit = db.scrubIO
+	var found []Corruption
+	for _, s := range segs {
+		select {
+		case <-quit:
+			return found, errStopped
+		default:
+		}
+		c, err := db.scrubLive(s, task)
+		if err != nil {
+			return found, err
+		}
+		if c != nil {
+			found = append(found, *c)
+			db.corrupted(*c)
+		}
+	}
+	db.scrubPasses.Add(1)
+	return found, nil
+}
+
+// scrubLive scrubs s unless a merge has replaced it in the meantime.
+func (db *DB) scrubLive(s *segment, task *bgTask) (*Corruption, error) {
+	db.mu.RLock()
+	live := false
+	for _, cur := range db.segments {
+		live = live || cur == s
+	}
+	if live {
+		s.ref()
+	}
+	db.mu.RUnlock()
+	if !live {
+		return nil, nil
+	}
+	defer db.unref(s)
+	return db.scrubSegment(s, task)
+}
+
+// scrubSegment verifies the entries of s in order and returns the first
+// one that fails. Offloaded segments are skipped.
+func (db *DB) scrubSegment(s *segment, task *bgTask) (*Corruption, error) {
+	r := bufio.NewReaderSize(io.NewSectionReader(scrubReader{s}, s.dataStart, s.size-s.dataStart), scrubBufferSize)
+	trailer := int64(formatSpecs[s.version].trailerSize())
+	offset := s.dataStart
+	for offset < s.size {
+		hdr, err := r.Peek(8)
+		if err == nil {
+			kl := int64(binary.LittleEndian.Uint32(hdr[0:4]))
+			vl := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+			// Check the lengths before decoding allocates for them.
+			if offset+8+kl+vl+trailer > s.size {
+				err = fmt.Errorf("entry of %d bytes runs past end of segment", 8+kl+vl+trailer)
+			}
+		}
+		var n int
+		if err == nil {
+			var e entry
+			n, err = decodeEntry(&e, r, s.version)
+		}
+		if errors.Is(err, errOffloaded) {
+			return nil, nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return &Corruption{Segment: s.id, Path: s.path, Offset: offset, Err: err}, nil
+		}
+		offset += int64(n)
+		db.scrubbedBytes.Add(uint64(n))
+		if err := task.step(n); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// scrubReader reads a local segment, holding its lock only for each read
+// so offloads are not held up by a whole pass.
+type scrubReader struct{ s *segment }
+
+func (r scrubReader) ReadAt(p []byte, off int64) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	if r.s.remote != nil {
+		return 0, errOffloaded
+	}
+	return r.s.file.ReadAt(p, off)
+}
+
+// corrupted reports corruption found by the scrubber.
+func (db *DB) corrupted(c Corruption) {
+	db.corruptEntries.Add(1)
+	db.event(EventCorruption, "%v", c)
+	db.log(slog.LevelError, "corrupt entry", "segment", c.Segment, "path", c.Path, "offset", c.Offset, "err", c.Err)
+	if h := db.opts.Hooks; h != nil && h.OnCorruption != nil {
+		db.runHook(func() { h.OnCorruption(c) })
+	}
+}
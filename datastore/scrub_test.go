@@ -0,0 +1,124 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScrub_FindsCorruption(t *testing.T) {
+	dir := "test_scrub"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	var mu sync.Mutex
+	var reported []Corruption
+	hooks := &Hooks{OnCorruption: func(c Corruption) {
+		mu.Lock()
+		reported = append(reported, c)
+		mu.Unlock()
+	}}
+	db, err := OpenWithOptions(dir, Options{Hooks: hooks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), fmt.Sprintf("value%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	found, err := db.Scrub(context.Background())
+	if err != nil || len(found) != 0 {
+		t.Fatalf("clean scrub: %v, %v", found, err)
+	}
+
+	// Псуємо байт значення першого запису другого сегмента
+	s := db.segments[1]
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := make([]byte, len("key00"))
+	if _, err := f.ReadAt(key, s.dataStart+8); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{'X'}, s.dataStart+8+int64(len(key))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	found, err = db.Scrub(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Segment != s.id || found[0].Offset != s.dataStart || !errors.Is(found[0].Err, ErrChecksum) {
+		t.Fatalf("unexpected corruption report: %v", found)
+	}
+	if len(reported) != 1 {
+		t.Errorf("expected OnCorruption to be called once, got %d", len(reported))
+	}
+	st := db.Stats()
+	if st.ScrubPasses != 2 || st.CorruptEntries != 1 || st.ScrubbedBytes == 0 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	// Get теж не віддає зіпсоване значення
+	if _, err := db.Get(string(key)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected checksum error for %s, got %v", key, err)
+	}
+}
+
+func TestScrub_Background(t *testing.T) {
+	dir := "test_scrub_background"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := OpenWithOptions(dir, Options{Scrub: &ScrubOptions{Interval: 10 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { return db.Stats().ScrubPasses > 1 })
+	if st := db.Stats(); st.CorruptEntries != 0 || st.ScrubbedBytes == 0 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
+
+func TestScrub_Canceled(t *testing.T) {
+	dir := "test_scrub_canceled"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	// 1 байт/с: прохід не встигне завершитися
+	db, err := OpenWithOptions(dir, Options{Scrub: &ScrubOptions{Interval: time.Hour, BytesPerSec: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := db.Scrub(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package datastore
+
+// Segments replaced by a merge, evicted, dropped or frozen are not closed
+// right away: reads look a segment up under db.mu and use it after
+// releasing it, so every such read holds a reference to the segment and
+// retire only gives up the one the DB holds. The segment is closed, and
+// its file removed if retire says so, when the last reference is gone.
+// Readers of IndexCOW find segments in the published view without db.mu,
+// so for them the DB holds on to retired segments until the next view no
+// longer has them.
+
+// ref takes a reference to s for a read. The caller must hold db.mu and s
+// must be one of the DB's segments, which cannot be closed meanwhile.
+func (s *segment) ref() {
+	s.refs.Add(1)
+}
+
+// tryRef takes a reference to s unless it has been closed already, for
+// readers that found s without holding db.mu.
+func (s *segment) tryRef() bool {
+	for {
+		n := s.refs.Load()
+		if n < 0 {
+			return false
+		}
+		if s.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// unref drops a reference taken with ref or tryRef, or the DB's own one,
+// and closes s once none is left.
+func (db *DB) unref(s *segment) {
+	if s.refs.Add(-1) >= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.file.Close()
+	if s.unlink && db.fs.Remove(s.path) == nil {
+		s.removed.Store(true)
+	}
+	s.mu.Unlock()
+}
+
+// retire gives up the DB's reference to segments that are no longer in
+// db.segments or the stripes. The file at keep is closed but not removed.
+// The caller must hold db.mu.
+func (db *DB) retire(segs []*segment, keep string) {
+	for _, s := range segs {
+		s.unlink = s.path != keep
+	}
+	if _, cow := db.index.(*cowIndex); cow {
+		db.retired = append(db.retired, segs...)
+		return
+	}
+	for _, s := range segs {
+		db.unref(s)
+	}
+}
+
+// releaseRetired gives up the segments retire held on to for IndexCOW
+// readers. The caller must hold db.mu.
+func (db *DB) releaseRetired() {
+	for _, s := range db.retired {
+		db.unref(s)
+	}
+	db.retired = nil
+}
@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSegmentRefs_DefersRemoval(t *testing.T) {
+	dir := "test_segref_defer"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.mu.RLock()
+	old := db.segments[0]
+	// Читач, що почався до злиття, дочитує старий файл
+	old.ref()
+	db.mu.RUnlock()
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old.path); err != nil {
+		t.Fatalf("expected %s to stay until the reader is done: %v", old.path, err)
+	}
+	old.mu.RLock()
+	_, err = old.readEntry(old.dataStart)
+	old.mu.RUnlock()
+	if err != nil {
+		t.Fatalf("expected old segment to stay readable, got %v", err)
+	}
+
+	db.unref(old)
+	if _, err := os.Stat(old.path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got %v", old.path, err)
+	}
+	if old.tryRef() {
+		t.Error("expected a closed segment to refuse new references")
+	}
+}
+
+func TestSegmentRefs_GetDuringMerge(t *testing.T) {
+	dir := "test_segref_get"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "300")
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Злиття під час читань не повинні давати помилок читання
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("key%d", i%50)
+				if _, err := db.Get(key); err != nil {
+					errs <- fmt.Errorf("%s: %w", key, err)
+					return
+				}
+			}
+		}()
+	}
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 10; i++ {
+			if err := db.Put(fmt.Sprintf("key%d", (round*10+i)%50), fmt.Sprintf("value%d", round)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.merge(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestSegmentRefs_COWViewOutlivesMerge(t *testing.T) {
+	dir := "test_segref_cow"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "200")
+
+	db, err := OpenWithOptions(dir, Options{IndexType: IndexCOW})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 30; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Застарілий вигляд після злиття читається через db.mu
+	stale := db.view.Load()
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	if stale.segments[0].tryRef() {
+		t.Fatal("expected the merged segment to be closed")
+	}
+	var buf []byte
+	if _, _, _, ok, _ := db.lookupView(stale, "key0", &buf); ok {
+		t.Error("expected a stale view to fall back to the locked path")
+	}
+	if v, err := db.Get("key0"); err != nil || v != strings.Repeat("v", 20) {
+		t.Errorf("got %q, %v", v, err)
+	}
+}
@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+// ErrUnknownOption is returned by SetOption for names it cannot change.
+var ErrUnknownOption = errors.New("unknown option")
+
+// Names of the settings SetOption changes.
+const (
+	// OptionMaxSegmentSize is the size in bytes at which active segments
+	// rotate, applied from the next write.
+	OptionMaxSegmentSize = "MaxSegmentSize"
+	// OptionSyncWrites is Options.SyncWrites, "true" or "false".
+	OptionSyncWrites = "SyncWrites"
+	// OptionCompactAfter is the number of frozen segments that triggers a
+	// background merge.
+	OptionCompactAfter = "CompactAfter"
+	// OptionCacheBytes is the byte budget of the value cache; shrinking it
+	// evicts entries right away. The cache must have been enabled at Open.
+	OptionCacheBytes = "CacheBytes"
+)
+
+// SetOption changes a setting of the open DB, so it can be tuned without a
+// restart. The change is not persisted, and the auto-tuner, if enabled,
+// goes on adjusting the settings it controls. Stats reports the values in
+// force.
+func (db *DB) SetOption(name, value string) error {
+	switch name {
+	case OptionMaxSegmentSize:
+		n, err := parseOption(name, value, 1)
+		if err != nil {
+			return err
+		}
+		db.SetMaxSegmentSize(n)
+	case OptionSyncWrites:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("option %s: %w", name, err)
+		}
+		db.syncWrites.Store(b)
+	case OptionCompactAfter:
+		n, err := parseOption(name, value, 1)
+		if err != nil {
+			return err
+		}
+		db.compactAfter.Store(n)
+	case OptionCacheBytes:
+		n, err := parseOption(name, value, 0)
+		if err != nil {
+			return err
+		}
+		if db.cache == nil {
+			return fmt.Errorf("option %s: the cache was not enabled at Open", name)
+		}
+		db.cache.setBudget(n)
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownOption, name)
+	}
+	db.log(slog.LevelInfo, "option changed", "name", name, "value", value)
+	return nil
+}
+
+func parseOption(name, value string, least int64) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("option %s: %w", name, err)
+	}
+	if n < least {
+		return 0, fmt.Errorf("option %s: %d is below %d", name, n, least)
+	}
+	return n, nil
+}
@@ -0,0 +1,81 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetOption(t *testing.T) {
+	dir := "test_setoption"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{CacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, o := range [][2]string{
+		{OptionMaxSegmentSize, "256"},
+		{OptionSyncWrites, "true"},
+		{OptionCompactAfter, "1000"},
+		{OptionCacheBytes, "64"},
+	} {
+		if err := db.SetOption(o[0], o[1]); err != nil {
+			t.Fatalf("%s: %v", o[0], err)
+		}
+	}
+	st := db.Stats()
+	if st.MaxSegmentSize != 256 || !st.SyncWrites || st.CompactAfter != 1000 || st.CacheBudget != 64 {
+		t.Fatalf("stats = %+v", st)
+	}
+
+	// Новий розмір сегмента діє з наступного запису
+	before := len(db.Segments())
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i), strings.Repeat("v", 50)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(db.Segments()); n <= before+1 {
+		t.Errorf("segments = %d, want rotations past %d", n, before)
+	}
+	if v, err := db.Get("key3"); err != nil || v != strings.Repeat("v", 50) {
+		t.Errorf("get: %q, %v", v, err)
+	}
+
+	if err := db.SetOption("Nope", "1"); !errors.Is(err, ErrUnknownOption) {
+		t.Errorf("unknown: err = %v", err)
+	}
+	for _, o := range [][2]string{
+		{OptionMaxSegmentSize, "0"},
+		{OptionCompactAfter, "many"},
+		{OptionSyncWrites, "maybe"},
+		{OptionCacheBytes, "-1"},
+	} {
+		if err := db.SetOption(o[0], o[1]); err == nil {
+			t.Errorf("%s=%s: expected error", o[0], o[1])
+		}
+	}
+	if st := db.Stats(); st.MaxSegmentSize != 256 || st.CompactAfter != 1000 {
+		t.Errorf("rejected values applied: %+v", st)
+	}
+}
+
+// Кеш, вимкнений при відкритті, не вмикається
+func TestSetOption_NoCache(t *testing.T) {
+	dir := "test_setoption_nocache"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetOption(OptionCacheBytes, "1024"); err == nil {
+		t.Error("expected error without a cache")
+	}
+}
@@ -0,0 +1,280 @@
+// Package sqlshim registers a database/sql driver named "dskv" that exposes
+// a datastore.DB as a single table:
+//
+//	kv(key TEXT PRIMARY KEY, value TEXT)
+//
+// Only these statements are understood, with ? placeholders:
+//
+//	SELECT value FROM kv WHERE key = ?
+//	SELECT key, value FROM kv WHERE key = ?
+//	SELECT key, value FROM kv
+//	INSERT INTO kv (key, value) VALUES (?, ?)
+//	INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)
+//	REPLACE INTO kv (key, value) VALUES (?, ?)
+//
+// Every INSERT is an upsert, like REPLACE, since Put always overwrites.
+// Transactions are not supported. The data source name is the directory of
+// the DB; connections to the same directory share one open DB.
+package sqlshim
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// DriverName is the name the driver is registered under.
+const DriverName = "dskv"
+
+var (
+	// ErrUnsupported is returned for statements outside the kv schema.
+	ErrUnsupported = errors.New("sqlshim: unsupported statement")
+	// ErrNoTx is returned by Begin.
+	ErrNoTx = errors.New("sqlshim: transactions are not supported")
+)
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+// Driver opens connections to datastore directories.
+type Driver struct{}
+
+var (
+	sharedMu sync.Mutex
+	shared   = make(map[string]*sharedDB)
+)
+
+// sharedDB is a DB opened by the driver and the number of connections
+// using it.
+type sharedDB struct {
+	db   *datastore.DB
+	refs int
+}
+
+// Open opens a connection to the DB in the directory name.
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	s := shared[name]
+	if s == nil {
+		db, err := datastore.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		s = &sharedDB{db: db}
+		shared[name] = s
+	}
+	s.refs++
+	return &conn{db: s.db, release: func() error { return release(name) }}, nil
+}
+
+func release(name string) error {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	s := shared[name]
+	if s == nil {
+		return nil
+	}
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	delete(shared, name)
+	return s.db.Close()
+}
+
+// OpenDB returns a *sql.DB backed by an already open db. Closing the
+// *sql.DB leaves db open.
+func OpenDB(db *datastore.DB) *sql.DB {
+	return sql.OpenDB(connector{db: db})
+}
+
+type connector struct {
+	db *datastore.DB
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{db: c.db}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+type conn struct {
+	db      *datastore.DB
+	release func() error
+	closed  bool
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	op, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{db: c.db, op: op}, nil
+}
+
+func (c *conn) Close() error {
+	if c.closed || c.release == nil {
+		c.closed = true
+		return nil
+	}
+	c.closed = true
+	return c.release()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, ErrNoTx
+}
+
+type opKind int
+
+const (
+	opGetValue opKind = iota
+	opGetRow
+	opScan
+	opPut
+)
+
+var statements = []struct {
+	re *regexp.Regexp
+	op opKind
+}{
+	{regexp.MustCompile(`(?i)^select\s+value\s+from\s+kv\s+where\s+key\s*=\s*\?$`), opGetValue},
+	{regexp.MustCompile(`(?i)^select\s+key\s*,\s*value\s+from\s+kv\s+where\s+key\s*=\s*\?$`), opGetRow},
+	{regexp.MustCompile(`(?i)^select\s+key\s*,\s*value\s+from\s+kv$`), opScan},
+	{regexp.MustCompile(`(?i)^(insert(\s+or\s+replace)?|replace)\s+into\s+kv\s*\(\s*key\s*,\s*value\s*\)\s*values\s*\(\s*\?\s*,\s*\?\s*\)$`), opPut},
+}
+
+// parse matches query against the supported statements, ignoring case,
+// extra whitespace and a trailing semicolon.
+func parse(query string) (opKind, error) {
+	q := strings.TrimSpace(query)
+	q = strings.TrimSpace(strings.TrimSuffix(q, ";"))
+	for _, s := range statements {
+		if s.re.MatchString(q) {
+			return s.op, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnsupported, query)
+}
+
+type stmt struct {
+	db *datastore.DB
+	op opKind
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	switch s.op {
+	case opScan:
+		return 0
+	case opPut:
+		return 2
+	}
+	return 1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.op != opPut {
+		return nil, fmt.Errorf("%w: SELECT passed to Exec", ErrUnsupported)
+	}
+	key, err := text(args[0])
+	if err != nil {
+		return nil, err
+	}
+	value, err := text(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Put(key, value); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch s.op {
+	case opPut:
+		return nil, fmt.Errorf("%w: INSERT passed to Query", ErrUnsupported)
+	case opScan:
+		r := &rows{cols: []string{"key", "value"}}
+		err := s.db.ForEach(func(key, value string) bool {
+			r.data = append(r.data, []driver.Value{key, value})
+			return true
+		})
+		return r, err
+	}
+
+	key, err := text(args[0])
+	if err != nil {
+		return nil, err
+	}
+	r := &rows{cols: []string{"value"}}
+	if s.op == opGetRow {
+		r.cols = []string{"key", "value"}
+	}
+	value, err := s.db.Get(key)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.op == opGetRow {
+		r.data = [][]driver.Value{{key, value}}
+	} else {
+		r.data = [][]driver.Value{{value}}
+	}
+	return r, nil
+}
+
+// text converts a statement argument to the string stored in the DB.
+func text(v driver.Value) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+	return "", fmt.Errorf("sqlshim: unsupported argument type %T", v)
+}
+
+type rows struct {
+	cols []string
+	data [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.cols
+}
+
+func (r *rows) Close() error {
+	r.data = nil
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
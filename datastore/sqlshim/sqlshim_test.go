@@ -0,0 +1,102 @@
+package sqlshim_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/sqlshim"
+)
+
+func TestDriver(t *testing.T) {
+	dir := "test_sqlshim"
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open(sqlshim.DriverName, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("INSERT INTO kv (key, value) VALUES (?, ?)", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("replace into kv(key,value) values(?,?);", "b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	// INSERT працює як upsert
+	if _, err := db.Exec("INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)", "a", int64(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	var v string
+	if err := db.QueryRow("SELECT value FROM kv WHERE key = ?", "a").Scan(&v); err != nil || v != "10" {
+		t.Fatalf("value = %q, %v", v, err)
+	}
+	var k string
+	if err := db.QueryRow("select key, value from kv where key=?", "b").Scan(&k, &v); err != nil || k != "b" || v != "2" {
+		t.Fatalf("row = %q, %q, %v", k, v, err)
+	}
+	if err := db.QueryRow("SELECT value FROM kv WHERE key = ?", "missing").Scan(&v); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows, got %v", err)
+	}
+
+	rows, err := db.Query("SELECT key, value FROM kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for rows.Next() {
+		if err := rows.Scan(&k, &v); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Fatalf("scan keys = %v", keys)
+	}
+
+	if _, err := db.Exec("DELETE FROM kv WHERE key = ?", "a"); !errors.Is(err, sqlshim.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+	if _, err := db.Begin(); !errors.Is(err, sqlshim.ErrNoTx) {
+		t.Fatalf("expected ErrNoTx, got %v", err)
+	}
+}
+
+func TestDriver_ReopenAfterClose(t *testing.T) {
+	dir := "test_sqlshim_reopen"
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open(sqlshim.DriverName, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO kv (key, value) VALUES (?, ?)", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Після закриття всіх з'єднань директорію можна відкрити напряму
+	kv, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	if v, err := kv.Get("k"); err != nil || v != "v" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+
+	wrapped := sqlshim.OpenDB(kv)
+	var v string
+	if err := wrapped.QueryRow("SELECT value FROM kv WHERE key = ?", "k").Scan(&v); err != nil || v != "v" {
+		t.Fatalf("value = %q, %v", v, err)
+	}
+	wrapped.Close()
+	if err := kv.Put("still", "open"); err != nil {
+		t.Fatalf("DB closed by OpenDB: %v", err)
+	}
+}
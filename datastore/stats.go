@@ -0,0 +1,101 @@
+package datastore
+
+// Stats is a point-in-time snapshot of DB counters.
+type Stats struct {
+	Puts uint64
+	Gets uint64
+	// Misses counts the Get and GetAppend calls, and the keys of GetMulti,
+	// that found no key.
+	Misses       uint64
+	BytesWritten uint64
+
+	// WriteQueueDepth is the number of writes waiting for the writer;
+	// WritesRejected counts writes refused with ErrBusy and WritesTimedOut
+	// those PutWithTimeout gave up on with ErrTimeout.
+	WriteQueueDepth int
+	WritesRejected  uint64
+	WritesTimedOut  uint64
+
+	// Current settings, possibly auto-tuned or changed with SetOption.
+	MaxSegmentSize int64
+	CompactAfter   int
+	CacheBudget    int64
+	SyncWrites     bool
+
+	CacheHits    uint64
+	CacheMisses  uint64
+	CacheEntries int
+	CacheBytes   int64
+
+	// ReadAheadBytes counts bytes read ahead by scans and exports.
+	ReadAheadBytes uint64
+
+	// Scrubber progress: completed passes, bytes verified and corrupt
+	// entries found.
+	ScrubPasses    uint64
+	ScrubbedBytes  uint64
+	CorruptEntries uint64
+
+	// QuotaRejections counts writes refused with ErrQuotaExceeded;
+	// EvictedSegments counts what QuotaEvictOldest dropped, EvictedKeys
+	// the keys dropped with them or deleted by Options.Eviction.
+	QuotaRejections uint64
+	EvictedSegments uint64
+	EvictedKeys     uint64
+
+	// IndexShardLoads and IndexShardSpills count the shards IndexLazy
+	// read from and wrote to disk.
+	IndexShardLoads  uint64
+	IndexShardSpills uint64
+
+	// Fsync latency of the writer (segment rotation) and the compactor.
+	WriterSyncLatency    LatencySummary
+	CompactorSyncLatency LatencySummary
+
+	// PutLatency covers writes from enqueueing to the acknowledgement, of
+	// which QueueLatency is the wait for the writer. GetLatency covers Get
+	// including cache hits, and each key of GetMulti; MergeLatency whole
+	// merges.
+	PutLatency   LatencySummary
+	QueueLatency LatencySummary
+	GetLatency   LatencySummary
+	MergeLatency LatencySummary
+}
+
+// Stats returns current DB counters.
+func (db *DB) Stats() Stats {
+	st := Stats{
+		Puts:                 db.puts.Load(),
+		Gets:                 db.gets.Load(),
+		Misses:               db.misses.Load(),
+		BytesWritten:         db.bytesWritten.Load(),
+		WriteQueueDepth:      db.queueDepth(),
+		WritesRejected:       db.writesRejected.Load(),
+		WritesTimedOut:       db.writesTimedOut.Load(),
+		ReadAheadBytes:       db.readAheadBytes.Load(),
+		ScrubPasses:          db.scrubPasses.Load(),
+		ScrubbedBytes:        db.scrubbedBytes.Load(),
+		CorruptEntries:       db.corruptEntries.Load(),
+		QuotaRejections:      db.quotaRejections.Load(),
+		EvictedSegments:      db.evictedSegments.Load(),
+		EvictedKeys:          db.evictedKeys.Load(),
+		MaxSegmentSize:       db.maxSegmentSize(),
+		CompactAfter:         db.compactThreshold(),
+		SyncWrites:           db.syncWrites.Load(),
+		WriterSyncLatency:    db.writerSync.summary(),
+		CompactorSyncLatency: db.compactorSync.summary(),
+		PutLatency:           db.putLatency.summary(),
+		QueueLatency:         db.queueLatency.summary(),
+		GetLatency:           db.getLatency.summary(),
+		MergeLatency:         db.mergeLatency.summary(),
+	}
+	if li, ok := db.index.(*lazyIndex); ok {
+		st.IndexShardLoads, st.IndexShardSpills = li.counters()
+	}
+	if db.cache != nil {
+		st.CacheHits, st.CacheMisses = db.cache.counters()
+		st.CacheEntries, st.CacheBytes = db.cache.usage()
+		st.CacheBudget = db.cache.limit()
+	}
+	return st
+}
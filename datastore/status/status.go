@@ -0,0 +1,134 @@
+// Package status serves a read-only diagnostics page for a datastore.DB,
+// as HTML for people and JSON for tools.
+package status
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// Config configures the status page.
+type Config struct {
+	// ReplicationLag reports the lag of each replica by name. It is
+	// optional; the section is omitted when nil.
+	ReplicationLag func() map[string]time.Duration
+}
+
+// Report is the JSON document served by the status page.
+type Report struct {
+	Time           time.Time                    `json:"time"`
+	Segments       []datastore.SegmentInfo      `json:"segments"`
+	Stats          datastore.Stats              `json:"stats"`
+	Compactions    []datastore.CompactionRecord `json:"compactions"`
+	Events         []datastore.Event            `json:"events"`
+	ReplicationLag map[string]time.Duration     `json:"replication_lag,omitempty"`
+}
+
+// Collect builds the current report for db.
+func Collect(db *datastore.DB, cfg Config) Report {
+	r := Report{
+		Time:        time.Now(),
+		Segments:    db.Segments(),
+		Stats:       db.Stats(),
+		Compactions: db.CompactionHistory(),
+		Events:      db.RecentEvents(),
+	}
+	if cfg.ReplicationLag != nil {
+		r.ReplicationLag = cfg.ReplicationLag()
+	}
+	return r
+}
+
+// Handler serves the status page of db. It renders HTML by default and
+// JSON when the request has ?format=json or accepts only application/json,
+// so it can be mounted on an existing mux, e.g. under /status.
+func Handler(db *datastore.DB, cfg Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report := Collect(db, cfg)
+		if r.URL.Query().Get("format") == "json" || r.Header.Get("Accept") == "application/json" {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(report)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = page.Execute(w, report)
+	})
+}
+
+// ListenAndServe serves the status page of db on its own listener at addr.
+func ListenAndServe(addr string, db *datastore.DB, cfg Config) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           Handler(db, cfg),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+var page = template.Must(template.New("status").Funcs(template.FuncMap{
+	"ts": func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>datastore status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+.err { color: #b00; }
+</style>
+</head>
+<body>
+<h1>datastore status</h1>
+<p>Generated {{ts .Time}} &middot; <a href="?format=json">JSON</a></p>
+
+<h2>Stats</h2>
+<table>
+<tr><th>Puts</th><td>{{.Stats.Puts}}</td></tr>
+<tr><th>Gets</th><td>{{.Stats.Gets}}</td></tr>
+<tr><th>Bytes written</th><td>{{.Stats.BytesWritten}}</td></tr>
+<tr><th>Max segment size</th><td>{{.Stats.MaxSegmentSize}}</td></tr>
+<tr><th>Cache hits / misses</th><td>{{.Stats.CacheHits}} / {{.Stats.CacheMisses}}</td></tr>
+<tr><th>Writer fsync p50 / p99</th><td>{{.Stats.WriterSyncLatency.P50}} / {{.Stats.WriterSyncLatency.P99}}</td></tr>
+<tr><th>Compactor fsync p50 / p99</th><td>{{.Stats.CompactorSyncLatency.P50}} / {{.Stats.CompactorSyncLatency.P99}}</td></tr>
+</table>
+
+<h2>Segments</h2>
+<table>
+<tr><th>ID</th><th>Path</th><th>Size</th><th>Format</th><th>Active</th><th>Remote</th></tr>
+{{range .Segments}}<tr><td>{{.ID}}</td><td>{{.Path}}</td><td>{{.Size}}</td><td>{{.Version}}</td><td>{{if .Active}}yes{{end}}</td><td>{{if .Remote}}yes{{end}}</td></tr>
+{{end}}</table>
+
+{{if .ReplicationLag}}<h2>Replication lag</h2>
+<table>
+<tr><th>Replica</th><th>Lag</th></tr>
+{{range $name, $lag := .ReplicationLag}}<tr><td>{{$name}}</td><td>{{$lag}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Compactions</h2>
+<table>
+<tr><th>Start</th><th>Duration</th><th>Segments</th><th>Bytes before</th><th>Bytes after</th><th>Error</th></tr>
+{{range .Compactions}}<tr><td>{{ts .Start}}</td><td>{{.Duration}}</td><td>{{.Segments}}</td><td>{{.BytesBefore}}</td><td>{{.BytesAfter}}</td><td class="err">{{.Err}}</td></tr>
+{{else}}<tr><td colspan="6">none yet</td></tr>
+{{end}}</table>
+
+<h2>Recent events</h2>
+<table>
+<tr><th>Time</th><th>Kind</th><th>Message</th></tr>
+{{range .Events}}<tr><td>{{ts .Time}}</td><td>{{.Kind}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
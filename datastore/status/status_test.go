@@ -0,0 +1,69 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestHandler(t *testing.T) {
+	dir := "test_status"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Handler(db, Config{
+		ReplicationLag: func() map[string]time.Duration {
+			return map[string]time.Duration{"replica-1": time.Second}
+		},
+	})
+
+	// JSON-звіт
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status?format=json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Stats.Puts != 1 {
+		t.Errorf("expected 1 put, got %d", report.Stats.Puts)
+	}
+	if len(report.Segments) == 0 || !report.Segments[len(report.Segments)-1].Active {
+		t.Error("expected active segment to be listed last")
+	}
+	if len(report.Events) == 0 || report.Events[len(report.Events)-1].Kind != datastore.EventOpen {
+		t.Errorf("expected open event, got %v", report.Events)
+	}
+	if report.ReplicationLag["replica-1"] != time.Second {
+		t.Errorf("expected replication lag to be reported, got %v", report.ReplicationLag)
+	}
+
+	// HTML-сторінка
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if !strings.Contains(rec.Body.String(), "<h2>Segments</h2>") {
+		t.Error("expected HTML page with segments section")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
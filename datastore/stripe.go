@@ -0,0 +1,158 @@
+package datastore
+
+import (
+	"cmp"
+	"slices"
+)
+
+// stripe is an active segment with the queue and writer goroutine that
+// feed it. There is one unless Options.WriteStripes asks for more.
+//
+// The index tells segments apart by ID, and reads and merges take the
+// entry of the segment with the highest ID as the latest. Each key is
+// written by a single stripe, whose segments get increasing IDs, so that
+// holds as long as no write spans stripes; writeBatch keeps it for the
+// ones that do.
+type stripe struct {
+	n      int // Position in db.stripes
+	active *segment
+	id     int // ID the active segment takes when it is frozen
+	queue  *writeQueues
+}
+
+func newStripe(n, queueSize int) *stripe {
+	return &stripe{n: n, queue: newWriteQueues(queueSize)}
+}
+
+// segID is the segment ID the index uses for positions in the active
+// segment of the stripe until it is frozen.
+func (st *stripe) segID() int {
+	return -1 - st.n
+}
+
+// stripeFor returns the stripe that writes key.
+func (db *DB) stripeFor(key string) *stripe {
+	if len(db.stripes) == 1 {
+		return db.stripes[0]
+	}
+	return db.stripes[keyHash(key)%uint64(len(db.stripes))]
+}
+
+// queueFor returns the stripe that writes key and the hash that picks the
+// shard of its queue.
+func (db *DB) queueFor(key string) (*stripe, uint64) {
+	h := keyHash(key)
+	k := uint64(len(db.stripes))
+	return db.stripes[h%k], h / k
+}
+
+// activeIDs returns the IDs of the active segments, as the manifest
+// records them.
+func (db *DB) activeIDs() []int {
+	ids := make([]int, len(db.stripes))
+	for i, st := range db.stripes {
+		ids[i] = st.id
+	}
+	return ids
+}
+
+// writeBatch appends entries to the stripe of the first one and returns
+// it. The caller must hold db.mu.
+//
+// A batch spanning stripes must sort after what the stripes it touches
+// wrote before and before what they write next, so it goes to a segment
+// with a higher ID than their active ones, which is frozen right after,
+// and each of them moves on to a new active segment.
+func (db *DB) writeBatch(entries []entry) (*stripe, error) {
+	w := db.stripeFor(entries[0].key)
+	touched := []*stripe{w}
+	for _, e := range entries[1:] {
+		if st := db.stripeFor(e.key); !slices.Contains(touched, st) {
+			touched = append(touched, st)
+		}
+	}
+	if len(touched) == 1 {
+		return w, db.doBatch(w, entries)
+	}
+	newest := slices.MaxFunc(touched, func(a, b *stripe) int { return cmp.Compare(a.id, b.id) })
+	if newest != w {
+		if err := db.renewStripe(w); err != nil {
+			return nil, err
+		}
+	}
+	if err := db.doBatch(w, entries); err != nil {
+		return nil, err
+	}
+	for _, st := range touched {
+		if err := db.renewStripe(st); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// renewStripe moves st on to a new active segment with the next ID: an
+// empty one is replaced, any other is frozen. The caller must hold db.mu.
+func (db *DB) renewStripe(st *stripe) error {
+	if st.active.size > 0 {
+		return db.rotateActive(st)
+	}
+	s, id, err := db.nextActive(st)
+	if err != nil {
+		return err
+	}
+	old := st.active
+	st.active, st.id = s, id
+	db.retire([]*segment{old}, "")
+	return db.preallocateActive(st)
+}
+
+// actives returns the active segments. The caller must hold db.mu.
+func (db *DB) actives() []*segment {
+	segs := make([]*segment, len(db.stripes))
+	for i, st := range db.stripes {
+		segs[i] = st.active
+	}
+	return segs
+}
+
+// mergeRuns splits segs, in ID order, wherever the ID of an active segment
+// falls between two of them. A merged segment takes the ID of its newest
+// input, which must not move the older entries of a stripe past its
+// active segment.
+func (db *DB) mergeRuns(segs []*segment) [][]*segment {
+	var runs [][]*segment
+	start := 0
+	for i := 1; i <= len(segs); i++ {
+		if i == len(segs) || slices.ContainsFunc(db.stripes, func(st *stripe) bool {
+			return st.id > segs[i-1].id && st.id < segs[i].id
+		}) {
+			runs = append(runs, segs[start:i])
+			start = i
+		}
+	}
+	return runs
+}
+
+// pickRun returns the segments of segs a merge takes: all of them if width
+// is zero, else the width adjacent ones picked by smallestRun. It keeps to
+// one of the runs of mergeRuns, the longest one, or the one with the
+// smallest pick among those wide enough. The caller must hold db.mu.
+func (db *DB) pickRun(segs []*segment, width int) []*segment {
+	var best []*segment
+	var bestSize int64
+	for _, run := range db.mergeRuns(segs) {
+		if width > 0 && len(run) > width {
+			i := smallestRun(run, width)
+			run = run[i : i+width]
+		}
+		var size int64
+		for _, s := range run {
+			size += s.size
+		}
+		if len(run) > len(best) || width > 0 && len(run) == len(best) && size < bestSize {
+			best, bestSize = run, size
+		}
+	}
+	return best
+}
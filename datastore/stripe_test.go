@@ -0,0 +1,123 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWriteStripes(t *testing.T) {
+	dir := "test_write_stripes"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "512")
+
+	db, err := OpenWithOptions(dir, Options{WriteStripes: 4, SyncWrites: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Кожна горутина пише свій ключ: порядок записів ключа зберігається
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		g := g
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := db.Put(fmt.Sprintf("key%d", g), strconv.Itoa(i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(db.segments) == 0 {
+		t.Fatal("no segment was frozen")
+	}
+	m, err := readManifest(OSFS{}, dir)
+	if err != nil || len(m.actives) != 4 {
+		t.Fatalf("manifest = %v, %v", m.actives, err)
+	}
+	check := func(db *DB) {
+		t.Helper()
+		for g := 0; g < 8; g++ {
+			if v, err := db.Get(fmt.Sprintf("key%d", g)); err != nil || v != "49" {
+				t.Fatalf("key%d = %q, %v", g, v, err)
+			}
+		}
+	}
+	check(db)
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+
+	// Активні сегменти минулого запуску заморожуються
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+	if m, _ := readManifest(OSFS{}, dir); len(m.actives) != 1 {
+		t.Fatalf("manifest after reopen = %v", m.actives)
+	}
+}
+
+func TestWriteStripes_Batch(t *testing.T) {
+	dir := "test_write_stripes_batch"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{WriteStripes: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey, newKey := "a", ""
+	for i := 0; newKey == ""; i++ {
+		if k := "b" + strconv.Itoa(i); db.stripeFor(k) != db.stripeFor(oldKey) {
+			newKey = k
+		}
+	}
+	for _, kv := range [][2]string{{newKey, "before"}, {oldKey, "v"}} {
+		if err := db.Put(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Пакет охоплює дві смуги й має лишитися між попередніми та наступними записами
+	if err := db.Rename(oldKey, newKey, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(newKey, "after"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(oldKey, "again"); err != nil {
+		t.Fatal(err)
+	}
+	// Заморожуємо все, щоб злиття охопило і пакет
+	db.mu.Lock()
+	for _, st := range db.stripes {
+		if err := db.renewStripe(st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.mu.Unlock()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = OpenWithOptions(dir, Options{WriteStripes: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for k, want := range map[string]string{oldKey: "again", newKey: "after"} {
+		if v, err := db.Get(k); err != nil || v != want {
+			t.Fatalf("Get(%s) = %q, %v", k, v, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package syncmap adapts a datastore.DB to the method set of sync.Map, so
+// code written against sync.Map can keep its data across restarts by
+// swapping the type. Keys must be strings; values are converted by a Codec,
+// by default StringCodec.
+//
+// sync.Map methods cannot return errors, so errors of the DB, such as a
+// full write queue, and keys or values of the wrong type are passed to
+// Map.OnError. Without it they panic.
+package syncmap
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// ErrType is reported for keys that are not strings and values the codec
+// cannot encode.
+var ErrType = errors.New("syncmap: unsupported type")
+
+// Codec converts values to and from the strings stored in the DB.
+type Codec interface {
+	Encode(v any) (string, error)
+	Decode(s string) (any, error)
+}
+
+// StringCodec stores strings and byte slices as they are and loads every
+// value as a string.
+type StringCodec struct{}
+
+func (StringCodec) Encode(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("%w: value of type %T", ErrType, v)
+}
+
+func (StringCodec) Decode(s string) (any, error) { return s, nil }
+
+// Map is a sync.Map backed by a DB. Every method is one DB operation, and
+// the ones sync.Map documents as atomic run atomically in the DB's writer.
+type Map struct {
+	db    *datastore.DB
+	codec Codec
+	// OnError receives errors the methods cannot return. The method then
+	// behaves as if the key were missing. Nil panics.
+	OnError func(error)
+}
+
+// New returns a Map over db using codec, or StringCodec if it is nil.
+func New(db *datastore.DB, codec Codec) *Map {
+	if codec == nil {
+		codec = StringCodec{}
+	}
+	return &Map{db: db, codec: codec}
+}
+
+func (m *Map) fail(err error) {
+	if m.OnError == nil {
+		panic(err)
+	}
+	m.OnError(err)
+}
+
+func (m *Map) key(key any) (string, bool) {
+	k, ok := key.(string)
+	if !ok {
+		m.fail(fmt.Errorf("%w: key of type %T", ErrType, key))
+	}
+	return k, ok
+}
+
+func (m *Map) encode(v any) (string, bool) {
+	s, err := m.codec.Encode(v)
+	if err != nil {
+		m.fail(err)
+		return "", false
+	}
+	return s, true
+}
+
+// decode converts a loaded value, reporting whether it could.
+func (m *Map) decode(s string) (any, bool) {
+	v, err := m.codec.Decode(s)
+	if err != nil {
+		m.fail(err)
+		return nil, false
+	}
+	return v, true
+}
+
+// check reports err unless it is nil or ErrNotFound, and whether the
+// operation succeeded.
+func (m *Map) check(err error) bool {
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, datastore.ErrNotFound) {
+		m.fail(err)
+	}
+	return false
+}
+
+// Load returns the value stored for key, or nil if there is none.
+func (m *Map) Load(key any) (value any, ok bool) {
+	k, ok := m.key(key)
+	if !ok {
+		return nil, false
+	}
+	s, err := m.db.Get(k)
+	if !m.check(err) {
+		return nil, false
+	}
+	return m.decode(s)
+}
+
+// Store sets the value for key.
+func (m *Map) Store(key, value any) {
+	k, ok := m.key(key)
+	if !ok {
+		return
+	}
+	if s, ok := m.encode(value); ok {
+		m.check(m.db.Put(k, s))
+	}
+}
+
+// LoadOrStore returns the existing value for key if there is one.
+// Otherwise it stores and returns value. loaded reports whether the value
+// was already there.
+func (m *Map) LoadOrStore(key, value any) (actual any, loaded bool) {
+	k, ok := m.key(key)
+	if !ok {
+		return nil, false
+	}
+	s, ok := m.encode(value)
+	if !ok {
+		return nil, false
+	}
+	cur, loaded, err := m.db.GetOrSet(k, s)
+	if !m.check(err) {
+		return nil, false
+	}
+	if !loaded {
+		return value, false
+	}
+	actual, _ = m.decode(cur)
+	return actual, true
+}
+
+// LoadAndDelete deletes key, returning its previous value if there was
+// one.
+func (m *Map) LoadAndDelete(key any) (value any, loaded bool) {
+	k, ok := m.key(key)
+	if !ok {
+		return nil, false
+	}
+	s, loaded, err := m.db.GetDelete(k)
+	if !m.check(err) || !loaded {
+		return nil, false
+	}
+	value, _ = m.decode(s)
+	return value, true
+}
+
+// Delete deletes the value for key.
+func (m *Map) Delete(key any) {
+	if k, ok := m.key(key); ok {
+		m.check(m.db.Delete(k))
+	}
+}
+
+// Swap stores value for key and returns the previous value if there was
+// one.
+func (m *Map) Swap(key, value any) (previous any, loaded bool) {
+	k, ok := m.key(key)
+	if !ok {
+		return nil, false
+	}
+	s, ok := m.encode(value)
+	if !ok {
+		return nil, false
+	}
+	old, loaded, err := m.db.GetSet(k, s)
+	if !m.check(err) || !loaded {
+		return nil, false
+	}
+	previous, _ = m.decode(old)
+	return previous, true
+}
+
+// CompareAndSwap stores new for key if its value equals old, comparing
+// the encoded forms.
+func (m *Map) CompareAndSwap(key, old, new any) (swapped bool) {
+	k, ok := m.key(key)
+	if !ok {
+		return false
+	}
+	o, ok := m.encode(old)
+	if !ok {
+		return false
+	}
+	n, ok := m.encode(new)
+	if !ok {
+		return false
+	}
+	swapped, err := m.db.CompareAndSwap(k, o, n)
+	return m.check(err) && swapped
+}
+
+// CompareAndDelete deletes key if its value equals old, comparing the
+// encoded forms.
+func (m *Map) CompareAndDelete(key, old any) (deleted bool) {
+	k, ok := m.key(key)
+	if !ok {
+		return false
+	}
+	o, ok := m.encode(old)
+	if !ok {
+		return false
+	}
+	deleted, err := m.db.CompareAndDelete(k, o)
+	return m.check(err) && deleted
+}
+
+// Range calls f for every key in ascending order until f returns false.
+// Like sync.Map's it is not a snapshot: a key written during Range may be
+// visited with either value, or not at all. Values that fail to decode
+// are reported and skipped.
+func (m *Map) Range(f func(key, value any) bool) {
+	err := m.db.ForEach(func(key, s string) bool {
+		v, ok := m.decode(s)
+		return !ok || f(key, v)
+	})
+	m.check(err)
+}
+
+// Clear deletes every key, see DB.DropAll.
+func (m *Map) Clear() {
+	m.check(m.db.DropAll())
+}
@@ -0,0 +1,131 @@
+package syncmap_test
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+	"github.com/MikhailoSafronov/design-db-practice/datastore/syncmap"
+)
+
+// mapLike — спільний набір методів sync.Map і syncmap.Map
+type mapLike interface {
+	Load(key any) (any, bool)
+	Store(key, value any)
+	LoadOrStore(key, value any) (any, bool)
+	LoadAndDelete(key any) (any, bool)
+	Delete(key any)
+	Swap(key, value any) (any, bool)
+	CompareAndSwap(key, old, new any) bool
+	CompareAndDelete(key, old any) bool
+	Range(f func(key, value any) bool)
+}
+
+var (
+	_ mapLike = (*sync.Map)(nil)
+	_ mapLike = (*syncmap.Map)(nil)
+)
+
+func TestMap(t *testing.T) {
+	dir := "test_syncmap"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m mapLike = syncmap.New(db, nil)
+
+	// Ті самі виклики дають ті самі результати, що й у sync.Map
+	var ref sync.Map
+	for _, mm := range []mapLike{m, &ref} {
+		mm.Store("a", "1")
+		if v, ok := mm.Load("a"); !ok || v != "1" {
+			t.Fatalf("%T Load = %v, %v", mm, v, ok)
+		}
+		if v, loaded := mm.LoadOrStore("a", "2"); !loaded || v != "1" {
+			t.Fatalf("%T LoadOrStore = %v, %v", mm, v, loaded)
+		}
+		if v, loaded := mm.LoadOrStore("b", "2"); loaded || v != "2" {
+			t.Fatalf("%T LoadOrStore(b) = %v, %v", mm, v, loaded)
+		}
+		if prev, loaded := mm.Swap("a", "3"); !loaded || prev != "1" {
+			t.Fatalf("%T Swap = %v, %v", mm, prev, loaded)
+		}
+		if mm.CompareAndSwap("a", "1", "4") || !mm.CompareAndSwap("a", "3", "4") {
+			t.Fatalf("%T CompareAndSwap", mm)
+		}
+		if mm.CompareAndDelete("b", "x") || !mm.CompareAndDelete("b", "2") {
+			t.Fatalf("%T CompareAndDelete", mm)
+		}
+		if v, loaded := mm.LoadAndDelete("a"); !loaded || v != "4" {
+			t.Fatalf("%T LoadAndDelete = %v, %v", mm, v, loaded)
+		}
+		if _, ok := mm.Load("a"); ok {
+			t.Fatalf("%T a still there", mm)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		m.Store("k"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	n := 0
+	m.Range(func(key, value any) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Fatalf("Range visited %d keys", n)
+	}
+	db.Close()
+
+	// Дані переживають перезапуск
+	db, err = datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	reopened := syncmap.New(db, nil)
+	if v, ok := reopened.Load("k4"); !ok || v != "4" {
+		t.Fatalf("Load after reopen = %v, %v", v, ok)
+	}
+	reopened.Clear()
+	if _, ok := reopened.Load("k4"); ok {
+		t.Fatal("k4 survived Clear")
+	}
+}
+
+func TestMap_Errors(t *testing.T) {
+	dir := "test_syncmap_errors"
+	defer os.RemoveAll(dir)
+
+	db, err := datastore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m := syncmap.New(db, nil)
+
+	var errs []error
+	m.OnError = func(err error) { errs = append(errs, err) }
+	m.Store(1, "v")
+	m.Store("k", 3.14)
+	if _, ok := m.Load(2); ok {
+		t.Fatal("Load of int key succeeded")
+	}
+	if len(errs) != 3 || !errors.Is(errs[0], syncmap.ErrType) {
+		t.Fatalf("errors = %v", errs)
+	}
+
+	// Без OnError помилки панікують, як неприпустимий ключ у sync.Map
+	m.OnError = nil
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	m.Store([]int{1}, "v")
+}
@@ -0,0 +1,318 @@
+// Package testutil helps validate the durability of a datastore.DB: a
+// FaultFS that injects write and fsync faults and simulates crashes, and
+// Torture, which runs crash-recovery scenarios against a set of Options.
+package testutil
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+var (
+	// ErrInjected is returned by the writes a FaultFS fails on purpose.
+	ErrInjected = errors.New("testutil: injected fault")
+	// ErrCrashed is returned by every call to a FaultFS after Crash.
+	ErrCrashed = errors.New("testutil: filesystem crashed")
+)
+
+// Faults are the faults a FaultFS injects.
+type Faults struct {
+	// FailAfterBytes fails writes once this many bytes have been written
+	// since the faults were set; the write crossing the limit is cut short.
+	// Zero disables it.
+	FailAfterBytes int64
+	// DropSyncs makes Sync report success without making anything
+	// durable, like a disk that lies about its write cache.
+	DropSyncs bool
+	// DuplicateEvery makes every n-th write land twice, first torn after
+	// half of it and then whole, as a write retried after a short one
+	// would. It still reports success. Zero disables it.
+	DuplicateEvery int
+}
+
+// FaultFS is a datastore.FS that injects Faults into the FS it wraps and
+// tracks how much of every file has been synced, so Crash can lose the
+// rest. Creating, renaming and removing files counts as durable at once.
+type FaultFS struct {
+	disk *disk
+
+	mu      sync.Mutex
+	faults  Faults
+	written int64
+	writes  int
+	crashed bool
+}
+
+// disk is the storage FaultFS instances share across crashes.
+type disk struct {
+	mu    sync.Mutex
+	base  datastore.FS
+	files map[string]*fileState
+}
+
+// fileState is the size of a file as written and as synced.
+type fileState struct {
+	size, durable int64
+}
+
+// NewFaultFS returns a FaultFS over base, without faults. Nil means a new
+// datastore.MemFS.
+func NewFaultFS(base datastore.FS) *FaultFS {
+	if base == nil {
+		base = datastore.NewMemFS()
+	}
+	return &FaultFS{disk: &disk{base: base, files: make(map[string]*fileState)}}
+}
+
+// SetFaults replaces the injected faults and restarts the byte and write
+// counts they refer to.
+func (f *FaultFS) SetFaults(faults Faults) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults, f.written, f.writes = faults, 0, 0
+}
+
+// Crash simulates a power loss: every file loses the bytes written to it
+// since it was last synced, and f fails every call from then on, so the DB
+// using it can be closed without touching the files. It returns a FaultFS
+// without faults over what is left, to reopen the DB on.
+func (f *FaultFS) Crash() (*FaultFS, error) {
+	f.mu.Lock()
+	f.crashed = true
+	f.mu.Unlock()
+
+	d := f.disk
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, st := range d.files {
+		if st.durable < st.size {
+			if err := d.truncate(name, st.durable); err != nil {
+				return nil, err
+			}
+			st.size = st.durable
+		}
+	}
+	return &FaultFS{disk: d}, nil
+}
+
+// truncate cuts the file off at size. The caller must hold d.mu.
+func (d *disk) truncate(name string, size int64) error {
+	data := make([]byte, size)
+	if size > 0 {
+		r, err := d.base.Open(name)
+		if err != nil {
+			return err
+		}
+		_, err = r.ReadAt(data, 0)
+		r.Close()
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	w, err := d.base.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (f *FaultFS) check() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.crashed {
+		return ErrCrashed
+	}
+	return nil
+}
+
+func (f *FaultFS) Open(name string) (datastore.File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (f *FaultFS) Create(name string) (datastore.File, error) {
+	return f.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o666)
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm fs.FileMode) (datastore.File, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	d := f.disk
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	file, err := d.base.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	name = filepath.Clean(name)
+	st, ok := d.files[name]
+	switch {
+	case flag&os.O_TRUNC != 0:
+		st = &fileState{}
+		d.files[name] = st
+	case !ok:
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		st = &fileState{size: info.Size(), durable: info.Size()}
+		d.files[name] = st
+	}
+	return &faultFile{File: file, fs: f, state: st}, nil
+}
+
+func (f *FaultFS) Rename(oldpath, newpath string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	d := f.disk
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.base.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	if st, ok := d.files[oldpath]; ok {
+		d.files[newpath] = st
+		delete(d.files, oldpath)
+	} else {
+		delete(d.files, newpath)
+	}
+	return nil
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	d := f.disk
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.base.Remove(name); err != nil {
+		return err
+	}
+	delete(d.files, filepath.Clean(name))
+	return nil
+}
+
+func (f *FaultFS) RemoveAll(path string) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	d := f.disk
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.base.RemoveAll(path); err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	for name := range d.files {
+		if name == path || strings.HasPrefix(name, path+string(filepath.Separator)) {
+			delete(d.files, name)
+		}
+	}
+	return nil
+}
+
+func (f *FaultFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return f.disk.base.ReadDir(name)
+}
+
+func (f *FaultFS) MkdirAll(path string, perm fs.FileMode) error {
+	if err := f.check(); err != nil {
+		return err
+	}
+	return f.disk.base.MkdirAll(path, perm)
+}
+
+// faultFile is a file of a FaultFS. Files are only ever appended to, so
+// the synced part of a file is a prefix of it.
+type faultFile struct {
+	datastore.File
+	fs    *FaultFS
+	state *fileState
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.fs.check(); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.fs.check(); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	ffs := f.fs
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	if ffs.crashed {
+		return 0, ErrCrashed
+	}
+	ffs.writes++
+	want, err := p, error(nil)
+	if limit := ffs.faults.FailAfterBytes; limit > 0 && ffs.written+int64(len(p)) > limit {
+		want, err = p[:max(limit-ffs.written, 0)], ErrInjected
+	}
+	if n := ffs.faults.DuplicateEvery; n > 0 && ffs.writes%n == 0 && err == nil && len(p) > 1 {
+		if err := f.write(p[:len(p)/2]); err != nil {
+			return 0, err
+		}
+	}
+	if len(want) > 0 {
+		if err := f.write(want); err != nil {
+			return 0, err
+		}
+	}
+	ffs.written += int64(len(want))
+	return len(want), err
+}
+
+// write writes p to the wrapped file. The caller must hold f.fs.mu.
+func (f *faultFile) write(p []byte) error {
+	d := f.fs.disk
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n, err := f.File.Write(p)
+	f.state.size += int64(n)
+	return err
+}
+
+func (f *faultFile) Sync() error {
+	ffs := f.fs
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	if ffs.crashed {
+		return ErrCrashed
+	}
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	if !ffs.faults.DropSyncs {
+		d := ffs.disk
+		d.mu.Lock()
+		f.state.durable = f.state.size
+		d.mu.Unlock()
+	}
+	return nil
+}
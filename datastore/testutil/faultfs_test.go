@@ -0,0 +1,92 @@
+package testutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func readAll(t *testing.T, f *FaultFS, name string) []byte {
+	t.Helper()
+	r, err := f.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFaultFS_Crash(t *testing.T) {
+	ffs := NewFaultFS(nil)
+	w, err := ffs.Create("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("synced"))
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("lost"))
+
+	// Після збою лишається тільки синхронізоване
+	after, err := ffs.Crash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, after, "f"); string(got) != "synced" {
+		t.Errorf("got %q after crash", got)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, ErrCrashed) {
+		t.Errorf("write after crash: %v", err)
+	}
+	if err := ffs.Remove("f"); !errors.Is(err, ErrCrashed) {
+		t.Errorf("remove after crash: %v", err)
+	}
+}
+
+func TestFaultFS_Faults(t *testing.T) {
+	ffs := NewFaultFS(nil)
+	ffs.SetFaults(Faults{FailAfterBytes: 10})
+	w, err := ffs.Create("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]byte("12345678")); n != 8 || err != nil {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	// Запис, що перетинає межу, обрізається
+	if n, err := w.Write([]byte("abcd")); n != 2 || !errors.Is(err, ErrInjected) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if got := readAll(t, ffs, "f"); string(got) != "12345678ab" {
+		t.Errorf("got %q", got)
+	}
+
+	ffs.SetFaults(Faults{DropSyncs: true, DuplicateEvery: 2})
+	w, err = ffs.Create("g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("one"))
+	if n, err := w.Write([]byte("twos")); n != 4 || err != nil {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if got := readAll(t, ffs, "g"); !bytes.Equal(got, []byte("onetwtwos")) {
+		t.Errorf("got %q, expected a torn duplicate", got)
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ffs.Crash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, after, "g"); len(got) != 0 {
+		t.Errorf("got %q despite dropped syncs", got)
+	}
+}
@@ -0,0 +1,178 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+// Scenario is a crash-recovery torture run, see Torture.
+type Scenario struct {
+	// Options are those the DB is opened with. FS is replaced by a
+	// FaultFS over it.
+	Options datastore.Options
+	// Faults are injected while writing, anew every round; reopening the
+	// DB runs without them.
+	Faults Faults
+	// Rounds is the number of write, crash and reopen cycles. Zero means
+	// 10.
+	Rounds int
+	// Writes is the number of writes per round. A round ends early at the
+	// first write that fails. Zero means 200.
+	Writes int
+	// Keys is the number of distinct keys written. Zero means 20.
+	Keys int
+	// Seed seeds the random puts and deletes.
+	Seed int64
+}
+
+func (s *Scenario) rounds() int {
+	if s.Rounds > 0 {
+		return s.Rounds
+	}
+	return 10
+}
+
+func (s *Scenario) writes() int {
+	if s.Writes > 0 {
+		return s.Writes
+	}
+	return 200
+}
+
+func (s *Scenario) keys() int {
+	if s.Keys > 0 {
+		return s.Keys
+	}
+	return 20
+}
+
+// durable says whether writes that returned must survive a crash.
+func (s *Scenario) durable() bool {
+	return s.Options.SyncWrites && !s.Faults.DropSyncs
+}
+
+// op is a put, or a delete if del is set.
+type op struct {
+	key, value string
+	del        bool
+}
+
+// Torture runs s on the DB in dir: every round writes random puts and
+// deletes with the faults injected, crashes without closing the DB,
+// reopens it and checks what it recovered. The contents must be those
+// after some prefix of the writes, one that holds every write that
+// returned if Options.SyncWrites is set and syncs are not dropped. It
+// returns the first violation, or the error that failed reopening.
+func Torture(dir string, s Scenario) error {
+	ffs := NewFaultFS(s.Options.FS)
+	opts := s.Options
+	opts.FS = ffs
+	db, err := datastore.OpenWithOptions(dir, opts)
+	if err != nil {
+		return err
+	}
+	state := make(map[string]string)
+	for round := 0; round < s.rounds(); round++ {
+		ffs.SetFaults(s.Faults)
+		ops, acked := s.run(db, state, rand.New(rand.NewSource(s.Seed+int64(round))), round)
+
+		crashed, err := ffs.Crash()
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("round %d: crash: %w", round, err)
+		}
+		// Fails on the crashed FS without touching the files.
+		db.Close()
+		ffs, opts.FS = crashed, crashed
+		if db, err = datastore.OpenWithOptions(dir, opts); err != nil {
+			return fmt.Errorf("round %d: reopen: %w", round, err)
+		}
+
+		got, err := s.contents(db)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("round %d: %w", round, err)
+		}
+		least := 0
+		if s.durable() {
+			least = acked
+		}
+		p, ok := matchPrefix(state, ops, got, least)
+		if !ok {
+			db.Close()
+			return fmt.Errorf("round %d: recovered contents match no prefix of the %d writes, %d of which returned, from write %d on",
+				round, len(ops), acked, least)
+		}
+		for _, o := range ops[:p] {
+			apply(state, o)
+		}
+	}
+	return db.Close()
+}
+
+// run writes random puts and deletes to db, whose contents are state,
+// until one fails. It returns the writes tried and how many returned.
+func (s *Scenario) run(db *datastore.DB, state map[string]string, rng *rand.Rand, round int) ([]op, int) {
+	var ops []op
+	cur := maps.Clone(state)
+	for i := 0; i < s.writes(); i++ {
+		o := op{key: fmt.Sprintf("key%03d", rng.Intn(s.keys()))}
+		var err error
+		if _, exists := cur[o.key]; exists && rng.Intn(10) == 0 {
+			o.del = true
+			err = db.Delete(o.key)
+		} else {
+			o.value = fmt.Sprintf("r%d-w%d", round, i)
+			err = db.Put(o.key, o.value)
+		}
+		ops = append(ops, o)
+		if err != nil {
+			return ops, len(ops) - 1
+		}
+		apply(cur, o)
+	}
+	return ops, len(ops)
+}
+
+// contents reads every key the scenario writes.
+func (s *Scenario) contents(db *datastore.DB) (map[string]string, error) {
+	got := make(map[string]string)
+	for i := 0; i < s.keys(); i++ {
+		key := fmt.Sprintf("key%03d", i)
+		v, err := db.Get(key)
+		switch {
+		case err == nil:
+			got[key] = v
+		case !errors.Is(err, datastore.ErrNotFound):
+			return nil, fmt.Errorf("get %s: %w", key, err)
+		}
+	}
+	return got, nil
+}
+
+// matchPrefix returns the length, least or more, of the prefix of ops
+// that turns base into got.
+func matchPrefix(base map[string]string, ops []op, got map[string]string, least int) (int, bool) {
+	state := maps.Clone(base)
+	for p := 0; p <= len(ops); p++ {
+		if p > 0 {
+			apply(state, ops[p-1])
+		}
+		if p >= least && maps.Equal(state, got) {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+func apply(state map[string]string, o op) {
+	if o.del {
+		delete(state, o.key)
+	} else {
+		state[o.key] = o.value
+	}
+}
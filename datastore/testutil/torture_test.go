@@ -0,0 +1,29 @@
+package testutil
+
+import (
+	"testing"
+
+	"github.com/MikhailoSafronov/design-db-practice/datastore"
+)
+
+func TestTorture(t *testing.T) {
+	for _, s := range []Scenario{
+		{Options: datastore.Options{SyncWrites: true, MaxSegmentSize: 2048, RecoveryMode: datastore.RecoveryRepairTail}, Faults: Faults{FailAfterBytes: 1500}, Rounds: 30},
+		{Options: datastore.Options{MaxSegmentSize: 2048}, Faults: Faults{FailAfterBytes: 3000}, Seed: 1},
+		{Options: datastore.Options{SyncWrites: true, WriteBuffer: &datastore.WriteBufferOptions{}}, Seed: 2},
+	} {
+		if err := Torture("db", s); err != nil {
+			t.Errorf("%+v: %v", s.Options, err)
+		}
+	}
+}
+
+func TestTorture_DetectsLoss(t *testing.T) {
+	// Втрачені fsync і розірвані дублікати записів мають виявлятися
+	for _, faults := range []Faults{{DropSyncs: true}, {DuplicateEvery: 50}} {
+		s := Scenario{Options: datastore.Options{SyncWrites: true, MaxSegmentSize: 2048}, Faults: faults, Rounds: 3}
+		if err := Torture("db", s); err == nil {
+			t.Errorf("%+v: expected a violation", faults)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package datastore
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ObjectStore is remote storage for cold segments, such as an S3 or GCS
+// bucket. Objects are written once and never modified, so any blob store
+// can back it with a thin adapter.
+type ObjectStore interface {
+	Upload(ctx context.Context, name string, r io.Reader) error
+	Download(ctx context.Context, name string, w io.Writer) error
+	Delete(ctx context.Context, name string) error
+}
+
+// TierOptions configures moving cold segments to an ObjectStore.
+type TierOptions struct {
+	Store ObjectStore
+	// Prefix is prepended to object names, so several DBs can share a
+	// bucket.
+	Prefix string
+	// KeepLocal is the number of newest frozen segments that stay on local
+	// disk. Zero means 2.
+	KeepLocal int
+	// CacheSegments is the number of offloaded segments kept on local disk
+	// after reads fetched them. Zero means 1.
+	CacheSegments int
+	// Interval between background offload passes. Zero disables them;
+	// call Offload instead.
+	Interval time.Duration
+}
+
+const (
+	remoteMagic  = "DSKR"
+	tierCacheDir = "tier-cache"
+)
+
+var remoteRE = regexp.MustCompile(`^segment-(\d+)\.remote$`)
+
+// remoteSegment serves reads of an offloaded segment from a local copy,
+// downloading it first if it is not cached.
+type remoteSegment struct {
+	tier     *tier
+	name     string // Object name
+	size     int64
+	lastUsed atomic.Int64
+
+	mu   sync.RWMutex
+	file File // Local copy, nil when not cached
+}
+
+// tier tracks offloaded segments and the local copies of them.
+type tier struct {
+	opts TierOptions
+	fs   FS
+	dir  string // Cache directory
+
+	mu     sync.Mutex
+	cached []*remoteSegment
+}
+
+func newTier(fsys FS, dir string, opts TierOptions) (*tier, error) {
+	if opts.KeepLocal <= 0 {
+		opts.KeepLocal = 2
+	}
+	if opts.CacheSegments <= 0 {
+		opts.CacheSegments = 1
+	}
+	t := &tier{opts: opts, fs: fsys, dir: filepath.Join(dir, tierCacheDir)}
+	// Copies left by an earlier run are not tracked; start empty.
+	if err := fsys.RemoveAll(t.dir); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *remoteSegment) ReadAt(p []byte, off int64) (int, error) {
+	r.lastUsed.Store(time.Now().UnixNano())
+	for {
+		r.mu.RLock()
+		if r.file != nil {
+			n, err := r.file.ReadAt(p, off)
+			r.mu.RUnlock()
+			return n, err
+		}
+		r.mu.RUnlock()
+		if err := r.fetch(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// fetch downloads the segment into the cache directory.
+func (r *remoteSegment) fetch() error {
+	r.mu.Lock()
+	if r.file != nil {
+		r.mu.Unlock()
+		return nil
+	}
+	f, err := r.tier.download(r.name, r.size)
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.file = f
+	r.mu.Unlock()
+	r.tier.cachedCopy(r)
+	return nil
+}
+
+func (r *remoteSegment) evict() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.tier.fs.Remove(r.file.Name())
+		r.file = nil
+	}
+}
+
+func (r *remoteSegment) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (t *tier) download(name string, size int64) (File, error) {
+	if err := t.fs.MkdirAll(t.dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(t.dir, filepath.Base(name))
+	tmp, err := t.fs.Create(path + ".part")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.opts.Store.Download(context.Background(), name, tmp); err != nil {
+		tmp.Close()
+		t.fs.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to fetch segment %s: %w", name, err)
+	}
+	err = t.fs.Rename(tmp.Name(), path)
+	tmp.Close()
+	if err != nil {
+		t.fs.Remove(tmp.Name())
+		return nil, err
+	}
+	f, err := t.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != size {
+		f.Close()
+		t.fs.Remove(path)
+		return nil, fmt.Errorf("fetched segment %s has the wrong size", name)
+	}
+	return f, nil
+}
+
+// cachedCopy records that r was fetched and evicts the least recently used
+// copies beyond the cache limit.
+func (t *tier) cachedCopy(r *remoteSegment) {
+	t.mu.Lock()
+	t.cached = append(t.cached, r)
+	var evict []*remoteSegment
+	for len(t.cached) > t.opts.CacheSegments {
+		oldest := 0
+		for i, c := range t.cached {
+			if c != r && (t.cached[oldest] == r || c.lastUsed.Load() < t.cached[oldest].lastUsed.Load()) {
+				oldest = i
+			}
+		}
+		evict = append(evict, t.cached[oldest])
+		t.cached = append(t.cached[:oldest], t.cached[oldest+1:]...)
+	}
+	t.mu.Unlock()
+	for _, c := range evict {
+		c.evict()
+	}
+}
+
+// reader returns where the segment's data is read from. Reads of an
+// active segment see only the bytes committed as of the call.
+func (s *segment) reader() io.ReaderAt {
+	if s.remote != nil {
+		return s.remote
+	}
+	if r, ok := s.committedReader(); ok {
+		return r
+	}
+	return s.file
+}
+
+// committedReader returns the reader of an active segment, or of one whose
+// last bytes are still in the write buffer.
+func (s *segment) committedReader() (committedReader, bool) {
+	if s.remote != nil || (s.id >= 0 && len(s.pending) == 0) {
+		return committedReader{}, false
+	}
+	return committedReader{file: s.file, flushed: s.size - int64(len(s.pending)), pending: s.pending}, true
+}
+
+// readAt is reader().ReadAt without boxing the reader of an active
+// segment, for Get.
+func (s *segment) readAt(p []byte, off int64) (int, error) {
+	if r, ok := s.committedReader(); ok {
+		return r.ReadAt(p, off)
+	}
+	return s.reader().ReadAt(p, off)
+}
+
+// localSuffix returns the index of the first segment after the offloaded
+// ones. Offloading always takes the oldest segments, so offloaded segments
+// form a prefix; a segment another write stripe froze later with a lower
+// ID may still sit among them, and is left out. The caller must hold
+// db.mu.
+func (db *DB) localSuffix() int {
+	i := len(db.segments)
+	for i > 0 && db.segments[i-1].remote == nil {
+		i--
+	}
+	return i
+}
+
+// Offload moves cold frozen segments, all but the newest
+// TierOptions.KeepLocal, to the object store and returns how many it
+// moved. Each one is replaced locally by a small hint file holding its keys
+// and offsets, so the index can be rebuilt without downloading it.
+// Offloaded segments are no longer compacted.
+func (db *DB) Offload(ctx context.Context) (int, error) {
+	if db.tier == nil {
+		return 0, errors.New("tiering is not configured")
+	}
+	// Merge must not rewrite segments while they are uploaded.
+	db.mergeMu.Lock()
+	defer db.mergeMu.Unlock()
+
+	db.mu.RLock()
+	first := db.localSuffix()
+	last := len(db.segments) - db.tier.opts.KeepLocal
+	var cold []*segment
+	if last > first {
+		cold = append(cold, db.segments[first:last]...)
+	}
+	db.mu.RUnlock()
+
+	for i, s := range cold {
+		if err := db.offload(ctx, s); err != nil {
+			return i, err
+		}
+	}
+	return len(cold), nil
+}
+
+func (db *DB) offload(ctx context.Context, s *segment) error {
+	name := fmt.Sprintf("%ssegment-%d-%d.data", db.tier.opts.Prefix, s.id, time.Now().UnixNano())
+	if err := db.tier.opts.Store.Upload(ctx, name, io.NewSectionReader(s.file, 0, s.size)); err != nil {
+		return err
+	}
+	hintPath := filepath.Join(db.dir, fmt.Sprintf("segment-%d.remote", s.id))
+	if err := writeRemoteHint(db.fs, hintPath, s, name); err != nil {
+		db.tier.opts.Store.Delete(ctx, name)
+		return err
+	}
+
+	rs := &remoteSegment{tier: db.tier, name: name, size: s.size}
+	db.mu.Lock()
+	s.mu.Lock()
+	s.remote = rs
+	err := s.file.Close()
+	s.file = nil
+	db.fs.Remove(s.path)
+	s.path = hintPath
+	s.mu.Unlock()
+	db.mu.Unlock()
+	db.event(EventOffload, "offloaded segment %d (%d bytes) as %s", s.id, s.size, name)
+	db.log(slog.LevelInfo, "segment offloaded", "segment", s.id, "bytes", s.size, "object", name)
+	return err
+}
+
+// tierer offloads cold segments every interval until the DB is closed.
+func (db *DB) tierer(interval time.Duration) {
+	defer db.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := db.Offload(context.Background()); err != nil {
+				db.event(EventOffloadFailed, "offload failed: %v", err)
+				db.log(slog.LevelError, "offload failed", "err", err)
+			}
+		case <-db.quit:
+			return
+		}
+	}
+}
+
+// A hint file is a header, magic + segment format version + 2 reserved
+// bytes + segment size + offset of the first entry + object name, followed
+// by one record per indexed entry: key length (uint32), kind (1 byte),
+// offset (int64), sequence number (uint64) and the key.
+func writeRemoteHint(fsys FS, path string, s *segment, name string) error {
+	tmp := path + ".tmp"
+	f, err := fsys.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer fsys.Remove(tmp)
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	hdr := make([]byte, 0, 64)
+	hdr = append(hdr, remoteMagic...)
+	hdr = binary.LittleEndian.AppendUint16(hdr, s.version)
+	hdr = append(hdr, 0, 0)
+	hdr = binary.LittleEndian.AppendUint64(hdr, uint64(s.size))
+	hdr = binary.LittleEndian.AppendUint64(hdr, uint64(s.dataStart))
+	hdr = binary.LittleEndian.AppendUint16(hdr, uint16(len(name)))
+	hdr = append(hdr, name...)
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(s.file, s.dataStart, s.size-s.dataStart))
+	offset := s.dataStart
+	rec := make([]byte, 0, 64)
+	for {
+		var e entry
+		n, err := decodeEntry(&e, r, s.version)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if e.kind != kindHistory {
+			rec = binary.LittleEndian.AppendUint32(rec[:0], uint32(len(e.key)))
+			rec = append(rec, byte(e.kind))
+			rec = binary.LittleEndian.AppendUint64(rec, uint64(offset))
+			rec = binary.LittleEndian.AppendUint64(rec, e.seq)
+			rec = append(rec, e.key...)
+			if _, err := w.Write(rec); err != nil {
+				return err
+			}
+		}
+		offset += int64(n)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, path)
+}
+
+// openRemoteSegment reads the header of the hint file at path.
+func (db *DB) openRemoteSegment(id int, path string) (*segment, error) {
+	if db.tier == nil {
+		return nil, fmt.Errorf("segment %d is offloaded but tiering is not configured", id)
+	}
+	f, err := db.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	hdr := make([]byte, 4+2+2+8+8+2)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("failed to read hint file %s: %w", path, err)
+	}
+	if string(hdr[0:4]) != remoteMagic {
+		return nil, fmt.Errorf("%s is not a hint file", path)
+	}
+	name := make([]byte, binary.LittleEndian.Uint16(hdr[24:26]))
+	if _, err := io.ReadFull(r, name); err != nil {
+		return nil, fmt.Errorf("failed to read hint file %s: %w", path, err)
+	}
+	size := int64(binary.LittleEndian.Uint64(hdr[8:16]))
+	return &segment{
+		id:        id,
+		path:      path,
+		size:      size,
+		version:   binary.LittleEndian.Uint16(hdr[4:6]),
+		dataStart: int64(binary.LittleEndian.Uint64(hdr[16:24])),
+		remote:    &remoteSegment{tier: db.tier, name: string(name), size: size},
+	}, nil
+}
+
+// scanRemoteHint indexes the entries listed in the hint file of s.
+func (db *DB) scanRemoteHint(s *segment, rp *recoveryProgress) (int, error) {
+	f, err := db.fs.Open(s.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	hdr := make([]byte, 26)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return 0, err
+	}
+	if _, err := r.Discard(int(binary.LittleEndian.Uint16(hdr[24:26]))); err != nil {
+		return 0, err
+	}
+	rec := make([]byte, 4+1+8+8)
+	keys := keyHashes{complete: true}
+	for count := 0; ; count++ {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				s.keys = keys.filter()
+				return count, nil
+			}
+			return count, fmt.Errorf("truncated hint file %s: %w", s.path, err)
+		}
+		key := make([]byte, binary.LittleEndian.Uint32(rec[0:4]))
+		if _, err := io.ReadFull(r, key); err != nil {
+			return count, fmt.Errorf("truncated hint file %s: %w", s.path, err)
+		}
+		keys.add(string(key))
+		offset := int64(binary.LittleEndian.Uint64(rec[5:13]))
+		// Hints do not record entry sizes; count the key alone.
+		db.indexEntry(string(key), entryKind(rec[4]), position{segID: s.id, offset: offset, size: int64(len(key))})
+		if db.evictor != nil {
+			db.evictor.record(string(key), entryKind(rec[4]), int64(len(key)))
+		}
+		if seq := binary.LittleEndian.Uint64(rec[13:21]); seq > db.seq.Load() {
+			db.seq.Store(seq)
+		}
+		rp.entry(0)
+	}
+}
+
+// remoteIDs returns the ids of the hint files in dir.
+func remoteIDs(names []os.DirEntry) map[int]bool {
+	ids := make(map[int]bool)
+	for _, e := range names {
+		if m := remoteRE.FindStringSubmatch(e.Name()); len(m) == 2 {
+			id, _ := strconv.Atoi(m[1])
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// DirStore is an ObjectStore keeping objects as files in a directory, such
+// as a mounted network filesystem.
+type DirStore string
+
+func (d DirStore) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+func (d DirStore) Upload(_ context.Context, name string, r io.Reader) error {
+	p := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(p + ".part")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(p+".part", p)
+}
+
+func (d DirStore) Download(_ context.Context, name string, w io.Writer) error {
+	f, err := os.Open(d.path(name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (d DirStore) Delete(_ context.Context, name string) error {
+	return os.Remove(d.path(name))
+}
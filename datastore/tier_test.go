@@ -0,0 +1,167 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStore рахує завантаження з віддаленого сховища
+type countingStore struct {
+	DirStore
+	downloads atomic.Int64
+}
+
+func (c *countingStore) Download(ctx context.Context, name string, w io.Writer) error {
+	c.downloads.Add(1)
+	return c.DirStore.Download(ctx, name, w)
+}
+
+func TestTiering_OffloadAndFetch(t *testing.T) {
+	dir, remote := "test_tier", "test_tier_remote"
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(remote)
+	t.Setenv("SEG_MAX", "100")
+
+	store := &countingStore{DirStore: DirStore(remote)}
+	opts := Options{Tier: &TierOptions{Store: store, Prefix: "db1/", KeepLocal: 1, CacheSegments: 1}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		if err := db.Put(fmt.Sprintf("key%02d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := db.Offload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("nothing was offloaded")
+	}
+	remoteSegs := 0
+	for _, s := range db.Segments() {
+		if s.Remote {
+			remoteSegs++
+		}
+	}
+	if remoteSegs != n {
+		t.Fatalf("%d segments report remote, offloaded %d", remoteSegs, n)
+	}
+	// Активний сегмент теж зберігається як segment-N.data
+	if local, _ := filepath.Glob(filepath.Join(dir, "segment-*.data")); len(local) != 2 {
+		t.Fatalf("expected 1 local segment besides the active one, got %v", local)
+	}
+
+	check := func(db *DB) {
+		t.Helper()
+		for i := 0; i < 40; i++ {
+			if v, err := db.Get(fmt.Sprintf("key%02d", i)); err != nil || v != fmt.Sprintf("value%d", i) {
+				t.Fatalf("key%02d = %q, %v", i, v, err)
+			}
+		}
+	}
+	check(db)
+	if store.downloads.Load() == 0 {
+		t.Fatal("reads did not fetch offloaded segments")
+	}
+	// Локально лишається не більше CacheSegments завантажених копій
+	if cached, _ := filepath.Glob(filepath.Join(dir, tierCacheDir, "*")); len(cached) > 1 {
+		t.Fatalf("cache holds %d segments", len(cached))
+	}
+	seq := db.CurrentSeq()
+	db.Close()
+
+	// Індекс відновлюється з hint-файлів без завантаження сегментів
+	store.downloads.Store(0)
+	reopened, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if store.downloads.Load() != 0 {
+		t.Fatal("recovery downloaded segments")
+	}
+	if reopened.CurrentSeq() != seq {
+		t.Fatalf("CurrentSeq = %d, want %d", reopened.CurrentSeq(), seq)
+	}
+	check(reopened)
+}
+
+func TestTiering_MergeKeepsOperandsOverRemoteBase(t *testing.T) {
+	dir, remote := "test_tier_operands", "test_tier_operands_remote"
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(remote)
+	t.Setenv("SEG_MAX", "60")
+
+	opts := Options{Tier: &TierOptions{Store: DirStore(remote), KeepLocal: 1}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.RegisterMerge(sumMerge)
+	db.Put("n", "10")
+	for i := 0; i < 3; i++ {
+		db.Put(fmt.Sprintf("pad%d", i), "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx")
+	}
+	if _, err := db.Offload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Segments()[0].Remote {
+		t.Fatal("segment holding the base value was not offloaded")
+	}
+
+	// Операнди в локальних сегментах, базове значення — у віддаленому
+	for i := 0; i < 5; i++ {
+		if err := db.MergeValue("n", "1"); err != nil {
+			t.Fatal(err)
+		}
+		db.Put(fmt.Sprintf("fill%d", i), "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx")
+	}
+	if err := db.merge(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get("n"); err != nil || v != "15" {
+		t.Fatalf("Get = %q, %v; want 15", v, err)
+	}
+	db.Close()
+
+	reopened, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	reopened.RegisterMerge(sumMerge)
+	if v, err := reopened.Get("n"); err != nil || v != "15" {
+		t.Fatalf("after reopen Get = %q, %v; want 15", v, err)
+	}
+}
+
+func TestTiering_RequiresStoreToOpen(t *testing.T) {
+	dir, remote := "test_tier_nostore", "test_tier_nostore_remote"
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(remote)
+	t.Setenv("SEG_MAX", "50")
+
+	db, err := OpenWithOptions(dir, Options{Tier: &TierOptions{Store: DirStore(remote), KeepLocal: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		db.Put(fmt.Sprintf("key%d", i), "value")
+	}
+	if n, err := db.Offload(context.Background()); err != nil || n == 0 {
+		t.Fatalf("Offload = %d, %v", n, err)
+	}
+	db.Close()
+
+	if _, err := Open(dir); err == nil {
+		t.Fatal("expected error opening offloaded segments without a store")
+	}
+}
@@ -0,0 +1,115 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans of a DB.
+const tracerName = "github.com/MikhailoSafronov/design-db-practice/datastore"
+
+// Attributes of the spans of a DB.
+const (
+	// AttrKeyPrefix is the part of the key up to its first '/' or ':',
+	// so spans group by key space without recording keys themselves.
+	AttrKeyPrefix = attribute.Key("db.key_prefix")
+	// AttrSegment is the ID of the segment a read found the key in;
+	// negative IDs are active segments.
+	AttrSegment = attribute.Key("db.segment")
+	// AttrSource is where a read found the value: "pending", "cache",
+	// "segment", or "none" for a missing key.
+	AttrSource = attribute.Key("db.source")
+	// AttrBytesRead is the size of the entry a read decoded.
+	AttrBytesRead = attribute.Key("db.bytes_read")
+	// AttrQueueWait is the time in milliseconds a write waited in the
+	// queue for the writer.
+	AttrQueueWait = attribute.Key("db.queue_wait_ms")
+)
+
+// keyPrefix returns the AttrKeyPrefix of key. Reserved keys, which start
+// with a zero byte, are cut after their second one.
+func keyPrefix(key string) string {
+	if rest, ok := strings.CutPrefix(key, "\x00"); ok {
+		if i := strings.IndexByte(rest, 0); i >= 0 {
+			return key[:i+2]
+		}
+		return ""
+	}
+	if i := strings.IndexAny(key, "/:"); i >= 0 {
+		return key[:i+1]
+	}
+	return ""
+}
+
+// readInfo is what a traced read reports in its span.
+type readInfo struct {
+	source string
+	pos    position
+}
+
+// traceGet is get in a span that is a child of ctx.
+func (db *DB) traceGet(ctx context.Context, key string) (string, error) {
+	_, span := db.tracer.Start(ctx, "datastore.Get", trace.WithAttributes(AttrKeyPrefix.String(keyPrefix(key))))
+	defer span.End()
+	info := readInfo{source: "none"}
+	v, err := db.get(key, &info)
+	span.SetAttributes(AttrSource.String(info.source))
+	if info.source == "segment" {
+		span.SetAttributes(AttrSegment.Int(info.pos.segID), AttrBytesRead.Int64(info.pos.size))
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return v, err
+}
+
+// startWriteSpan starts the span of req, a child of ctx, and has the
+// writer report its queue wait. It returns nil without
+// Options.TracerProvider.
+func (db *DB) startWriteSpan(ctx context.Context, req *writeRequest) trace.Span {
+	if db.tracer == nil {
+		return nil
+	}
+	name := "datastore.Put"
+	switch {
+	case req.batch != nil || req.update != nil:
+		name = "datastore.Write"
+	case req.kind == kindTombstone:
+		name = "datastore.Delete"
+	}
+	_, span := db.tracer.Start(ctx, name, trace.WithAttributes(AttrKeyPrefix.String(keyPrefix(req.key))))
+	req.wait = new(time.Duration)
+	return span
+}
+
+// endWriteSpan ends span, if any, with the outcome of req. The writer has
+// answered req unless it failed to queue.
+func endWriteSpan(span trace.Span, req *writeRequest, answered bool, err error) {
+	if span == nil {
+		return
+	}
+	if answered {
+		span.SetAttributes(AttrQueueWait.Float64(float64(*req.wait) / float64(time.Millisecond)))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startSpan starts a span named name, a child of ctx, or returns a span
+// that records nothing without Options.TracerProvider.
+func (db *DB) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	if db.tracer == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return db.tracer.Start(ctx, name)
+}
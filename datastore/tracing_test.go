@@ -0,0 +1,105 @@
+package datastore
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttr(s sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracing(t *testing.T) {
+	dir := "test_tracing"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "200")
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	db, err := OpenWithOptions(dir, Options{TracerProvider: tp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		if err := db.Put("users/1", "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Delete("users/1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("users/2", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Спан читання вкладається у спан виклику
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	if _, err := db.GetContext(ctx, "users/2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get("missing"); err != ErrNotFound {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	counts := make(map[string]int)
+	for _, s := range rec.Ended() {
+		counts[s.Name()]++
+		switch s.Name() {
+		case "datastore.Put", "datastore.Delete":
+			if v, _ := spanAttr(s, AttrKeyPrefix); v.AsString() != "users/" {
+				t.Errorf("%s: expected key prefix users/, got %q", s.Name(), v.AsString())
+			}
+			if _, ok := spanAttr(s, AttrQueueWait); !ok {
+				t.Errorf("%s: expected queue wait", s.Name())
+			}
+		case "datastore.Get":
+			src, _ := spanAttr(s, AttrSource)
+			if s.Parent().SpanID() == parent.SpanContext().SpanID() {
+				_, seg := spanAttr(s, AttrSegment)
+				size, _ := spanAttr(s, AttrBytesRead)
+				if src.AsString() != "segment" || !seg || size.AsInt64() <= 0 {
+					t.Errorf("unexpected read attributes %v", s.Attributes())
+				}
+			} else if src.AsString() != "none" || s.Parent().IsValid() {
+				t.Errorf("unexpected span of a missing key %v", s.Attributes())
+			}
+		case "datastore.Merge":
+			if v, _ := spanAttr(s, "db.merge.segments"); v.AsInt64() < 2 {
+				t.Errorf("unexpected merge attributes %v", s.Attributes())
+			}
+		}
+	}
+	if counts["datastore.Put"] != 21 || counts["datastore.Delete"] != 1 || counts["datastore.Get"] != 2 || counts["datastore.Merge"] != 1 {
+		t.Errorf("unexpected spans %v", counts)
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	for key, want := range map[string]string{
+		"users/1/name":   "users/",
+		"session:abc":    "session:",
+		"plain":          "",
+		LockPrefix + "x": LockPrefix,
+		"\x00broken":     "",
+	} {
+		if got := keyPrefix(key); got != want {
+			t.Errorf("keyPrefix(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidValue is returned for a write a registered validator rejects.
+var ErrInvalidValue = errors.New("invalid value")
+
+// Validator checks a value about to be written under key, returning an
+// error describing why it is malformed.
+type Validator func(key, value string) error
+
+type prefixValidator struct {
+	prefix string
+	fn     Validator
+}
+
+// RegisterValidator makes every full-value write to a key starting with
+// prefix, whether by Put, a batch or an update like CompareAndSwap, run fn
+// first and fail with ErrInvalidValue if it rejects the value. Every
+// matching validator runs, and a batch is rejected as a whole. Merge
+// operands and deletes are not checked.
+//
+// Validators run on the writer goroutine with the DB locked, so they must
+// be quick and must not use the DB. Like merge operators they have to be
+// registered again after every Open.
+func (db *DB) RegisterValidator(prefix string, fn Validator) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.validators = append(db.validators, prefixValidator{prefix, fn})
+}
+
+// validate runs the registered validators on the values among entries.
+// The caller must hold db.mu.
+func (db *DB) validate(entries []entry) error {
+	if len(db.validators) == 0 {
+		return nil
+	}
+	for _, e := range entries {
+		if e.kind != kindValue {
+			continue
+		}
+		for _, v := range db.validators {
+			if !strings.HasPrefix(e.key, v.prefix) {
+				continue
+			}
+			if err := v.fn(e.key, e.value); err != nil {
+				return fmt.Errorf("%w for %q: %v", ErrInvalidValue, e.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// JSONObject returns a Validator accepting JSON objects that have all the
+// required members.
+func JSONObject(required ...string) Validator {
+	return func(_, value string) error {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(value), &obj); err != nil {
+			return err
+		}
+		if obj == nil {
+			return errors.New("not a JSON object")
+		}
+		for _, name := range required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("missing member %q", name)
+			}
+		}
+		return nil
+	}
+}
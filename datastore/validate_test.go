@@ -0,0 +1,53 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	dir := "test_validate"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.RegisterValidator("user:", JSONObject("name"))
+	db.RegisterValidator("user:", func(_, value string) error {
+		if len(value) > 64 {
+			return errors.New("too long")
+		}
+		return nil
+	})
+
+	if err := db.Put("user:1", `{"name":"alice"}`); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{`not json`, `[1,2]`, `null`, `{"age":3}`, `{"name":"` + strings.Repeat("a", 64) + `"}`} {
+		if err := db.Put("user:2", bad); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("Put(%q) err = %v", bad, err)
+		}
+	}
+	if _, err := db.Get("user:2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("rejected value was written: %v", err)
+	}
+
+	// Оновлення теж перевіряються, а інші префікси — ні
+	if ok, err := db.CompareAndSwap("user:1", `{"name":"alice"}`, `{}`); ok || !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("CompareAndSwap = %v, %v", ok, err)
+	}
+	if v, _ := db.Get("user:1"); v != `{"name":"alice"}` {
+		t.Errorf("user:1 = %q", v)
+	}
+	if err := db.Put("order:1", "anything"); err != nil {
+		t.Error(err)
+	}
+	if err := db.Delete("user:1"); err != nil {
+		t.Error(err)
+	}
+}
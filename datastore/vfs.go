@@ -0,0 +1,79 @@
+package datastore
+
+import (
+	"io"
+	"io/fs"
+	"os"
+)
+
+// FS is the filesystem a DB keeps its files in. Every file operation of
+// the DB goes through it, so tests can run on an in-memory filesystem or
+// inject faults, and segments can live on other storage.
+type FS interface {
+	// Open opens name for reading.
+	Open(name string) (File, error)
+	// Create creates or truncates name for reading and writing.
+	Create(name string) (File, error)
+	// OpenFile is the generalized open call, taking os.O_* flags.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
+}
+
+// File is an open file of an FS.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Closer
+	Sync() error
+	Stat() (fs.FileInfo, error)
+	Name() string
+}
+
+// OSFS is the FS of the host operating system, used when Options.FS is
+// nil.
+type OSFS struct{}
+
+func (OSFS) Open(name string) (File, error) {
+	return osFile(os.Open(name))
+}
+
+func (OSFS) Create(name string) (File, error) {
+	return osFile(os.Create(name))
+}
+
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return osFile(os.OpenFile(name, flag, perm))
+}
+
+func (OSFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// osFile keeps a nil *os.File from turning into a non-nil File.
+func osFile(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,143 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingFS записує всі виклики й може підсовувати помилки
+type recordingFS struct {
+	OSFS
+	mu       sync.Mutex
+	ops      []string
+	failOpen string
+}
+
+func (r *recordingFS) record(op, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, op+" "+name)
+}
+
+func (r *recordingFS) count(op string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, o := range r.ops {
+		if strings.HasPrefix(o, op+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *recordingFS) Open(name string) (File, error) {
+	r.record("open", name)
+	return r.OSFS.Open(name)
+}
+
+func (r *recordingFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	r.record("openfile", name)
+	if r.failOpen != "" && strings.Contains(name, r.failOpen) {
+		return nil, errors.New("injected failure")
+	}
+	return r.OSFS.OpenFile(name, flag, perm)
+}
+
+func (r *recordingFS) Rename(oldpath, newpath string) error {
+	r.record("rename", newpath)
+	return r.OSFS.Rename(oldpath, newpath)
+}
+
+func (r *recordingFS) Remove(name string) error {
+	r.record("remove", name)
+	return r.OSFS.Remove(name)
+}
+
+func (r *recordingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	r.record("readdir", name)
+	return r.OSFS.ReadDir(name)
+}
+
+func TestFS_AllOpsGoThroughIt(t *testing.T) {
+	dir := "test_vfs"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "200")
+
+	rfs := &recordingFS{}
+	db, err := OpenWithOptions(dir, Options{FS: rfs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(fmt.Sprintf("key%d", i%5), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ротація, злиття й відкриття мають іти через FS
+	for _, op := range []string{"readdir", "openfile", "rename", "remove", "open"} {
+		if rfs.count(op) == 0 {
+			t.Errorf("expected %s to go through the FS, ops: %v", op, rfs.ops)
+		}
+	}
+
+	db, err = OpenWithOptions(dir, Options{FS: rfs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 15; i < 20; i++ {
+		v, err := db.Get(fmt.Sprintf("key%d", i%5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != fmt.Sprintf("value%d", i) {
+			t.Errorf("expected value%d, got %s", i, v)
+		}
+	}
+}
+
+func TestFS_OpenFailure(t *testing.T) {
+	dir := "test_vfs_fail"
+	defer os.RemoveAll(dir)
+
+	// Помилка FS при відкритті активного сегмента повертається з Open
+	rfs := &recordingFS{failOpen: "segment-0.data"}
+	if _, err := OpenWithOptions(dir, Options{FS: rfs}); err == nil {
+		t.Fatal("expected Open to fail")
+	}
+}
+
+func TestMigrateFS(t *testing.T) {
+	dir := "test_vfs_migrate"
+	defer os.RemoveAll(dir)
+
+	db, err := OpenWithOptions(dir, Options{FormatVersion: FormatV1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	rfs := &recordingFS{}
+	if err := MigrateFS(rfs, dir, CurrentFormat); err != nil {
+		t.Fatal(err)
+	}
+	if rfs.count("rename") == 0 {
+		t.Errorf("expected migration to go through the FS, ops: %v", rfs.ops)
+	}
+}
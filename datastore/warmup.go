@@ -0,0 +1,68 @@
+package datastore
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Warmup reads the keys starting with any of prefixes, or every key if
+// none is given, so the first reads after a deploy do not wait for the
+// disk: index implementations that load keys lazily load them, values go
+// into the value cache if it is enabled, and the segment pages read stay
+// in the OS page cache. It does not count as reads in Stats or for
+// Eviction, and returns the number of keys read.
+func (db *DB) Warmup(prefixes ...string) (int, error) {
+	start := time.Now()
+	bp := getEntryBuf()
+	defer putEntryBuf(bp)
+	n := 0
+	for _, prefix := range warmupPrefixes(prefixes) {
+		keys, _ := db.keysInRange(prefix, prefixEnd(prefix))
+		for _, key := range keys {
+			if err := db.warm(key, bp); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	db.log(slog.LevelInfo, "warmup finished", "prefixes", prefixes, "keys", n, "duration", time.Since(start))
+	return n, nil
+}
+
+// warm reads the value of key and caches it, unless a write replaced it
+// meanwhile.
+func (db *DB) warm(key string, buf *[]byte) error {
+	raw, pos, nocache, err := db.lookup(key, buf)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil || db.cache == nil || nocache {
+		return err
+	}
+	db.mu.RLock()
+	if cur, ok := db.index.get(key); ok && cur == pos {
+		db.cache.add(key, string(raw))
+	}
+	db.mu.RUnlock()
+	return nil
+}
+
+// warmupPrefixes drops the prefixes another one covers, so no key is read
+// twice.
+func warmupPrefixes(prefixes []string) []string {
+	if len(prefixes) == 0 {
+		return []string{""}
+	}
+	sorted := append([]string(nil), prefixes...)
+	sort.Strings(sorted)
+	var kept []string
+	for _, p := range sorted {
+		if len(kept) == 0 || !strings.HasPrefix(p, kept[len(kept)-1]) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
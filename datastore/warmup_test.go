@@ -0,0 +1,71 @@
+package datastore
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestWarmup(t *testing.T) {
+	dir := "test_warmup"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		for _, prefix := range []string{"hot/", "hot/a/", "cold/"} {
+			if err := db.Put(fmt.Sprintf("%s%d", prefix, i), fmt.Sprintf("value%d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Delete("hot/0"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = OpenWithOptions(dir, Options{CacheBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Префікс, що вже покритий іншим, не читається двічі
+	n, err := db.Warmup("hot/a/", "hot/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 19 {
+		t.Errorf("expected 19 keys warmed, got %d", n)
+	}
+	if v, ok := db.cache.get("hot/a/3"); !ok || v != "value3" {
+		t.Errorf("expected hot/a/3 cached, got %q, %v", v, ok)
+	}
+	if _, ok := db.cache.get("cold/3"); ok {
+		t.Error("expected cold/3 not to be cached")
+	}
+	if gets := db.Stats().Gets; gets != 0 {
+		t.Errorf("expected warmup not to count as reads, got %d", gets)
+	}
+
+	if n, err := db.Warmup(); err != nil || n != 29 {
+		t.Errorf("Warmup() = %d, %v", n, err)
+	}
+}
+
+func TestWarmupPrefixes(t *testing.T) {
+	for _, tc := range []struct {
+		in, want []string
+	}{
+		{nil, []string{""}},
+		{[]string{"b", "a/x", "a/"}, []string{"a/", "b"}},
+		{[]string{"x", ""}, []string{""}},
+	} {
+		if got := warmupPrefixes(tc.in); !slices.Equal(got, tc.want) {
+			t.Errorf("warmupPrefixes(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package datastore
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrWatchOverflow ends a watch whose consumer fell further behind than
+// its buffer allows.
+var ErrWatchOverflow = errors.New("watch buffer overflow")
+
+// Watcher receives the writes to keys with a prefix, as they commit.
+type Watcher struct {
+	db     *DB
+	prefix string
+	ch     chan Change
+	err    error // Set under db.watchers.mu before ch is closed
+
+	// live is the watch a WatchFrom watcher forwards after replaying the
+	// backlog; stop ends the forwarding.
+	live *Watcher
+	stop chan struct{}
+	once sync.Once
+}
+
+type watchers struct {
+	mu  sync.Mutex
+	set map[*Watcher]struct{}
+}
+
+// Watch starts reporting every write committed from now on to a key with
+// prefix, in commit order. An empty prefix watches every key.
+//
+// Writes never wait for watchers: once buffer changes are pending, the
+// watch ends with ErrWatchOverflow. The watch also ends when the DB
+// closes.
+func (db *DB) Watch(prefix string, buffer int) *Watcher {
+	w := &Watcher{db: db, prefix: prefix, ch: make(chan Change, max(buffer, 1))}
+	db.watchers.mu.Lock()
+	defer db.watchers.mu.Unlock()
+	if db.watchers.set == nil {
+		db.watchers.set = make(map[*Watcher]struct{})
+	}
+	db.watchers.set[w] = struct{}{}
+	return w
+}
+
+// WatchFrom is Watch resuming from a saved position: it first replays the
+// writes with sequence numbers above after that are still on disk, as
+// Changes returns them, then goes on with the live ones, each write
+// reported once. A consumer that records the Seq of every change it
+// handled can reconnect with it without missing writes, as long as no
+// merge compacted them away; Options.ChangeRetention keeps merges off
+// recent segments for that. buffer must also hold the writes committed
+// while the backlog is replayed.
+func (db *DB) WatchFrom(prefix string, after uint64, buffer int) (*Watcher, error) {
+	// Watch first, so that every write is either on disk by the time the
+	// backlog is read or reported live.
+	live := db.Watch(prefix, buffer)
+	changes, err := db.Changes(after, 0)
+	if err != nil {
+		live.Close()
+		return nil, err
+	}
+	backlog := changes[:0]
+	for _, c := range changes {
+		if strings.HasPrefix(c.Key, prefix) {
+			backlog = append(backlog, c)
+		}
+	}
+	w := &Watcher{db: db, prefix: prefix, ch: make(chan Change), live: live, stop: make(chan struct{})}
+	go w.forward(backlog, after)
+	return w, nil
+}
+
+// forward sends backlog and then the live changes not in it.
+func (w *Watcher) forward(backlog []Change, last uint64) {
+	defer close(w.ch)
+	for _, c := range backlog {
+		select {
+		case w.ch <- c:
+			last = c.Seq
+		case <-w.stop:
+			return
+		}
+	}
+	for c := range w.live.ch {
+		if c.Seq <= last {
+			continue
+		}
+		select {
+		case w.ch <- c:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Changes returns the channel the writes are sent on. It is closed when
+// the watch ends.
+func (w *Watcher) Changes() <-chan Change {
+	return w.ch
+}
+
+// Err returns why the watch ended once Changes is closed: nil after Close
+// and Close of the DB, ErrWatchOverflow if the consumer was too slow.
+func (w *Watcher) Err() error {
+	if w.live != nil {
+		return w.live.Err()
+	}
+	w.db.watchers.mu.Lock()
+	defer w.db.watchers.mu.Unlock()
+	return w.err
+}
+
+// Close ends the watch.
+func (w *Watcher) Close() {
+	if w.live != nil {
+		w.live.Close()
+		w.once.Do(func() { close(w.stop) })
+		return
+	}
+	w.db.watchers.mu.Lock()
+	defer w.db.watchers.mu.Unlock()
+	w.db.endWatch(w, nil)
+}
+
+// endWatch removes w and closes its channel. The caller must hold
+// db.watchers.mu.
+func (db *DB) endWatch(w *Watcher, err error) {
+	if _, ok := db.watchers.set[w]; !ok {
+		return
+	}
+	delete(db.watchers.set, w)
+	w.err = err
+	close(w.ch)
+}
+
+// notifyWatchers sends e to the watchers of its key.
+func (db *DB) notifyWatchers(e entry) {
+	db.watchers.mu.Lock()
+	defer db.watchers.mu.Unlock()
+	if len(db.watchers.set) == 0 {
+		return
+	}
+	c := Change{Seq: e.seq, Key: e.key, Value: e.value}
+	switch e.kind {
+	case kindTombstone:
+		c.Op = ChangeDelete
+	case kindMergeOperand:
+		c.Op = ChangeMerge
+	}
+	for w := range db.watchers.set {
+		if !strings.HasPrefix(e.key, w.prefix) {
+			continue
+		}
+		select {
+		case w.ch <- c:
+		default:
+			db.endWatch(w, ErrWatchOverflow)
+		}
+	}
+}
+
+// mergeable returns how many of segs, oldest first, were frozen long
+// enough ago for merges to compact them under Options.ChangeRetention.
+func (db *DB) mergeable(segs []*segment) int {
+	if db.opts.ChangeRetention <= 0 {
+		return len(segs)
+	}
+	cutoff := db.now().Add(-db.opts.ChangeRetention)
+	for i, s := range segs {
+		if s.frozen.After(cutoff) {
+			return i
+		}
+	}
+	return len(segs)
+}
+
+// closeWatchers ends every watch.
+func (db *DB) closeWatchers() {
+	db.watchers.mu.Lock()
+	defer db.watchers.mu.Unlock()
+	for w := range db.watchers.set {
+		db.endWatch(w, nil)
+	}
+}
@@ -0,0 +1,131 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := "test_watch"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := db.Watch("user/", 10)
+	if err := db.Put("user/1", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("order/1", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete("user/1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Лише ключі з префіксом, у порядку запису
+	c := <-w.Changes()
+	if c.Op != ChangePut || c.Key != "user/1" || c.Value != "alice" || c.Seq != 1 {
+		t.Errorf("unexpected change %+v", c)
+	}
+	c = <-w.Changes()
+	if c.Op != ChangeDelete || c.Key != "user/1" || c.Seq != 3 {
+		t.Errorf("unexpected change %+v", c)
+	}
+
+	// Повільний споживач відключається, а не гальмує запис
+	slow := db.Watch("", 2)
+	for i := 0; i < 5; i++ {
+		if err := db.Put("k"+strconv.Itoa(i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := 0
+	for range slow.Changes() {
+		n++
+	}
+	if n != 2 || !errors.Is(slow.Err(), ErrWatchOverflow) {
+		t.Errorf("expected overflow after 2 changes, got %d, %v", n, slow.Err())
+	}
+
+	w.Close()
+	if _, ok := <-w.Changes(); ok {
+		t.Error("expected channel closed after Close")
+	}
+	last := db.Watch("", 1)
+	db.Close()
+	if _, ok := <-last.Changes(); ok || last.Err() != nil {
+		t.Errorf("expected clean end on DB close, got %v", last.Err())
+	}
+}
+
+func TestWatchFrom(t *testing.T) {
+	dir := "test_watch_from"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "100")
+
+	now := time.Unix(1700000000, 0)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	db, err := OpenWithOptions(dir, Options{ChangeRetention: time.Hour, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := db.Put("user/1", strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Злиття не чіпає сегменти, молодші за вікно збереження
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := db.Changes(0, 0); err != nil || len(changes) != 10 {
+		t.Fatalf("Changes = %d, %v", len(changes), err)
+	}
+
+	// Споживач відновлюється з 5-го запису і далі отримує нові
+	w, err := db.WatchFrom("user/", 5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := db.Put("user/2", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put("order/1", "y"); err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(6); want <= 11; want++ {
+		c := <-w.Changes()
+		if c.Seq != want {
+			t.Fatalf("got change %+v, want seq %d", c, want)
+		}
+	}
+	w.Close()
+	for c := range w.Changes() {
+		t.Errorf("unexpected change %+v after Close", c)
+	}
+
+	// Поза вікном злиття стискає історію як звичайно
+	mu.Lock()
+	now = now.Add(2 * time.Hour)
+	mu.Unlock()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := db.Changes(0, 0); err != nil || len(changes) >= 10 {
+		t.Fatalf("Changes = %d, %v after merge", len(changes), err)
+	}
+}
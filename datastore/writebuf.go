@@ -0,0 +1,156 @@
+package datastore
+
+import (
+	"io"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultWriteBufferSize  = 64 << 10
+	defaultWriteBufferFlush = 10 * time.Millisecond
+)
+
+// WriteBufferOptions configures buffering of writes to the active segment.
+type WriteBufferOptions struct {
+	// Size is the number of buffered bytes that triggers a flush. Zero
+	// means 64 KiB.
+	Size int
+	// FlushInterval is the longest time written entries stay in the
+	// buffer. Zero means 10ms.
+	FlushInterval time.Duration
+}
+
+func (o *WriteBufferOptions) size() int {
+	if o.Size > 0 {
+		return o.Size
+	}
+	return defaultWriteBufferSize
+}
+
+func (o *WriteBufferOptions) interval() time.Duration {
+	if o.FlushInterval > 0 {
+		return o.FlushInterval
+	}
+	return defaultWriteBufferFlush
+}
+
+// appendActive appends data to the active segment of st, through the
+// write buffer if there is one, and commits it: the size of the segment,
+// up to which reads see its bytes, only grows once data is complete. The
+// caller must hold db.mu.
+func (db *DB) appendActive(st *stripe, data []byte) (int, error) {
+	s := st.active
+	wb := db.opts.WriteBuffer
+	if wb == nil {
+		n, err := s.file.Write(data)
+		if err != nil {
+			return n, err
+		}
+		// Reads of IndexCOW do not hold db.mu, so size changes under s.mu.
+		s.mu.Lock()
+		s.size += int64(n)
+		s.mu.Unlock()
+		return n, nil
+	}
+	s.mu.Lock()
+	s.pending = append(s.pending, data...)
+	s.size += int64(len(data))
+	s.mu.Unlock()
+	if len(s.pending) >= wb.size() {
+		if err := db.flushActive(st); err != nil {
+			return len(data), err
+		}
+	}
+	return len(data), nil
+}
+
+// flushActive writes the buffered bytes of the active segment of st to
+// its file. The caller must hold db.mu. Readers use the bytes in the
+// buffer until they are written, so s.mu is only taken to swap the buffer
+// out.
+func (db *DB) flushActive(st *stripe) error {
+	s := st.active
+	if len(s.pending) == 0 {
+		return nil
+	}
+	n, err := s.file.Write(s.pending)
+	s.mu.Lock()
+	// The old buffer is left as is: readers may still hold it.
+	if err != nil {
+		s.pending = append([]byte(nil), s.pending[n:]...)
+	} else {
+		s.pending = nil
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// Flush writes buffered entries to the active segments and syncs them to
+// disk. Without Options.WriteBuffer it only syncs.
+func (db *DB) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, st := range db.stripes {
+		if err := db.flushActive(st); err != nil {
+			return err
+		}
+		if err := db.syncFile(st.active.file, SyncSourceWriter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushTicker returns the channel the writer flushes the buffer on, or nil
+// without a write buffer.
+func (db *DB) flushTicker() (<-chan time.Time, func()) {
+	if db.opts.WriteBuffer == nil {
+		return nil, func() {}
+	}
+	t := time.NewTicker(db.opts.WriteBuffer.interval())
+	return t.C, t.Stop
+}
+
+// flushBuffered is the periodic flush of the writer of st.
+func (db *DB) flushBuffered(st *stripe) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.flushActive(st); err != nil {
+		db.log(slog.LevelError, "flushing write buffer failed", "err", err)
+	}
+}
+
+// committedReader reads the committed bytes of an active segment: offsets
+// before flushed come from the file, the rest from a snapshot of the write
+// buffer. Bytes the writer is still appending past them read as io.EOF.
+type committedReader struct {
+	file    io.ReaderAt
+	flushed int64
+	pending []byte
+}
+
+func (r committedReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < r.flushed {
+		m, err := r.file.ReadAt(p[:min(int64(len(p)), r.flushed-off)], off)
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if n < len(p) && int64(m) < r.flushed-off {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	if n < len(p) {
+		i := off + int64(n) - r.flushed
+		if i >= int64(len(r.pending)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], r.pending[i:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,160 @@
+package datastore
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteBuffer(t *testing.T) {
+	dir := "test_write_buffer"
+	defer os.RemoveAll(dir)
+	// Сегмент не має ротуватися посеред перевірки
+	t.Setenv("SEG_MAX", "1048576")
+
+	opts := Options{WriteBuffer: &WriteBufferOptions{Size: 1 << 20, FlushInterval: time.Hour}}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := db.Put("k"+strconv.Itoa(i), "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Записи ще в буфері, але вже читаються
+	fi, err := os.Stat(db.stripes[0].active.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() >= db.stripes[0].active.size {
+		t.Fatalf("file has %d of %d bytes, expected buffered writes", fi.Size(), db.stripes[0].active.size)
+	}
+	for i := 0; i < 100; i++ {
+		if v, err := db.Get("k" + strconv.Itoa(i)); err != nil || v != "v"+strconv.Itoa(i) {
+			t.Fatalf("Get(k%d) = %q, %v", i, v, err)
+		}
+	}
+	if changes, err := db.Changes(0, 0); err != nil || len(changes) != 100 {
+		t.Fatalf("Changes = %d, %v", len(changes), err)
+	}
+
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(db.stripes[0].active.path); fi.Size() != db.stripes[0].active.size {
+		t.Fatalf("file has %d of %d bytes after Flush", fi.Size(), db.stripes[0].active.size)
+	}
+
+	// Close скидає решту буфера
+	db.Put("last", "x")
+	db.Close()
+	reopened, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if v, err := reopened.Get("last"); err != nil || v != "x" {
+		t.Fatalf("Get(last) = %q, %v", v, err)
+	}
+}
+
+func TestWriteBuffer_Flushes(t *testing.T) {
+	dir := "test_write_buffer_flush"
+	defer os.RemoveAll(dir)
+	t.Setenv("SEG_MAX", "2000")
+
+	db, err := OpenWithOptions(dir, Options{WriteBuffer: &WriteBufferOptions{Size: 256, FlushInterval: 5 * time.Millisecond}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Паралельні читання під час записів, ротацій і скидань буфера
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if v, err := db.Get("k0"); err == nil && v[0] != 'v' {
+					t.Errorf("Get(k0) = %q", v)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 300; i++ {
+		if err := db.Put("k"+strconv.Itoa(i%20), "v"+strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if db.segmentCount() == 0 {
+		t.Fatal("expected rotations")
+	}
+	for i := 280; i < 300; i++ {
+		if v, err := db.Get("k" + strconv.Itoa(i%20)); err != nil || v != "v"+strconv.Itoa(i) {
+			t.Fatalf("Get = %q, %v", v, err)
+		}
+	}
+
+	// Інтервал скидає буфер без явного Flush
+	db.Put("tick", "x")
+	deadline := time.Now().Add(time.Second)
+	for {
+		db.mu.RLock()
+		n := len(db.stripes[0].active.pending)
+		db.mu.RUnlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("buffer not flushed by the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCommittedReader(t *testing.T) {
+	dir := "test_committed_reader"
+	defer os.RemoveAll(dir)
+
+	for _, opts := range []Options{{}, {WriteBuffer: &WriteBufferOptions{Size: 1 << 20, FlushInterval: time.Hour}}} {
+		os.RemoveAll(dir)
+		db, err := OpenWithOptions(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put("k", "v"); err != nil {
+			t.Fatal(err)
+		}
+		s := db.stripes[0].active
+		// Байти, які записувач ще дописує, не видно читачам
+		if _, err := s.file.Write([]byte("half-written")); err != nil {
+			t.Fatal(err)
+		}
+		s.mu.RLock()
+		committed := s.size
+		b := make([]byte, 4)
+		n, err := s.reader().ReadAt(b, committed)
+		s.mu.RUnlock()
+		if n != 0 || err != io.EOF {
+			t.Errorf("buffered=%v: read %d bytes past the committed size, err %v", opts.WriteBuffer != nil, n, err)
+		}
+		if v, err := db.Get("k"); err != nil || v != "v" {
+			t.Errorf("buffered=%v: Get(k) = %q, %v", opts.WriteBuffer != nil, v, err)
+		}
+		db.Close()
+	}
+}
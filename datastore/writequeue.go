@@ -0,0 +1,108 @@
+package datastore
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// maxWriteBatch caps the writes the writer applies under one hold of db.mu.
+const maxWriteBatch = 256
+
+// ErrClosed is returned by writes queued after Close.
+var ErrClosed = errors.New("database is closed")
+
+// writeQueue is one shard of the queue of a stripe. Writers to a key
+// always use the same shard, so their writes keep their order.
+type writeQueue struct {
+	mu     sync.Mutex
+	reqs   []writeRequest
+	closed bool
+}
+
+// writeQueues spreads the writes queued for a stripe over one shard per
+// CPU, so that concurrent writers do not contend on a single channel. The
+// writer takes whatever every shard holds at once, shard by shard, so only
+// the writes to one key keep the order they were queued in.
+type writeQueues struct {
+	shards []*writeQueue
+	size   int          // Writes queued before Backpressure applies
+	depth  atomic.Int64 // Writes in all shards
+	ready  chan struct{}
+
+	roomMu sync.Mutex
+	room   chan struct{} // Closed once the writer takes writes; nil if no one waits
+}
+
+func newWriteQueues(size int) *writeQueues {
+	q := &writeQueues{size: size, ready: make(chan struct{}, 1)}
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		q.shards = append(q.shards, &writeQueue{})
+	}
+	return q
+}
+
+// reserve takes a place in the queue, beyond its size if grow is set.
+func (q *writeQueues) reserve(grow bool) bool {
+	if n := q.depth.Add(1); n > int64(q.size) && !grow {
+		q.depth.Add(-1)
+		return false
+	}
+	return true
+}
+
+// push adds req to the shard for hash h, on a place taken with reserve,
+// and wakes the writer.
+func (q *writeQueues) push(h uint64, req writeRequest) error {
+	w := q.shards[h%uint64(len(q.shards))]
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		q.depth.Add(-1)
+		return ErrClosed
+	}
+	w.reqs = append(w.reqs, req)
+	w.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// waitRoom returns a channel closed the next time the writer takes writes
+// from the queue.
+func (q *writeQueues) waitRoom() <-chan struct{} {
+	q.roomMu.Lock()
+	defer q.roomMu.Unlock()
+	if q.room == nil {
+		q.room = make(chan struct{})
+	}
+	return q.room
+}
+
+// take appends the writes of all shards to batch and returns it. If last
+// is set, the shards refuse further writes.
+func (q *writeQueues) take(batch []writeRequest, last bool) []writeRequest {
+	n := len(batch)
+	for _, w := range q.shards {
+		w.mu.Lock()
+		batch = append(batch, w.reqs...)
+		clear(w.reqs)
+		w.reqs = w.reqs[:0]
+		w.closed = w.closed || last
+		w.mu.Unlock()
+	}
+	if len(batch) == n && !last {
+		return batch
+	}
+	q.depth.Add(-int64(len(batch) - n))
+	q.roomMu.Lock()
+	if q.room != nil {
+		close(q.room)
+		q.room = nil
+	}
+	q.roomMu.Unlock()
+	return batch
+}
@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestWriteQueue_GroupCommit(t *testing.T) {
+	dir := "test_write_queue_group"
+	defer os.RemoveAll(dir)
+
+	t.Setenv("SEG_MAX", "10485760")
+
+	db, err := OpenWithOptions(dir, Options{SyncWrites: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := db.update("stall", func(string, bool) (string, error) {
+			close(entered)
+			<-unblock
+			return "v", nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	<-entered
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := db.Put(fmt.Sprintf("key%d", i), "value"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	waitFor(t, func() bool { return db.queueDepth() == 20 })
+	before := db.Stats().WriterSyncLatency.Count
+	close(unblock)
+	wg.Wait()
+
+	// Записи з черги застосовуються разом і діляться одним fsync
+	if n := db.Stats().WriterSyncLatency.Count - before; n != 2 {
+		t.Errorf("expected 2 fsyncs, got %d", n)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := db.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Errorf("key%d: %v", i, err)
+		}
+	}
+}
+
+func TestWriteQueue_Closed(t *testing.T) {
+	dir := "test_write_queue_closed"
+	defer os.RemoveAll(dir)
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := db.Put("key", "value"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// zsetPrefix starts the keys the members of sorted sets are stored under,
+// one entry per member with its score as the value. They are reserved, see
+// Reserved, so only ZAdd and ZRem write them.
+const zsetPrefix = "\x00zset\x00"
+
+// ZMember is a member of a sorted set and its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// zsets keeps the sorted sets read so far ordered by score in memory.
+// They are loaded from their member entries on first use, which is a
+// range scan, cheap with IndexBTree.
+type zsets struct {
+	mu     sync.Mutex
+	sets   map[string]*zset
+	loaded uint64        // gen the sets were loaded at
+	gen    atomic.Uint64 // Bumped by DropAll
+}
+
+// zset is a sorted set: byScore orders its members by sortable score
+// encoding followed by the member.
+type zset struct {
+	scores  map[string]float64
+	byScore btreeIndex
+}
+
+// ZAdd sets the score of member in the sorted set at key, adding the
+// member if needed. NaN scores are rejected.
+func (db *DB) ZAdd(key, member string, score float64) error {
+	if math.IsNaN(score) {
+		return fmt.Errorf("invalid score %v for %q", score, member)
+	}
+	db.zsets.mu.Lock()
+	defer db.zsets.mu.Unlock()
+	z, err := db.zset(key)
+	if err != nil {
+		return err
+	}
+	if err := db.Put(zsetMemberKey(key, member), strconv.FormatFloat(score, 'g', -1, 64), reservedWrite()); err != nil {
+		return err
+	}
+	z.set(member, score)
+	return nil
+}
+
+// ZRem removes members from the sorted set at key. Missing members are
+// ignored.
+func (db *DB) ZRem(key string, members ...string) error {
+	db.zsets.mu.Lock()
+	defer db.zsets.mu.Unlock()
+	z, err := db.zset(key)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if _, ok := z.scores[m]; !ok {
+			continue
+		}
+		if err := db.send(writeRequest{key: zsetMemberKey(key, m), kind: kindTombstone, reserved: true}); err != nil {
+			return err
+		}
+		z.remove(m)
+	}
+	return nil
+}
+
+// ZRangeByScore returns the members of the sorted set at key with scores
+// in [lo, hi], by ascending score and then member. A missing key reads as
+// an empty set.
+func (db *DB) ZRangeByScore(key string, lo, hi float64) ([]ZMember, error) {
+	db.zsets.mu.Lock()
+	defer db.zsets.mu.Unlock()
+	z, err := db.zset(key)
+	if err != nil {
+		return nil, err
+	}
+	var out []ZMember
+	z.byScore.ascend(sortableScore(lo), prefixEnd(sortableScore(hi)), func(k string, _ position) bool {
+		m := k[8:]
+		out = append(out, ZMember{Member: m, Score: z.scores[m]})
+		return true
+	})
+	return out, nil
+}
+
+// zset returns the sorted set at key, loading it from its member entries
+// on first use. The caller must hold db.zsets.mu.
+func (db *DB) zset(key string) (*zset, error) {
+	zs := &db.zsets
+	if gen := zs.gen.Load(); zs.sets == nil || zs.loaded != gen {
+		zs.sets, zs.loaded = make(map[string]*zset), gen
+	}
+	if z, ok := zs.sets[key]; ok {
+		return z, nil
+	}
+	z := &zset{scores: make(map[string]float64)}
+	prefix := zsetMemberKey(key, "")
+	var parseErr error
+	err := db.scanReserved(prefix, func(k, v string) bool {
+		score, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			parseErr = fmt.Errorf("score of %q in %q: %w", k[len(prefix):], key, err)
+			return false
+		}
+		z.set(k[len(prefix):], score)
+		return true
+	})
+	if err == nil {
+		err = parseErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	zs.sets[key] = z
+	return z, nil
+}
+
+func (z *zset) set(member string, score float64) {
+	z.remove(member)
+	z.scores[member] = score
+	z.byScore.put(sortableScore(score)+member, position{})
+}
+
+func (z *zset) remove(member string) {
+	if old, ok := z.scores[member]; ok {
+		z.byScore.remove(sortableScore(old) + member)
+		delete(z.scores, member)
+	}
+}
+
+// zsetMemberKey returns the key member of the sorted set at key is stored
+// under. The length of key comes first, so no set's keys start with
+// another's.
+func zsetMemberKey(key, member string) string {
+	b := binary.AppendUvarint([]byte(zsetPrefix), uint64(len(key)))
+	return string(b) + key + member
+}
+
+// sortableScore encodes score in 8 bytes that sort like the scores.
+func sortableScore(score float64) string {
+	if score == 0 {
+		score = 0 // -0 sorts with 0
+	}
+	bits := math.Float64bits(score)
+	if bits>>63 == 0 {
+		bits |= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return string(binary.BigEndian.AppendUint64(nil, bits))
+}
@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"errors"
+	"math"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestZSet(t *testing.T) {
+	dir := "test_zset"
+	defer os.RemoveAll(dir)
+
+	opts := Options{IndexType: IndexBTree}
+	db, err := OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []ZMember{{"alice", 30}, {"bob", -5}, {"carol", 30}, {"dave", 12.5}, {"bob", 40}} {
+		if err := db.ZAdd("board", m.Member, m.Score); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.ZAdd("board", "eve", math.NaN()); err == nil {
+		t.Error("expected NaN score to be rejected")
+	}
+	// Інший набір з ключем-префіксом не змішується з цим
+	if err := db.ZAdd("boar", "x", 1); err != nil {
+		t.Fatal(err)
+	}
+	members := func(db *DB, lo, hi float64) []string {
+		t.Helper()
+		got, err := db.ZRangeByScore("board", lo, hi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, m := range got {
+			names = append(names, m.Member)
+		}
+		return names
+	}
+	if got := members(db, math.Inf(-1), math.Inf(1)); !slices.Equal(got, []string{"dave", "alice", "carol", "bob"}) {
+		t.Errorf("full range = %v", got)
+	}
+	if got := members(db, 12.5, 30); !slices.Equal(got, []string{"dave", "alice", "carol"}) {
+		t.Errorf("[12.5, 30] = %v", got)
+	}
+	if err := db.ZRem("board", "alice", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Після перевідкриття набір завантажується із записів
+	db, err = OpenWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got, err := db.ZRangeByScore("board", 0, 100)
+	if err != nil || len(got) != 3 || got[0] != (ZMember{"dave", 12.5}) || got[2] != (ZMember{"bob", 40}) {
+		t.Fatalf("after reopen = %v, %v", got, err)
+	}
+
+	// Записи членів змінюються лише через ZAdd та ZRem і не видні ззовні
+	if err := db.Put(zsetMemberKey("board", "dave"), "1000"); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Put: err = %v", err)
+	}
+	if err := db.Delete(zsetMemberKey("board", "bob")); !errors.Is(err, ErrReservedKey) {
+		t.Errorf("Delete: err = %v", err)
+	}
+	if n := db.Count(); n != 0 {
+		t.Errorf("Count = %d, want the members left out", n)
+	}
+	if db.HasKeys("", "") {
+		t.Error("expected no visible keys")
+	}
+
+	if err := db.DropAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := members(db, math.Inf(-1), math.Inf(1)); len(got) != 0 {
+		t.Errorf("after DropAll = %v", got)
+	}
+}